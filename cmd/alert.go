@@ -0,0 +1,402 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// 閾値のルール
+// 例: size>1GB, count>10000, quota>90
+type alertRule struct {
+	text      string
+	metric    CheckMetric
+	threshold float64
+}
+
+// Webhookに送るアラート
+type alertEvent struct {
+	Status    string  `json:"status"` // firing or resolved
+	User      string  `json:"user"`
+	Folder    string  `json:"folder,omitempty"`
+	Count     int64   `json:"count"`
+	Size      int64   `json:"size"`
+	Rule      string  `json:"rule"`
+	Metric    string  `json:"metric"`
+	Threshold float64 `json:"threshold"`
+	Value     float64 `json:"value"`
+
+	metric CheckMetric
+}
+
+// Webhookに送る内容
+// textはSlackなどのIncoming Webhookでそのまま表示できるように
+type alertPayload struct {
+	Text   string        `json:"text"`
+	Host   string        `json:"host"`
+	Alerts []*alertEvent `json:"alerts"`
+}
+
+// 前回までに通知したアラート
+type alertState struct {
+	Alerts []*alertStateEntry `json:"alerts"`
+}
+
+// stateファイルの内容
+// 一部のWebhookへの送信だけ失敗した場合に、送信できたWebhookへ再送しないよう、Webhook毎に状態を持つ
+type alertStateFile struct {
+	Webhooks map[string]*alertState `json:"webhooks"`
+}
+
+// Webhookの前回の状態(初めてのWebhookは空)
+func (f *alertStateFile) webhook(webhookURL string) *alertState {
+
+	if state, ok := f.Webhooks[webhookURL]; ok && state != nil {
+		return state
+	}
+	return &alertState{Alerts: []*alertStateEntry{}}
+}
+
+type alertStateEntry struct {
+	Rule   string    `json:"rule"`
+	User   string    `json:"user"`
+	Folder string    `json:"folder,omitempty"`
+	Since  time.Time `json:"since"`
+}
+
+func (e *alertStateEntry) key() string {
+	return e.Rule + "\t" + e.User + "\t" + e.Folder
+}
+
+// テスト用に差し替え可能にしておく
+var webhookClient = &http.Client{Timeout: 30 * time.Second}
+
+func newAlertCmd() *cobra.Command {
+
+	subCmd := &cobra.Command{
+		Use:   "alert",
+		Short: "Send alerts to webhooks when users cross thresholds",
+		RunE: func(cmd *cobra.Command, args []string) error {
+
+			maildirName, _ := cmd.Flags().GetString("mail-dir")
+
+			ruleStrs, _ := cmd.Flags().GetStringSlice("rule")
+			rules := []*alertRule{}
+			for _, ruleStr := range ruleStrs {
+				rule, err := parseAlertRule(ruleStr)
+				if err != nil {
+					return err
+				}
+				rules = append(rules, rule)
+			}
+
+			perStr, _ := cmd.Flags().GetString("per")
+			perUser := perStr == "user"
+			if !perUser && perStr != "folder" {
+				return fmt.Errorf("invalid per '%s'", perStr)
+			}
+			for _, rule := range rules {
+				if rule.metric == QuotaMetric && !perUser {
+					return fmt.Errorf("quota rule can be used only with --per user")
+				}
+			}
+
+			webhookURLs, _ := cmd.Flags().GetStringSlice("webhook")
+			statePath, _ := cmd.Flags().GetString("state")
+			inboxFolderName, _ := cmd.Flags().GetString("inbox-name")
+
+			// 引数の解析に成功した時点で、エラーが起きてもUsageは表示しない
+			cmd.SilenceUsage = true
+
+			return runAlert(maildirName, inboxFolderName, rules, perUser, webhookURLs, statePath, cmd.OutOrStdout())
+		},
+	}
+
+	subCmd.Flags().StringP("mail-dir", "d", "", "User maildir name.")
+	subCmd.MarkFlagRequired("mail-dir")
+	subCmd.Flags().StringSliceP("rule", "", nil, "Threshold rule. (e.g. size>1GB, count>10000, quota>90) (can be specified multiple times)")
+	subCmd.MarkFlagRequired("rule")
+	subCmd.Flags().StringP("per", "", "user", "Evaluate rules per user or per folder. [user|folder]")
+	subCmd.Flags().StringSliceP("webhook", "", nil, "Webhook URL to post alerts. (can be specified multiple times)")
+	subCmd.MarkFlagRequired("webhook")
+	subCmd.Flags().StringP("state", "", "", "State file path to remember sent alerts. Without this, all alerts are sent on every run.")
+	subCmd.Flags().StringP("inbox-name", "", "INBOX", "The name of the inbox folder.")
+
+	return subCmd
+}
+
+func parseAlertRule(str string) (*alertRule, error) {
+
+	metricStr, thresholdStr, found := strings.Cut(str, ">")
+	if !found {
+		return nil, fmt.Errorf("invalid rule '%s'", str)
+	}
+
+	metric, err := parseCheckMetric(strings.TrimSpace(metricStr))
+	if err != nil {
+		return nil, fmt.Errorf("invalid rule '%s'", str)
+	}
+
+	thresholdStr = strings.TrimSpace(thresholdStr)
+	if thresholdStr == "" {
+		return nil, fmt.Errorf("invalid rule '%s'", str)
+	}
+	threshold, err := parseCheckThreshold(thresholdStr, metric)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rule '%s'", str)
+	}
+
+	return &alertRule{text: str, metric: metric, threshold: threshold}, nil
+}
+
+func runAlert(maildirName string, inboxFolderName string, rules []*alertRule, perUser bool, webhookURLs []string, statePath string, writer io.Writer) error {
+
+	withQuota := false
+	for _, rule := range rules {
+		withQuota = withQuota || rule.metric == QuotaMetric
+	}
+
+	usages, err := collectMailUsages(maildirName, inboxFolderName, perUser, withQuota)
+	if err != nil {
+		return err
+	}
+
+	states := &alertStateFile{Webhooks: map[string]*alertState{}}
+	if statePath != "" {
+		if states, err = loadAlertState(statePath); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	newStates := &alertStateFile{Webhooks: map[string]*alertState{}}
+	printed := map[string]bool{}
+	var postErr error
+
+	for _, webhookURL := range webhookURLs {
+		state := states.webhook(webhookURL)
+		events, newState := evaluateAlertRules(usages, rules, state, now)
+
+		if len(events) > 0 {
+			payload, err := newAlertPayload(events)
+			if err != nil {
+				return err
+			}
+
+			// 前回の状態が同じWebhookには同じ内容を送るので、表示は一度だけ
+			if !printed[payload.Text] {
+				fmt.Fprintf(writer, "%s\n", payload.Text)
+				printed[payload.Text] = true
+			}
+
+			if err := postWebhook(webhookURL, payload); err != nil {
+				// 送信に失敗したWebhookは状態を更新せず、次回に再送する
+				// 他のWebhookへの送信は続ける
+				newStates.Webhooks[webhookURL] = state
+				if postErr == nil {
+					postErr = err
+				}
+				continue
+			}
+		}
+
+		newStates.Webhooks[webhookURL] = newState
+	}
+
+	if len(printed) == 0 {
+		fmt.Fprintf(writer, "No alert changes.\n")
+	}
+
+	if statePath != "" {
+		if err := saveAlertState(statePath, newStates); err != nil {
+			return err
+		}
+	}
+	return postErr
+}
+
+// ルールを評価し、前回の状態から変化したもの(新たに超えたもの、超えなくなったもの)を返す
+// 状態を使わない場合(前回の状態が空)は、超えているもの全てが対象となる
+func evaluateAlertRules(usages []*mailUsage, rules []*alertRule, state *alertState, now time.Time) ([]*alertEvent, *alertState) {
+
+	previous := map[string]*alertStateEntry{}
+	for _, entry := range state.Alerts {
+		previous[entry.key()] = entry
+	}
+
+	events := []*alertEvent{}
+	newState := &alertState{Alerts: []*alertStateEntry{}}
+	current := map[string]bool{}
+
+	usageByName := map[string]*mailUsage{}
+	for _, usage := range usages {
+		usageByName[usage.name()] = usage
+	}
+
+	for _, rule := range rules {
+		for _, usage := range usages {
+			value, ok := usage.value(rule.metric)
+			if !ok || value <= rule.threshold {
+				continue
+			}
+
+			entry := &alertStateEntry{Rule: rule.text, User: usage.userName, Folder: usage.mailFolderName, Since: now}
+			if prev, ok := previous[entry.key()]; ok {
+				// 通知済み
+				entry.Since = prev.Since
+			} else {
+				events = append(events, newAlertEvent("firing", usage, rule, value))
+			}
+
+			current[entry.key()] = true
+			newState.Alerts = append(newState.Alerts, entry)
+		}
+	}
+
+	// 超えなくなったもの
+	for _, entry := range state.Alerts {
+		if current[entry.key()] {
+			continue
+		}
+
+		rule, err := parseAlertRule(entry.Rule)
+		if err != nil || !containsAlertRule(rules, entry.Rule) {
+			// ルール自体が無くなったものは通知しない
+			continue
+		}
+
+		usage, ok := usageByName[(&mailUsage{userName: entry.User, mailFolderName: entry.Folder}).name()]
+		if !ok {
+			// ユーザやフォルダが無くなった
+			usage = &mailUsage{userName: entry.User, mailFolderName: entry.Folder}
+		}
+		value, _ := usage.value(rule.metric)
+		events = append(events, newAlertEvent("resolved", usage, rule, value))
+	}
+
+	return events, newState
+}
+
+func containsAlertRule(rules []*alertRule, text string) bool {
+
+	for _, rule := range rules {
+		if rule.text == text {
+			return true
+		}
+	}
+	return false
+}
+
+func newAlertEvent(status string, usage *mailUsage, rule *alertRule, value float64) *alertEvent {
+
+	return &alertEvent{
+		Status:    status,
+		User:      usage.userName,
+		Folder:    usage.mailFolderName,
+		Count:     usage.count,
+		Size:      usage.size,
+		Rule:      rule.text,
+		Metric:    rule.metric.String(),
+		Threshold: rule.threshold,
+		Value:     value,
+		metric:    rule.metric,
+	}
+}
+
+func newAlertPayload(events []*alertEvent) (*alertPayload, error) {
+
+	host, err := hostname()
+	if err != nil {
+		return nil, err
+	}
+
+	lines := []string{}
+	for _, event := range events {
+		name := event.User
+		if event.Folder != "" {
+			name += "/" + event.Folder
+		}
+
+		lines = append(lines, fmt.Sprintf("[%s] %s: %s %s %s (%s)",
+			strings.ToUpper(event.Status),
+			host,
+			name,
+			event.Metric,
+			formatCheckValue(event.Value, event.metric),
+			event.Rule))
+	}
+
+	return &alertPayload{
+		Text:   strings.Join(lines, "\n"),
+		Host:   host,
+		Alerts: events,
+	}, nil
+}
+
+func postWebhook(webhookURL string, payload *alertPayload) error {
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	response, err := webhookClient.Post(webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	// 内容は使わないが、コネクションを再利用できるように読み切っておく
+	io.Copy(io.Discard, response.Body)
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s returned %s", webhookURL, response.Status)
+	}
+
+	return nil
+}
+
+func loadAlertState(statePath string) (*alertStateFile, error) {
+
+	data, err := os.ReadFile(statePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// 初回
+			return &alertStateFile{Webhooks: map[string]*alertState{}}, nil
+		}
+		return nil, err
+	}
+
+	var states alertStateFile
+	if err := json.Unmarshal(data, &states); err != nil {
+		return nil, fmt.Errorf("%s is invalid state file: %w", statePath, err)
+	}
+	if states.Webhooks == nil {
+		states.Webhooks = map[string]*alertState{}
+	}
+
+	return &states, nil
+}
+
+// 途中で中断しても壊れたファイルが残らないように、一時ファイルに書いてから置き換える
+func saveAlertState(statePath string, states *alertStateFile) error {
+
+	data, err := json.MarshalIndent(states, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tempPath := statePath + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tempPath, statePath)
+}
@@ -0,0 +1,345 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/onozaty/maildir-stats/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlertCmd(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	users := setupTestCheckMaildir(t, temp)
+
+	// テスト用にメソッド差し替え
+	loadPasswd = func(passwdPath string) ([]user.User, error) {
+		return users, nil
+	}
+	hostname = func() (string, error) {
+		return "mail01", nil
+	}
+	t.Cleanup(func() { hostname = os.Hostname })
+
+	server, received := startTestWebhookServer(t, http.StatusOK)
+
+	// ACT
+	result, err := executeAlertCmd(t,
+		"-d", "Maildir",
+		"--rule", "size>3KB",
+		"--rule", "count>1",
+		"--webhook", server.URL)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	expected := `[FIRING] mail01: user1 size 3.5 kB (size>3KB)
+[FIRING] mail01: user1 count 3 (count>1)
+[FIRING] mail01: user2 count 2 (count>1)
+`
+	assert.Equal(t, expected, result)
+
+	require.Len(t, *received, 1)
+	assert.JSONEq(t, `{
+  "text": "[FIRING] mail01: user1 size 3.5 kB (size>3KB)\n[FIRING] mail01: user1 count 3 (count>1)\n[FIRING] mail01: user2 count 2 (count>1)",
+  "host": "mail01",
+  "alerts": [
+    {"status": "firing", "user": "user1", "count": 3, "size": 3500, "rule": "size>3KB", "metric": "size", "threshold": 3000, "value": 3500},
+    {"status": "firing", "user": "user1", "count": 3, "size": 3500, "rule": "count>1", "metric": "count", "threshold": 1, "value": 3},
+    {"status": "firing", "user": "user2", "count": 2, "size": 2100, "rule": "count>1", "metric": "count", "threshold": 1, "value": 2}
+  ]
+}`, (*received)[0])
+}
+
+func TestAlertCmd_State(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	users := setupTestCheckMaildir(t, temp)
+
+	// テスト用にメソッド差し替え
+	loadPasswd = func(passwdPath string) ([]user.User, error) {
+		return users, nil
+	}
+	hostname = func() (string, error) {
+		return "mail01", nil
+	}
+	t.Cleanup(func() { hostname = os.Hostname })
+
+	server1, received1 := startTestWebhookServer(t, http.StatusOK)
+	server2, received2 := startTestWebhookServer(t, http.StatusNoContent)
+	statePath := filepath.Join(t.TempDir(), "alert-state.json")
+
+	args := []string{
+		"-d", "Maildir",
+		"--per", "folder",
+		"--rule", "size>2KB",
+		"--webhook", server1.URL,
+		"--webhook", server2.URL,
+		"--state", statePath,
+	}
+
+	// ACT (1回目)
+	result, err := executeAlertCmd(t, args...)
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(t, "[FIRING] mail01: user1/Sent size 2.5 kB (size>2KB)\n[FIRING] mail01: user2/My Box size 2.1 kB (size>2KB)\n", result)
+	assert.Len(t, *received1, 1)
+	assert.Len(t, *received2, 1)
+
+	// ACT (2回目) 変化無し
+	result, err = executeAlertCmd(t, args...)
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(t, "No alert changes.\n", result)
+	assert.Len(t, *received1, 1)
+	assert.Len(t, *received2, 1)
+
+	// ACT (3回目) 閾値を下回ったものは解消として通知
+	require.NoError(t, os.Remove(filepath.Join(users[1].HomeDir, "Maildir", ".My Box", "cur", "2")))
+	result, err = executeAlertCmd(t, args...)
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(t, "[RESOLVED] mail01: user2/My Box size 1.0 kB (size>2KB)\n", result)
+	require.Len(t, *received1, 2)
+	assert.JSONEq(t, `{
+  "text": "[RESOLVED] mail01: user2/My Box size 1.0 kB (size>2KB)",
+  "host": "mail01",
+  "alerts": [
+    {"status": "resolved", "user": "user2", "folder": "My Box", "count": 1, "size": 1000, "rule": "size>2KB", "metric": "size", "threshold": 2000, "value": 1000}
+  ]
+}`, (*received1)[1])
+
+	states, err := loadAlertState(statePath)
+	require.NoError(t, err)
+	for _, webhookURL := range []string{server1.URL, server2.URL} {
+		state := states.webhook(webhookURL)
+		require.Len(t, state.Alerts, 1)
+		assert.Equal(t, "user1", state.Alerts[0].User)
+		assert.Equal(t, "Sent", state.Alerts[0].Folder)
+		assert.Equal(t, "size>2KB", state.Alerts[0].Rule)
+	}
+}
+
+func TestAlertCmd_WebhookError(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	users := setupTestCheckMaildir(t, temp)
+
+	// テスト用にメソッド差し替え
+	loadPasswd = func(passwdPath string) ([]user.User, error) {
+		return users, nil
+	}
+
+	server, received := startTestWebhookServer(t, http.StatusInternalServerError)
+	statePath := filepath.Join(t.TempDir(), "alert-state.json")
+
+	// ACT
+	_, err := executeAlertCmd(t,
+		"-d", "Maildir",
+		"--rule", "quota>80",
+		"--webhook", server.URL,
+		"--state", statePath)
+
+	// ASSERT
+	require.EqualError(t, err, "webhook "+server.URL+" returned 500 Internal Server Error")
+	assert.Len(t, *received, 1)
+
+	// 次回に再送するため、送信できなかったWebhookの状態は更新しない
+	states, err := loadAlertState(statePath)
+	require.NoError(t, err)
+	assert.Len(t, states.webhook(server.URL).Alerts, 0)
+}
+
+func TestAlertCmd_PartialWebhookError(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	users := setupTestCheckMaildir(t, temp)
+
+	// テスト用にメソッド差し替え
+	loadPasswd = func(passwdPath string) ([]user.User, error) {
+		return users, nil
+	}
+	hostname = func() (string, error) {
+		return "mail01", nil
+	}
+	t.Cleanup(func() { hostname = os.Hostname })
+
+	server1, received1 := startTestWebhookServer(t, http.StatusOK)
+
+	// 1回目だけ失敗するWebhook
+	received2 := 0
+	server2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received2++
+		if received2 == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(server2.Close)
+
+	statePath := filepath.Join(t.TempDir(), "alert-state.json")
+
+	args := []string{
+		"-d", "Maildir",
+		"--per", "folder",
+		"--rule", "size>2KB",
+		"--webhook", server2.URL,
+		"--webhook", server1.URL,
+		"--state", statePath,
+	}
+
+	// ACT (1回目) 2つ目のWebhookには送信できる
+	_, err := executeAlertCmd(t, args...)
+
+	// ASSERT
+	require.EqualError(t, err, "webhook "+server2.URL+" returned 500 Internal Server Error")
+	assert.Equal(t, 1, received2)
+	assert.Len(t, *received1, 1)
+
+	// ACT (2回目) 失敗したWebhookにだけ再送する
+	result, err := executeAlertCmd(t, args...)
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(t, "[FIRING] mail01: user1/Sent size 2.5 kB (size>2KB)\n[FIRING] mail01: user2/My Box size 2.1 kB (size>2KB)\n", result)
+	assert.Equal(t, 2, received2)
+	assert.Len(t, *received1, 1)
+
+	// ACT (3回目) 変化無し
+	result, err = executeAlertCmd(t, args...)
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(t, "No alert changes.\n", result)
+	assert.Equal(t, 2, received2)
+	assert.Len(t, *received1, 1)
+}
+
+func TestAlertCmd_InvalidRule(t *testing.T) {
+
+	tests := []struct {
+		args    []string
+		message string
+	}{
+		{[]string{"--rule", "size"}, "invalid rule 'size'"},
+		{[]string{"--rule", "xx>1"}, "invalid rule 'xx>1'"},
+		{[]string{"--rule", "size>"}, "invalid rule 'size>'"},
+		{[]string{"--rule", "count>1KB"}, "invalid rule 'count>1KB'"},
+		{[]string{"--rule", "size>1KB", "--per", "xx"}, "invalid per 'xx'"},
+		{[]string{"--rule", "quota>90", "--per", "folder"}, "quota rule can be used only with --per user"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.message, func(t *testing.T) {
+			// ACT
+			_, err := executeAlertCmd(t, append([]string{"-d", "Maildir", "--webhook", "http://localhost/"}, tt.args...)...)
+
+			// ASSERT
+			require.EqualError(t, err, tt.message)
+		})
+	}
+}
+
+func TestAlertCmd_InvalidState(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	users := setupTestCheckMaildir(t, temp)
+
+	// テスト用にメソッド差し替え
+	loadPasswd = func(passwdPath string) ([]user.User, error) {
+		return users, nil
+	}
+
+	statePath := filepath.Join(temp, "alert-state.json")
+	createFile(t, statePath, "xxx")
+
+	// ACT
+	_, err := executeAlertCmd(t,
+		"-d", "Maildir",
+		"--rule", "size>1KB",
+		"--webhook", "http://localhost/",
+		"--state", statePath)
+
+	// ASSERT
+	require.ErrorContains(t, err, statePath+" is invalid state file: ")
+}
+
+func executeAlertCmd(t *testing.T, args ...string) (string, error) {
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs(append([]string{"alert"}, args...))
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	err := rootCmd.Execute()
+	return buf.String(), err
+}
+
+// 受け取ったリクエストの本文を記録するWebhookのサーバ
+func startTestWebhookServer(t *testing.T, statusCode int) (*httptest.Server, *[]string) {
+
+	received := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		received = append(received, string(body))
+
+		w.WriteHeader(statusCode)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &received
+}
+
+func TestEvaluateAlertRules_RemovedRule(t *testing.T) {
+
+	// ARRANGE
+	usages := []*mailUsage{
+		{userName: "user1", count: 10, size: 100},
+	}
+	rule, err := parseAlertRule("count>5")
+	require.NoError(t, err)
+
+	state := &alertState{Alerts: []*alertStateEntry{
+		{Rule: "count>5", User: "user1"},
+		{Rule: "size>50", User: "user1"}, // ルールから削除された
+	}}
+
+	// ACT
+	events, newState := evaluateAlertRules(usages, []*alertRule{rule}, state, state.Alerts[0].Since)
+
+	// ASSERT
+	// 削除されたルールは解消として通知しない
+	assert.Len(t, events, 0)
+	require.Len(t, newState.Alerts, 1)
+	assert.Equal(t, "count>5", newState.Alerts[0].Rule)
+}
+
+func TestLoadAlertState_NotFound(t *testing.T) {
+
+	// ACT
+	states, err := loadAlertState(filepath.Join(t.TempDir(), "alert-state.json"))
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Len(t, states.Webhooks, 0)
+	assert.Len(t, states.webhook("https://hooks.example.com/").Alerts, 0)
+}
@@ -3,6 +3,8 @@ package cmd
 import (
 	"fmt"
 	"io"
+	"text/template"
+	"time"
 
 	"github.com/onozaty/maildir-stats/maildir"
 	"github.com/spf13/cobra"
@@ -16,6 +18,7 @@ func newAllCmd() *cobra.Command {
 		RunE: func(cmd *cobra.Command, args []string) error {
 
 			maildirName, _ := cmd.Flags().GetString("mail-dir")
+			mailSpoolPath, _ := cmd.Flags().GetString("mail-spool")
 
 			reportUser, _ := cmd.Flags().GetBool("user")
 			reportUserSortCondition, err := getSortCondition(cmd.Flags(), "sort-user")
@@ -35,24 +38,93 @@ func newAllCmd() *cobra.Command {
 				return err
 			}
 
+			reportSender, _ := cmd.Flags().GetBool("sender")
+			reportSenderDomain, _ := cmd.Flags().GetBool("sender-domain")
+			reportSenderSortCondition, err := getSortCondition(cmd.Flags(), "sort-sender")
+			if err != nil { // 許可されていなパラメータの可能性あり
+				return err
+			}
+			reportSenderTop, _ := cmd.Flags().GetInt("sender-top")
+
+			errorPolicy, err := getErrorPolicy(cmd.Flags(), "on-error")
+			if err != nil { // 許可されていなパラメータの可能性あり
+				return err
+			}
+
+			progress, _ := cmd.Flags().GetBool("progress")
+			progressInterval, _ := cmd.Flags().GetDuration("progress-interval")
+
+			storageFormat, err := getStorageFormat(cmd.Flags(), "format-in")
+			if err != nil { // 許可されていなパラメータの可能性あり
+				return err
+			}
+
+			archivePath, _ := cmd.Flags().GetString("archive")
+			if archivePath != "" && storageFormat != maildir.MaildirStorage {
+				return fmt.Errorf("--archive supports only --format-in maildir")
+			}
+
+			inboxFolderName, _ := cmd.Flags().GetString("inbox-name")
+
+			outputFormat, err := getOutputFormat(cmd.Flags(), "format")
+			if err != nil { // 許可されていなパラメータの可能性あり
+				return err
+			}
+			outputPath, _ := cmd.Flags().GetString("output")
+
+			var reportTemplate *template.Template
+			templatePath, _ := cmd.Flags().GetString("template")
+			if templatePath != "" {
+				if cmd.Flags().Changed("format") && outputFormat != TableFormat {
+					return fmt.Errorf("--template cannot be used with --format %s", cmd.Flag("format").Value)
+				}
+
+				reportTemplate, err = loadReportTemplate(templatePath)
+				if err != nil {
+					return err
+				}
+			}
+
+			statsdAddress, _ := cmd.Flags().GetString("statsd")
+			statsdPrefix, _ := cmd.Flags().GetString("statsd-prefix")
+			ncduMaxFiles, _ := cmd.Flags().GetInt("ncdu-max-files")
+
 			// 引数の解析に成功した時点で、エラーが起きてもUsageは表示しない
 			cmd.SilenceUsage = true
 
 			return runAllReport(
 				maildirName,
 				allReportCondition{
-					reportUser:               reportUser,
-					reportUserSortCondition:  reportUserSortCondition,
-					reportYear:               reportYear,
-					reportYearSortCondition:  reportYearSortCondition,
-					reportMonth:              reportMonth,
-					reportMonthSortCondition: reportMonthSortCondition,
+					reportUser:                reportUser,
+					reportUserSortCondition:   reportUserSortCondition,
+					reportYear:                reportYear,
+					reportYearSortCondition:   reportYearSortCondition,
+					reportMonth:               reportMonth,
+					reportMonthSortCondition:  reportMonthSortCondition,
+					reportSender:              reportSender,
+					reportSenderDomain:        reportSenderDomain,
+					reportSenderSortCondition: reportSenderSortCondition,
+					reportSenderTop:           reportSenderTop,
+					errorPolicy:               errorPolicy,
+					progress:                  progress,
+					progressInterval:          progressInterval,
+					storageFormat:             storageFormat,
+					mailSpoolPath:             mailSpoolPath,
+					archivePath:               archivePath,
+					inboxFolderName:           inboxFolderName,
+					outputFormat:              outputFormat,
+					outputPath:                outputPath,
+					reportTemplate:            reportTemplate,
+					statsdAddress:             statsdAddress,
+					statsdPrefix:              statsdPrefix,
+					ncduMaxFiles:              ncduMaxFiles,
 				},
-				cmd.OutOrStdout())
+				cmd.OutOrStdout(),
+				cmd.ErrOrStderr())
 		},
 	}
 
-	subCmd.Flags().StringP("mail-dir", "d", "", "User maildir name.")
+	subCmd.Flags().StringP("mail-dir", "d", "", "User maildir name. (directory of mbox files with --format-in mbox, dbox root with --format-in dbox)")
 	subCmd.MarkFlagRequired("mail-dir")
 
 	subCmd.Flags().BoolP("user", "u", false, "Report by user.")
@@ -61,20 +133,54 @@ func newAllCmd() *cobra.Command {
 	subCmd.Flags().StringP("sort-year", "", "name-asc", "Sorting condition for report by year.\ncan be specified: name-asc, name-desc, count-asc, count-desc, size-asc, size-desc")
 	subCmd.Flags().BoolP("month", "m", false, "Report by month.")
 	subCmd.Flags().StringP("sort-month", "", "name-asc", "Sorting condition for report by month.\ncan be specified: name-asc, name-desc, count-asc, count-desc, size-asc, size-desc")
+	subCmd.Flags().BoolP("sender", "", false, "Report by sender address. (reads mail headers)")
+	subCmd.Flags().BoolP("sender-domain", "", false, "Report by sender domain. (reads mail headers)")
+	subCmd.Flags().StringP("sort-sender", "", "size-desc", "Sorting condition for report by sender and sender domain.\ncan be specified: name-asc, name-desc, count-asc, count-desc, size-asc, size-desc")
+	subCmd.Flags().IntP("sender-top", "", 10, "Number of senders to report. (0 means all)")
+	subCmd.Flags().StringP("on-error", "", "fail", "Behavior when a mail folder cannot be read.\ncan be specified: fail, warn, skip")
+	subCmd.Flags().BoolP("progress", "", false, "Report progress to stderr.")
+	subCmd.Flags().DurationP("progress-interval", "", 30*time.Second, "Interval of progress log lines when stderr is not a terminal.")
+	subCmd.Flags().StringP("format-in", "", "maildir", "Format of the mailbox.\ncan be specified: maildir, mbox, dbox, auto")
+	subCmd.Flags().StringP("mail-spool", "", "/var/spool/mail", "Mail spool directory of inbox mbox files. (used with --format-in mbox, auto)")
+	subCmd.Flags().StringP("archive", "", "", "Read home directories in the tar (or tar.gz) archive without extracting it.")
+	subCmd.Flags().StringP("inbox-name", "", "", "The name of the inbox folder. (used by per folder output such as --format prom-textfile) (default \"\")")
+	subCmd.Flags().StringP("format", "", "table", "Output format.\ncan be specified: table, prom-textfile, influx, html, ncdu, markdown")
+	subCmd.Flags().StringP("output", "", "", "Output file path. The file is replaced atomically. (default stdout)")
+	subCmd.Flags().StringP("template", "", "", "Template file (Go text/template) to format the report instead of --format.")
+	subCmd.Flags().StringP("statsd", "", "", "StatsD server address to send gauges over UDP. (host:port)")
+	subCmd.Flags().StringP("statsd-prefix", "", "maildir", "Prefix of StatsD metric names.")
+	subCmd.Flags().IntP("ncdu-max-files", "", 1000, "Maximum number of mail files listed in a directory with --format ncdu.\nDirectories with more files are written as one entry. (0 means no limit)")
 
 	return subCmd
 }
 
 type allReportCondition struct {
-	reportUser               bool
-	reportUserSortCondition  SortCondition
-	reportYear               bool
-	reportYearSortCondition  SortCondition
-	reportMonth              bool
-	reportMonthSortCondition SortCondition
+	reportUser                bool
+	reportUserSortCondition   SortCondition
+	reportYear                bool
+	reportYearSortCondition   SortCondition
+	reportMonth               bool
+	reportMonthSortCondition  SortCondition
+	reportSender              bool
+	reportSenderDomain        bool
+	reportSenderSortCondition SortCondition
+	reportSenderTop           int
+	errorPolicy               ErrorPolicy
+	progress                  bool
+	progressInterval          time.Duration
+	storageFormat             maildir.StorageFormat
+	mailSpoolPath             string
+	archivePath               string
+	inboxFolderName           string
+	outputFormat              OutputFormat
+	outputPath                string
+	reportTemplate            *template.Template
+	statsdAddress             string
+	statsdPrefix              string
+	ncduMaxFiles              int
 }
 
-func runAllReport(maildirName string, condition allReportCondition, writer io.Writer) error {
+func runAllReport(maildirName string, condition allReportCondition, writer io.Writer, progressWriter io.Writer) error {
 
 	users, err := loadPasswd(passwdPath)
 	if err != nil {
@@ -87,20 +193,164 @@ func runAllReport(maildirName string, condition allReportCondition, writer io.Wr
 
 	var yearAggregator *maildir.TimeAggregator
 	var monthAggregator *maildir.TimeAggregator
+	var senderAggregator *maildir.SenderAggregator
+	var senderDomainAggregator *maildir.SenderAggregator
 
-	if condition.reportYear {
+	// 時系列DB向けの出力では、-y、-m の指定に関わらず、年、月の値も出力するために常に集計する
+	metricOutput := condition.outputFormat == InfluxFormat || condition.statsdAddress != ""
+
+	if condition.reportYear || metricOutput {
 		yearAggregator = maildir.NewYearAggregator()
 		aggregators = append(aggregators, yearAggregator)
 	}
-	if condition.reportMonth {
+	// HTMLの出力では、月毎のグラフを出すために常に集計する
+	if condition.reportMonth || condition.outputFormat == HtmlFormat || metricOutput {
 		monthAggregator = maildir.NewMonthAggregator()
 		aggregators = append(aggregators, monthAggregator)
 	}
+	// 送信者での集計を行う場合のみ、メールのヘッダが読み込まれる
+	if condition.reportSender {
+		senderAggregator = maildir.NewSenderAggregator()
+		aggregators = append(aggregators, senderAggregator)
+	}
+	if condition.reportSenderDomain {
+		senderDomainAggregator = maildir.NewSenderDomainAggregator()
+		aggregators = append(aggregators, senderDomainAggregator)
+	}
+
+	// 監視、時系列DB向けの出力では、ユーザ毎のフォルダ(Prometheusの形式では月も)の値も出力する
+	var userFolderAggregator *maildir.PerUserAggregator[*maildir.FolderAggregator]
+	var userMonthAggregator *maildir.PerUserAggregator[*maildir.TimeAggregator]
+
+	if condition.outputFormat == PromTextfileFormat || condition.outputFormat == InfluxFormat || condition.statsdAddress != "" {
+		userFolderAggregator = maildir.NewPerUserAggregator(maildir.NewFolderAggregator)
+		aggregators = append(aggregators, userFolderAggregator)
+	}
+	if condition.outputFormat == PromTextfileFormat {
+		userMonthAggregator = maildir.NewPerUserAggregator(maildir.NewMonthAggregator)
+		aggregators = append(aggregators, userMonthAggregator)
+	}
+
+	var treeAggregator *maildir.TreeAggregator
+	if condition.outputFormat == NcduFormat {
+		treeAggregator = maildir.NewTreeAggregator(condition.ncduMaxFiles)
+		aggregators = append(aggregators, treeAggregator)
+	}
+
+	var progressReporter *progressReporter
+	var progressAggregator *maildir.ProgressAggregator
+
+	// 集計対象のユーザ(メールの格納場所があるユーザ)に絞っておく
+	var userCount int
+	var aggregate func(aggregator maildir.Aggregator, errorHandler maildir.ErrorHandler) error
+
+	if condition.archivePath != "" {
+		// アーカイブ内のhomeディレクトリ
+		archive, err := maildir.OpenTarFS(condition.archivePath)
+		if err != nil {
+			return err
+		}
+
+		stores := maildir.UserMaildirFSStores(archive, users, maildirName, condition.inboxFolderName)
+		userCount = len(stores)
+		aggregate = func(aggregator maildir.Aggregator, errorHandler maildir.ErrorHandler) error {
+			return maildir.AggregateUserMailStoresWithErrorHandler(stores, aggregator, errorHandler)
+		}
+	} else {
+		mailboxes := maildir.UserMailboxes(users, maildirName, condition.mailSpoolPath, condition.storageFormat)
+		userCount = len(mailboxes)
+		aggregate = func(aggregator maildir.Aggregator, errorHandler maildir.ErrorHandler) error {
+			return maildir.AggregateUserMailboxesWithErrorHandler(mailboxes, condition.inboxFolderName, aggregator, errorHandler)
+		}
+	}
+
+	if condition.progress {
+		progressReporter = newProgressReporter(progressWriter, userCount, condition.progressInterval)
+		progressAggregator = maildir.NewProgressAggregator(progressReporter.report)
+		aggregators = append(aggregators, progressAggregator)
+
+		progressReporter.start()
+	}
+
+	scanStart := time.Now()
+
+	errorCollector := newErrorCollector(condition.errorPolicy)
+	if err := aggregate(maildir.NewMultiAggregator(aggregators), errorCollector.handle); err != nil {
+		return err
+	}
+
+	scanEnd := time.Now()
+
+	if condition.progress {
+		progressReporter.finish(progressAggregator.Progress())
+	}
+
+	var points []*metricPoint
+	if metricOutput {
+		points = allMetricPoints(userAggregator, userFolderAggregator, yearAggregator, monthAggregator)
+	}
+
+	if condition.statsdAddress != "" {
+		if err := sendStatsd(condition.statsdAddress, condition.statsdPrefix, points); err != nil {
+			return err
+		}
+	}
 
-	// フォルダ毎での集計はしないので、INBOXは空文字固定で
-	if err := maildir.AggregateUsers(users, maildirName, "", maildir.NewMultiAggregator(aggregators)); err != nil {
+	var data *reportData
+	if condition.reportTemplate != nil || condition.outputFormat == MarkdownFormat {
+		data = newReportData(condition, userAggregator, yearAggregator, monthAggregator, senderAggregator, senderDomainAggregator, errorCollector.reportErrors(), scanEnd)
+	}
+
+	var lastSuccess time.Time
+	if condition.outputFormat == PromTextfileFormat {
+		// 出力先のファイルを置き換える前に、前回の値を読んでおく
+		lastSuccess = promLastSuccess(condition.outputPath, len(errorCollector.errors), scanEnd)
+	}
+
+	var rendered []byte
+	if condition.reportTemplate != nil {
+		rendered, err = renderReportTemplate(condition.reportTemplate, data)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = writeOutput(condition.outputPath, writer, func(writer io.Writer) {
+		if condition.reportTemplate != nil {
+			writer.Write(rendered)
+			return
+		}
+
+		switch condition.outputFormat {
+		case PromTextfileFormat:
+			printPromTextfile(writer, userAggregator, userFolderAggregator, userMonthAggregator, len(errorCollector.errors), scanStart, scanEnd, lastSuccess)
+		case InfluxFormat:
+			printInflux(writer, points, scanEnd)
+		case NcduFormat:
+			printNcdu(writer, treeAggregator, scanEnd)
+		case MarkdownFormat:
+			printMarkdownReport(writer, data)
+		case HtmlFormat:
+			printHtmlReport(writer, condition, userAggregator, yearAggregator, monthAggregator, senderAggregator, senderDomainAggregator, errorCollector.reportErrors(), scanEnd)
+		default:
+			printAllTableReport(writer, condition, userAggregator, yearAggregator, monthAggregator, senderAggregator, senderDomainAggregator, errorCollector.reportErrors())
+		}
+	})
+	if err != nil {
 		return err
 	}
+	return errorCollector.result()
+}
+
+func printAllTableReport(
+	writer io.Writer,
+	condition allReportCondition,
+	userAggregator *maildir.UserAggregator,
+	yearAggregator *maildir.TimeAggregator,
+	monthAggregator *maildir.TimeAggregator,
+	senderAggregator *maildir.SenderAggregator,
+	senderDomainAggregator *maildir.SenderAggregator,
+	errors []*maildir.AggregateError) {
 
 	// Summary
 	printSummaryReport(writer, userAggregator.Results())
@@ -124,5 +374,21 @@ func runAllReport(maildirName string, condition allReportCondition, writer io.Wr
 		fmt.Fprintf(writer, "\n")
 	}
 
-	return nil
+	// Sender
+	if condition.reportSender {
+		printSenderReport(writer, senderAggregator, condition.reportSenderSortCondition, condition.reportSenderTop, "Sender", "Sender")
+		fmt.Fprintf(writer, "\n")
+	}
+
+	// Sender domain
+	if condition.reportSenderDomain {
+		printSenderReport(writer, senderDomainAggregator, condition.reportSenderSortCondition, condition.reportSenderTop, "Sender domain", "Domain")
+		fmt.Fprintf(writer, "\n")
+	}
+
+	// Errors
+	if len(errors) > 0 {
+		printErrorReport(writer, errors, true)
+		fmt.Fprintf(writer, "\n")
+	}
 }
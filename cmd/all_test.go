@@ -3,6 +3,7 @@ package cmd
 import (
 	"bytes"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/onozaty/maildir-stats/user"
@@ -425,6 +426,62 @@ Total size      : 6,321 byte
 	assert.Equal(t, expected, result)
 }
 
+func TestAllCmd_SenderDomain(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	maildir := "Maildir"
+
+	users := []user.User{}
+	for _, userName := range []string{"user1", "user2"} {
+		homeDir := createDir(t, temp, userName)
+		users = append(users, user.User{
+			Name:    userName,
+			HomeDir: homeDir,
+		})
+
+		mailDir := createDir(t, homeDir, maildir)
+		setupTestSenderMaildir(t, mailDir)
+	}
+
+	// テスト用にメソッド差し替え
+	loadPasswd = func(passwdPath string) ([]user.User, error) {
+		return users, nil
+	}
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"all",
+		"-d", maildir,
+		"--sender-domain",
+		"--sender-top", "3",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	result := buf.String()
+	expected := `[Summary]
+Number of mails : 12
+Total size      : 538 byte
+
+[Sender domain]
+  Domain      | Number of mails | Total size(byte)  
+--------------+-----------------+-------------------
+  example.net |               4 |              330  
+  example.com |               4 |              122  
+  example.org |               2 |               54  
+
+`
+	assert.Equal(t, expected, result)
+}
+
 func TestAllCmd_PasswdFileNotFound(t *testing.T) {
 
 	// ARRANGE
@@ -491,6 +548,185 @@ func TestAllCmd_FolderNotFound(t *testing.T) {
 	assert.Contains(t, err.Error(), expect)
 }
 
+func TestAllCmd_OnErrorWarn(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	maildir := "Maildir"
+
+	users := setupTestAllMaildir(t, temp, maildir)
+
+	// Maildirはあるが、その配下にnew/cur/tmpが無い
+	userName := "user9"
+	homeDir := createDir(t, temp, userName)
+	users = append(users, user.User{
+		Name:    userName,
+		HomeDir: homeDir,
+	})
+	mailDir := createDir(t, homeDir, "Maildir")
+
+	// テスト用にメソッド差し替え
+	loadPasswd = func(passwdPath string) ([]user.User, error) {
+		return users, nil
+	}
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"all",
+		"-d", maildir,
+		"-u",
+		"--on-error", "warn",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "1 error(s) occurred during aggregation")
+
+	result := buf.String()
+	expected := `[Summary]
+Number of mails : 11
+Total size      : 6,321 byte
+
+[User]
+  Name  | Number of mails | Total size(byte)  
+--------+-----------------+-------------------
+  user1 |               6 |               21  
+  user2 |               2 |              300  
+  user3 |               3 |            6,000  
+  user4 |               0 |                0  
+  user9 |               0 |                0  
+
+[Errors]
+`
+	assert.True(t, strings.HasPrefix(result, expected), result)
+	// OSによってエラーメッセージが異なるのでファイル名部分だけチェック
+	assert.Contains(t, result, "  user9 |        | open "+filepath.Join(mailDir, "new"))
+}
+
+func TestAllCmd_OnErrorSkip(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	maildir := "Maildir"
+
+	users := setupTestAllMaildir(t, temp, maildir)
+
+	// Maildirはあるが、その配下にnew/cur/tmpが無い
+	userName := "user9"
+	homeDir := createDir(t, temp, userName)
+	users = append(users, user.User{
+		Name:    userName,
+		HomeDir: homeDir,
+	})
+	createDir(t, homeDir, "Maildir")
+
+	// テスト用にメソッド差し替え
+	loadPasswd = func(passwdPath string) ([]user.User, error) {
+		return users, nil
+	}
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"all",
+		"-d", maildir,
+		"--on-error", "skip",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err) // skipの場合はエラー終了にならない
+
+	result := buf.String()
+	expected := `[Summary]
+Number of mails : 11
+Total size      : 6,321 byte
+
+`
+	// skipの場合はエラーを出力しない
+	assert.Equal(t, expected, result)
+}
+
+func TestAllCmd_InvalidOnError(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	maildir := "Maildir"
+
+	users := setupTestAllMaildir(t, temp, maildir)
+
+	// テスト用にメソッド差し替え
+	loadPasswd = func(passwdPath string) ([]user.User, error) {
+		return users, nil
+	}
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"all",
+		"-d", maildir,
+		"--on-error", "xxx",
+	})
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "invalid error policy 'xxx'")
+}
+
+func TestAllCmd_Progress(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	maildir := "Maildir"
+
+	users := setupTestAllMaildir(t, temp, maildir)
+
+	// テスト用にメソッド差し替え
+	loadPasswd = func(passwdPath string) ([]user.User, error) {
+		return users, nil
+	}
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"all",
+		"-d", maildir,
+		"--progress",
+	})
+
+	outBuf := new(bytes.Buffer)
+	rootCmd.SetOut(outBuf)
+	errBuf := new(bytes.Buffer)
+	rootCmd.SetErr(errBuf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// 進捗は標準出力には出ない
+	expected := `[Summary]
+Number of mails : 11
+Total size      : 6,321 byte
+
+`
+	assert.Equal(t, expected, outBuf.String())
+
+	// 端末では無いのでログ形式で、間隔内に終わるので完了の行のみ
+	progress := errBuf.String()
+	assert.Regexp(t, `^time=\S+ msg=done users=4 total_users=4 mails=11 bytes=6321 mails_per_sec=\S+ current_user="user4" elapsed=\S+ eta=00:00:00\n$`, progress)
+}
+
 func TestAllCmd_InvalidSortUser(t *testing.T) {
 
 	// ARRANGE
@@ -575,6 +811,126 @@ func TestAllCmd_InvalidSortMonth(t *testing.T) {
 	require.EqualError(t, err, "invalid sort condition 'xxx'")
 }
 
+func TestAllCmd_FormatInAuto(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	maildir := "Maildir"
+
+	users := setupTestAllMaildir(t, temp, maildir)
+
+	// user4はspoolのmbox、user5はhome配下にmboxファイルのディレクトリ
+	spool := createDir(t, temp, "spool")
+	createFile(t, filepath.Join(spool, "user4"), "From a@example.com Sat Jan  1 00:00:00 2022\nSubject: a\n\nbody\n")
+	{
+		mboxDir := createDir(t, filepath.Join(temp, "user5"), maildir)
+		createFile(t, filepath.Join(mboxDir, "Sent"), "From a@example.com Sat Jan  1 00:00:00 2022\nSubject: a\n\nbody\n\nFrom b@example.com Sun Jan  2 00:00:00 2022\nSubject: b\n\nbody\n")
+	}
+
+	// テスト用にメソッド差し替え
+	loadPasswd = func(passwdPath string) ([]user.User, error) {
+		return users, nil
+	}
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"all",
+		"-d", maildir,
+		"--format-in", "auto",
+		"--mail-spool", spool,
+		"-u",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	result := buf.String()
+	expected := `[Summary]
+Number of mails : 14
+Total size      : 6,372 byte
+
+[User]
+  Name  | Number of mails | Total size(byte)  
+--------+-----------------+-------------------
+  user1 |               6 |               21  
+  user2 |               2 |              300  
+  user3 |               3 |            6,000  
+  user4 |               1 |               17  
+  user5 |               2 |               34  
+
+`
+	assert.Equal(t, expected, result)
+}
+
+func TestAllCmd_Archive(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	src := createDir(t, temp, "src")
+	maildir := "Maildir"
+
+	users := setupTestAllMaildir(t, src, maildir)
+
+	archivePath := filepath.Join(temp, "backup.tar.gz")
+	createTarGzArchive(t, archivePath, src)
+
+	// アーカイブ内ではsrc配下がルートとなる
+	archiveUsers := []user.User{}
+	for _, u := range users {
+		archiveUsers = append(archiveUsers, user.User{
+			Name:    u.Name,
+			HomeDir: "/" + filepath.Base(u.HomeDir),
+		})
+	}
+
+	// テスト用にメソッド差し替え
+	loadPasswd = func(passwdPath string) ([]user.User, error) {
+		return archiveUsers, nil
+	}
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"all",
+		"-d", maildir,
+		"--archive", archivePath,
+		"-u",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	result := buf.String()
+
+	// 展開した状態と同じ結果になること
+	loadPasswd = func(passwdPath string) ([]user.User, error) {
+		return users, nil
+	}
+	rootCmd = newRootCmd()
+	rootCmd.SetArgs([]string{
+		"all",
+		"-d", maildir,
+		"-u",
+	})
+	expected := new(bytes.Buffer)
+	rootCmd.SetOutput(expected)
+	require.NoError(t, rootCmd.Execute())
+
+	assert.Equal(t, expected.String(), result)
+	assert.Contains(t, result, "Number of mails : 11")
+}
+
 func setupTestAllMaildir(t *testing.T, temp string, maildir string) []user.User {
 
 	users := []user.User{}
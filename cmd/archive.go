@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/onozaty/maildir-stats/maildir"
+	"github.com/spf13/cobra"
+)
+
+func newArchiveCmd() *cobra.Command {
+
+	subCmd := &cobra.Command{
+		Use:   "archive",
+		Short: "Move old mails into compressed archive files",
+		RunE: func(cmd *cobra.Command, args []string) error {
+
+			maildirPath, _ := cmd.Flags().GetString("dir")
+			mailFolderNames, _ := cmd.Flags().GetStringSlice("folder")
+
+			olderThanStr, _ := cmd.Flags().GetString("older-than")
+			olderThan, err := parseAge(olderThanStr)
+			if err != nil {
+				return err
+			}
+
+			inboxFolderName, _ := cmd.Flags().GetString("inbox-name")
+			outputDirPath, _ := cmd.Flags().GetString("output")
+
+			formatStr, _ := cmd.Flags().GetString("format")
+			format, err := parseArchiveFormat(formatStr)
+			if err != nil {
+				return err
+			}
+
+			execute, _ := cmd.Flags().GetBool("execute")
+			auditLogPath, _ := cmd.Flags().GetString("audit-log")
+
+			// 引数の解析に成功した時点で、エラーが起きてもUsageは表示しない
+			cmd.SilenceUsage = true
+
+			return runArchive(
+				maildirPath,
+				maildir.SelectCondition{
+					MailFolderNames: mailFolderNames,
+					Before:          time.Now().Add(-olderThan),
+				},
+				inboxFolderName,
+				outputDirPath,
+				format,
+				execute,
+				auditLogPath,
+				cmd.OutOrStdout())
+		},
+	}
+
+	subCmd.Flags().StringP("dir", "d", "", "User maildir path.")
+	subCmd.MarkFlagRequired("dir")
+	subCmd.Flags().StringSliceP("folder", "", nil, "Target folder names. (can be specified multiple times, default all folders)")
+	subCmd.Flags().StringP("older-than", "", "", "Target mails older than this. (e.g. 365d, 52w)")
+	subCmd.MarkFlagRequired("older-than")
+	subCmd.Flags().StringP("inbox-name", "", "", "The name of the inbox folder. (default \"\")")
+	subCmd.Flags().StringP("output", "o", "", "Output directory of archive files.")
+	subCmd.MarkFlagRequired("output")
+	subCmd.Flags().StringP("format", "", "mbox", "Archive format.\ncan be specified: mbox (archive-YYYY.mbox.gz), tar (archive-YYYY.tar.zst)")
+	subCmd.Flags().BoolP("execute", "", false, "Actually archive and remove mails. Without this, only reports what would be archived (dry run).")
+	subCmd.Flags().StringP("audit-log", "", "", "Audit log file path to append archived mails.")
+
+	return subCmd
+}
+
+func runArchive(maildirPath string, condition maildir.SelectCondition, inboxFolderName string, outputDirPath string, format maildir.ArchiveFormat, execute bool, auditLogPath string, writer io.Writer) error {
+
+	selectAggregator := maildir.NewSelectAggregator(condition)
+	if err := maildir.AggregateMailFolders(maildirPath, inboxFolderName, selectAggregator); err != nil {
+		return err
+	}
+
+	if !execute {
+		// Dry run
+		// アーカイブファイルは受信日時の年毎に作られるので、年毎の内訳も出力する
+		results := selectAggregator.FolderResults()
+		printSummaryReport(writer, results)
+		fmt.Fprintf(writer, "\n")
+		printFolderResults(writer, results, NameAsc)
+		fmt.Fprintf(writer, "\n")
+
+		yearResults := maildir.YearResultsOf(selectAggregator.Results())
+		sortResults(yearResults, NameAsc)
+		fmt.Fprintf(writer, "[Year]\n")
+		renderTableLayout(writer, yearResults, "Year")
+		fmt.Fprintf(writer, "\n")
+		fmt.Fprintf(writer, "Dry run: no mails were archived. Specify --execute to archive them.\n")
+		return nil
+	}
+
+	auditLog := io.Discard
+	if auditLogPath != "" {
+		file, err := os.OpenFile(auditLogPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		auditLog = file
+	}
+
+	archiveFiles, archiveErr := maildir.ArchiveMails(maildirPath, selectAggregator.Results(), outputDirPath, format, auditLog)
+
+	// エラーとなった場合も、それまでにアーカイブしたものは出力しておく
+	archived := []*maildir.SelectedMail{}
+	for _, archiveFile := range archiveFiles {
+		archived = append(archived, archiveFile.Mails...)
+	}
+
+	results := maildir.FolderResultsOf(archived)
+	printSummaryReport(writer, results)
+	fmt.Fprintf(writer, "\n")
+	printFolderResults(writer, results, NameAsc)
+	fmt.Fprintf(writer, "\n")
+	printArchiveFileReport(writer, archiveFiles)
+	fmt.Fprintf(writer, "\n")
+
+	return archiveErr
+}
+
+func printArchiveFileReport(writer io.Writer, archiveFiles []*maildir.ArchiveFile) {
+
+	results := []*maildir.AggregateResult{}
+	for _, archiveFile := range archiveFiles {
+		totalSize := int64(0)
+		for _, mail := range archiveFile.Mails {
+			totalSize += mail.Size
+		}
+
+		results = append(results, &maildir.AggregateResult{
+			Name:      archiveFile.Path,
+			Count:     int64(len(archiveFile.Mails)),
+			TotalSize: totalSize,
+		})
+	}
+
+	fmt.Fprintf(writer, "[Archive file]\n")
+	renderTableLayout(writer, results, "File")
+}
+
+func parseArchiveFormat(str string) (maildir.ArchiveFormat, error) {
+
+	switch str {
+	case "mbox":
+		return maildir.MboxGzArchive, nil
+	case "tar":
+		return maildir.TarZstArchive, nil
+	default:
+		return 0, fmt.Errorf("invalid archive format '%s'", str)
+	}
+}
@@ -0,0 +1,224 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/onozaty/maildir-stats/maildir"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiveCmd(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	output := t.TempDir()
+	setupTestArchiveMaildir(t, temp)
+
+	auditLogPath := filepath.Join(t.TempDir(), "audit.log")
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"archive",
+		"-d", temp,
+		"--older-than", "365d",
+		"-o", output,
+		"--audit-log", auditLogPath,
+		"--execute",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	result := buf.String()
+	expected := `[Summary]
+Number of mails : 3
+Total size      : 33 byte
+
+[Folder]
+  Name  | Number of mails | Total size(byte)  
+--------+-----------------+-------------------
+        |               2 |               12  
+  Trash |               1 |               21  
+
+[Archive file]
+` + archiveFileTable(output, []string{"archive-2021.mbox.gz", "2", "12"}, []string{"archive-2022.mbox.gz", "1", "21"}) + `
+`
+	assert.Equal(t, expected, result)
+
+	assert.FileExists(t, filepath.Join(output, "archive-2021.mbox.gz"))
+	assert.FileExists(t, filepath.Join(output, "archive-2022.mbox.gz"))
+
+	assert.NoFileExists(t, filepath.Join(temp, "cur", "1609459200.M1:2,S"))
+	// 新しいものは残る
+	assert.Len(t, readDirNames(t, filepath.Join(temp, "new")), 1)
+
+	auditLog, err := os.ReadFile(auditLogPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(auditLog), "\tarchived\tTrash\t21\t")
+}
+
+func TestArchiveCmd_Tar(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	output := t.TempDir()
+	setupTestArchiveMaildir(t, temp)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"archive",
+		"-d", temp,
+		"--folder", "Trash",
+		"--older-than", "365d",
+		"-o", output,
+		"--format", "tar",
+		"--execute",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"archive-2022.tar.zst"}, readDirNames(t, output))
+	assert.FileExists(t, filepath.Join(temp, "cur", "1609459200.M1:2,S"))
+}
+
+func TestArchiveCmd_DryRun(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	output := t.TempDir()
+	setupTestArchiveMaildir(t, temp)
+
+	auditLogPath := filepath.Join(t.TempDir(), "audit.log")
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"archive",
+		"-d", temp,
+		"--older-than", "365d",
+		"-o", output,
+		"--audit-log", auditLogPath,
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	result := buf.String()
+	expected := `[Summary]
+Number of mails : 3
+Total size      : 33 byte
+
+[Folder]
+  Name  | Number of mails | Total size(byte)  
+--------+-----------------+-------------------
+        |               2 |               12  
+  Trash |               1 |               21  
+
+[Year]
+  Year | Number of mails | Total size(byte)  
+-------+-----------------+-------------------
+  2021 |               2 |               12  
+  2022 |               1 |               21  
+
+Dry run: no mails were archived. Specify --execute to archive them.
+`
+	assert.Equal(t, expected, result)
+
+	// アーカイブファイルは作られず、メールも残る
+	assert.Empty(t, readDirNames(t, output))
+	assert.FileExists(t, filepath.Join(temp, "cur", "1609459200.M1:2,S"))
+	assert.NoFileExists(t, auditLogPath)
+}
+
+func TestArchiveCmd_InvalidFormat(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"archive",
+		"-d", temp,
+		"--older-than", "365d",
+		"-o", temp,
+		"--format", "zip",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "invalid archive format 'zip'")
+}
+
+func setupTestArchiveMaildir(t *testing.T, rootMailFolderPath string) {
+
+	recent := strconv.FormatInt(time.Now().Unix(), 10)
+
+	// INBOX
+	createMailFolder(t, rootMailFolderPath, []mail{
+		{"cur/1609459200.M1:2,S", 5}, // 2021-01-01
+		{"cur/1609459201.M2:2,S", 7}, // 2021-01-01
+		{"new/" + recent + ".M3", 3}, // 新しいので対象外
+	})
+
+	// その他フォルダ
+	{
+		sub := createDir(t, rootMailFolderPath, ".Trash")
+		createMailFolder(t, sub, []mail{
+			{"cur/1640995200.M1:2,ST", 21}, // 2022-01-01
+		})
+	}
+}
+
+func archiveFileTable(output string, rows ...[]string) string {
+
+	buf := new(bytes.Buffer)
+	results := []*maildir.AggregateResult{}
+	for _, row := range rows {
+		count, _ := strconv.ParseInt(row[1], 10, 64)
+		size, _ := strconv.ParseInt(row[2], 10, 64)
+		results = append(results, &maildir.AggregateResult{Name: filepath.Join(output, row[0]), Count: count, TotalSize: size})
+	}
+	renderTableLayout(buf, results, "File")
+	return buf.String()
+}
+
+func readDirNames(t *testing.T, dir string) []string {
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
@@ -0,0 +1,433 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/onozaty/maildir-stats/maildir"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// 監視プラグインの状態(終了コード)
+type CheckStatus int
+
+const (
+	CheckOK CheckStatus = iota
+	CheckWarning
+	CheckCritical
+	CheckUnknown
+)
+
+func (s CheckStatus) String() string {
+	switch s {
+	case CheckOK:
+		return "OK"
+	case CheckWarning:
+		return "WARNING"
+	case CheckCritical:
+		return "CRITICAL"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+type CheckMetric int
+
+const (
+	SizeMetric CheckMetric = iota
+	CountMetric
+	QuotaMetric
+)
+
+func (m CheckMetric) String() string {
+	switch m {
+	case SizeMetric:
+		return "size"
+	case CountMetric:
+		return "count"
+	default:
+		return "quota"
+	}
+}
+
+func parseCheckMetric(str string) (CheckMetric, error) {
+
+	for _, metric := range []CheckMetric{SizeMetric, CountMetric, QuotaMetric} {
+		if str == metric.String() {
+			return metric, nil
+		}
+	}
+	return -1, fmt.Errorf("invalid metric '%s'", str)
+}
+
+type checkCondition struct {
+	metric   CheckMetric
+	perUser  bool
+	warning  float64 // 未指定の場合は+Inf
+	critical float64 // 未指定の場合は+Inf
+}
+
+// チェック対象(ユーザもしくはフォルダ)毎の値
+type checkTarget struct {
+	name   string
+	value  float64
+	status CheckStatus
+}
+
+func newCheckCmd() *cobra.Command {
+
+	subCmd := &cobra.Command{
+		Use:   "check",
+		Short: "Check mailbox sizes as a monitoring plugin (Nagios, Icinga)",
+		RunE: func(cmd *cobra.Command, args []string) error {
+
+			// 結果は状態とperfdataで表すので、Usageは表示しない
+			cmd.SilenceUsage = true
+
+			status := runCheck(cmd.Flags(), cmd.OutOrStdout())
+			if status != CheckOK {
+				return &exitCodeError{code: int(status)}
+			}
+			return nil
+		},
+	}
+
+	// フラグの誤り(引数、設定ファイルの誤りも含む)もUNKNOWNとして扱う
+	subCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		cmd.SilenceUsage = true
+		printCheckUnknown(cmd.OutOrStdout(), err)
+		return &exitCodeError{code: int(CheckUnknown)}
+	})
+
+	subCmd.Flags().StringP("mail-dir", "d", "", "User maildir name.")
+	subCmd.Flags().StringP("metric", "", "size", "Metric to check. [size|count|quota]")
+	subCmd.Flags().StringP("per", "", "user", "Check per user or per folder. [user|folder]")
+	subCmd.Flags().StringP("warning", "", "", "Warning threshold. (size: e.g. 500MB, count: number, quota: percent)")
+	subCmd.Flags().StringP("critical", "", "", "Critical threshold. (size: e.g. 1GB, count: number, quota: percent)")
+	subCmd.Flags().StringP("inbox-name", "", "INBOX", "The name of the inbox folder.")
+
+	return subCmd
+}
+
+func runCheck(f *pflag.FlagSet, writer io.Writer) CheckStatus {
+
+	maildirName, _ := f.GetString("mail-dir")
+	inboxFolderName, _ := f.GetString("inbox-name")
+
+	condition, err := getCheckCondition(f, maildirName)
+	if err != nil {
+		printCheckUnknown(writer, err)
+		return CheckUnknown
+	}
+
+	targets, err := collectCheckTargets(maildirName, inboxFolderName, condition)
+	if err != nil {
+		printCheckUnknown(writer, err)
+		return CheckUnknown
+	}
+	if len(targets) == 0 {
+		// 設定誤りで何もチェックしていない状態を見逃さないように
+		printCheckUnknown(writer, fmt.Errorf("no target to check"))
+		return CheckUnknown
+	}
+
+	status := CheckOK
+	for _, target := range targets {
+		switch {
+		case target.value > condition.critical:
+			target.status = CheckCritical
+		case target.value > condition.warning:
+			target.status = CheckWarning
+		}
+		if target.status > status {
+			status = target.status
+		}
+	}
+
+	fmt.Fprintf(writer, "MAILDIR %s - %s | %s\n", status, checkMessage(targets, condition), checkPerfData(targets, condition))
+	return status
+}
+
+func getCheckCondition(f *pflag.FlagSet, maildirName string) (checkCondition, error) {
+
+	condition := checkCondition{}
+
+	if maildirName == "" {
+		return condition, fmt.Errorf("--mail-dir must be specified")
+	}
+
+	metricStr, _ := f.GetString("metric")
+	metric, err := parseCheckMetric(metricStr)
+	if err != nil {
+		return condition, err
+	}
+	condition.metric = metric
+
+	perStr, _ := f.GetString("per")
+	switch perStr {
+	case "user":
+		condition.perUser = true
+	case "folder":
+		condition.perUser = false
+	default:
+		return condition, fmt.Errorf("invalid per '%s'", perStr)
+	}
+
+	if condition.metric == QuotaMetric && !condition.perUser {
+		return condition, fmt.Errorf("--metric quota can be used only with --per user")
+	}
+
+	warningStr, _ := f.GetString("warning")
+	criticalStr, _ := f.GetString("critical")
+	if warningStr == "" && criticalStr == "" {
+		return condition, fmt.Errorf("--warning or --critical must be specified")
+	}
+
+	if condition.warning, err = parseCheckThreshold(warningStr, condition.metric); err != nil {
+		return condition, err
+	}
+	if condition.critical, err = parseCheckThreshold(criticalStr, condition.metric); err != nil {
+		return condition, err
+	}
+
+	return condition, nil
+}
+
+func parseCheckThreshold(str string, metric CheckMetric) (float64, error) {
+
+	if str == "" {
+		return math.Inf(1), nil
+	}
+
+	switch metric {
+	case SizeMetric:
+		size, err := humanize.ParseBytes(str)
+		if err != nil {
+			return 0, fmt.Errorf("invalid threshold '%s'", str)
+		}
+		return float64(size), nil
+	case CountMetric:
+		count, err := strconv.ParseInt(str, 10, 64)
+		if err != nil || count < 0 {
+			return 0, fmt.Errorf("invalid threshold '%s'", str)
+		}
+		return float64(count), nil
+	default:
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(str, "%"), 64)
+		if err != nil || percent < 0 {
+			return 0, fmt.Errorf("invalid threshold '%s'", str)
+		}
+		return percent, nil
+	}
+}
+
+func collectCheckTargets(maildirName string, inboxFolderName string, condition checkCondition) ([]*checkTarget, error) {
+
+	usages, err := collectMailUsages(maildirName, inboxFolderName, condition.perUser, condition.metric == QuotaMetric)
+	if err != nil {
+		return nil, err
+	}
+
+	targets := []*checkTarget{}
+	for _, usage := range usages {
+		if value, ok := usage.value(condition.metric); ok {
+			targets = append(targets, &checkTarget{name: usage.name(), value: value})
+		}
+	}
+
+	return targets, nil
+}
+
+// ユーザもしくはフォルダ毎の使用量
+type mailUsage struct {
+	userName       string
+	mailFolderName string // ユーザ毎の場合は空
+	count          int64
+	size           int64
+	quota          *maildir.MaildirQuota // quotaが設定されていない場合はnil
+}
+
+func (u *mailUsage) name() string {
+
+	if u.mailFolderName == "" {
+		return u.userName
+	}
+	return u.userName + "/" + u.mailFolderName
+}
+
+// 指標の値(quotaが設定されていない場合、quotaの値は無し)
+func (u *mailUsage) value(metric CheckMetric) (float64, bool) {
+
+	switch metric {
+	case SizeMetric:
+		return float64(u.size), true
+	case CountMetric:
+		return float64(u.count), true
+	default:
+		if u.quota == nil {
+			return 0, false
+		}
+		percent, ok := u.quota.UsagePercent(u.size, u.count)
+		// perfdataなどが長くならないように、小数点以下2桁に
+		return math.Round(percent*100) / 100, ok
+	}
+}
+
+// 全ユーザの使用量をユーザ毎、もしくはフォルダ毎に集計する(名前順)
+// quotaはユーザ毎の場合のみ読み込む
+func collectMailUsages(maildirName string, inboxFolderName string, perUser bool, withQuota bool) ([]*mailUsage, error) {
+
+	users, err := loadPasswd(passwdPath)
+	if err != nil {
+		return nil, err
+	}
+
+	mailboxes := maildir.UserMailboxes(users, maildirName, "", maildir.MaildirStorage)
+	errorHandler := func(err *maildir.AggregateError) error {
+		return err
+	}
+
+	usages := []*mailUsage{}
+
+	if perUser {
+		userAggregator := maildir.NewUserAggregator()
+		if err := maildir.AggregateUserMailboxesWithErrorHandler(mailboxes, inboxFolderName, userAggregator, errorHandler); err != nil {
+			return nil, err
+		}
+
+		// 集計結果の順番には依存せず、ユーザ名でquotaを読むMaildirを探す
+		mailboxByUser := map[string]maildir.UserMailbox{}
+		for _, mailbox := range mailboxes {
+			mailboxByUser[mailbox.UserName] = mailbox
+		}
+
+		for _, result := range userAggregator.Results() {
+			usage := &mailUsage{userName: result.Name, count: result.Count, size: result.TotalSize}
+
+			if withQuota {
+				quota, err := maildir.ReadMaildirQuota(mailboxByUser[result.Name].Mailbox.MaildirPath)
+				if err != nil && !os.IsNotExist(err) {
+					return nil, err
+				}
+				usage.quota = quota
+			}
+
+			usages = append(usages, usage)
+		}
+	} else {
+		// フォルダ名はユーザ間で重複するので、ユーザ毎に集計する
+		for _, mailbox := range mailboxes {
+			folderAggregator := maildir.NewFolderAggregator()
+			if err := maildir.AggregateUserMailboxesWithErrorHandler([]maildir.UserMailbox{mailbox}, inboxFolderName, folderAggregator, errorHandler); err != nil {
+				return nil, err
+			}
+
+			for _, result := range folderAggregator.Results() {
+				usages = append(usages, &mailUsage{userName: mailbox.UserName, mailFolderName: result.Name, count: result.Count, size: result.TotalSize})
+			}
+		}
+	}
+
+	sort.Slice(usages, func(i, j int) bool {
+		return usages[i].name() < usages[j].name()
+	})
+
+	return usages, nil
+}
+
+// 状態の説明
+// 閾値を超えたものがある場合はそれを(CRITICALを先に)、無い場合はチェックした件数を出力する
+func checkMessage(targets []*checkTarget, condition checkCondition) string {
+
+	messages := []string{}
+	for _, status := range []CheckStatus{CheckCritical, CheckWarning} {
+		threshold := condition.critical
+		if status == CheckWarning {
+			threshold = condition.warning
+		}
+
+		for _, target := range targets {
+			if target.status == status {
+				messages = append(messages, fmt.Sprintf("%s %s > %s", target.name, formatCheckValue(target.value, condition.metric), formatCheckValue(threshold, condition.metric)))
+			}
+		}
+	}
+
+	if len(messages) > 0 {
+		return strings.Join(messages, ", ")
+	}
+
+	targetName := "users"
+	if !condition.perUser {
+		targetName = "folders"
+	}
+	return fmt.Sprintf("%d %s checked", len(targets), targetName)
+}
+
+func formatCheckValue(value float64, metric CheckMetric) string {
+
+	switch metric {
+	case SizeMetric:
+		return humanize.Bytes(uint64(value))
+	case CountMetric:
+		return humanize.Comma(int64(value))
+	default:
+		return strconv.FormatFloat(value, 'f', 1, 64) + "%"
+	}
+}
+
+// perfdata
+// 'label'=value[UOM];[warn];[crit];[min];[max]
+func checkPerfData(targets []*checkTarget, condition checkCondition) string {
+
+	uom := ""
+	max := ""
+	switch condition.metric {
+	case SizeMetric:
+		uom = "B"
+	case QuotaMetric:
+		uom = "%"
+		max = "100"
+	}
+
+	perfData := []string{}
+	for _, target := range targets {
+		perfData = append(perfData, fmt.Sprintf("%s=%s%s;%s;%s;0;%s",
+			perfLabel(target.name),
+			perfValue(target.value),
+			uom,
+			perfValue(condition.warning),
+			perfValue(condition.critical),
+			max))
+	}
+
+	return strings.Join(perfData, " ")
+}
+
+func perfLabel(name string) string {
+
+	if strings.ContainsAny(name, " '=") {
+		return "'" + strings.ReplaceAll(name, "'", "''") + "'"
+	}
+	return name
+}
+
+func perfValue(value float64) string {
+
+	if math.IsInf(value, 1) {
+		// 閾値が未指定
+		return ""
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func printCheckUnknown(writer io.Writer, err error) {
+	fmt.Fprintf(writer, "MAILDIR %s - %s\n", CheckUnknown, err)
+}
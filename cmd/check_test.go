@@ -0,0 +1,245 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/onozaty/maildir-stats/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckCmd_Size(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	users := setupTestCheckMaildir(t, temp)
+
+	// テスト用にメソッド差し替え
+	loadPasswd = func(passwdPath string) ([]user.User, error) {
+		return users, nil
+	}
+
+	// ACT
+	result, code := executeCheckCmd(t, "-d", "Maildir", "--warning", "2000", "--critical", "3KB")
+
+	// ASSERT
+	assert.Equal(t, CheckCritical, code)
+	assert.Equal(t, "MAILDIR CRITICAL - user1 3.5 kB > 3.0 kB, user2 2.1 kB > 2.0 kB | user1=3500B;2000;3000;0; user2=2100B;2000;3000;0; user3=0B;2000;3000;0;\n", result)
+}
+
+func TestCheckCmd_Count(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	users := setupTestCheckMaildir(t, temp)
+
+	// テスト用にメソッド差し替え
+	loadPasswd = func(passwdPath string) ([]user.User, error) {
+		return users, nil
+	}
+
+	// ACT
+	result, code := executeCheckCmd(t, "-d", "Maildir", "--metric", "count", "--warning", "2")
+
+	// ASSERT
+	assert.Equal(t, CheckWarning, code)
+	assert.Equal(t, "MAILDIR WARNING - user1 3 > 2 | user1=3;2;;0; user2=2;2;;0; user3=0;2;;0;\n", result)
+}
+
+func TestCheckCmd_OK(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	users := setupTestCheckMaildir(t, temp)
+
+	// テスト用にメソッド差し替え
+	loadPasswd = func(passwdPath string) ([]user.User, error) {
+		return users, nil
+	}
+
+	// ACT
+	result, code := executeCheckCmd(t, "-d", "Maildir", "--metric", "count", "--critical", "10")
+
+	// ASSERT
+	assert.Equal(t, CheckOK, code)
+	assert.Equal(t, "MAILDIR OK - 3 users checked | user1=3;;10;0; user2=2;;10;0; user3=0;;10;0;\n", result)
+}
+
+func TestCheckCmd_Quota(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	users := setupTestCheckMaildir(t, temp)
+
+	// テスト用にメソッド差し替え
+	loadPasswd = func(passwdPath string) ([]user.User, error) {
+		return users, nil
+	}
+
+	// ACT
+	result, code := executeCheckCmd(t, "-d", "Maildir", "--metric", "quota", "--warning", "80%", "--critical", "90")
+
+	// ASSERT
+	// user3はquotaが無いので対象外
+	assert.Equal(t, CheckWarning, code)
+	assert.Equal(t, "MAILDIR WARNING - user1 87.5% > 80.0% | user1=87.5%;80;90;0;100 user2=52.5%;80;90;0;100\n", result)
+}
+
+func TestCheckCmd_PerFolder(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	users := setupTestCheckMaildir(t, temp)
+
+	// テスト用にメソッド差し替え
+	loadPasswd = func(passwdPath string) ([]user.User, error) {
+		return users, nil
+	}
+
+	// ACT
+	result, code := executeCheckCmd(t, "-d", "Maildir", "--per", "folder", "--warning", "2000", "--critical", "3000")
+
+	// ASSERT
+	assert.Equal(t, CheckWarning, code)
+	assert.Equal(t, "MAILDIR WARNING - user1/Sent 2.5 kB > 2.0 kB, user2/My Box 2.1 kB > 2.0 kB | user1/INBOX=1000B;2000;3000;0; user1/Sent=2500B;2000;3000;0; user2/INBOX=0B;2000;3000;0; 'user2/My Box'=2100B;2000;3000;0; user3/INBOX=0B;2000;3000;0;\n", result)
+}
+
+func TestCheckCmd_NoTarget(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	users := setupTestCheckMaildir(t, temp)
+
+	// テスト用にメソッド差し替え
+	loadPasswd = func(passwdPath string) ([]user.User, error) {
+		return users, nil
+	}
+
+	// ACT
+	result, code := executeCheckCmd(t, "-d", "xxx", "--warning", "1")
+
+	// ASSERT
+	assert.Equal(t, CheckUnknown, code)
+	assert.Equal(t, "MAILDIR UNKNOWN - no target to check\n", result)
+}
+
+func TestCheckCmd_InvalidArgs(t *testing.T) {
+
+	tests := []struct {
+		args    []string
+		message string
+	}{
+		{[]string{"--warning", "1"}, "--mail-dir must be specified"},
+		{[]string{"-d", "Maildir"}, "--warning or --critical must be specified"},
+		{[]string{"-d", "Maildir", "--metric", "xx", "--warning", "1"}, "invalid metric 'xx'"},
+		{[]string{"-d", "Maildir", "--per", "xx", "--warning", "1"}, "invalid per 'xx'"},
+		{[]string{"-d", "Maildir", "--metric", "quota", "--per", "folder", "--warning", "1"}, "--metric quota can be used only with --per user"},
+		{[]string{"-d", "Maildir", "--warning", "xx"}, "invalid threshold 'xx'"},
+		{[]string{"-d", "Maildir", "--metric", "count", "--critical", "1.5"}, "invalid threshold '1.5'"},
+		{[]string{"-d", "Maildir", "--metric", "quota", "--critical", "-1"}, "invalid threshold '-1'"},
+		{[]string{"-d", "Maildir", "--xx"}, "unknown flag: --xx"},
+		{[]string{"-d", "Maildir", "--warning", "1", "xx"}, "only flags can be specified"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.message, func(t *testing.T) {
+			// ACT
+			result, code := executeCheckCmd(t, tt.args...)
+
+			// ASSERT
+			assert.Equal(t, CheckUnknown, code)
+			assert.Equal(t, "MAILDIR UNKNOWN - "+tt.message+"\n", result)
+		})
+	}
+}
+
+func TestCheckCmd_InvalidConfig(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	configPath := filepath.Join(temp, "config.yaml")
+	createFile(t, configPath, "check: [")
+
+	// ACT
+	result, code := executeCheckCmd(t, "-d", "Maildir", "--warning", "1", "--config", configPath)
+
+	// ASSERT
+	assert.Equal(t, CheckUnknown, code)
+	assert.Equal(t, "MAILDIR UNKNOWN - "+configPath+" is invalid config file: yaml: line 1: did not find expected node content\n", result)
+}
+
+func TestCheckCmd_ConfigNotFound(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	configPath := filepath.Join(temp, "config.yaml") // 存在しないファイル
+
+	// ACT
+	result, code := executeCheckCmd(t, "-d", "Maildir", "--warning", "1", "--config", configPath)
+
+	// ASSERT
+	assert.Equal(t, CheckUnknown, code)
+	assert.True(t, strings.HasPrefix(result, "MAILDIR UNKNOWN - "), result)
+	assert.Contains(t, result, configPath)
+}
+
+func executeCheckCmd(t *testing.T, args ...string) (string, CheckStatus) {
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs(append([]string{"check"}, args...))
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	err := rootCmd.Execute()
+	if err == nil {
+		return buf.String(), CheckOK
+	}
+
+	var exitErr *exitCodeError
+	require.True(t, errors.As(err, &exitErr), err.Error())
+
+	return buf.String(), CheckStatus(exitErr.code)
+}
+
+func setupTestCheckMaildir(t *testing.T, temp string) []user.User {
+
+	users := []user.User{}
+	for _, userName := range []string{"user1", "user2", "user3", "user4"} {
+		homeDir := createDir(t, temp, userName)
+		users = append(users, user.User{Name: userName, HomeDir: homeDir})
+	}
+
+	{
+		maildir := createDir(t, users[0].HomeDir, "Maildir")
+		createMailFolder(t, maildir, []mail{
+			{"cur/1", 1000},
+		})
+		createMailFolder(t, createDir(t, maildir, ".Sent"), []mail{
+			{"cur/2", 2000},
+			{"new/3", 500},
+		})
+		createFile(t, filepath.Join(maildir, "maildirsize"), "4000S,100C\n3500 3\n")
+	}
+	{
+		maildir := createDir(t, users[1].HomeDir, "Maildir")
+		createMailFolder(t, maildir, []mail{})
+		createMailFolder(t, createDir(t, maildir, ".My Box"), []mail{
+			{"cur/1", 1000},
+			{"cur/2", 1100},
+		})
+		createFile(t, filepath.Join(maildir, "maildirsize"), "4000S\n")
+	}
+	{
+		// 空
+		maildir := createDir(t, users[2].HomeDir, "Maildir")
+		createMailFolder(t, maildir, []mail{})
+	}
+	// user4はMaildir無し
+
+	return users
+}
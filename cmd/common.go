@@ -1,8 +1,13 @@
 package cmd
 
 import (
+	"bufio"
 	"fmt"
 	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
 
 	"github.com/dustin/go-humanize"
 	"github.com/olekukonko/tablewriter"
@@ -54,6 +59,10 @@ func reverse[S ~[]E, E any](s S) {
 func getSortCondition(f *pflag.FlagSet, name string) (SortCondition, error) {
 
 	str, _ := f.GetString(name)
+	return parseSortCondition(str)
+}
+
+func parseSortCondition(str string) (SortCondition, error) {
 
 	switch str {
 	case "name-asc":
@@ -73,6 +82,196 @@ func getSortCondition(f *pflag.FlagSet, name string) (SortCondition, error) {
 	}
 }
 
+type ErrorPolicy int
+
+const (
+	ErrorFail ErrorPolicy = iota
+	ErrorWarn
+	ErrorSkip
+)
+
+func getErrorPolicy(f *pflag.FlagSet, name string) (ErrorPolicy, error) {
+
+	str, _ := f.GetString(name)
+
+	switch str {
+	case "fail":
+		return ErrorFail, nil
+	case "warn":
+		return ErrorWarn, nil
+	case "skip":
+		return ErrorSkip, nil
+	default:
+		return -1, fmt.Errorf("invalid error policy '%s'", str)
+	}
+}
+
+func getStorageFormat(f *pflag.FlagSet, name string) (maildir.StorageFormat, error) {
+
+	str, _ := f.GetString(name)
+
+	switch str {
+	case "maildir":
+		return maildir.MaildirStorage, nil
+	case "mbox":
+		return maildir.MboxStorage, nil
+	case "dbox":
+		return maildir.DboxStorage, nil
+	case "auto":
+		return maildir.AutoStorage, nil
+	default:
+		return -1, fmt.Errorf("invalid input format '%s'", str)
+	}
+}
+
+type OutputFormat int
+
+const (
+	TableFormat OutputFormat = iota
+	PromTextfileFormat
+	InfluxFormat
+	HtmlFormat
+	NcduFormat
+	MarkdownFormat
+)
+
+func getOutputFormat(f *pflag.FlagSet, name string) (OutputFormat, error) {
+
+	str, _ := f.GetString(name)
+
+	switch str {
+	case "table":
+		return TableFormat, nil
+	case "prom-textfile":
+		return PromTextfileFormat, nil
+	case "influx":
+		return InfluxFormat, nil
+	case "html":
+		return HtmlFormat, nil
+	case "ncdu":
+		return NcduFormat, nil
+	case "markdown":
+		return MarkdownFormat, nil
+	default:
+		return -1, fmt.Errorf("invalid format '%s'", str)
+	}
+}
+
+// IMAP、SMTPのサーバとの接続方法
+type ConnectionSecurity int
+
+const (
+	SecurityTLS ConnectionSecurity = iota
+	SecurityStartTLS
+	SecurityNone
+)
+
+func getConnectionSecurity(f *pflag.FlagSet, name string) (ConnectionSecurity, error) {
+
+	str, _ := f.GetString(name)
+
+	switch str {
+	case "tls":
+		return SecurityTLS, nil
+	case "starttls":
+		return SecurityStartTLS, nil
+	case "none":
+		return SecurityNone, nil
+	default:
+		return -1, fmt.Errorf("invalid security '%s'", str)
+	}
+}
+
+// 出力先のファイルが指定されている場合はファイルに、指定されていない場合はwriterに出力する
+// ファイルは読み込み側が書き込み途中の内容を見ないように、一時ファイルに書いてから置き換える
+func writeOutput(outputPath string, writer io.Writer, write func(writer io.Writer)) error {
+
+	if outputPath == "" {
+		write(writer)
+		return nil
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(outputPath), "."+filepath.Base(outputPath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tempPath := file.Name()
+
+	err = func() error {
+		bufferedWriter := bufio.NewWriter(file)
+		write(bufferedWriter)
+		if err := bufferedWriter.Flush(); err != nil {
+			return err
+		}
+
+		// CreateTempは所有者のみ読み書きできる権限になるので、他のプロセスからも読めるように
+		if err := file.Chmod(0644); err != nil {
+			return err
+		}
+		return file.Close()
+	}()
+	if err != nil {
+		file.Close()
+		os.Remove(tempPath)
+		return err
+	}
+
+	if err := os.Rename(tempPath, outputPath); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	return nil
+}
+
+// アーカイブ内のパスは先頭の"/"を除いて扱う
+// 例: /home/user1/Maildir -> home/user1/Maildir
+func archiveEntryPath(str string) string {
+	return strings.TrimPrefix(path.Clean("/"+str), "/")
+}
+
+// 集計中のエラーを方針に従って扱う
+type errorCollector struct {
+	policy ErrorPolicy
+	errors []*maildir.AggregateError
+}
+
+func newErrorCollector(policy ErrorPolicy) *errorCollector {
+	return &errorCollector{
+		policy: policy,
+		errors: []*maildir.AggregateError{},
+	}
+}
+
+func (c *errorCollector) handle(err *maildir.AggregateError) error {
+
+	if c.policy == ErrorFail {
+		// 従来通りそのエラーで中断
+		return err.Err
+	}
+
+	c.errors = append(c.errors, err)
+	return nil
+}
+
+// レポートの[Errors]に出力するエラー
+// skipの場合は、エラーとしたメールフォルダを無視するので出力しない
+func (c *errorCollector) reportErrors() []*maildir.AggregateError {
+
+	if c.policy == ErrorSkip {
+		return []*maildir.AggregateError{}
+	}
+	return c.errors
+}
+
+// 全ての出力を終えた後に、終了コードを決めるためのエラーを返す
+func (c *errorCollector) result() error {
+
+	if c.policy == ErrorWarn && len(c.errors) > 0 {
+		return fmt.Errorf("%d error(s) occurred during aggregation", len(c.errors))
+	}
+	return nil
+}
+
 func printSummaryReport(writer io.Writer, results []*maildir.AggregateResult) {
 
 	summaryCount := int64(0)
@@ -89,8 +288,11 @@ func printSummaryReport(writer io.Writer, results []*maildir.AggregateResult) {
 }
 
 func printFolderReport(writer io.Writer, folderAggregator *maildir.FolderAggregator, sortCondition SortCondition) {
+	printFolderResults(writer, folderAggregator.Results(), sortCondition)
+}
+
+func printFolderResults(writer io.Writer, results []*maildir.AggregateResult, sortCondition SortCondition) {
 
-	results := folderAggregator.Results()
 	sortResults(results, sortCondition)
 
 	fmt.Fprintf(writer, "[Folder]\n")
@@ -124,6 +326,88 @@ func printMonthReport(writer io.Writer, monthAggregator *maildir.TimeAggregator,
 	renderTableLayout(writer, results, "Month")
 }
 
+func printErrorReport(writer io.Writer, errors []*maildir.AggregateError, withUser bool) {
+
+	fmt.Fprintf(writer, "[Errors]\n")
+
+	table := tablewriter.NewWriter(writer)
+	table.SetAutoFormatHeaders(false)
+	table.SetAutoWrapText(false)
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetBorder(false)
+
+	if withUser {
+		table.SetHeader([]string{"User", "Folder", "Error"})
+	} else {
+		table.SetHeader([]string{"Folder", "Error"})
+	}
+
+	for _, err := range errors {
+		if withUser {
+			table.Append([]string{err.UserName, err.MailFolderName, err.Err.Error()})
+		} else {
+			table.Append([]string{err.MailFolderName, err.Err.Error()})
+		}
+	}
+
+	table.Render()
+}
+
+func printSenderReport(writer io.Writer, senderAggregator *maildir.SenderAggregator, sortCondition SortCondition, top int, title string, nameTitle string) {
+
+	results := senderAggregator.Results()
+	sortResults(results, sortCondition)
+
+	// 0以下の場合は全件
+	if top > 0 && len(results) > top {
+		results = results[:top]
+	}
+
+	fmt.Fprintf(writer, "[%s]\n", title)
+	renderTableLayout(writer, results, nameTitle)
+}
+
+func printAttachmentReport(writer io.Writer, attachmentAggregator *maildir.AttachmentAggregator, sortCondition SortCondition, mailboxSize int64) {
+
+	typeResults := attachmentAggregator.TypeResults()
+	sortResults(typeResults, sortCondition)
+
+	fmt.Fprintf(writer, "[Attachment type]\n")
+	renderRatioTableLayout(writer, typeResults, "Type", attachmentAggregator.TypeEncodedSizes(), mailboxSize)
+	fmt.Fprintf(writer, "\n")
+
+	extensionResults := attachmentAggregator.ExtensionResults()
+	sortResults(extensionResults, sortCondition)
+
+	fmt.Fprintf(writer, "[Attachment extension]\n")
+	renderRatioTableLayout(writer, extensionResults, "Extension", attachmentAggregator.ExtensionEncodedSizes(), mailboxSize)
+}
+
+// サイズの割合(メールボックス全体のサイズに対して)の列を加えたもの
+// メールボックスのサイズはエンコードされたままのサイズなので、割合もメール内でのサイズ(ratioSizeByName)で求める
+func renderRatioTableLayout(writer io.Writer, results []*maildir.AggregateResult, nameTitle string, ratioSizeByName map[string]int64, totalSize int64) {
+
+	table := tablewriter.NewWriter(writer)
+	table.SetAutoFormatHeaders(false)
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetColumnAlignment([]int{tablewriter.ALIGN_LEFT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT})
+	table.SetBorder(false)
+	table.SetHeader([]string{nameTitle, "Number of attachments", "Total size(byte)", "Ratio"})
+
+	for _, result := range results {
+		ratio := float64(0)
+		if totalSize > 0 {
+			ratio = float64(ratioSizeByName[result.Name]) / float64(totalSize) * 100
+		}
+
+		table.Append(
+			[]string{result.Name, humanize.Comma(int64(result.Count)), humanize.Comma(result.TotalSize), fmt.Sprintf("%.1f%%", ratio)})
+	}
+
+	table.Render()
+}
+
 func renderTableLayout(writer io.Writer, results []*maildir.AggregateResult, nameTitle string) {
 
 	table := tablewriter.NewWriter(writer)
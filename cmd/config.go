@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+const envPrefix = "MAILDIR_STATS_"
+
+// 設定ファイルの内容
+// サブコマンド名をキーに、フラグ名と値を持つ
+//
+//	all:
+//	  mail-dir: Maildir
+//	  sort-user: size-desc
+//	profiles:
+//	  mail01:
+//	    all:
+//	      mail-dir: Mail
+type config struct {
+	Commands map[string]map[string]interface{}            `yaml:",inline"`
+	Profiles map[string]map[string]map[string]interface{} `yaml:"profiles"`
+}
+
+// テスト用に差し替え可能にしておく
+var defaultConfigPaths = defaultConfigPathsReal
+
+func defaultConfigPathsReal() []string {
+
+	paths := []string{}
+	if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, filepath.Join(home, ".config", "maildir-stats", "config.yaml"))
+	}
+	return append(paths, "/etc/maildir-stats.yaml")
+}
+
+// テスト用に差し替え可能にしておく
+var hostname = os.Hostname
+
+func loadConfig(configPath string) (*config, error) {
+
+	if configPath == "" {
+		// 明示的に指定されていない場合は、既定の場所から最初に見つかったものを使う
+		for _, path := range defaultConfigPaths() {
+			if _, err := os.Stat(path); err == nil {
+				configPath = path
+				break
+			}
+		}
+
+		if configPath == "" {
+			return &config{}, nil
+		}
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var conf config
+	if err := yaml.Unmarshal(data, &conf); err != nil {
+		return nil, fmt.Errorf("%s is invalid config file: %w", configPath, err)
+	}
+
+	return &conf, nil
+}
+
+// サブコマンドのオプション値を、プロファイルの設定で上書きした上で返す
+// プロファイルは明示的に指定された場合のみ使う(ホストによって暗黙に設定が変わらないように)
+func (c *config) commandValues(commandName string, profileName string) (map[string]interface{}, error) {
+
+	values := map[string]interface{}{}
+	for name, value := range c.Commands[commandName] {
+		values[name] = value
+	}
+
+	if profileName == "" {
+		return values, nil
+	}
+
+	profile, ok := c.Profiles[profileName]
+	if !ok {
+		return nil, fmt.Errorf("profile '%s' is not found in config file", profileName)
+	}
+
+	for name, value := range profile[commandName] {
+		values[name] = value
+	}
+
+	return values, nil
+}
+
+// フラグ > 環境変数 > 設定ファイル > デフォルト値 の優先順でフラグの値を決める
+func applyConfig(cmd *cobra.Command) error {
+
+	configPath, _ := cmd.Flags().GetString("config")
+	if configPath == "" {
+		configPath = os.Getenv(envPrefix + "CONFIG")
+	}
+
+	profileName, _ := cmd.Flags().GetString("profile")
+	if profileName == "" {
+		profileName = os.Getenv(envPrefix + "PROFILE")
+	}
+
+	conf, err := loadConfig(configPath)
+	if err != nil {
+		return err
+	}
+
+	values, err := conf.commandValues(cmd.Name(), profileName)
+	if err != nil {
+		return err
+	}
+
+	for name := range values {
+		if name == "config" || name == "profile" || cmd.LocalFlags().Lookup(name) == nil {
+			return fmt.Errorf("unknown option '%s' for '%s' in config file", name, cmd.Name())
+		}
+	}
+
+	var applyErr error
+	cmd.LocalFlags().VisitAll(func(flag *pflag.Flag) {
+
+		if applyErr != nil || flag.Changed || flag.Name == "help" || flag.Name == "config" || flag.Name == "profile" {
+			return
+		}
+
+		if value, ok := os.LookupEnv(envName(cmd.Name(), flag.Name)); ok {
+			if err := cmd.Flags().Set(flag.Name, value); err != nil {
+				applyErr = fmt.Errorf("environment variable %s: %w", envName(cmd.Name(), flag.Name), err)
+			}
+			return
+		}
+
+		if value, ok := values[flag.Name]; ok {
+			// 複数指定できるフラグは、リストでも指定できるように
+			items, isList := value.([]interface{})
+			if !isList {
+				items = []interface{}{value}
+			}
+			for _, item := range items {
+				if err := cmd.Flags().Set(flag.Name, fmt.Sprint(item)); err != nil {
+					applyErr = fmt.Errorf("config file: %w", err)
+					return
+				}
+			}
+		}
+	})
+
+	return applyErr
+}
+
+// 例: all の mail-dir -> MAILDIR_STATS_ALL_MAIL_DIR
+func envName(commandName string, flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(commandName+"_"+flagName, "-", "_"))
+}
@@ -0,0 +1,516 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/onozaty/maildir-stats/user"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	maildir := "Maildir"
+
+	users := setupTestAllMaildir(t, temp, maildir)
+
+	// テスト用にメソッド差し替え
+	loadPasswd = func(passwdPath string) ([]user.User, error) {
+		return users, nil
+	}
+
+	configPath := filepath.Join(temp, "config.yaml")
+	createFile(t, configPath, `
+all:
+  mail-dir: Maildir
+  user: true
+  sort-user: size-desc
+`)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"all",
+		"--config", configPath,
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	result := buf.String()
+	expected := `[Summary]
+Number of mails : 11
+Total size      : 6,321 byte
+
+[User]
+  Name  | Number of mails | Total size(byte)  
+--------+-----------------+-------------------
+  user3 |               3 |            6,000  
+  user2 |               2 |              300  
+  user1 |               6 |               21  
+  user4 |               0 |                0  
+
+`
+	assert.Equal(t, expected, result)
+}
+
+func TestConfig_Precedence(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	maildir := "Maildir"
+
+	users := setupTestAllMaildir(t, temp, maildir)
+
+	// テスト用にメソッド差し替え
+	loadPasswd = func(passwdPath string) ([]user.User, error) {
+		return users, nil
+	}
+
+	configPath := filepath.Join(temp, "config.yaml")
+	createFile(t, configPath, `
+all:
+  mail-dir: xxx
+  user: true
+  sort-user: size-desc
+`)
+
+	// 環境変数は設定ファイルより優先
+	t.Setenv("MAILDIR_STATS_ALL_MAIL_DIR", maildir)
+	t.Setenv("MAILDIR_STATS_ALL_SORT_USER", "count-asc")
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"all",
+		"--config", configPath,
+		"--sort-user", "name-desc", // フラグは環境変数より優先
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	result := buf.String()
+	expected := `[Summary]
+Number of mails : 11
+Total size      : 6,321 byte
+
+[User]
+  Name  | Number of mails | Total size(byte)  
+--------+-----------------+-------------------
+  user4 |               0 |                0  
+  user3 |               3 |            6,000  
+  user2 |               2 |              300  
+  user1 |               6 |               21  
+
+`
+	assert.Equal(t, expected, result)
+}
+
+func TestConfig_Profile(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	setupTestUserMaildir(t, temp)
+
+	configPath := filepath.Join(temp, "config.yaml")
+	createFile(t, configPath, `
+user:
+  dir: `+filepath.Join(temp, "xxx")+`
+  year: true
+profiles:
+  p1:
+    user:
+      dir: `+temp+`
+      sort-year: name-desc
+  p2:
+    user:
+      year: false
+`)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"user",
+		"--config", configPath,
+		"--profile", "p1",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	result := buf.String()
+	expected := `[Summary]
+Number of mails : 10
+Total size      : 3,340 byte
+
+[Year]
+  Year | Number of mails | Total size(byte)  
+-------+-----------------+-------------------
+  2023 |               7 |              337  
+  2022 |               3 |            3,003  
+
+`
+	assert.Equal(t, expected, result)
+}
+
+func TestConfig_EnvProfile(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	setupTestUserMaildir(t, temp)
+
+	configPath := filepath.Join(temp, "config.yaml")
+	createFile(t, configPath, `
+user:
+  dir: `+filepath.Join(temp, "xxx")+`
+profiles:
+  p1:
+    user:
+      dir: `+temp+`
+`)
+
+	t.Setenv("MAILDIR_STATS_PROFILE", "p1")
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"user",
+		"--config", configPath,
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	result := buf.String()
+	expected := `[Summary]
+Number of mails : 10
+Total size      : 3,340 byte
+
+`
+	assert.Equal(t, expected, result)
+}
+
+func TestConfig_HostProfileNotApplied(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	setupTestUserMaildir(t, temp)
+
+	configPath := filepath.Join(temp, "config.yaml")
+	createFile(t, configPath, `
+user:
+  dir: `+temp+`
+profiles:
+  mail01:
+    user:
+      dir: `+filepath.Join(temp, "xxx")+`
+`)
+
+	// ホスト名と同じ名前のプロファイルがあっても、指定されていなければ使わない
+	hostname = func() (string, error) {
+		return "mail01", nil
+	}
+	t.Cleanup(func() { hostname = os.Hostname })
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"user",
+		"--config", configPath,
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	result := buf.String()
+	expected := `[Summary]
+Number of mails : 10
+Total size      : 3,340 byte
+
+`
+	assert.Equal(t, expected, result)
+}
+
+func TestConfig_DefaultPath(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	setupTestUserMaildir(t, temp)
+
+	configPath := filepath.Join(temp, "config.yaml")
+	createFile(t, configPath, `
+user:
+  dir: `+temp+`
+`)
+
+	// テスト用にメソッド差し替え
+	defaultConfigPaths = func() []string {
+		return []string{filepath.Join(temp, "notfound.yaml"), configPath}
+	}
+	t.Cleanup(func() { defaultConfigPaths = defaultConfigPathsReal })
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"user",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	result := buf.String()
+	expected := `[Summary]
+Number of mails : 10
+Total size      : 3,340 byte
+
+`
+	assert.Equal(t, expected, result)
+}
+
+func TestConfig_List(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	maildirPath := createDir(t, temp, "Maildir")
+	setupTestPurgeMaildir(t, maildirPath)
+
+	// 複数指定できるフラグはリストで
+	configPath := filepath.Join(temp, "config.yaml")
+	createFile(t, configPath, `
+purge:
+  folder:
+    - Trash
+    - Junk
+  older-than: 30d
+`)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"purge",
+		"-d", maildirPath,
+		"--config", configPath,
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	result := buf.String()
+	expected := `[Summary]
+Number of mails : 3
+Total size      : 33 byte
+
+[Folder]
+  Name  | Number of mails | Total size(byte)  
+--------+-----------------+-------------------
+  Junk  |               1 |               21  
+  Trash |               2 |               12  
+
+Dry run: no mails were deleted. Specify --execute to delete them.
+`
+	assert.Equal(t, expected, result)
+}
+
+func TestApplyConfig_List(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	// 複数指定できるフラグはリストでも、単一の値でも指定できる
+	configPath := filepath.Join(temp, "config.yaml")
+	createFile(t, configPath, `
+list:
+  folder:
+    - Trash
+    - Junk
+  name: single
+`)
+
+	cmd := &cobra.Command{Use: "list"}
+	cmd.Flags().String("config", configPath, "")
+	cmd.Flags().String("profile", "", "")
+	cmd.Flags().StringSlice("folder", nil, "")
+	cmd.Flags().StringSlice("name", nil, "")
+
+	// ACT
+	err := applyConfig(cmd)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	folders, _ := cmd.Flags().GetStringSlice("folder")
+	assert.Equal(t, []string{"Trash", "Junk"}, folders)
+	names, _ := cmd.Flags().GetStringSlice("name")
+	assert.Equal(t, []string{"single"}, names)
+}
+
+func TestConfig_ProfileNotFound(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	setupTestUserMaildir(t, temp)
+
+	configPath := filepath.Join(temp, "config.yaml")
+	createFile(t, configPath, `
+profiles:
+  p1:
+    user:
+      dir: `+temp+`
+`)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"user",
+		"--config", configPath,
+		"--profile", "p2",
+	})
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "profile 'p2' is not found in config file")
+}
+
+func TestConfig_UnknownOption(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	setupTestUserMaildir(t, temp)
+
+	configPath := filepath.Join(temp, "config.yaml")
+	createFile(t, configPath, `
+user:
+  mail-dir: Maildir
+`)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"user",
+		"--config", configPath,
+		"-d", temp,
+	})
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "unknown option 'mail-dir' for 'user' in config file")
+}
+
+func TestConfig_InvalidValue(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	setupTestUserMaildir(t, temp)
+
+	configPath := filepath.Join(temp, "config.yaml")
+	createFile(t, configPath, `
+user:
+  folder: xxx
+`)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"user",
+		"--config", configPath,
+		"-d", temp,
+	})
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, `config file: invalid argument "xxx" for "-f, --folder" flag: strconv.ParseBool: parsing "xxx": invalid syntax`)
+}
+
+func TestConfig_ConfigFileNotFound(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	configPath := filepath.Join(temp, "config.yaml") // 存在しないファイル
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"user",
+		"--config", configPath,
+		"-d", temp,
+	})
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	// OSによってエラーメッセージが異なるのでファイル名部分だけチェック
+	expect := "open " + configPath
+	assert.Contains(t, err.Error(), expect)
+}
+
+func TestConfig_InvalidEnvValue(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	setupTestUserMaildir(t, temp)
+
+	t.Setenv("MAILDIR_STATS_USER_FOLDER", "xxx")
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"user",
+		"-d", temp,
+	})
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, `environment variable MAILDIR_STATS_USER_FOLDER: invalid argument "xxx" for "-f, --folder" flag: strconv.ParseBool: parsing "xxx": invalid syntax`)
+}
+
+func TestEnvName(t *testing.T) {
+
+	assert.Equal(t, "MAILDIR_STATS_ALL_MAIL_DIR", envName("all", "mail-dir"))
+	assert.Equal(t, "MAILDIR_STATS_USER_LIST_SIZE_LOWER", envName("user-list", "size-lower"))
+}
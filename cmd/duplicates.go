@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/dustin/go-humanize"
+	"github.com/olekukonko/tablewriter"
+	"github.com/onozaty/maildir-stats/maildir"
+	"github.com/spf13/cobra"
+)
+
+func newDuplicatesCmd() *cobra.Command {
+
+	subCmd := &cobra.Command{
+		Use:   "duplicates",
+		Short: "Report duplicate mails across folders",
+		RunE: func(cmd *cobra.Command, args []string) error {
+
+			maildirPath, _ := cmd.Flags().GetString("dir")
+
+			keyType := maildir.MessageIDKey
+			if contentHash, _ := cmd.Flags().GetBool("content-hash"); contentHash {
+				keyType = maildir.ContentHashKey
+			}
+
+			inboxFolderName, _ := cmd.Flags().GetString("inbox-name")
+
+			// 引数の解析に成功した時点で、エラーが起きてもUsageは表示しない
+			cmd.SilenceUsage = true
+
+			return runDuplicatesReport(maildirPath, keyType, inboxFolderName, cmd.OutOrStdout())
+		},
+	}
+
+	subCmd.Flags().StringP("dir", "d", "", "User maildir path.")
+	subCmd.MarkFlagRequired("dir")
+
+	subCmd.Flags().BoolP("content-hash", "", false, "Detect duplicates by content hash instead of Message-ID.")
+	subCmd.Flags().StringP("inbox-name", "", "", "The name of the inbox folder. (default \"\")")
+
+	return subCmd
+}
+
+func runDuplicatesReport(maildirPath string, keyType maildir.DuplicateKeyType, inboxFolderName string, writer io.Writer) error {
+
+	duplicateAggregator := maildir.NewDuplicateAggregator(keyType)
+
+	if err := maildir.AggregateMailFolders(maildirPath, inboxFolderName, duplicateAggregator); err != nil {
+		return err
+	}
+	if err := duplicateAggregator.Err(); err != nil {
+		return err
+	}
+
+	groups := duplicateAggregator.Results()
+	pairResults := duplicateAggregator.FolderPairResults()
+
+	// Summary
+	duplicateCount := int64(0)
+	reclaimableSize := int64(0)
+	for _, result := range pairResults {
+		duplicateCount += result.Count
+		reclaimableSize += result.TotalSize
+	}
+
+	fmt.Fprintf(writer, "[Summary]\n")
+	fmt.Fprintf(writer, "Number of duplicate groups : %s\n", humanize.Comma(int64(len(groups))))
+	fmt.Fprintf(writer, "Number of duplicate mails  : %s\n", humanize.Comma(duplicateCount))
+	fmt.Fprintf(writer, "Reclaimable size           : %s byte\n", humanize.Comma(reclaimableSize))
+	fmt.Fprintf(writer, "\n")
+
+	if len(groups) == 0 {
+		return nil
+	}
+
+	// Folder pair
+	fmt.Fprintf(writer, "[Folder pair]\n")
+	table := tablewriter.NewWriter(writer)
+	table.SetAutoFormatHeaders(false)
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetColumnAlignment([]int{tablewriter.ALIGN_LEFT, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT})
+	table.SetBorder(false)
+	table.SetHeader([]string{"Folder", "Duplicate folder", "Number of mails", "Reclaimable size(byte)"})
+
+	for _, result := range pairResults {
+		table.Append(
+			[]string{result.MailFolderName, result.DuplicateMailFolderName, humanize.Comma(result.Count), humanize.Comma(result.TotalSize)})
+	}
+
+	table.Render()
+	fmt.Fprintf(writer, "\n")
+
+	// Duplicates
+	// 各グループの先頭が残すメールで、それ以降が重複
+	fmt.Fprintf(writer, "[Duplicates]\n")
+	for _, group := range groups {
+		fmt.Fprintf(writer, "%s\n", group.Key)
+		for _, mail := range group.Mails {
+			fmt.Fprintf(writer, "  %s\n", mail.Path)
+		}
+	}
+	fmt.Fprintf(writer, "\n")
+
+	return nil
+}
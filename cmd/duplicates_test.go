@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDuplicatesCmd(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	setupTestDuplicatesMaildir(t, temp)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"duplicates",
+		"-d", temp,
+		"--inbox-name", "INBOX",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	result := buf.String()
+	expected := `[Summary]
+Number of duplicate groups : 2
+Number of duplicate mails  : 3
+Reclaimable size           : 108 byte
+
+[Folder pair]
+  Folder | Duplicate folder | Number of mails | Reclaimable size(byte)  
+---------+------------------+-----------------+-------------------------
+  INBOX  | Archive          |               1 |                     36  
+  INBOX  | Sent             |               2 |                     72  
+
+[Duplicates]
+message-id:<a@example.com>
+  ` + filepath.Join(temp, "cur", "1") + `
+  ` + filepath.Join(temp, ".Sent", "cur", "1") + `
+message-id:<b@example.com>
+  ` + filepath.Join(temp, "cur", "2") + `
+  ` + filepath.Join(temp, ".Archive", "cur", "1") + `
+  ` + filepath.Join(temp, ".Sent", "cur", "2") + `
+
+`
+	assert.Equal(t, expected, result)
+}
+
+func TestDuplicatesCmd_ContentHash(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	setupTestDuplicatesMaildir(t, temp)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"duplicates",
+		"-d", temp,
+		"--content-hash",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	result := buf.String()
+	expected := `[Summary]
+Number of duplicate groups : 1
+Number of duplicate mails  : 2
+Reclaimable size           : 72 byte
+
+[Folder pair]
+  Folder | Duplicate folder | Number of mails | Reclaimable size(byte)  
+---------+------------------+-----------------+-------------------------
+         | Archive          |               1 |                     36  
+         | Sent             |               1 |                     36  
+
+[Duplicates]
+sha256:4d9cda150afc399e7cb3fe8605fc3049ddc99297f5f05c20e3dfec70cd168f2c
+  ` + filepath.Join(temp, "cur", "2") + `
+  ` + filepath.Join(temp, ".Archive", "cur", "1") + `
+  ` + filepath.Join(temp, ".Sent", "cur", "2") + `
+
+`
+	assert.Equal(t, expected, result)
+}
+
+func TestDuplicatesCmd_NoDuplicate(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	setupTestUserMaildir(t, temp)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"duplicates",
+		"-d", temp,
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	result := buf.String()
+	expected := `[Summary]
+Number of duplicate groups : 0
+Number of duplicate mails  : 0
+Reclaimable size           : 0 byte
+
+`
+	assert.Equal(t, expected, result)
+}
+
+func TestDuplicatesCmd_MaildirNotFound(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	maildir := filepath.Join(temp, "xxx") // 存在しないディレクトリ
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"duplicates",
+		"-d", maildir,
+	})
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	// OSによってエラーメッセージが異なるのでファイル名部分だけチェック
+	expect := "open " + maildir
+	assert.Contains(t, err.Error(), expect)
+}
+
+func setupTestDuplicatesMaildir(t *testing.T, rootMailFolderPath string) {
+
+	// INBOX
+	createMailFolder(t, rootMailFolderPath, []mail{})
+	createFile(t, filepath.Join(rootMailFolderPath, "cur", "1"), "Message-ID: <a@example.com>\r\n\r\nbody1")
+	createFile(t, filepath.Join(rootMailFolderPath, "cur", "2"), "Message-ID: <b@example.com>\r\n\r\nbody2")
+
+	// その他フォルダ
+	{
+		sub := createDir(t, rootMailFolderPath, ".Archive")
+		createMailFolder(t, sub, []mail{})
+		createFile(t, filepath.Join(sub, "cur", "1"), "Message-ID: <b@example.com>\r\n\r\nbody2")
+	}
+	{
+		sub := createDir(t, rootMailFolderPath, ".Sent")
+		createMailFolder(t, sub, []mail{})
+		createFile(t, filepath.Join(sub, "cur", "1"), "Message-ID: <a@example.com>\r\n\r\nbody9") // 内容は異なる
+		createFile(t, filepath.Join(sub, "cur", "2"), "Message-ID: <b@example.com>\r\n\r\nbody2")
+	}
+}
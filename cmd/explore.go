@@ -0,0 +1,965 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/olekukonko/tablewriter"
+	"github.com/onozaty/maildir-stats/maildir"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// 端末の制御シーケンス
+const (
+	clearScreen     = "\033[H\033[2J"
+	enterAltScreen  = "\033[?1049h\033[?25l" // 代替画面に切り替えて、カーソルを隠す
+	exitAltScreen   = "\033[?25h\033[?1049l"
+	reverseVideo    = "\033[7m"
+	resetAttributes = "\033[0m"
+)
+
+// 比率のバーの幅
+const exploreBarWidth = 10
+
+// 画面の最後に表示するキーの説明
+const exploreKeysLine = "↑↓:move Enter:open Backspace:back n/c/s:sort r:rescan e:errors ?:help q:quit"
+
+func newExploreCmd() *cobra.Command {
+
+	subCmd := &cobra.Command{
+		Use:   "explore",
+		Short: "Browse usage by user, folder, year, month and message in a terminal UI",
+		RunE: func(cmd *cobra.Command, args []string) error {
+
+			maildirName, _ := cmd.Flags().GetString("mail-dir")
+			mailSpoolPath, _ := cmd.Flags().GetString("mail-spool")
+
+			sortCondition, err := getSortCondition(cmd.Flags(), "sort")
+			if err != nil { // 許可されていなパラメータの可能性あり
+				return err
+			}
+
+			errorPolicy, err := getErrorPolicy(cmd.Flags(), "on-error")
+			if err != nil { // 許可されていなパラメータの可能性あり
+				return err
+			}
+
+			storageFormat, err := getStorageFormat(cmd.Flags(), "format-in")
+			if err != nil { // 許可されていなパラメータの可能性あり
+				return err
+			}
+
+			inboxFolderName, _ := cmd.Flags().GetString("inbox-name")
+			top, _ := cmd.Flags().GetInt("top")
+
+			// 引数の解析に成功した時点で、エラーが起きてもUsageは表示しない
+			cmd.SilenceUsage = true
+
+			users, err := loadPasswd(passwdPath)
+			if err != nil {
+				return err
+			}
+
+			explorer := newExplorer(
+				maildir.UserMailboxes(users, maildirName, mailSpoolPath, storageFormat),
+				inboxFolderName,
+				errorPolicy,
+				sortCondition,
+				top)
+
+			return explorer.run(cmd.InOrStdin(), cmd.OutOrStdout())
+		},
+	}
+
+	subCmd.Flags().StringP("mail-dir", "d", "", "User maildir name. (directory of mbox files with --format-in mbox, dbox root with --format-in dbox)")
+	subCmd.MarkFlagRequired("mail-dir")
+	subCmd.Flags().StringP("sort", "", "size-desc", "Initial sorting condition.\ncan be specified: name-asc, name-desc, count-asc, count-desc, size-asc, size-desc")
+	subCmd.Flags().IntP("top", "", 20, "Number of largest messages to list in a month.")
+	subCmd.Flags().StringP("on-error", "", "fail", "Behavior when a mail folder cannot be read.\ncan be specified: fail, warn, skip")
+	subCmd.Flags().StringP("format-in", "", "maildir", "Format of the mailbox.\ncan be specified: maildir, mbox, dbox, auto")
+	subCmd.Flags().StringP("mail-spool", "", "/var/spool/mail", "Mail spool directory of inbox mbox files. (used with --format-in mbox, auto)")
+	subCmd.Flags().StringP("inbox-name", "", "", "The name of the inbox folder. (default \"\")")
+
+	return subCmd
+}
+
+// ユーザ -> フォルダ -> 年 -> 月 -> メール の順に掘り下げて表示する
+type explorer struct {
+	mailboxes       []maildir.UserMailbox
+	inboxFolderName string
+	errorPolicy     ErrorPolicy
+	sortCondition   SortCondition
+	top             int
+
+	userResults   []*maildir.AggregateResult
+	folderResults map[string][]*maildir.AggregateResult // ユーザ毎のフォルダ
+	errors        []*maildir.AggregateError
+
+	path     []string                // 表示中の階層(ユーザ、フォルダ、年、月の名前)
+	mails    []*maildir.SelectedMail // 表示中のフォルダのメール(フォルダを開いた時に読み込む)
+	selected int                     // 表示中の一覧で選択している位置
+	offset   int                     // 表示中の一覧で、画面の先頭に表示している位置
+	message  string                  // 次の画面に表示するメッセージ
+}
+
+// 画面に表示する一覧
+type exploreList struct {
+	nameTitle string
+	results   []*maildir.AggregateResult
+	mails     map[*maildir.AggregateResult]*maildir.SelectedMail // メールの一覧の場合のみ
+}
+
+func newExplorer(mailboxes []maildir.UserMailbox, inboxFolderName string, errorPolicy ErrorPolicy, sortCondition SortCondition, top int) *explorer {
+	return &explorer{
+		mailboxes:       mailboxes,
+		inboxFolderName: inboxFolderName,
+		errorPolicy:     errorPolicy,
+		sortCondition:   sortCondition,
+		top:             top,
+		userResults:     []*maildir.AggregateResult{},
+		folderResults:   map[string][]*maildir.AggregateResult{},
+		errors:          []*maildir.AggregateError{},
+	}
+}
+
+// キーを1つずつ読み込んで、画面を更新する
+// 端末の場合はrawモードにして、Enterを待たずにキーを受け付ける
+// (端末以外からの入力も、同じキーの並びとして読み込む)
+func (e *explorer) run(reader io.Reader, writer io.Writer) error {
+
+	// 最初の集計に失敗した場合は表示するものが無いので終了
+	if err := e.scan(e.mailboxes); err != nil {
+		return err
+	}
+
+	screen, err := openExploreScreen(reader, writer)
+	if err != nil {
+		return err
+	}
+	defer screen.close()
+
+	keys := bufio.NewReader(reader)
+	for {
+		screen.draw(e.render(screen.height(), screen.interactive))
+
+		key, err := readExploreKey(keys)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if quit := e.execute(key); quit {
+			return nil
+		}
+	}
+}
+
+// キー(操作)
+type exploreKey int
+
+const (
+	exploreKeyNone exploreKey = iota
+	exploreKeyUp
+	exploreKeyDown
+	exploreKeyPageUp
+	exploreKeyPageDown
+	exploreKeyHome
+	exploreKeyEnd
+	exploreKeyOpen
+	exploreKeyBack
+	exploreKeySortName
+	exploreKeySortCount
+	exploreKeySortSize
+	exploreKeyRescan
+	exploreKeyErrors
+	exploreKeyHelp
+	exploreKeyQuit
+)
+
+// 1キー分を読み込んで操作にする
+// 矢印キーなどは、ESC [ (もしくは ESC O) で始まるエスケープシーケンスで送られてくる
+func readExploreKey(reader *bufio.Reader) (exploreKey, error) {
+
+	b, err := reader.ReadByte()
+	if err != nil {
+		return exploreKeyNone, err
+	}
+
+	switch b {
+	case '\033':
+		return readExploreEscapeKey(reader)
+	case '\r', '\n', 'l':
+		return exploreKeyOpen, nil
+	case 0x7f, 0x08, 'h', 'b':
+		return exploreKeyBack, nil
+	case 'k':
+		return exploreKeyUp, nil
+	case 'j':
+		return exploreKeyDown, nil
+	case 'g':
+		return exploreKeyHome, nil
+	case 'G':
+		return exploreKeyEnd, nil
+	case 'n':
+		return exploreKeySortName, nil
+	case 'c':
+		return exploreKeySortCount, nil
+	case 's':
+		return exploreKeySortSize, nil
+	case 'r':
+		return exploreKeyRescan, nil
+	case 'e':
+		return exploreKeyErrors, nil
+	case '?':
+		return exploreKeyHelp, nil
+	case 'q', 0x03: // rawモードではCtrl+Cもキーとして届く
+		return exploreKeyQuit, nil
+	default:
+		return exploreKeyNone, nil
+	}
+}
+
+func readExploreEscapeKey(reader *bufio.Reader) (exploreKey, error) {
+
+	// ESCだけが押された場合は、続きが届いていない
+	if reader.Buffered() == 0 {
+		return exploreKeyNone, nil
+	}
+
+	b, err := reader.ReadByte()
+	if err != nil {
+		return exploreKeyNone, err
+	}
+	if b != '[' && b != 'O' {
+		return exploreKeyNone, nil
+	}
+
+	// パラメータ(数字など)に続く、最後の文字(0x40-0x7e)で種類が決まる
+	params := []byte{}
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return exploreKeyNone, err
+		}
+		if b < 0x40 || b > 0x7e {
+			params = append(params, b)
+			continue
+		}
+
+		switch b {
+		case 'A':
+			return exploreKeyUp, nil
+		case 'B':
+			return exploreKeyDown, nil
+		case 'C':
+			return exploreKeyOpen, nil
+		case 'D':
+			return exploreKeyBack, nil
+		case 'H':
+			return exploreKeyHome, nil
+		case 'F':
+			return exploreKeyEnd, nil
+		case '~':
+			switch string(params) {
+			case "1", "7":
+				return exploreKeyHome, nil
+			case "4", "8":
+				return exploreKeyEnd, nil
+			case "5":
+				return exploreKeyPageUp, nil
+			case "6":
+				return exploreKeyPageDown, nil
+			}
+		}
+		return exploreKeyNone, nil
+	}
+}
+
+// 操作を実行し、終了する場合はtrueを返す
+func (e *explorer) execute(key exploreKey) bool {
+
+	switch key {
+	case exploreKeyQuit:
+		return true
+	case exploreKeyUp:
+		e.move(-1)
+	case exploreKeyDown:
+		e.move(1)
+	case exploreKeyPageUp:
+		e.move(-exploreScrollPage)
+	case exploreKeyPageDown:
+		e.move(exploreScrollPage)
+	case exploreKeyHome:
+		e.selected = 0
+	case exploreKeyEnd:
+		e.selected = len(e.list().results) - 1
+	case exploreKeyOpen:
+		e.open()
+	case exploreKeyBack:
+		e.back()
+	case exploreKeySortName:
+		e.toggleSort(NameAsc, NameDesc)
+	case exploreKeySortCount:
+		e.toggleSort(CountDesc, CountAsc)
+	case exploreKeySortSize:
+		e.toggleSort(SizeDesc, SizeAsc)
+	case exploreKeyRescan:
+		e.rescan()
+	case exploreKeyErrors:
+		e.showErrors()
+	case exploreKeyHelp:
+		e.message = exploreHelp
+	}
+
+	e.clampSelected()
+	return false
+}
+
+// PageUp、PageDownで移動する行数
+const exploreScrollPage = 10
+
+const exploreHelp = `Keys:
+  Up, Down, k, j        select the entry
+  PageUp, PageDown      select the entry 10 lines up or down
+  Home, End, g, G       select the first or last entry
+  Enter, Right, l       open the entry (show the path of the message in the message list)
+  Backspace, Left, h, b go back to the parent
+  n                     sort by name (again to reverse)
+  c                     sort by number of mails (again to reverse)
+  s                     sort by size (again to reverse)
+  r                     rescan the selected user (in the user list) or the user or folder being viewed
+  e                     show errors
+  q, Ctrl+C             quit`
+
+func (e *explorer) move(delta int) {
+	e.selected += delta
+}
+
+func (e *explorer) clampSelected() {
+
+	count := len(e.list().results)
+	if e.selected >= count {
+		e.selected = count - 1
+	}
+	if e.selected < 0 {
+		e.selected = 0
+	}
+}
+
+func (e *explorer) toggleSort(first SortCondition, second SortCondition) {
+
+	// 並び替えても、選択しているものはそのままに
+	name, ok := e.selectedName()
+
+	if e.sortCondition == first {
+		e.sortCondition = second
+	} else {
+		e.sortCondition = first
+	}
+
+	if ok {
+		e.selectName(name)
+	}
+}
+
+func (e *explorer) open() {
+
+	list := e.list()
+	if len(list.results) == 0 {
+		return
+	}
+	result := list.results[e.selected]
+
+	if list.mails != nil {
+		// メールより下の階層は無いので、場所を表示する
+		mail := list.mails[result]
+		e.message = fmt.Sprintf("Path: %s", mail.Path)
+		return
+	}
+
+	e.path = append(e.path, result.Name)
+	if len(e.path) == 2 {
+		// フォルダを開いた時に、そのフォルダのメールを読み込む
+		if err := e.scanFolder(); err != nil {
+			e.path = e.path[:1]
+			e.message = fmt.Sprintf("Error: %s", err)
+			return
+		}
+		if e.mails == nil {
+			e.path = e.path[:1]
+			e.message = fmt.Sprintf("Folder %s is not found. (r to rescan)", result.Name)
+			return
+		}
+	}
+
+	e.selected = 0
+	e.offset = 0
+}
+
+func (e *explorer) back() {
+
+	if len(e.path) == 0 {
+		return
+	}
+
+	// 戻った一覧では、開いていたものを選択する
+	name := e.path[len(e.path)-1]
+
+	e.path = e.path[:len(e.path)-1]
+	if len(e.path) < 2 {
+		e.mails = nil
+	}
+
+	e.offset = 0
+	e.selectName(name)
+}
+
+// 集計し直すのは、ユーザの一覧では選択中のユーザ、ユーザの画面ではそのユーザ、フォルダ以下の画面ではそのフォルダのみ
+func (e *explorer) rescan() {
+
+	name, selected := e.selectedName()
+
+	switch len(e.path) {
+	case 0:
+		if !selected {
+			return
+		}
+		if err := e.rescanUser(name); err != nil {
+			e.message = fmt.Sprintf("Error: %s", err)
+			return
+		}
+		e.message = fmt.Sprintf("Rescanned %s.", name)
+	case 1:
+		if err := e.rescanUser(e.path[0]); err != nil {
+			e.message = fmt.Sprintf("Error: %s", err)
+			return
+		}
+		e.message = fmt.Sprintf("Rescanned %s.", e.path[0])
+	default:
+		found, err := e.rescanFolder()
+		if err != nil {
+			e.message = fmt.Sprintf("Error: %s", err)
+			return
+		}
+		if !found {
+			e.message = fmt.Sprintf("Folder %s is not found.", e.path[1])
+		} else {
+			e.message = fmt.Sprintf("Rescanned %s/%s.", e.path[0], e.path[1])
+		}
+	}
+
+	// 集計し直した結果、無くなったものを開いている場合はその親まで戻る
+	for len(e.path) > 0 && !e.exists(e.path) {
+		e.back()
+	}
+
+	if selected {
+		e.selectName(name)
+	}
+}
+
+func (e *explorer) rescanUser(userName string) error {
+
+	mailbox, ok := e.mailboxOf(userName)
+	if !ok {
+		return fmt.Errorf("mailbox of %s is not found", userName)
+	}
+
+	return e.scan([]maildir.UserMailbox{mailbox})
+}
+
+// 開いているフォルダのメールを読み込み直し、そのフォルダとユーザの集計結果を更新する
+// フォルダが無くなっていた場合はfalseを返す
+func (e *explorer) rescanFolder() (bool, error) {
+
+	userName := e.path[0]
+	folderName := e.path[1]
+
+	if err := e.scanFolder(); err != nil {
+		return false, err
+	}
+
+	folderResults := []*maildir.AggregateResult{}
+	for _, result := range e.folderResults[userName] {
+		if result.Name != folderName {
+			folderResults = append(folderResults, result)
+		}
+	}
+
+	if e.mails != nil {
+		folderResult := &maildir.AggregateResult{Name: folderName}
+		for _, mail := range e.mails {
+			folderResult.Count++
+			folderResult.TotalSize += mail.Size
+		}
+		folderResults = append(folderResults, folderResult)
+	}
+	e.folderResults[userName] = folderResults
+
+	// ユーザの集計結果は、フォルダの合計
+	for _, result := range e.userResults {
+		if result.Name == userName {
+			result.Count = 0
+			result.TotalSize = 0
+			for _, folderResult := range folderResults {
+				result.Count += folderResult.Count
+				result.TotalSize += folderResult.TotalSize
+			}
+		}
+	}
+
+	return e.mails != nil, nil
+}
+
+func (e *explorer) showErrors() {
+
+	if len(e.errors) == 0 {
+		e.message = "No errors."
+		return
+	}
+
+	lines := []string{"Errors:"}
+	for _, err := range e.errors {
+		lines = append(lines, fmt.Sprintf("  %s", err.Error()))
+	}
+	e.message = strings.Join(lines, "\n")
+}
+
+// ユーザ毎、ユーザのフォルダ毎の集計
+// 既に集計済みのユーザは、結果を置き換える
+func (e *explorer) scan(mailboxes []maildir.UserMailbox) error {
+
+	userAggregator := maildir.NewUserAggregator()
+	userFolderAggregator := maildir.NewPerUserAggregator(maildir.NewFolderAggregator)
+
+	errorCollector := newErrorCollector(e.errorPolicy)
+	err := maildir.AggregateUserMailboxesWithErrorHandler(
+		mailboxes,
+		e.inboxFolderName,
+		maildir.NewMultiAggregator([]maildir.Aggregator{userAggregator, userFolderAggregator}),
+		errorCollector.handle)
+	if err != nil {
+		return err
+	}
+
+	scanned := map[string]bool{}
+	for _, result := range userAggregator.Results() {
+		scanned[result.Name] = true
+	}
+
+	userResults := []*maildir.AggregateResult{}
+	for _, result := range e.userResults {
+		if !scanned[result.Name] {
+			userResults = append(userResults, result)
+		}
+	}
+	e.userResults = append(userResults, userAggregator.Results()...)
+
+	for _, perUserResult := range userFolderAggregator.Results() {
+		e.folderResults[perUserResult.UserName] = perUserResult.Aggregator.Results()
+	}
+
+	e.replaceErrors(func(err *maildir.AggregateError) bool {
+		return scanned[err.UserName]
+	}, errorCollector.errors)
+
+	return nil
+}
+
+// 開いているフォルダのメールを読み込む(そのフォルダのみを辿る)
+// フォルダが無くなっていた場合は、メールをnilとする
+func (e *explorer) scanFolder() error {
+
+	userName := e.path[0]
+	folderName := e.path[1]
+
+	mailbox, ok := e.mailboxOf(userName)
+	if !ok {
+		return fmt.Errorf("mailbox of %s is not found", userName)
+	}
+
+	selectAggregator := maildir.NewSelectAggregator(maildir.SelectCondition{
+		MailFolderNames: []string{folderName},
+	})
+
+	errorCollector := newErrorCollector(e.errorPolicy)
+	err := maildir.AggregateUserMailboxesWithErrorHandler(
+		[]maildir.UserMailbox{mailbox},
+		e.inboxFolderName,
+		selectAggregator,
+		errorCollector.handle)
+	if err != nil {
+		return err
+	}
+
+	e.replaceErrors(func(err *maildir.AggregateError) bool {
+		return err.UserName == userName && err.MailFolderName == folderName
+	}, errorCollector.errors)
+
+	e.mails = nil
+	if len(selectAggregator.MailFolderNames()) > 0 {
+		e.mails = selectAggregator.Results()
+	}
+	return nil
+}
+
+// 集計し直した対象のエラーを置き換える
+func (e *explorer) replaceErrors(rescanned func(err *maildir.AggregateError) bool, errors []*maildir.AggregateError) {
+
+	remaining := []*maildir.AggregateError{}
+	for _, err := range e.errors {
+		if !rescanned(err) {
+			remaining = append(remaining, err)
+		}
+	}
+	e.errors = append(remaining, errors...)
+}
+
+func (e *explorer) mailboxOf(userName string) (maildir.UserMailbox, bool) {
+
+	for _, mailbox := range e.mailboxes {
+		if mailbox.UserName == userName {
+			return mailbox, true
+		}
+	}
+	return maildir.UserMailbox{}, false
+}
+
+// 階層の最後の要素が、その親の一覧に含まれるか
+// (フォルダ以下の階層は、フォルダのメールが読み込めているか)
+func (e *explorer) exists(path []string) bool {
+
+	if len(path) >= 2 && e.mails == nil {
+		return false
+	}
+
+	saved := e.path
+	e.path = path[:len(path)-1]
+	defer func() { e.path = saved }()
+
+	for _, result := range e.list().results {
+		if result.Name == path[len(path)-1] {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *explorer) selectedName() (string, bool) {
+
+	results := e.list().results
+	if e.selected < 0 || e.selected >= len(results) {
+		return "", false
+	}
+	return results[e.selected].Name, true
+}
+
+// 名前で選択する(無い場合は、選択位置をそのままにする)
+func (e *explorer) selectName(name string) {
+
+	for i, result := range e.list().results {
+		if result.Name == name {
+			e.selected = i
+			return
+		}
+	}
+	e.clampSelected()
+}
+
+// 表示中の階層の一覧
+func (e *explorer) list() *exploreList {
+
+	switch len(e.path) {
+	case 0:
+		return &exploreList{nameTitle: "User", results: e.sorted(e.userResults)}
+	case 1:
+		return &exploreList{nameTitle: "Folder", results: e.sorted(e.folderResults[e.path[0]])}
+	case 2:
+		return &exploreList{nameTitle: "Year", results: e.sorted(maildir.YearResultsOf(e.mails))}
+	case 3:
+		return &exploreList{nameTitle: "Month", results: e.sorted(maildir.MonthResultsOf(maildir.YearMailsOf(e.mails, e.path[2])))}
+	default:
+		// サイズの大きいものから指定件数
+		mails := maildir.MonthMailsOf(e.mails, e.path[3])
+		results := []*maildir.AggregateResult{}
+		mailByResult := map[*maildir.AggregateResult]*maildir.SelectedMail{}
+		for _, mail := range mails {
+			result := &maildir.AggregateResult{Name: filepath.Base(mail.Path), Count: 1, TotalSize: mail.Size}
+			results = append(results, result)
+			mailByResult[result] = mail
+		}
+
+		sortResults(results, SizeDesc)
+		if e.top > 0 && len(results) > e.top {
+			results = results[:e.top]
+		}
+
+		return &exploreList{nameTitle: "Message", results: e.sorted(results), mails: mailByResult}
+	}
+}
+
+func (e *explorer) sorted(results []*maildir.AggregateResult) []*maildir.AggregateResult {
+
+	sortedResults := append([]*maildir.AggregateResult{}, results...)
+	sortResults(sortedResults, e.sortCondition)
+	return sortedResults
+}
+
+// 画面の内容
+// heightは端末の行数で、一覧が収まらない場合は選択している位置が表示されるようにスクロールする(0の場合は全て表示)
+// highlightがtrueの場合は、選択している行を反転表示する
+func (e *explorer) render(height int, highlight bool) string {
+
+	list := e.list()
+
+	totalCount := int64(0)
+	totalSize := int64(0)
+	maxSize := int64(0)
+	for _, result := range list.results {
+		totalCount += result.Count
+		totalSize += result.TotalSize
+		if result.TotalSize > maxSize {
+			maxSize = result.TotalSize
+		}
+	}
+
+	header := new(strings.Builder)
+	fmt.Fprintf(header, "[%s]\n", e.location())
+	fmt.Fprintf(header, "Number of mails : %s\n", humanize.Comma(totalCount))
+	fmt.Fprintf(header, "Total size      : %s byte\n", humanize.Comma(totalSize))
+	fmt.Fprintf(header, "Sort            : %s\n", sortConditionName(e.sortCondition))
+	if len(e.errors) > 0 {
+		fmt.Fprintf(header, "Errors          : %s (e to show)\n", humanize.Comma(int64(len(e.errors))))
+	}
+	fmt.Fprintf(header, "\n")
+
+	footer := new(strings.Builder)
+	fmt.Fprintf(footer, "\n")
+	if e.message != "" {
+		fmt.Fprintf(footer, "%s\n\n", e.message)
+		e.message = ""
+	}
+	fmt.Fprintf(footer, "%s\n", exploreKeysLine)
+
+	tableBuffer := new(bytes.Buffer)
+	table := tablewriter.NewWriter(tableBuffer)
+	table.SetAutoFormatHeaders(false)
+	table.SetAutoWrapText(false)
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetBorder(false)
+
+	if list.mails != nil {
+		table.SetColumnAlignment([]int{tablewriter.ALIGN_LEFT, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_LEFT})
+		table.SetHeader([]string{"", list.nameTitle, "Received", "Size(byte)", "Ratio", ""})
+	} else {
+		table.SetColumnAlignment([]int{tablewriter.ALIGN_LEFT, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_LEFT})
+		table.SetHeader([]string{"", list.nameTitle, "Number of mails", "Total size(byte)", "Ratio", ""})
+	}
+
+	for i, result := range list.results {
+		ratio := float64(0)
+		if totalSize > 0 {
+			ratio = float64(result.TotalSize) / float64(totalSize) * 100
+		}
+
+		// バーは最大のものに対する比率
+		bar := strings.Repeat(" ", exploreBarWidth)
+		if maxSize > 0 {
+			length := int(result.TotalSize * exploreBarWidth / maxSize)
+			bar = strings.Repeat("#", length) + strings.Repeat(" ", exploreBarWidth-length)
+		}
+
+		cursor := ""
+		if i == e.selected {
+			cursor = ">"
+		}
+
+		if list.mails != nil {
+			mail := list.mails[result]
+			table.Append([]string{cursor, result.Name, formatExploreTime(mail.Time), humanize.Comma(result.TotalSize), fmt.Sprintf("%.1f%%", ratio), "[" + bar + "]"})
+		} else {
+			table.Append([]string{cursor, exploreName(result.Name, len(e.path)), humanize.Comma(result.Count), humanize.Comma(result.TotalSize), fmt.Sprintf("%.1f%%", ratio), "[" + bar + "]"})
+		}
+	}
+	table.Render()
+
+	// 見出しと区切りの2行に続いて、1件1行
+	tableLines := strings.Split(strings.TrimSuffix(tableBuffer.String(), "\n"), "\n")
+	rowLines := tableLines[2:]
+
+	// 画面に収まる行数だけ表示する
+	rows := len(rowLines)
+	position := ""
+	if height > 0 {
+		available := height - strings.Count(header.String(), "\n") - 2 - strings.Count(footer.String(), "\n")
+		if len(rowLines) > available {
+			// 表示している範囲の分
+			available--
+			if available < 1 {
+				available = 1
+			}
+			rows = available
+		}
+	}
+
+	if e.selected < e.offset {
+		e.offset = e.selected
+	}
+	if e.selected >= e.offset+rows {
+		e.offset = e.selected - rows + 1
+	}
+	if e.offset > len(rowLines)-rows {
+		e.offset = len(rowLines) - rows
+	}
+	if e.offset < 0 {
+		e.offset = 0
+	}
+	if rows < len(rowLines) {
+		position = fmt.Sprintf("  (%d-%d of %d)\n", e.offset+1, e.offset+rows, len(rowLines))
+	}
+
+	screen := new(strings.Builder)
+	screen.WriteString(header.String())
+	screen.WriteString(tableLines[0] + "\n")
+	screen.WriteString(tableLines[1] + "\n")
+	for i, line := range rowLines[e.offset : e.offset+rows] {
+		if highlight && e.offset+i == e.selected {
+			line = reverseVideo + line + resetAttributes
+		}
+		screen.WriteString(line + "\n")
+	}
+	screen.WriteString(position)
+	screen.WriteString(footer.String())
+
+	return screen.String()
+}
+
+// 表示中の階層 (例: /user1/INBOX/2023/2023-01)
+func (e *explorer) location() string {
+
+	names := []string{}
+	for i, name := range e.path {
+		names = append(names, exploreName(name, i))
+	}
+	return "/" + strings.Join(names, "/")
+}
+
+// 年、月の名前が空のもの(受信日時が不明)は、分かるように表示する
+func exploreName(name string, level int) string {
+
+	if name == "" && level >= 2 {
+		return "(unknown)"
+	}
+	return name
+}
+
+func formatExploreTime(time time.Time) string {
+
+	if time.Unix() == 0 {
+		return "(unknown)"
+	}
+	return time.Format("2006-01-02 15:04:05")
+}
+
+func sortConditionName(sortCondition SortCondition) string {
+
+	switch sortCondition {
+	case NameAsc:
+		return "name-asc"
+	case NameDesc:
+		return "name-desc"
+	case CountAsc:
+		return "count-asc"
+	case CountDesc:
+		return "count-desc"
+	case SizeAsc:
+		return "size-asc"
+	default:
+		return "size-desc"
+	}
+}
+
+// exploreの画面
+// 出力先が端末の場合は、代替画面に切り替えて全画面で表示する
+// 入力が端末の場合は、rawモードにして1キーずつ読み込めるようにする
+type exploreScreen struct {
+	writer      io.Writer
+	interactive bool        // 出力先が端末
+	outputFd    int         // 出力先が端末の場合の、端末の大きさを取得するためのもの
+	input       *os.File    // 入力が端末の場合のみ
+	state       *term.State // rawモードにする前の状態
+}
+
+func openExploreScreen(reader io.Reader, writer io.Writer) (*exploreScreen, error) {
+
+	screen := &exploreScreen{
+		writer:      writer,
+		interactive: isTerminal(writer),
+	}
+
+	if screen.interactive {
+		screen.outputFd = int(writer.(*os.File).Fd())
+	}
+
+	if file, ok := reader.(*os.File); ok && term.IsTerminal(int(file.Fd())) {
+		state, err := term.MakeRaw(int(file.Fd()))
+		if err != nil {
+			return nil, err
+		}
+		screen.input = file
+		screen.state = state
+	}
+
+	if screen.interactive {
+		fmt.Fprint(writer, enterAltScreen)
+	}
+
+	return screen, nil
+}
+
+func (s *exploreScreen) close() {
+
+	if s.interactive {
+		fmt.Fprint(s.writer, exitAltScreen)
+	}
+	if s.state != nil {
+		term.Restore(int(s.input.Fd()), s.state)
+	}
+}
+
+// 端末の行数(端末以外は0)
+func (s *exploreScreen) height() int {
+
+	if !s.interactive {
+		return 0
+	}
+
+	_, height, err := term.GetSize(s.outputFd)
+	if err != nil {
+		return 0
+	}
+	return height
+}
+
+func (s *exploreScreen) draw(content string) {
+
+	if s.state != nil {
+		// rawモードでは改行で行頭に戻らない
+		content = strings.ReplaceAll(content, "\n", "\r\n")
+	}
+	if s.interactive {
+		content = clearScreen + content
+	}
+
+	fmt.Fprint(s.writer, content)
+}
@@ -0,0 +1,438 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/onozaty/maildir-stats/maildir"
+	"github.com/onozaty/maildir-stats/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExploreCmd(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	maildir := "Maildir"
+
+	users := setupTestAllMaildir(t, temp, maildir)
+
+	// テスト用にメソッド差し替え
+	loadPasswd = func(passwdPath string) ([]user.User, error) {
+		return users, nil
+	}
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"explore",
+		"-d", maildir,
+		"--inbox-name", "INBOX",
+	})
+	// user1 -> A -> 2023 -> 2023-01 -> メールのパス表示 -> 戻る
+	rootCmd.SetIn(strings.NewReader("jj\r" + "j\r" + "\r" + "\033[B\r" + "\r" + "\x7f" + "q"))
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	screens := splitExploreScreens(buf.String())
+	require.Len(t, screens, 11)
+
+	assert.Equal(t, `[/]
+Number of mails : 11
+Total size      : 6,321 byte
+Sort            : size-desc
+
+    | User  | Number of mails | Total size(byte) | Ratio |               
+----+-------+-----------------+------------------+-------+---------------
+  > | user3 |               3 |            6,000 | 94.9% | [##########]  
+    | user2 |               2 |              300 |  4.7% | [          ]  
+    | user1 |               6 |               21 |  0.3% | [          ]  
+    | user4 |               0 |                0 |  0.0% | [          ]  
+
+`, screens[0])
+
+	assert.Equal(t, `[/]
+Number of mails : 11
+Total size      : 6,321 byte
+Sort            : size-desc
+
+    | User  | Number of mails | Total size(byte) | Ratio |               
+----+-------+-----------------+------------------+-------+---------------
+    | user3 |               3 |            6,000 | 94.9% | [##########]  
+    | user2 |               2 |              300 |  4.7% | [          ]  
+  > | user1 |               6 |               21 |  0.3% | [          ]  
+    | user4 |               0 |                0 |  0.0% | [          ]  
+
+`, screens[2])
+
+	assert.Equal(t, `[/user1]
+Number of mails : 6
+Total size      : 21 byte
+Sort            : size-desc
+
+    | Folder | Number of mails | Total size(byte) | Ratio |               
+----+--------+-----------------+------------------+-------+---------------
+  > | B      |               2 |               11 | 52.4% | [##########]  
+    | A      |               2 |                7 | 33.3% | [######    ]  
+    | INBOX  |               2 |                3 | 14.3% | [##        ]  
+
+`, screens[3])
+
+	assert.Equal(t, `[/user1/A]
+Number of mails : 2
+Total size      : 7 byte
+Sort            : size-desc
+
+    | Year | Number of mails | Total size(byte) | Ratio  |               
+----+------+-----------------+------------------+--------+---------------
+  > | 2023 |               2 |                7 | 100.0% | [##########]  
+
+`, screens[5])
+
+	assert.Equal(t, `[/user1/A/2023]
+Number of mails : 2
+Total size      : 7 byte
+Sort            : size-desc
+
+    | Month   | Number of mails | Total size(byte) | Ratio |               
+----+---------+-----------------+------------------+-------+---------------
+    | 2023-02 |               1 |                4 | 57.1% | [##########]  
+  > | 2023-01 |               1 |                3 | 42.9% | [#######   ]  
+
+`, screens[7])
+
+	assert.Equal(t, `[/user1/A/2023/2023-01]
+Number of mails : 1
+Total size      : 3 byte
+Sort            : size-desc
+
+    | Message    | Received            | Size(byte) | Ratio  |               
+----+------------+---------------------+------------+--------+---------------
+  > | 1672531200 | 2023-01-01 00:00:00 |          3 | 100.0% | [##########]  
+
+`, screens[8])
+
+	assert.Contains(t, screens[9], "Path: "+filepath.Join(temp, "user1", maildir, ".A", "new", "1672531200")+"\n")
+
+	// 戻った時は、開いていたものが選択されている
+	assert.True(t, strings.HasPrefix(screens[10], "[/user1/A/2023]\n"))
+	assert.Contains(t, screens[10], "  > | 2023-01 |")
+}
+
+func TestExploreCmd_Sort(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	maildir := "Maildir"
+
+	users := setupTestAllMaildir(t, temp, maildir)
+
+	// テスト用にメソッド差し替え
+	loadPasswd = func(passwdPath string) ([]user.User, error) {
+		return users, nil
+	}
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"explore",
+		"-d", maildir,
+		"--sort", "name-desc",
+	})
+	// user2を選択してから並び替え
+	rootCmd.SetIn(strings.NewReader("jj" + "nnccss"))
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	screens := splitExploreScreens(buf.String())
+	require.Len(t, screens, 9)
+
+	tests := []struct {
+		sort  string
+		users []string
+	}{
+		{"name-desc", []string{"user4", "user3", "user2", "user1"}},
+		{"name-asc", []string{"user1", "user2", "user3", "user4"}},
+		{"name-desc", []string{"user4", "user3", "user2", "user1"}},
+		{"count-desc", []string{"user1", "user3", "user2", "user4"}},
+		{"count-asc", []string{"user4", "user2", "user3", "user1"}},
+		{"size-desc", []string{"user3", "user2", "user1", "user4"}},
+		{"size-asc", []string{"user4", "user1", "user2", "user3"}},
+	}
+
+	for i, tt := range tests {
+		screen := screens[i+2]
+		assert.Contains(t, screen, "Sort            : "+tt.sort+"\n")
+
+		for j, userName := range tt.users {
+			// 並び替えても、選択しているものは変わらない
+			cursor := " "
+			if userName == "user2" {
+				cursor = ">"
+			}
+			assert.Contains(t, screen, fmt.Sprintf("  %s | %s |", cursor, userName), "row %d", j)
+		}
+
+		rows := regexp.MustCompile(`\| (user\d) \|`).FindAllStringSubmatch(screen, -1)
+		require.Len(t, rows, len(tt.users))
+		for j, userName := range tt.users {
+			assert.Equal(t, userName, rows[j][1])
+		}
+	}
+}
+
+func TestExploreCmd_Rescan(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	maildir := "Maildir"
+
+	users := setupTestAllMaildir(t, temp, maildir)
+
+	// テスト用にメソッド差し替え
+	loadPasswd = func(passwdPath string) ([]user.User, error) {
+		return users, nil
+	}
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"explore",
+		"-d", maildir,
+		"--sort", "name-asc",
+	})
+
+	// 画面を表示した後に、メールを追加、フォルダを削除してから再集計
+	reader, writer := io.Pipe()
+	rootCmd.SetIn(reader)
+
+	buf := &syncBuffer{}
+	rootCmd.SetOutput(buf)
+
+	done := make(chan error)
+	go func() {
+		done <- rootCmd.Execute()
+	}()
+
+	// user1 -> B
+	fmt.Fprint(writer, "\r"+"jj\r")
+	waitForScreens(t, buf, 5)
+
+	// ACT
+	// 開いているフォルダのみ集計し直す(INBOXに追加したものは反映されない)
+	createFile(t, filepath.Join(temp, "user1", maildir, ".B", "cur", "1675209600"), strings.Repeat("x", 100))
+	createFile(t, filepath.Join(temp, "user1", maildir, "cur", "1675209600"), strings.Repeat("x", 50))
+	fmt.Fprint(writer, "r")
+	waitForScreens(t, buf, 6)
+
+	// 開いているフォルダが無くなった
+	require.NoError(t, os.RemoveAll(filepath.Join(temp, "user1", maildir, ".B")))
+	fmt.Fprint(writer, "r")
+	waitForScreens(t, buf, 7)
+
+	// ユーザの一覧では、選択しているユーザ(user1)のみ集計し直す
+	createFile(t, filepath.Join(temp, "user2", maildir, "cur", "1675209600"), strings.Repeat("x", 1000))
+	fmt.Fprint(writer, "\x7f"+"r"+"q")
+	err := <-done
+
+	// ASSERT
+	require.NoError(t, err)
+
+	screens := splitExploreScreens(buf.String())
+	require.Len(t, screens, 9)
+
+	assert.Equal(t, `[/user1/B]
+Number of mails : 3
+Total size      : 111 byte
+Sort            : name-asc
+
+    | Year | Number of mails | Total size(byte) | Ratio |               
+----+------+-----------------+------------------+-------+---------------
+  > | 2022 |               2 |               11 |  9.9% | [#         ]  
+    | 2023 |               1 |              100 | 90.1% | [##########]  
+
+Rescanned user1/B.
+
+`, screens[5])
+
+	// 開いていたフォルダが無くなったので、ユーザの画面に戻る
+	assert.Equal(t, `[/user1]
+Number of mails : 4
+Total size      : 10 byte
+Sort            : name-asc
+
+    | Folder | Number of mails | Total size(byte) | Ratio |               
+----+--------+-----------------+------------------+-------+---------------
+  > |        |               2 |                3 | 30.0% | [####      ]  
+    | A      |               2 |                7 | 70.0% | [##########]  
+
+Folder B is not found.
+
+`, screens[6])
+
+	assert.Equal(t, `[/]
+Number of mails : 10
+Total size      : 6,360 byte
+Sort            : name-asc
+
+    | User  | Number of mails | Total size(byte) | Ratio |               
+----+-------+-----------------+------------------+-------+---------------
+  > | user1 |               5 |               60 |  0.9% | [          ]  
+    | user2 |               2 |              300 |  4.7% | [          ]  
+    | user3 |               3 |            6,000 | 94.3% | [##########]  
+    | user4 |               0 |                0 |  0.0% | [          ]  
+
+Rescanned user1.
+
+`, screens[8])
+}
+
+func TestExploreCmd_Scroll(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	maildirName := "Maildir"
+
+	users := setupTestAllMaildir(t, temp, maildirName)
+
+	explorer := newExplorer(
+		maildir.UserMailboxes(users, maildirName, "", maildir.MaildirStorage),
+		"",
+		ErrorFail,
+		NameAsc,
+		20)
+	require.NoError(t, explorer.scan(explorer.mailboxes))
+
+	// ACT
+	// 見出しの5行、表の見出しの2行、キーの説明の2行に、2件と範囲の1行
+	explorer.execute(exploreKeyEnd)
+	screen := explorer.render(12, false)
+
+	// ASSERT
+	assert.Equal(t, `[/]
+Number of mails : 11
+Total size      : 6,321 byte
+Sort            : name-asc
+
+    | User  | Number of mails | Total size(byte) | Ratio |               
+----+-------+-----------------+------------------+-------+---------------
+    | user3 |               3 |            6,000 | 94.9% | [##########]  
+  > | user4 |               0 |                0 |  0.0% | [          ]  
+  (3-4 of 4)
+
+`+exploreKeysLine+"\n", screen)
+}
+
+func TestReadExploreKey(t *testing.T) {
+
+	tests := []struct {
+		input string
+		keys  []exploreKey
+	}{
+		{"\033[A\033[B\033[C\033[D", []exploreKey{exploreKeyUp, exploreKeyDown, exploreKeyOpen, exploreKeyBack}},
+		{"\033OA\033OB\033OH\033OF", []exploreKey{exploreKeyUp, exploreKeyDown, exploreKeyHome, exploreKeyEnd}},
+		{"\033[5~\033[6~\033[1~\033[4~", []exploreKey{exploreKeyPageUp, exploreKeyPageDown, exploreKeyHome, exploreKeyEnd}},
+		{"kjgG", []exploreKey{exploreKeyUp, exploreKeyDown, exploreKeyHome, exploreKeyEnd}},
+		{"\r\nl", []exploreKey{exploreKeyOpen, exploreKeyOpen, exploreKeyOpen}},
+		{"\x7f\x08hb", []exploreKey{exploreKeyBack, exploreKeyBack, exploreKeyBack, exploreKeyBack}},
+		{"ncsre?", []exploreKey{exploreKeySortName, exploreKeySortCount, exploreKeySortSize, exploreKeyRescan, exploreKeyErrors, exploreKeyHelp}},
+		{"q\x03", []exploreKey{exploreKeyQuit, exploreKeyQuit}},
+		{"x\033[2~\033", []exploreKey{exploreKeyNone, exploreKeyNone, exploreKeyNone}},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%q", tt.input), func(t *testing.T) {
+
+			// ARRANGE
+			reader := bufio.NewReader(strings.NewReader(tt.input))
+
+			// ACT
+			keys := []exploreKey{}
+			for {
+				key, err := readExploreKey(reader)
+				if err == io.EOF {
+					break
+				}
+				require.NoError(t, err)
+				keys = append(keys, key)
+			}
+
+			// ASSERT
+			assert.Equal(t, tt.keys, keys)
+		})
+	}
+}
+
+func TestExploreCmd_InvalidSort(t *testing.T) {
+
+	// ARRANGE
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"explore",
+		"-d", "Maildir",
+		"--sort", "xxx",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "invalid sort condition 'xxx'")
+}
+
+// 別のgoroutineから書き込まれるので、排他して読み書きする
+type syncBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.String()
+}
+
+// 指定した数の画面が表示されるまで待つ
+func waitForScreens(t *testing.T, buf *syncBuffer, count int) {
+
+	require.Eventually(t, func() bool {
+		return strings.Count(buf.String(), exploreKeysLine+"\n") >= count
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+// 画面毎に分ける(各画面の最後のキーの説明は除く)
+func splitExploreScreens(output string) []string {
+
+	screens := strings.Split(output, exploreKeysLine+"\n")
+	return screens[:len(screens)-1]
+}
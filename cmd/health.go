@@ -0,0 +1,196 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/olekukonko/tablewriter"
+	"github.com/onozaty/maildir-stats/maildir"
+	"github.com/spf13/cobra"
+)
+
+func newHealthCmd() *cobra.Command {
+
+	subCmd := &cobra.Command{
+		Use:   "health",
+		Short: "Report stale tmp files and unexpected entries in maildirs",
+		RunE: func(cmd *cobra.Command, args []string) error {
+
+			maildirPath, _ := cmd.Flags().GetString("dir")
+			maildirName, _ := cmd.Flags().GetString("mail-dir")
+			if (maildirPath == "") == (maildirName == "") {
+				return fmt.Errorf("either --dir or --mail-dir must be specified")
+			}
+
+			tmpOlderThanStr, _ := cmd.Flags().GetString("tmp-older-than")
+			tmpOlderThan, err := parseAge(tmpOlderThanStr)
+			if err != nil {
+				return err
+			}
+
+			inboxFolderName, _ := cmd.Flags().GetString("inbox-name")
+
+			// 引数の解析に成功した時点で、エラーが起きてもUsageは表示しない
+			cmd.SilenceUsage = true
+
+			staleBefore := time.Now().Add(-tmpOlderThan)
+			if maildirPath != "" {
+				return runUserHealth(maildirPath, inboxFolderName, staleBefore, cmd.OutOrStdout())
+			}
+			return runAllHealth(maildirName, inboxFolderName, staleBefore, cmd.OutOrStdout())
+		},
+	}
+
+	subCmd.Flags().StringP("dir", "d", "", "User maildir path. (check a single user)")
+	subCmd.Flags().StringP("mail-dir", "", "", "User maildir name. (check all users in /etc/passwd)")
+	subCmd.Flags().StringP("tmp-older-than", "", "36h", "Report files in tmp older than this. (e.g. 36h, 7d)")
+	subCmd.Flags().StringP("inbox-name", "", "", "The name of the inbox folder. (default \"\")")
+
+	return subCmd
+}
+
+func runUserHealth(maildirPath string, inboxFolderName string, staleBefore time.Time, writer io.Writer) error {
+
+	issues, err := maildir.CheckMaildirHealth("", maildirPath, inboxFolderName, staleBefore)
+	if err != nil {
+		return err
+	}
+
+	printHealthReport(writer, issues, false)
+	return nil
+}
+
+func runAllHealth(maildirName string, inboxFolderName string, staleBefore time.Time, writer io.Writer) error {
+
+	users, err := loadPasswd(passwdPath)
+	if err != nil {
+		return err
+	}
+
+	issues := []*maildir.HealthIssue{}
+	for _, mailbox := range maildir.UserMailboxes(users, maildirName, "", maildir.MaildirStorage) {
+		userIssues, err := maildir.CheckMaildirHealth(mailbox.UserName, mailbox.Mailbox.MaildirPath, inboxFolderName, staleBefore)
+		if err != nil {
+			return err
+		}
+		issues = append(issues, userIssues...)
+	}
+
+	printHealthReport(writer, issues, true)
+	return nil
+}
+
+func printHealthReport(writer io.Writer, issues []*maildir.HealthIssue, withUser bool) {
+
+	issuesByKind := map[maildir.HealthIssueKind][]*maildir.HealthIssue{}
+	staleTmpSize := int64(0)
+	for _, issue := range issues {
+		issuesByKind[issue.Kind] = append(issuesByKind[issue.Kind], issue)
+		if issue.Kind == maildir.StaleTmpFile {
+			staleTmpSize += issue.Size
+		}
+	}
+
+	// Summary
+	fmt.Fprintf(writer, "[Summary]\n")
+	fmt.Fprintf(writer, "Number of stale tmp files  : %s\n", humanize.Comma(int64(len(issuesByKind[maildir.StaleTmpFile]))))
+	fmt.Fprintf(writer, "Size of stale tmp files    : %s byte\n", humanize.Comma(staleTmpSize))
+	fmt.Fprintf(writer, "Number of malformed names  : %s\n", humanize.Comma(int64(len(issuesByKind[maildir.MalformedName]))))
+	fmt.Fprintf(writer, "Number of non-file entries : %s\n", humanize.Comma(int64(len(issuesByKind[maildir.NonFileEntry]))))
+	fmt.Fprintf(writer, "\n")
+
+	// Stale tmp files
+	// ユーザ、フォルダ毎の件数とサイズ
+	if staleTmpIssues := issuesByKind[maildir.StaleTmpFile]; len(staleTmpIssues) > 0 {
+		fmt.Fprintf(writer, "[Stale tmp files]\n")
+
+		type key struct{ userName, mailFolderName string }
+		keys := []key{}
+		counts := map[key]int64{}
+		sizes := map[key]int64{}
+		for _, issue := range staleTmpIssues {
+			k := key{issue.UserName, issue.MailFolderName}
+			if _, ok := counts[k]; !ok {
+				keys = append(keys, k)
+			}
+			counts[k]++
+			sizes[k] += issue.Size
+		}
+
+		table := newHealthTable(writer, withUser, []string{"Folder", "Number of files", "Total size(byte)"})
+		if withUser {
+			table.SetColumnAlignment([]int{tablewriter.ALIGN_LEFT, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT})
+		} else {
+			table.SetColumnAlignment([]int{tablewriter.ALIGN_LEFT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT})
+		}
+		for _, k := range keys {
+			appendHealthRow(table, withUser, k.userName, []string{k.mailFolderName, humanize.Comma(counts[k]), humanize.Comma(sizes[k])})
+		}
+		table.Render()
+		fmt.Fprintf(writer, "\n")
+	}
+
+	// Malformed names
+	if malformedIssues := issuesByKind[maildir.MalformedName]; len(malformedIssues) > 0 {
+		fmt.Fprintf(writer, "[Malformed names]\n")
+
+		table := newHealthTable(writer, withUser, []string{"Folder", "Path"})
+		for _, issue := range malformedIssues {
+			appendHealthRow(table, withUser, issue.UserName, []string{issue.MailFolderName, issue.Path})
+		}
+		table.Render()
+		fmt.Fprintf(writer, "\n")
+	}
+
+	// Non-file entries
+	if nonFileIssues := issuesByKind[maildir.NonFileEntry]; len(nonFileIssues) > 0 {
+		fmt.Fprintf(writer, "[Non-file entries]\n")
+
+		table := newHealthTable(writer, withUser, []string{"Folder", "Path", "Type"})
+		for _, issue := range nonFileIssues {
+			appendHealthRow(table, withUser, issue.UserName, []string{issue.MailFolderName, issue.Path, fileTypeName(issue.Mode)})
+		}
+		table.Render()
+		fmt.Fprintf(writer, "\n")
+	}
+}
+
+func newHealthTable(writer io.Writer, withUser bool, header []string) *tablewriter.Table {
+
+	table := tablewriter.NewWriter(writer)
+	table.SetAutoFormatHeaders(false)
+	table.SetAutoWrapText(false)
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetBorder(false)
+
+	if withUser {
+		header = append([]string{"User"}, header...)
+	}
+	table.SetHeader(header)
+
+	return table
+}
+
+func appendHealthRow(table *tablewriter.Table, withUser bool, userName string, row []string) {
+
+	if withUser {
+		row = append([]string{userName}, row...)
+	}
+	table.Append(row)
+}
+
+func fileTypeName(mode os.FileMode) string {
+
+	switch {
+	case mode.IsDir():
+		return "directory"
+	case mode&os.ModeSymlink != 0:
+		return "symlink"
+	default:
+		return "other"
+	}
+}
@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/onozaty/maildir-stats/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthCmd(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	setupTestHealthMaildir(t, temp)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"health",
+		"-d", temp,
+		"--inbox-name", "INBOX",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	malformedPath := filepath.Join(temp, "cur", "mail.txt")
+	nonFilePath := filepath.Join(temp, "new", "1678060800.M5.host")
+
+	result := buf.String()
+	expected := `[Summary]
+Number of stale tmp files  : 3
+Size of stale tmp files    : 1,003 byte
+Number of malformed names  : 1
+Number of non-file entries : 1
+
+[Stale tmp files]
+  Folder | Number of files | Total size(byte)  
+---------+-----------------+-------------------
+  INBOX  |               2 |                3  
+  Sent   |               1 |            1,000  
+
+[Malformed names]
+  Folder | Path` + strings.Repeat(" ", len(malformedPath)-4) + `  
+---------+` + strings.Repeat("-", len(malformedPath)+3) + `
+  INBOX  | ` + malformedPath + `  
+
+[Non-file entries]
+  Folder | Path` + strings.Repeat(" ", len(nonFilePath)-4) + ` | Type       
+---------+` + strings.Repeat("-", len(nonFilePath)+2) + `+------------
+  INBOX  | ` + nonFilePath + ` | directory  
+
+`
+	assert.Equal(t, expected, result)
+}
+
+func TestHealthCmd_TmpOlderThan(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	setupTestHealthMaildir(t, temp)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"health",
+		"-d", temp,
+		"--tmp-older-than", "3d",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), "Number of stale tmp files  : 1\nSize of stale tmp files    : 1,000 byte\n")
+}
+
+func TestHealthCmd_AllUsers(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	users := []user.User{}
+	for _, userName := range []string{"user1", "user2", "user3"} {
+		homeDir := createDir(t, temp, userName)
+		users = append(users, user.User{Name: userName, HomeDir: homeDir})
+	}
+	setupTestHealthMaildir(t, createDir(t, users[0].HomeDir, "Maildir"))
+	{
+		maildir := createDir(t, users[1].HomeDir, "Maildir")
+		createMailFolder(t, maildir, []mail{})
+		createFile(t, filepath.Join(maildir, "cur", "1678060800.M1.host:2,S"), "1")
+	}
+	// user3はMaildir無し
+
+	// テスト用にメソッド差し替え
+	loadPasswd = func(passwdPath string) ([]user.User, error) {
+		return users, nil
+	}
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"health",
+		"--mail-dir", "Maildir",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	result := buf.String()
+	expected := `[Summary]
+Number of stale tmp files  : 3
+Size of stale tmp files    : 1,003 byte
+Number of malformed names  : 1
+Number of non-file entries : 1
+
+[Stale tmp files]
+  User  | Folder | Number of files | Total size(byte)  
+--------+--------+-----------------+-------------------
+  user1 |        |               2 |                3  
+  user1 | Sent   |               1 |            1,000  
+
+`
+	assert.Contains(t, result, expected)
+	assert.Contains(t, result, "  user1 |        | "+filepath.Join(users[0].HomeDir, "Maildir", "cur", "mail.txt"))
+}
+
+func TestHealthCmd_DirAndMailDir(t *testing.T) {
+
+	// ARRANGE
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"health",
+		"-d", "/home/user1/Maildir",
+		"--mail-dir", "Maildir",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "either --dir or --mail-dir must be specified")
+}
+
+func TestHealthCmd_InvalidTmpOlderThan(t *testing.T) {
+
+	// ARRANGE
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"health",
+		"-d", "/home/user1/Maildir",
+		"--tmp-older-than", "xx",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "invalid age 'xx'")
+}
+
+func setupTestHealthMaildir(t *testing.T, rootMailFolderPath string) {
+
+	now := time.Now()
+	setModTime := func(path string, modTime time.Time) {
+		require.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+
+	// INBOX
+	createMailFolder(t, rootMailFolderPath, []mail{})
+	createFile(t, filepath.Join(rootMailFolderPath, "tmp", "1678060800.M1.host"), "1")
+	setModTime(filepath.Join(rootMailFolderPath, "tmp", "1678060800.M1.host"), now.Add(-48*time.Hour))
+	createFile(t, filepath.Join(rootMailFolderPath, "tmp", "1678060800.M2.host"), "12")
+	setModTime(filepath.Join(rootMailFolderPath, "tmp", "1678060800.M2.host"), now.Add(-40*time.Hour))
+	createFile(t, filepath.Join(rootMailFolderPath, "tmp", "1678060800.M3.host"), "123") // 配送中
+	createFile(t, filepath.Join(rootMailFolderPath, "cur", "1678060800.M4.host:2,S"), "1234")
+	createFile(t, filepath.Join(rootMailFolderPath, "cur", "mail.txt"), "12345")
+	createDir(t, filepath.Join(rootMailFolderPath, "new"), "1678060800.M5.host")
+
+	// その他フォルダ
+	{
+		sub := createDir(t, rootMailFolderPath, ".Sent")
+		createMailFolder(t, sub, []mail{})
+		createFile(t, filepath.Join(sub, "tmp", "1678060800.M6.host"), string(make([]byte, 1000)))
+		setModTime(filepath.Join(sub, "tmp", "1678060800.M6.host"), now.Add(-100*time.Hour))
+	}
+}
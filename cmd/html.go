@@ -0,0 +1,357 @@
+package cmd
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/onozaty/maildir-stats/maildir"
+)
+
+// 棒グラフに表示するユーザの数
+const htmlTopUsers = 10
+
+// HTMLレポートの内容
+type htmlReport struct {
+	GeneratedAt   string
+	Host          string
+	UserCount     int
+	Count         int64
+	TotalSize     int64
+	TopUsersChart *htmlBarChart
+	MonthChart    *htmlLineChart
+	Sections      []*htmlSection
+	Errors        []*maildir.AggregateError
+}
+
+// 集計結果の表
+type htmlSection struct {
+	Title     string
+	NameTitle string
+	Results   []*maildir.AggregateResult
+}
+
+// 横向きの棒グラフ(SVG)
+type htmlBarChart struct {
+	Width  int
+	Height int
+	Bars   []*htmlBar
+}
+
+type htmlBar struct {
+	Label string
+	Value string
+	Y     int
+	Width float64
+}
+
+// 折れ線グラフ(SVG)
+type htmlLineChart struct {
+	Width   int
+	Height  int
+	Left    int
+	Right   int
+	Top     int
+	Bottom  int
+	MaxSize string
+	Points  string
+	Dots    []*htmlDot
+}
+
+type htmlDot struct {
+	Label     string
+	Title     string // マウスオーバーで表示する内容
+	X         float64
+	Y         float64
+	ShowLabel bool // 軸にラベルを表示するか
+}
+
+// 1つのファイルで完結するHTML(外部のCSS、JSを参照しない)で出力する
+func printHtmlReport(
+	writer io.Writer,
+	condition allReportCondition,
+	userAggregator *maildir.UserAggregator,
+	yearAggregator *maildir.TimeAggregator,
+	monthAggregator *maildir.TimeAggregator,
+	senderAggregator *maildir.SenderAggregator,
+	senderDomainAggregator *maildir.SenderAggregator,
+	errors []*maildir.AggregateError,
+	generatedAt time.Time) {
+
+	host, _ := hostname()
+
+	report := &htmlReport{
+		GeneratedAt: generatedAt.Format("2006-01-02 15:04:05 MST"),
+		Host:        host,
+		Errors:      errors,
+	}
+
+	userResults := append([]*maildir.AggregateResult{}, userAggregator.Results()...)
+	report.UserCount = len(userResults)
+	for _, result := range userResults {
+		report.Count += result.Count
+		report.TotalSize += result.TotalSize
+	}
+
+	report.TopUsersChart = newHtmlBarChart(userResults)
+	report.MonthChart = newHtmlLineChart(monthAggregator.Results())
+
+	// 表は-u、-y、-mなどの指定に関わらず、集計しているものは全て出力する(グラフの元になるユーザ、月は常に集計している)
+	sortResults(userResults, condition.reportUserSortCondition)
+	report.Sections = append(report.Sections, &htmlSection{"User", "Name", userResults})
+
+	if yearAggregator != nil {
+		results := yearAggregator.Results()
+		sortResults(results, condition.reportYearSortCondition)
+		report.Sections = append(report.Sections, &htmlSection{"Year", "Year", results})
+	}
+
+	{
+		results := monthAggregator.Results()
+		sortResults(results, condition.reportMonthSortCondition)
+		report.Sections = append(report.Sections, &htmlSection{"Month", "Month", results})
+	}
+
+	for _, sender := range []struct {
+		title      string
+		nameTitle  string
+		aggregator *maildir.SenderAggregator
+	}{
+		{"Sender", "Sender", senderAggregator},
+		{"Sender domain", "Domain", senderDomainAggregator},
+	} {
+		if sender.aggregator == nil {
+			continue
+		}
+
+		results := sender.aggregator.Results()
+		sortResults(results, condition.reportSenderSortCondition)
+		if condition.reportSenderTop > 0 && len(results) > condition.reportSenderTop {
+			results = results[:condition.reportSenderTop]
+		}
+		report.Sections = append(report.Sections, &htmlSection{sender.title, sender.nameTitle, results})
+	}
+
+	// テンプレートは固定なので、エラーになるのは書き込みに失敗した場合のみ
+	htmlReportTemplate.Execute(writer, report)
+}
+
+// サイズの大きいユーザの棒グラフ
+func newHtmlBarChart(userResults []*maildir.AggregateResult) *htmlBarChart {
+
+	results := append([]*maildir.AggregateResult{}, userResults...)
+	sortResults(results, SizeDesc)
+	if len(results) > htmlTopUsers {
+		results = results[:htmlTopUsers]
+	}
+
+	const labelWidth = 160
+	const barWidth = 440
+	const rowHeight = 24
+
+	chart := &htmlBarChart{
+		Width:  labelWidth + barWidth + 100,
+		Height: len(results) * rowHeight,
+	}
+
+	maxSize := int64(0)
+	if len(results) > 0 {
+		maxSize = results[0].TotalSize
+	}
+
+	for i, result := range results {
+		width := float64(0)
+		if maxSize > 0 {
+			width = float64(result.TotalSize) / float64(maxSize) * barWidth
+		}
+
+		chart.Bars = append(chart.Bars, &htmlBar{
+			Label: result.Name,
+			Value: humanize.Bytes(uint64(result.TotalSize)),
+			Y:     i * rowHeight,
+			Width: width,
+		})
+	}
+
+	return chart
+}
+
+// 月毎のサイズの折れ線グラフ
+// 受信日時が分からないもの(月が空)は含めない
+func newHtmlLineChart(monthResults []*maildir.AggregateResult) *htmlLineChart {
+
+	results := []*maildir.AggregateResult{}
+	for _, result := range monthResults {
+		if result.Name != "" {
+			results = append(results, result)
+		}
+	}
+	maildir.SortByName(results)
+
+	chart := &htmlLineChart{
+		Width:  720,
+		Height: 240,
+		Left:   80,
+		Right:  700,
+		Top:    10,
+		Bottom: 210,
+	}
+
+	maxSize := int64(0)
+	for _, result := range results {
+		if result.TotalSize > maxSize {
+			maxSize = result.TotalSize
+		}
+	}
+	chart.MaxSize = humanize.Bytes(uint64(maxSize))
+
+	// 軸のラベルは最大12個程度に間引く
+	labelStep := (len(results) + 11) / 12
+
+	points := []string{}
+	for i, result := range results {
+		x := float64(chart.Left+chart.Right) / 2
+		if len(results) > 1 {
+			x = float64(chart.Left) + float64(chart.Right-chart.Left)*float64(i)/float64(len(results)-1)
+		}
+		y := float64(chart.Bottom)
+		if maxSize > 0 {
+			y = float64(chart.Bottom) - float64(chart.Bottom-chart.Top)*float64(result.TotalSize)/float64(maxSize)
+		}
+
+		points = append(points, fmt.Sprintf("%.1f,%.1f", x, y))
+		chart.Dots = append(chart.Dots, &htmlDot{
+			Label:     result.Name,
+			Title:     fmt.Sprintf("%s: %s mails, %s", result.Name, humanize.Comma(result.Count), humanize.Bytes(uint64(result.TotalSize))),
+			X:         x,
+			Y:         y,
+			ShowLabel: i%labelStep == 0,
+		})
+	}
+	chart.Points = strings.Join(points, " ")
+
+	return chart
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"comma": func(value int64) string {
+		return humanize.Comma(value)
+	},
+	"bytes": func(value int64) string {
+		return humanize.Bytes(uint64(value))
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>maildir-stats report{{if .Host}} - {{.Host}}{{end}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.6em; margin-bottom: 0.2em; }
+h2 { font-size: 1.2em; margin-top: 2em; border-bottom: 1px solid #ccc; padding-bottom: 0.2em; }
+.generated { color: #666; }
+.summary { display: flex; flex-wrap: wrap; gap: 1em; margin: 1.5em 0; }
+.summary div { border: 1px solid #ddd; border-radius: 6px; padding: 0.8em 1.2em; min-width: 10em; }
+.summary .label { color: #666; font-size: 0.85em; }
+.summary .value { font-size: 1.4em; font-weight: bold; }
+table { border-collapse: collapse; min-width: 30em; }
+th, td { padding: 0.3em 0.8em; border-bottom: 1px solid #eee; text-align: left; }
+th { cursor: pointer; user-select: none; background: #f6f6f6; }
+th[aria-sort="ascending"]::after { content: " \25B2"; }
+th[aria-sort="descending"]::after { content: " \25BC"; }
+.num { text-align: right; }
+svg text { font-size: 12px; fill: #333; }
+.bar { fill: #4a90d9; }
+.line { fill: none; stroke: #4a90d9; stroke-width: 2; }
+.dot { fill: #4a90d9; }
+.axis { stroke: #999; }
+</style>
+</head>
+<body>
+<h1>maildir-stats report</h1>
+<div class="generated">Generated at {{.GeneratedAt}}{{if .Host}} on {{.Host}}{{end}}</div>
+
+<div class="summary">
+<div><div class="label">Number of users</div><div class="value">{{.UserCount}}</div></div>
+<div><div class="label">Number of mails</div><div class="value">{{comma .Count}}</div></div>
+<div><div class="label">Total size</div><div class="value" title="{{comma .TotalSize}} byte">{{bytes .TotalSize}}</div></div>
+<div><div class="label">Errors</div><div class="value">{{len .Errors}}</div></div>
+</div>
+
+<h2>Top users by size</h2>
+{{with .TopUsersChart}}{{if .Bars}}<svg width="{{.Width}}" height="{{.Height}}" viewBox="0 0 {{.Width}} {{.Height}}">
+{{range .Bars}}<g transform="translate(0,{{.Y}})"><text x="0" y="16">{{.Label}}</text><rect class="bar" x="160" y="4" width="{{printf "%.1f" .Width}}" height="16"><title>{{.Label}}: {{.Value}}</title></rect><text x="{{printf "%.1f" .Width}}" dx="166" y="16">{{.Value}}</text></g>
+{{end}}</svg>{{else}}<p>No users.</p>{{end}}{{end}}
+
+<h2>Monthly volume</h2>
+{{with .MonthChart}}{{if .Dots}}<svg width="{{.Width}}" height="{{.Height}}" viewBox="0 0 {{.Width}} {{.Height}}">
+<line class="axis" x1="{{.Left}}" y1="{{.Top}}" x2="{{.Left}}" y2="{{.Bottom}}"/>
+<line class="axis" x1="{{.Left}}" y1="{{.Bottom}}" x2="{{.Right}}" y2="{{.Bottom}}"/>
+<text x="{{.Left}}" dx="-6" y="{{.Top}}" dy="10" text-anchor="end">{{.MaxSize}}</text>
+<text x="{{.Left}}" dx="-6" y="{{.Bottom}}" text-anchor="end">0</text>
+<polyline class="line" points="{{.Points}}"/>
+{{range .Dots}}<circle class="dot" cx="{{printf "%.1f" .X}}" cy="{{printf "%.1f" .Y}}" r="3"><title>{{.Title}}</title></circle>{{if .ShowLabel}}<text x="{{printf "%.1f" .X}}" y="228" text-anchor="middle">{{.Label}}</text>{{end}}
+{{end}}</svg>{{else}}<p>No mails with a known received time.</p>{{end}}{{end}}
+{{range .Sections}}
+<h2>{{.Title}}</h2>
+<table class="sortable">
+<thead><tr><th>{{.NameTitle}}</th><th class="num">Number of mails</th><th class="num">Total size(byte)</th></tr></thead>
+<tbody>
+{{range .Results}}<tr><td>{{.Name}}</td><td class="num" data-value="{{.Count}}">{{comma .Count}}</td><td class="num" data-value="{{.TotalSize}}">{{comma .TotalSize}}</td></tr>
+{{end}}</tbody>
+</table>
+{{end}}{{if .Errors}}
+<h2>Errors</h2>
+<table class="sortable">
+<thead><tr><th>User</th><th>Folder</th><th>Error</th></tr></thead>
+<tbody>
+{{range .Errors}}<tr><td>{{.UserName}}</td><td>{{.MailFolderName}}</td><td>{{.Err}}</td></tr>
+{{end}}</tbody>
+</table>
+{{end}}
+<script>
+(function () {
+  var tables = document.querySelectorAll("table.sortable");
+  for (var i = 0; i < tables.length; i++) {
+    var headers = tables[i].tHead.rows[0].cells;
+    for (var j = 0; j < headers.length; j++) {
+      headers[j].addEventListener("click", sortTable);
+    }
+  }
+
+  function sortTable(event) {
+    var header = event.currentTarget;
+    var table = header.closest("table");
+    var index = header.cellIndex;
+    var numeric = header.classList.contains("num");
+    var ascending = header.getAttribute("aria-sort") !== "ascending";
+
+    var headers = table.tHead.rows[0].cells;
+    for (var i = 0; i < headers.length; i++) {
+      headers[i].removeAttribute("aria-sort");
+    }
+    header.setAttribute("aria-sort", ascending ? "ascending" : "descending");
+
+    var tbody = table.tBodies[0];
+    var rows = Array.prototype.slice.call(tbody.rows);
+    rows.sort(function (a, b) {
+      var x = a.cells[index];
+      var y = b.cells[index];
+      var result = numeric
+        ? Number(x.getAttribute("data-value")) - Number(y.getAttribute("data-value"))
+        : x.textContent.localeCompare(y.textContent);
+      return ascending ? result : -result;
+    });
+    for (var i = 0; i < rows.length; i++) {
+      tbody.appendChild(rows[i]);
+    }
+  }
+})();
+</script>
+</body>
+</html>
+`))
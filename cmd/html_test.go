@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/onozaty/maildir-stats/maildir"
+	"github.com/onozaty/maildir-stats/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllCmd_Html(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	maildirName := "Maildir"
+
+	users := setupTestAllMaildir(t, temp, maildirName)
+
+	// テスト用にメソッド差し替え
+	loadPasswd = func(passwdPath string) ([]user.User, error) {
+		return users, nil
+	}
+	hostname = func() (string, error) {
+		return "mail01", nil
+	}
+	t.Cleanup(func() { hostname = os.Hostname })
+
+	outputPath := filepath.Join(t.TempDir(), "report.html")
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"all",
+		"-d", maildirName,
+		"-y",
+		"--sort-user", "size-desc",
+		"--format", "html",
+		"--output", outputPath,
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(t, "", buf.String())
+
+	content, err := os.ReadFile(outputPath)
+	require.NoError(t, err)
+	html := string(content)
+
+	assert.True(t, strings.HasPrefix(html, "<!DOCTYPE html>\n"))
+	// 外部のファイルは参照しない
+	assert.NotContains(t, html, "src=")
+	assert.NotContains(t, html, "href=")
+
+	// Summary
+	assert.Contains(t, html, "<title>maildir-stats report - mail01</title>")
+	assert.Contains(t, html, `<div class="label">Number of users</div><div class="value">4</div>`)
+	assert.Contains(t, html, `<div class="label">Number of mails</div><div class="value">11</div>`)
+	assert.Contains(t, html, `<div class="label">Total size</div><div class="value" title="6,321 byte">6.3 kB</div>`)
+	assert.Contains(t, html, `<div class="label">Errors</div><div class="value">0</div>`)
+
+	// 棒グラフはサイズの大きい順
+	assert.Contains(t, html, `<g transform="translate(0,0)"><text x="0" y="16">user3</text><rect class="bar" x="160" y="4" width="440.0" height="16"><title>user3: 6.0 kB</title></rect>`)
+	assert.Contains(t, html, `<g transform="translate(0,72)"><text x="0" y="16">user4</text><rect class="bar" x="160" y="4" width="0.0" height="16">`)
+
+	// 折れ線グラフは月の順
+	assert.Contains(t, html, `<title>2021-12: 2 mails, 300 B</title>`)
+	assert.Less(t, strings.Index(html, `<title>2021-12:`), strings.Index(html, `<title>2023-02:`))
+
+	// 表は-uの指定が無くてもユーザ、月は出力され、-yを指定した年も出力される
+	assert.Contains(t, html, "<h2>User</h2>")
+	assert.Contains(t, html, "<h2>Year</h2>")
+	assert.Contains(t, html, "<h2>Month</h2>")
+	assert.NotContains(t, html, "<h2>Sender</h2>")
+	assert.NotContains(t, html, "<h2>Errors</h2>")
+
+	// ユーザの表は--sort-userの順
+	assert.Contains(t, html, `<tr><td>user3</td><td class="num" data-value="3">3</td><td class="num" data-value="6000">6,000</td></tr>
+<tr><td>user2</td><td class="num" data-value="2">2</td><td class="num" data-value="300">300</td></tr>
+<tr><td>user1</td><td class="num" data-value="6">6</td><td class="num" data-value="21">21</td></tr>
+<tr><td>user4</td><td class="num" data-value="0">0</td><td class="num" data-value="0">0</td></tr>
+`)
+}
+
+func TestPrintHtmlReport_Escape(t *testing.T) {
+
+	// ARRANGE
+	hostname = func() (string, error) {
+		return "mail01", nil
+	}
+	t.Cleanup(func() { hostname = os.Hostname })
+
+	userAggregator := maildir.NewUserAggregator()
+	userAggregator.StartUser("<script>")
+
+	monthAggregator := maildir.NewMonthAggregator()
+
+	errors := []*maildir.AggregateError{
+		{UserName: "user1", MailFolderName: "A&B", Err: os.ErrPermission},
+	}
+
+	buf := new(bytes.Buffer)
+
+	// ACT
+	printHtmlReport(buf, allReportCondition{}, userAggregator, nil, monthAggregator, nil, nil, errors, time.Date(2023, 3, 1, 12, 34, 56, 0, time.UTC))
+
+	// ASSERT
+	html := buf.String()
+	assert.Contains(t, html, "Generated at 2023-03-01 12:34:56 UTC on mail01")
+	assert.Contains(t, html, "<tr><td>&lt;script&gt;</td>")
+	assert.NotContains(t, html, "<td><script>")
+	assert.Contains(t, html, "<h2>Errors</h2>")
+	assert.Contains(t, html, "<tr><td>user1</td><td>A&amp;B</td><td>permission denied</td></tr>")
+	assert.Contains(t, html, "<p>No mails with a known received time.</p>")
+}
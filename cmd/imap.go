@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/emersion/go-imap/client"
+	"github.com/onozaty/maildir-stats/maildir"
+	"github.com/spf13/cobra"
+)
+
+func newImapCmd() *cobra.Command {
+
+	subCmd := &cobra.Command{
+		Use:   "imap",
+		Short: "Report mailbox statistics on IMAP server",
+		RunE: func(cmd *cobra.Command, args []string) error {
+
+			server, _ := cmd.Flags().GetString("server")
+			userName, _ := cmd.Flags().GetString("user")
+			password, _ := cmd.Flags().GetString("password")
+
+			security, err := getConnectionSecurity(cmd.Flags(), "security")
+			if err != nil { // 許可されていなパラメータの可能性あり
+				return err
+			}
+			insecureSkipVerify, _ := cmd.Flags().GetBool("insecure-skip-verify")
+
+			reportFolder, _ := cmd.Flags().GetBool("folder")
+			reportFolderSortCondition, err := getSortCondition(cmd.Flags(), "sort-folder")
+			if err != nil { // 許可されていなパラメータの可能性あり
+				return err
+			}
+
+			reportYear, _ := cmd.Flags().GetBool("year")
+			reportYearSortCondition, err := getSortCondition(cmd.Flags(), "sort-year")
+			if err != nil { // 許可されていなパラメータの可能性あり
+				return err
+			}
+
+			reportMonth, _ := cmd.Flags().GetBool("month")
+			reportMonthSortCondition, err := getSortCondition(cmd.Flags(), "sort-month")
+			if err != nil { // 許可されていなパラメータの可能性あり
+				return err
+			}
+
+			inboxFolderName, _ := cmd.Flags().GetString("inbox-name")
+
+			errorPolicy, err := getErrorPolicy(cmd.Flags(), "on-error")
+			if err != nil { // 許可されていなパラメータの可能性あり
+				return err
+			}
+
+			// 引数の解析に成功した時点で、エラーが起きてもUsageは表示しない
+			cmd.SilenceUsage = true
+
+			return runImapReport(
+				imapConnection{
+					server:             server,
+					userName:           userName,
+					password:           password,
+					security:           security,
+					insecureSkipVerify: insecureSkipVerify,
+				},
+				imapReportCondition{
+					reportFolder:              reportFolder,
+					reportFolderSortCondition: reportFolderSortCondition,
+					reportYear:                reportYear,
+					reportYearSortCondition:   reportYearSortCondition,
+					reportMonth:               reportMonth,
+					reportMonthSortCondition:  reportMonthSortCondition,
+					errorPolicy:               errorPolicy,
+				},
+				inboxFolderName,
+				cmd.OutOrStdout())
+		},
+	}
+
+	subCmd.Flags().StringP("server", "s", "", "IMAP server address. (host:port)")
+	subCmd.MarkFlagRequired("server")
+	subCmd.Flags().StringP("user", "", "", "Login user name.")
+	subCmd.MarkFlagRequired("user")
+	subCmd.Flags().StringP("password", "", "", "Login password. (can also be specified by MAILDIR_STATS_IMAP_PASSWORD)")
+	subCmd.Flags().StringP("security", "", "tls", "Connection security.\ncan be specified: tls, starttls, none")
+	subCmd.Flags().BoolP("insecure-skip-verify", "", false, "Do not verify the server certificate.")
+
+	subCmd.Flags().BoolP("folder", "f", false, "Report by folder.")
+	subCmd.Flags().StringP("sort-folder", "", "name-asc", "Sorting condition for report by folder.\ncan be specified: name-asc, name-desc, count-asc, count-desc, size-asc, size-desc")
+	subCmd.Flags().BoolP("year", "y", false, "Report by year.")
+	subCmd.Flags().StringP("sort-year", "", "name-asc", "Sorting condition for report by year.\ncan be specified: name-asc, name-desc, count-asc, count-desc, size-asc, size-desc")
+	subCmd.Flags().BoolP("month", "m", false, "Report by month.")
+	subCmd.Flags().StringP("sort-month", "", "name-asc", "Sorting condition for report by month.\ncan be specified: name-asc, name-desc, count-asc, count-desc, size-asc, size-desc")
+
+	subCmd.Flags().StringP("inbox-name", "", "INBOX", "The name of the inbox folder.")
+	subCmd.Flags().StringP("on-error", "", "fail", "Behavior when a mail folder cannot be read.\ncan be specified: fail, warn, skip")
+
+	return subCmd
+}
+
+type imapConnection struct {
+	server             string
+	userName           string
+	password           string
+	security           ConnectionSecurity
+	insecureSkipVerify bool
+}
+
+type imapReportCondition struct {
+	reportFolder              bool
+	reportFolderSortCondition SortCondition
+	reportYear                bool
+	reportYearSortCondition   SortCondition
+	reportMonth               bool
+	reportMonthSortCondition  SortCondition
+	errorPolicy               ErrorPolicy
+}
+
+func runImapReport(connection imapConnection, condition imapReportCondition, inboxFolderName string, writer io.Writer) error {
+
+	c, err := connectImap(connection)
+	if err != nil {
+		return err
+	}
+	defer c.Logout()
+
+	// Summaryを集計するためにもFolderAggregatorはデフォルトで用意する
+	folderAggregator := maildir.NewFolderAggregator()
+	aggregators := []maildir.Aggregator{folderAggregator}
+
+	var yearAggregator *maildir.TimeAggregator
+	var monthAggregator *maildir.TimeAggregator
+
+	if condition.reportYear {
+		yearAggregator = maildir.NewYearAggregator()
+		aggregators = append(aggregators, yearAggregator)
+	}
+	if condition.reportMonth {
+		monthAggregator = maildir.NewMonthAggregator()
+		aggregators = append(aggregators, monthAggregator)
+	}
+
+	host, _, err := net.SplitHostPort(connection.server)
+	if err != nil {
+		host = connection.server
+	}
+
+	errorCollector := newErrorCollector(condition.errorPolicy)
+	store := maildir.NewImapStore(c, host, inboxFolderName)
+	if err := maildir.AggregateMailStoreWithErrorHandler(store, maildir.NewMultiAggregator(aggregators), errorCollector.handle); err != nil {
+		return err
+	}
+
+	// Summary
+	printSummaryReport(writer, folderAggregator.Results())
+	fmt.Fprintf(writer, "\n")
+
+	// Folder
+	if condition.reportFolder {
+		printFolderReport(writer, folderAggregator, condition.reportFolderSortCondition)
+		fmt.Fprintf(writer, "\n")
+	}
+
+	// Year
+	if condition.reportYear {
+		printYearReport(writer, yearAggregator, condition.reportYearSortCondition)
+		fmt.Fprintf(writer, "\n")
+	}
+
+	// Month
+	if condition.reportMonth {
+		printMonthReport(writer, monthAggregator, condition.reportMonthSortCondition)
+		fmt.Fprintf(writer, "\n")
+	}
+
+	// Errors
+	if errors := errorCollector.reportErrors(); len(errors) > 0 {
+		printErrorReport(writer, errors, false)
+		fmt.Fprintf(writer, "\n")
+	}
+
+	return errorCollector.result()
+}
+
+func connectImap(connection imapConnection) (*client.Client, error) {
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: connection.insecureSkipVerify}
+
+	var c *client.Client
+	var err error
+	if connection.security == SecurityTLS {
+		c, err = client.DialTLS(connection.server, tlsConfig)
+	} else {
+		c, err = client.Dial(connection.server)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if connection.security == SecurityStartTLS {
+		if err := c.StartTLS(tlsConfig); err != nil {
+			c.Logout()
+			return nil, err
+		}
+	}
+
+	if err := c.Login(connection.userName, connection.password); err != nil {
+		c.Logout()
+		return nil, err
+	}
+
+	return c, nil
+}
@@ -0,0 +1,194 @@
+package cmd
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImapCmd(t *testing.T) {
+
+	// ARRANGE
+	addr := startTestImapServer(t)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"imap",
+		"-s", addr,
+		"--user", "username",
+		"--password", "password",
+		"--security", "none",
+		"-f",
+		"-y",
+		"-m",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	result := buf.String()
+	expected := `[Summary]
+Number of mails : 4
+Total size      : 68 byte
+
+[Folder]
+  Name  | Number of mails | Total size(byte)  
+--------+-----------------+-------------------
+  INBOX |               2 |               38  
+  Sent  |               1 |               15  
+  あ    |               1 |               15  
+
+[Year]
+  Year | Number of mails | Total size(byte)  
+-------+-----------------+-------------------
+  2022 |               2 |               38  
+  2023 |               2 |               30  
+
+[Month]
+  Month   | Number of mails | Total size(byte)  
+----------+-----------------+-------------------
+  2022-01 |               1 |               18  
+  2022-02 |               1 |               20  
+  2023-03 |               2 |               30  
+
+`
+	assert.Equal(t, expected, result)
+}
+
+func TestImapCmd_PasswordEnv(t *testing.T) {
+
+	// ARRANGE
+	addr := startTestImapServer(t)
+	t.Setenv("MAILDIR_STATS_IMAP_PASSWORD", "password")
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"imap",
+		"-s", addr,
+		"--user", "username",
+		"--security", "none",
+		"--inbox-name", "受信箱",
+		"-f",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), "  受信箱 |               2 |               38  ")
+}
+
+func TestImapCmd_LoginFailed(t *testing.T) {
+
+	// ARRANGE
+	addr := startTestImapServer(t)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"imap",
+		"-s", addr,
+		"--user", "username",
+		"--password", "xxx",
+		"--security", "none",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "Bad username or password")
+}
+
+func TestImapCmd_InvalidSecurity(t *testing.T) {
+
+	// ARRANGE
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"imap",
+		"-s", "localhost:143",
+		"--user", "username",
+		"--security", "ssl",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "invalid security 'ssl'")
+}
+
+// go-imapのメモリ上のバックエンドでIMAPサーバを起動する
+func startTestImapServer(t *testing.T) string {
+
+	be := memory.New()
+	u, err := be.Login(nil, "username", "password")
+	require.NoError(t, err)
+
+	mailboxes := map[string][]struct {
+		date time.Time
+		body string
+	}{
+		"INBOX": {
+			{time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), "Subject: a\r\n\r\nbody"},
+			{time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC), "Subject: b\r\n\r\nbody b"},
+		},
+		"Sent": {
+			{time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC), "Subject: c\r\n\r\nc"},
+		},
+		"&MEI-": {
+			{time.Date(2023, 3, 2, 0, 0, 0, 0, time.UTC), "Subject: d\r\n\r\nd"},
+		},
+	}
+
+	// 初期状態で入っているメッセージは消しておく
+	inbox, err := u.GetMailbox("INBOX")
+	require.NoError(t, err)
+	inbox.(*memory.Mailbox).Messages = nil
+
+	for name, messages := range mailboxes {
+		if name != "INBOX" {
+			require.NoError(t, u.CreateMailbox(name))
+		}
+
+		mailbox, err := u.GetMailbox(name)
+		require.NoError(t, err)
+
+		for _, message := range messages {
+			require.NoError(t, mailbox.CreateMessage([]string{imap.SeenFlag}, message.date, bytes.NewBufferString(message.body)))
+		}
+	}
+
+	s := server.New(be)
+	s.AllowInsecureAuth = true
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	go s.Serve(listener)
+	t.Cleanup(func() { s.Close() })
+
+	return listener.Addr().String()
+}
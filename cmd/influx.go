@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/onozaty/maildir-stats/maildir"
+)
+
+// 時系列DB(InfluxDB、StatsD)向けの値
+type metricPoint struct {
+	measurement string      // user, folder, year, month
+	tags        [][2]string // タグ名と値
+	count       int64
+	size        int64
+}
+
+// ユーザ毎、ユーザのフォルダ毎、年、月の値
+func allMetricPoints(
+	userAggregator *maildir.UserAggregator,
+	userFolderAggregator *maildir.PerUserAggregator[*maildir.FolderAggregator],
+	yearAggregator *maildir.TimeAggregator,
+	monthAggregator *maildir.TimeAggregator) []*metricPoint {
+
+	points := []*metricPoint{}
+
+	// User
+	{
+		results := append([]*maildir.AggregateResult{}, userAggregator.Results()...)
+		maildir.SortByName(results)
+
+		for _, result := range results {
+			points = append(points, &metricPoint{"user", [][2]string{{"user", result.Name}}, result.Count, result.TotalSize})
+		}
+	}
+
+	// Folder
+	{
+		perUserResults := append([]*maildir.PerUserResult[*maildir.FolderAggregator]{}, userFolderAggregator.Results()...)
+		sort.Slice(perUserResults, func(i, j int) bool {
+			return perUserResults[i].UserName < perUserResults[j].UserName
+		})
+
+		for _, perUserResult := range perUserResults {
+			results := append([]*maildir.AggregateResult{}, perUserResult.Aggregator.Results()...)
+			maildir.SortByName(results)
+
+			for _, result := range results {
+				points = append(points, &metricPoint{"folder", [][2]string{{"user", perUserResult.UserName}, {"folder", result.Name}}, result.Count, result.TotalSize})
+			}
+		}
+	}
+
+	// Year, Month
+	for _, timeResult := range []struct {
+		name       string
+		aggregator *maildir.TimeAggregator
+	}{{"year", yearAggregator}, {"month", monthAggregator}} {
+		if timeResult.aggregator == nil {
+			continue
+		}
+
+		results := timeResult.aggregator.Results()
+		maildir.SortByName(results)
+
+		for _, result := range results {
+			name := result.Name
+			if name == "" {
+				// 日時が分からないもの
+				name = "unknown"
+			}
+			points = append(points, &metricPoint{timeResult.name, [][2]string{{timeResult.name, name}}, result.Count, result.TotalSize})
+		}
+	}
+
+	return points
+}
+
+// InfluxDBのline protocolで出力する
+// 例: maildir_folder,host=mail01,user=user1,folder=INBOX count=10i,bytes=2048i 1677628800000000000
+func printInflux(writer io.Writer, points []*metricPoint, timestamp time.Time) {
+
+	// ホスト名が取得できない場合は、空の値は許されないのでタグ自体を出力しない
+	host, err := hostname()
+	if err != nil {
+		host = ""
+	}
+
+	for _, point := range points {
+		tags := []string{}
+		if host != "" {
+			tags = append(tags, "host="+escapeInfluxTag(host))
+		}
+		for _, tag := range point.tags {
+			if tag[1] == "" {
+				// 空の値は許されないので、タグ自体を出力しない(INBOXの名前が空の場合など)
+				continue
+			}
+			tags = append(tags, escapeInfluxTag(tag[0])+"="+escapeInfluxTag(tag[1]))
+		}
+
+		key := "maildir_" + point.measurement
+		if len(tags) > 0 {
+			key += "," + strings.Join(tags, ",")
+		}
+
+		fmt.Fprintf(writer, "%s count=%di,bytes=%di %d\n",
+			key,
+			point.count,
+			point.size,
+			timestamp.UnixNano())
+	}
+}
+
+// タグのキーと値では、カンマ、イコール、スペースをエスケープする
+func escapeInfluxTag(value string) string {
+	return strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `).Replace(value)
+}
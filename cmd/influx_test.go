@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/onozaty/maildir-stats/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllCmd_Influx(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	maildir := "Maildir"
+
+	users := setupTestAllMaildir(t, temp, maildir)
+
+	// テスト用にメソッド差し替え
+	loadPasswd = func(passwdPath string) ([]user.User, error) {
+		return users, nil
+	}
+	hostname = func() (string, error) {
+		return "mail01", nil
+	}
+	t.Cleanup(func() { hostname = os.Hostname })
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"all",
+		"-d", maildir,
+		"--inbox-name", "INBOX",
+		"--format", "influx",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// タイムスタンプは全て同じ値
+	timestamps := regexp.MustCompile(`(?m) ([0-9]+)$`).FindAllStringSubmatch(buf.String(), -1)
+	require.Len(t, timestamps, 19)
+	for _, timestamp := range timestamps {
+		assert.Equal(t, timestamps[0][1], timestamp[1])
+	}
+
+	result := regexp.MustCompile(`(?m) [0-9]+$`).ReplaceAllString(buf.String(), " X")
+	expected := `maildir_user,host=mail01,user=user1 count=6i,bytes=21i X
+maildir_user,host=mail01,user=user2 count=2i,bytes=300i X
+maildir_user,host=mail01,user=user3 count=3i,bytes=6000i X
+maildir_user,host=mail01,user=user4 count=0i,bytes=0i X
+maildir_folder,host=mail01,user=user1,folder=A count=2i,bytes=7i X
+maildir_folder,host=mail01,user=user1,folder=B count=2i,bytes=11i X
+maildir_folder,host=mail01,user=user1,folder=INBOX count=2i,bytes=3i X
+maildir_folder,host=mail01,user=user2,folder=INBOX count=1i,bytes=100i X
+maildir_folder,host=mail01,user=user2,folder=Z count=1i,bytes=200i X
+maildir_folder,host=mail01,user=user3,folder=INBOX count=3i,bytes=6000i X
+maildir_folder,host=mail01,user=user4,folder=INBOX count=0i,bytes=0i X
+maildir_year,host=mail01,year=2021 count=2i,bytes=300i X
+maildir_year,host=mail01,year=2022 count=6i,bytes=3014i X
+maildir_year,host=mail01,year=2023 count=3i,bytes=3007i X
+maildir_month,host=mail01,month=2021-12 count=2i,bytes=300i X
+maildir_month,host=mail01,month=2022-11 count=3i,bytes=1006i X
+maildir_month,host=mail01,month=2022-12 count=3i,bytes=2008i X
+maildir_month,host=mail01,month=2023-01 count=2i,bytes=3003i X
+maildir_month,host=mail01,month=2023-02 count=1i,bytes=4i X
+`
+	assert.Equal(t, expected, result)
+}
+
+func TestPrintInflux(t *testing.T) {
+
+	// ARRANGE
+	hostname = func() (string, error) {
+		return "mail 01", nil
+	}
+	t.Cleanup(func() { hostname = os.Hostname })
+
+	points := []*metricPoint{
+		{"folder", [][2]string{{"user", "user1"}, {"folder", "a,b=c d"}}, 1, 2},
+		{"folder", [][2]string{{"user", "user1"}, {"folder", ""}}, 3, 4},
+		{"month", [][2]string{{"month", "unknown"}}, 5, 6},
+	}
+
+	buf := new(bytes.Buffer)
+
+	// ACT
+	printInflux(buf, points, time.Unix(1677628800, 123))
+
+	// ASSERT
+	expected := `maildir_folder,host=mail\ 01,user=user1,folder=a\,b\=c\ d count=1i,bytes=2i 1677628800000000123
+maildir_folder,host=mail\ 01,user=user1 count=3i,bytes=4i 1677628800000000123
+maildir_month,host=mail\ 01,month=unknown count=5i,bytes=6i 1677628800000000123
+`
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestPrintInflux_NoHost(t *testing.T) {
+
+	// ARRANGE
+	hostname = func() (string, error) {
+		return "", errors.New("hostname error")
+	}
+	t.Cleanup(func() { hostname = os.Hostname })
+
+	points := []*metricPoint{
+		{"user", [][2]string{{"user", "user1"}}, 1, 2},
+		{"folder", [][2]string{{"user", ""}, {"folder", ""}}, 3, 4},
+	}
+
+	buf := new(bytes.Buffer)
+
+	// ACT
+	printInflux(buf, points, time.Unix(1677628800, 123))
+
+	// ASSERT
+	// hostタグは出力しない
+	expected := `maildir_user,user=user1 count=1i,bytes=2i 1677628800000000123
+maildir_folder count=3i,bytes=4i 1677628800000000123
+`
+	assert.Equal(t, expected, buf.String())
+}
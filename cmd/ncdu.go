@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/onozaty/maildir-stats/maildir"
+)
+
+// ncduのJSON形式(ncdu -f で読み込める形式)で出力する
+// ユーザ -> フォルダ -> new、cur -> メールファイル のツリーとし、サイズはメールのサイズとする
+func printNcdu(writer io.Writer, treeAggregator *maildir.TreeAggregator, scanEnd time.Time) {
+
+	fmt.Fprintf(writer, `[1,2,{"progname":"maildir-stats","progver":%s,"timestamp":%d},`+"\n", ncduString(Version), scanEnd.Unix())
+	fmt.Fprintf(writer, `[{"name":"/"}`)
+
+	for _, user := range treeAggregator.Users() {
+		fmt.Fprintf(writer, ",\n"+`[{"name":%s}`, ncduString(user.Name))
+
+		for _, folder := range user.Folders {
+			fmt.Fprintf(writer, ",\n"+`[{"name":%s}`, ncduString(ncduFolderName(folder.Name)))
+
+			for _, dir := range folder.Dirs {
+				// mboxなど、new、curの区別が無いものはフォルダの直下に置く
+				if dir.Name != "" {
+					fmt.Fprintf(writer, ",\n"+`[{"name":%s}`, ncduString(dir.Name))
+				}
+
+				if dir.Aggregated {
+					// ファイルが多いものは1つにまとめる
+					printNcduFile(writer, fmt.Sprintf("(%s mails)", humanize.Comma(dir.Count)), dir.TotalSize)
+				} else {
+					for _, file := range dir.Files {
+						printNcduFile(writer, file.Name, file.Size)
+					}
+				}
+
+				if dir.Name != "" {
+					fmt.Fprintf(writer, "]")
+				}
+			}
+			fmt.Fprintf(writer, "]")
+		}
+		fmt.Fprintf(writer, "]")
+	}
+	fmt.Fprintf(writer, "]]\n")
+}
+
+func printNcduFile(writer io.Writer, name string, size int64) {
+	// ディスク上の使用量(dsize)は分からないので、メールのサイズ(asize)と同じにしておく
+	fmt.Fprintf(writer, ",\n"+`{"name":%s,"asize":%d,"dsize":%d}`, ncduString(name), size, size)
+}
+
+// ncduでは名前が空のものは扱えないので、受信箱の名前が指定されていない場合は分かる名前にする
+func ncduFolderName(name string) string {
+
+	if name == "" {
+		return "(inbox)"
+	}
+	return name
+}
+
+func ncduString(value string) string {
+
+	// HTML向けのエスケープ(< を \u003c にするなど)はせずに、そのままの文字で出力する
+	buffer := &strings.Builder{}
+	encoder := json.NewEncoder(buffer)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(value) // 文字列のエンコードでエラーになることはない
+
+	return strings.TrimSuffix(buffer.String(), "\n")
+}
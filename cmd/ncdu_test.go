@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"testing"
+
+	"github.com/onozaty/maildir-stats/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllCmd_Ncdu(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	maildir := "Maildir"
+
+	users := setupTestAllMaildir(t, temp, maildir)
+
+	// テスト用にメソッド差し替え
+	loadPasswd = func(passwdPath string) ([]user.User, error) {
+		return users, nil
+	}
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"all",
+		"-d", maildir,
+		"--format", "ncdu",
+		"--ncdu-max-files", "2",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// JSONとして読み込める
+	var parsed []any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &parsed))
+
+	result := regexp.MustCompile(`"timestamp":[0-9]+`).ReplaceAllString(buf.String(), `"timestamp":X`)
+	expected := `[1,2,{"progname":"maildir-stats","progver":"dev","timestamp":X},
+[{"name":"/"},
+[{"name":"user1"},
+[{"name":"(inbox)"},
+[{"name":"new"},
+{"name":"1667260800","asize":1,"dsize":1}],
+[{"name":"cur"},
+{"name":"1669852800","asize":2,"dsize":2}]],
+[{"name":"A"},
+[{"name":"new"},
+{"name":"1672531200","asize":3,"dsize":3}],
+[{"name":"cur"},
+{"name":"1675209600","asize":4,"dsize":4}]],
+[{"name":"B"},
+[{"name":"new"},
+{"name":"1669766400","asize":5,"dsize":5}],
+[{"name":"cur"},
+{"name":"1672444800","asize":6,"dsize":6}]]],
+[{"name":"user2"},
+[{"name":"(inbox)"},
+[{"name":"cur"},
+{"name":"1640908800","asize":100,"dsize":100}]],
+[{"name":"Z"},
+[{"name":"new"},
+{"name":"1638316800","asize":200,"dsize":200}]]],
+[{"name":"user3"},
+[{"name":"(inbox)"},
+[{"name":"cur"},
+{"name":"(3 mails)","asize":6000,"dsize":6000}]]],
+[{"name":"user4"},
+[{"name":"(inbox)"}]]]]
+`
+	assert.Equal(t, expected, result)
+}
+
+func TestNcduString(t *testing.T) {
+
+	assert.Equal(t, `"a<b>&c"`, ncduString("a<b>&c"))
+	assert.Equal(t, `"a\"b\\c"`, ncduString(`a"b\c`))
+	assert.Equal(t, `"受信箱"`, ncduString("受信箱"))
+}
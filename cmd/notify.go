@@ -0,0 +1,425 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/onozaty/maildir-stats/maildir"
+	"github.com/spf13/cobra"
+)
+
+const defaultNotifySubject = "Your mailbox is getting large"
+
+const defaultNotifyTemplate = `Hello {{.UserName}},
+
+Your mailbox is using {{bytes .TotalSize}} ({{comma .Count}} mails){{if .HasQuota}}, {{printf "%.1f" .QuotaPercent}}% of your quota{{end}}.
+Please delete unnecessary mails.
+
+Biggest folders:
+{{range .TopFolders}}  {{.Name}} : {{bytes .TotalSize}} ({{comma .Count}} mails)
+{{end}}`
+
+// テンプレートに渡す内容
+type notifyData struct {
+	UserName     string
+	Address      string
+	Count        int64
+	TotalSize    int64
+	HasQuota     bool
+	QuotaPercent float64
+	Quota        *maildir.MaildirQuota      // quotaが設定されていない場合はnil
+	Folders      []*maildir.AggregateResult // 名前順
+	TopFolders   []*maildir.AggregateResult // サイズが大きい順
+}
+
+type notifyCondition struct {
+	userListCondition
+	quotaLower float64 // 未指定の場合は-1
+}
+
+type smtpConnection struct {
+	server             string
+	userName           string
+	password           string
+	security           ConnectionSecurity
+	insecureSkipVerify bool
+}
+
+type notifyMessage struct {
+	from            string
+	domain          string
+	subjectTemplate *template.Template
+	bodyTemplate    *template.Template
+	top             int
+}
+
+func newNotifyCmd() *cobra.Command {
+
+	subCmd := &cobra.Command{
+		Use:   "notify",
+		Short: "Send warning emails to users with large mailboxes",
+		RunE: func(cmd *cobra.Command, args []string) error {
+
+			maildirName, _ := cmd.Flags().GetString("mail-dir")
+
+			condition := notifyCondition{quotaLower: -1}
+			condition.sizeLower, _ = cmd.Flags().GetInt64("size-lower")
+			condition.sizeUpper, _ = cmd.Flags().GetInt64("size-upper")
+			if !cmd.Flags().Changed("size-upper") {
+				// 未設定の場合は、int64の最大値いれておく
+				condition.sizeUpper = math.MaxInt64
+			}
+			condition.countLower, _ = cmd.Flags().GetInt64("count-lower")
+			condition.countUpper, _ = cmd.Flags().GetInt64("count-upper")
+			if !cmd.Flags().Changed("count-upper") {
+				// 未設定の場合は、int64の最大値いれておく
+				condition.countUpper = math.MaxInt64
+			}
+			if cmd.Flags().Changed("quota-lower") {
+				condition.quotaLower, _ = cmd.Flags().GetFloat64("quota-lower")
+			}
+
+			from, _ := cmd.Flags().GetString("from")
+			domain, _ := cmd.Flags().GetString("domain")
+			top, _ := cmd.Flags().GetInt("top")
+
+			subject, _ := cmd.Flags().GetString("subject")
+			subjectTemplate, err := newNotifyTemplate("subject").Parse(subject)
+			if err != nil {
+				return err
+			}
+
+			bodyTemplate := newNotifyTemplate("body")
+			templatePath, _ := cmd.Flags().GetString("template")
+			if templatePath == "" {
+				bodyTemplate, err = bodyTemplate.Parse(defaultNotifyTemplate)
+			} else {
+				var content []byte
+				content, err = os.ReadFile(templatePath)
+				if err == nil {
+					bodyTemplate, err = bodyTemplate.Parse(string(content))
+				}
+			}
+			if err != nil {
+				return err
+			}
+
+			server, _ := cmd.Flags().GetString("smtp-server")
+			smtpUser, _ := cmd.Flags().GetString("smtp-user")
+			smtpPassword, _ := cmd.Flags().GetString("smtp-password")
+			security, err := getConnectionSecurity(cmd.Flags(), "smtp-security")
+			if err != nil { // 許可されていなパラメータの可能性あり
+				return err
+			}
+			insecureSkipVerify, _ := cmd.Flags().GetBool("insecure-skip-verify")
+
+			dryRunDir, _ := cmd.Flags().GetString("dry-run-dir")
+			inboxFolderName, _ := cmd.Flags().GetString("inbox-name")
+
+			// 条件を指定し忘れて全ユーザに送ってしまわないように、送信する場合は下限の指定を必須とする
+			if dryRunDir == "" &&
+				!cmd.Flags().Changed("size-lower") && !cmd.Flags().Changed("count-lower") && !cmd.Flags().Changed("quota-lower") {
+				return fmt.Errorf("--size-lower, --count-lower or --quota-lower is required to send emails")
+			}
+
+			// 引数の解析に成功した時点で、エラーが起きてもUsageは表示しない
+			cmd.SilenceUsage = true
+
+			return runNotify(
+				maildirName,
+				inboxFolderName,
+				condition,
+				notifyMessage{
+					from:            from,
+					domain:          domain,
+					subjectTemplate: subjectTemplate,
+					bodyTemplate:    bodyTemplate,
+					top:             top,
+				},
+				smtpConnection{
+					server:             server,
+					userName:           smtpUser,
+					password:           smtpPassword,
+					security:           security,
+					insecureSkipVerify: insecureSkipVerify,
+				},
+				dryRunDir,
+				cmd.OutOrStdout())
+		},
+	}
+
+	subCmd.Flags().StringP("mail-dir", "d", "", "User maildir name.")
+	subCmd.MarkFlagRequired("mail-dir")
+
+	subCmd.Flags().Int64P("size-lower", "", 0, "Size lower limit.")
+	subCmd.Flags().Int64P("size-upper", "", 0, "Size upper limit.")
+	subCmd.Flags().Int64P("count-lower", "", 0, "Count lower limit.")
+	subCmd.Flags().Int64P("count-upper", "", 0, "Count upper limit.")
+	subCmd.Flags().Float64P("quota-lower", "", 0, "Quota usage (percent) lower limit. Users without quota are excluded.")
+
+	subCmd.Flags().StringP("from", "", "", "From address of the emails.")
+	subCmd.MarkFlagRequired("from")
+	subCmd.Flags().StringP("domain", "", "", "Domain of the user addresses. (user@domain) Without this, the user name is used as it is.")
+	subCmd.Flags().StringP("subject", "", defaultNotifySubject, "Subject of the emails. (Go template)")
+	subCmd.Flags().StringP("template", "", "", "Body template file path. (Go template) (default built-in template)")
+	subCmd.Flags().IntP("top", "", 5, "Number of the biggest folders.")
+
+	subCmd.Flags().StringP("smtp-server", "", "localhost:25", "SMTP server address. (host:port)")
+	subCmd.Flags().StringP("smtp-user", "", "", "SMTP auth user name. Without this, auth is not used.")
+	subCmd.Flags().StringP("smtp-password", "", "", "SMTP auth password. (can also be specified by MAILDIR_STATS_NOTIFY_SMTP_PASSWORD)")
+	subCmd.Flags().StringP("smtp-security", "", "starttls", "Connection security.\ncan be specified: tls, starttls, none")
+	subCmd.Flags().BoolP("insecure-skip-verify", "", false, "Do not verify the server certificate.")
+
+	subCmd.Flags().StringP("dry-run-dir", "", "", "Write the emails to this directory instead of sending them.")
+	subCmd.Flags().StringP("inbox-name", "", "INBOX", "The name of the inbox folder.")
+
+	return subCmd
+}
+
+func newNotifyTemplate(name string) *template.Template {
+
+	return template.New(name).Funcs(template.FuncMap{
+		"bytes": func(size int64) string {
+			return humanize.Bytes(uint64(size))
+		},
+		"comma": humanize.Comma,
+	})
+}
+
+func runNotify(maildirName string, inboxFolderName string, condition notifyCondition, message notifyMessage, connection smtpConnection, dryRunDir string, writer io.Writer) error {
+
+	users, err := loadPasswd(passwdPath)
+	if err != nil {
+		return err
+	}
+
+	// 送信対象のユーザ毎に、メールの内容を作成
+	mails := map[string][]byte{}
+	targets := []*notifyData{}
+	for _, mailbox := range maildir.UserMailboxes(users, maildirName, "", maildir.MaildirStorage) {
+		data, err := newNotifyData(mailbox, inboxFolderName, condition, message)
+		if err != nil {
+			return err
+		}
+		if data == nil {
+			continue
+		}
+
+		mail, err := composeNotifyMail(data, message, time.Now())
+		if err != nil {
+			return err
+		}
+
+		targets = append(targets, data)
+		mails[data.UserName] = mail
+	}
+
+	if dryRunDir != "" {
+		for _, data := range targets {
+			mailPath := filepath.Join(dryRunDir, data.UserName+".eml")
+			if err := os.WriteFile(mailPath, mails[data.UserName], 0644); err != nil {
+				return err
+			}
+			fmt.Fprintf(writer, "Wrote %s (%s)\n", mailPath, data.Address)
+		}
+		return nil
+	}
+
+	if len(targets) == 0 {
+		return nil
+	}
+
+	c, err := connectSmtp(connection)
+	if err != nil {
+		return err
+	}
+	defer func() { c.Close() }()
+
+	failed := 0
+	for _, data := range targets {
+		if err := sendSmtpMail(c, message.from, data.Address, mails[data.UserName]); err != nil {
+			// 宛先の拒否などで、残りのユーザへの送信を止めないように
+			fmt.Fprintf(writer, "Failed to send to %s: %v\n", data.Address, err)
+			failed++
+
+			// 途中の状態を取り消す(接続が切れている場合は接続し直す)
+			if err := c.Reset(); err != nil {
+				c.Close()
+				if c, err = connectSmtp(connection); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		fmt.Fprintf(writer, "Sent to %s\n", data.Address)
+	}
+
+	if err := c.Quit(); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to send %d of %d email(s)", failed, len(targets))
+	}
+	return nil
+}
+
+// 条件に一致するユーザの、テンプレートに渡す内容を作成する(一致しない場合はnil)
+func newNotifyData(mailbox maildir.UserMailbox, inboxFolderName string, condition notifyCondition, message notifyMessage) (*notifyData, error) {
+
+	folderAggregator := maildir.NewFolderAggregator()
+	if err := maildir.AggregateUserMailboxesWithErrorHandler([]maildir.UserMailbox{mailbox}, inboxFolderName, folderAggregator, func(err *maildir.AggregateError) error {
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	data := &notifyData{
+		UserName: mailbox.UserName,
+		Address:  mailbox.UserName,
+	}
+	if message.domain != "" {
+		data.Address += "@" + message.domain
+	}
+
+	for _, result := range folderAggregator.Results() {
+		data.Count += result.Count
+		data.TotalSize += result.TotalSize
+	}
+
+	if !condition.within(&maildir.AggregateResult{Name: data.UserName, Count: data.Count, TotalSize: data.TotalSize}) {
+		return nil, nil
+	}
+
+	quota, err := maildir.ReadMaildirQuota(mailbox.Mailbox.MaildirPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if quota != nil {
+		data.Quota = quota
+		data.QuotaPercent, data.HasQuota = quota.UsagePercent(data.TotalSize, data.Count)
+	}
+	if condition.quotaLower >= 0 && (!data.HasQuota || data.QuotaPercent < condition.quotaLower) {
+		return nil, nil
+	}
+
+	data.Folders = append([]*maildir.AggregateResult{}, folderAggregator.Results()...)
+	maildir.SortByName(data.Folders)
+
+	data.TopFolders = append([]*maildir.AggregateResult{}, folderAggregator.Results()...)
+	sortResults(data.TopFolders, SizeDesc)
+	if len(data.TopFolders) > message.top {
+		data.TopFolders = data.TopFolders[:message.top]
+	}
+
+	return data, nil
+}
+
+func composeNotifyMail(data *notifyData, message notifyMessage, now time.Time) ([]byte, error) {
+
+	subject := new(bytes.Buffer)
+	if err := message.subjectTemplate.Execute(subject, data); err != nil {
+		return nil, err
+	}
+
+	body := new(bytes.Buffer)
+	if err := message.bodyTemplate.Execute(body, data); err != nil {
+		return nil, err
+	}
+
+	mail := new(bytes.Buffer)
+	fmt.Fprintf(mail, "From: %s\r\n", message.from)
+	fmt.Fprintf(mail, "To: %s\r\n", data.Address)
+	fmt.Fprintf(mail, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", strings.TrimSpace(subject.String())))
+	fmt.Fprintf(mail, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(mail, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(mail, "Content-Type: text/plain; charset=utf-8\r\n")
+	fmt.Fprintf(mail, "Content-Transfer-Encoding: quoted-printable\r\n")
+	fmt.Fprintf(mail, "\r\n")
+
+	// 改行はCRLFに揃える
+	qp := quotedprintable.NewWriter(mail)
+	text := strings.ReplaceAll(strings.ReplaceAll(body.String(), "\r\n", "\n"), "\n", "\r\n")
+	if _, err := qp.Write([]byte(text)); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+
+	return mail.Bytes(), nil
+}
+
+func connectSmtp(connection smtpConnection) (*smtp.Client, error) {
+
+	host, _, err := net.SplitHostPort(connection.server)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{ServerName: host, InsecureSkipVerify: connection.insecureSkipVerify}
+
+	var conn net.Conn
+	if connection.security == SecurityTLS {
+		conn, err = tls.Dial("tcp", connection.server, tlsConfig)
+	} else {
+		conn, err = net.Dial("tcp", connection.server)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if connection.security == SecurityStartTLS {
+		if err := c.StartTLS(tlsConfig); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+
+	if connection.userName != "" {
+		if err := c.Auth(smtp.PlainAuth("", connection.userName, connection.password, host)); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+func sendSmtpMail(c *smtp.Client, from string, to string, mail []byte) error {
+
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(mail); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
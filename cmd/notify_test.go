@@ -0,0 +1,422 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	netmail "net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/onozaty/maildir-stats/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slices"
+)
+
+func TestNotifyCmd_DryRun(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	users := setupTestCheckMaildir(t, temp)
+
+	// テスト用にメソッド差し替え
+	loadPasswd = func(passwdPath string) ([]user.User, error) {
+		return users, nil
+	}
+
+	dryRunDir := t.TempDir()
+
+	// ACT
+	result, err := executeNotifyCmd(t,
+		"-d", "Maildir",
+		"--size-lower", "2000",
+		"--from", "postmaster@example.com",
+		"--domain", "example.com",
+		"--top", "1",
+		"--dry-run-dir", dryRunDir)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	expected := fmt.Sprintf("Wrote %s (user1@example.com)\nWrote %s (user2@example.com)\n",
+		filepath.Join(dryRunDir, "user1.eml"),
+		filepath.Join(dryRunDir, "user2.eml"))
+	assert.Equal(t, expected, result)
+
+	header, body := readTestNotifyMail(t, filepath.Join(dryRunDir, "user1.eml"))
+	assert.Equal(t, "postmaster@example.com", header.Get("From"))
+	assert.Equal(t, "user1@example.com", header.Get("To"))
+	assert.Equal(t, "Your mailbox is getting large", header.Get("Subject"))
+	assert.NotEmpty(t, header.Get("Date"))
+	assert.Equal(t, `Hello user1,
+
+Your mailbox is using 3.5 kB (3 mails), 87.5% of your quota.
+Please delete unnecessary mails.
+
+Biggest folders:
+  Sent : 2.5 kB (2 mails)
+`, body)
+
+	header, body = readTestNotifyMail(t, filepath.Join(dryRunDir, "user2.eml"))
+	assert.Equal(t, "user2@example.com", header.Get("To"))
+	assert.Equal(t, `Hello user2,
+
+Your mailbox is using 2.1 kB (2 mails), 52.5% of your quota.
+Please delete unnecessary mails.
+
+Biggest folders:
+  My Box : 2.1 kB (2 mails)
+`, body)
+
+	assert.NoFileExists(t, filepath.Join(dryRunDir, "user3.eml"))
+}
+
+func TestNotifyCmd_Template(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	users := setupTestCheckMaildir(t, temp)
+
+	// テスト用にメソッド差し替え
+	loadPasswd = func(passwdPath string) ([]user.User, error) {
+		return users, nil
+	}
+
+	templatePath := filepath.Join(temp, "notify.tmpl")
+	createFile(t, templatePath, `{{.UserName}}さん
+{{range .Folders}}{{.Name}}={{.TotalSize}}/{{.Count}}
+{{end}}quota={{.Quota.Size}}
+`)
+	dryRunDir := t.TempDir()
+
+	// ACT
+	result, err := executeNotifyCmd(t,
+		"-d", "Maildir",
+		"--quota-lower", "80",
+		"--from", "postmaster@example.com",
+		"--subject", "[警告] {{.UserName}} {{printf \"%.0f\" .QuotaPercent}}%",
+		"--template", templatePath,
+		"--dry-run-dir", dryRunDir)
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("Wrote %s (user1)\n", filepath.Join(dryRunDir, "user1.eml")), result)
+
+	header, body := readTestNotifyMail(t, filepath.Join(dryRunDir, "user1.eml"))
+	assert.Equal(t, "user1", header.Get("To"))
+	subject, err := new(mime.WordDecoder).DecodeHeader(header.Get("Subject"))
+	require.NoError(t, err)
+	assert.Equal(t, "[警告] user1 88%", subject)
+	assert.Equal(t, "user1さん\nINBOX=1000/1\nSent=2500/2\nquota=4000\n", body)
+}
+
+func TestNotifyCmd_Smtp(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	users := setupTestCheckMaildir(t, temp)
+
+	// テスト用にメソッド差し替え
+	loadPasswd = func(passwdPath string) ([]user.User, error) {
+		return users, nil
+	}
+
+	server := startTestSmtpServer(t)
+
+	// ACT
+	result, err := executeNotifyCmd(t,
+		"-d", "Maildir",
+		"--count-lower", "2",
+		"--from", "postmaster@example.com",
+		"--domain", "example.com",
+		"--smtp-server", server.address,
+		"--smtp-security", "none",
+		"--smtp-user", "admin",
+		"--smtp-password", "secret")
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(t, "Sent to user1@example.com\nSent to user2@example.com\n", result)
+
+	assert.Equal(t, "\x00admin\x00secret", server.auth)
+	require.Len(t, server.mails, 2)
+	assert.Equal(t, "<postmaster@example.com>", server.mails[0].from)
+	assert.Equal(t, "<user1@example.com>", server.mails[0].to)
+	assert.Contains(t, server.mails[0].data, "To: user1@example.com\r\n")
+	assert.Equal(t, "<user2@example.com>", server.mails[1].to)
+	assert.Contains(t, server.mails[1].data, "Hello user2,")
+}
+
+func TestNotifyCmd_SmtpRejected(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	users := setupTestCheckMaildir(t, temp)
+
+	// テスト用にメソッド差し替え
+	loadPasswd = func(passwdPath string) ([]user.User, error) {
+		return users, nil
+	}
+
+	server := startTestSmtpServer(t, "<user1@example.com>")
+
+	// ACT
+	result, err := executeNotifyCmd(t,
+		"-d", "Maildir",
+		"--count-lower", "2",
+		"--from", "postmaster@example.com",
+		"--domain", "example.com",
+		"--smtp-server", server.address,
+		"--smtp-security", "none")
+
+	// ASSERT
+	// 拒否されたユーザがいても、残りのユーザには送信する
+	require.EqualError(t, err, "failed to send 1 of 2 email(s)")
+	assert.Equal(t, "Failed to send to user1@example.com: 550 \"No such user\"\nSent to user2@example.com\n", result)
+
+	require.Len(t, server.mails, 1)
+	assert.Equal(t, "<user2@example.com>", server.mails[0].to)
+}
+
+func TestNotifyCmd_NoTarget(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	users := setupTestCheckMaildir(t, temp)
+
+	// テスト用にメソッド差し替え
+	loadPasswd = func(passwdPath string) ([]user.User, error) {
+		return users, nil
+	}
+
+	// ACT
+	// 対象がいない場合は接続しない
+	result, err := executeNotifyCmd(t,
+		"-d", "Maildir",
+		"--size-lower", "100000",
+		"--from", "postmaster@example.com",
+		"--smtp-server", "127.0.0.1:1")
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(t, "", result)
+}
+
+func TestNotifyCmd_InvalidSecurity(t *testing.T) {
+
+	// ACT
+	_, err := executeNotifyCmd(t,
+		"-d", "Maildir",
+		"--from", "postmaster@example.com",
+		"--smtp-security", "ssl")
+
+	// ASSERT
+	require.EqualError(t, err, "invalid security 'ssl'")
+}
+
+func TestNotifyCmd_InvalidTemplate(t *testing.T) {
+
+	// ACT
+	_, err := executeNotifyCmd(t,
+		"-d", "Maildir",
+		"--from", "postmaster@example.com",
+		"--subject", "{{.UserName")
+
+	// ASSERT
+	require.ErrorContains(t, err, "template: subject:")
+}
+
+func TestNotifyCmd_TemplateNotFound(t *testing.T) {
+
+	// ARRANGE
+	templatePath := filepath.Join(t.TempDir(), "notify.tmpl")
+
+	// ACT
+	_, err := executeNotifyCmd(t,
+		"-d", "Maildir",
+		"--from", "postmaster@example.com",
+		"--template", templatePath)
+
+	// ASSERT
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestNotifyCmd_NoSelection(t *testing.T) {
+
+	// ACT
+	_, err := executeNotifyCmd(t,
+		"-d", "Maildir",
+		"--size-upper", "100000",
+		"--from", "postmaster@example.com",
+		"--smtp-server", "127.0.0.1:1")
+
+	// ASSERT
+	require.EqualError(t, err, "--size-lower, --count-lower or --quota-lower is required to send emails")
+}
+
+func TestNotifyCmd_NoSelectionDryRun(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	users := setupTestCheckMaildir(t, temp)
+
+	// テスト用にメソッド差し替え
+	loadPasswd = func(passwdPath string) ([]user.User, error) {
+		return users, nil
+	}
+
+	dryRunDir := t.TempDir()
+
+	// ACT
+	// 書き出すだけであれば、条件無し(全ユーザ)でも良い
+	result, err := executeNotifyCmd(t,
+		"-d", "Maildir",
+		"--from", "postmaster@example.com",
+		"--dry-run-dir", dryRunDir)
+
+	// ASSERT
+	require.NoError(t, err)
+	// Maildirの無いユーザ以外の全員
+	assert.Equal(t, 3, strings.Count(result, "Wrote "))
+}
+
+func executeNotifyCmd(t *testing.T, args ...string) (string, error) {
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs(append([]string{"notify"}, args...))
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	err := rootCmd.Execute()
+	return buf.String(), err
+}
+
+func readTestNotifyMail(t *testing.T, path string) (netmail.Header, string) {
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	message, err := netmail.ReadMessage(file)
+	require.NoError(t, err)
+	assert.Equal(t, "quoted-printable", message.Header.Get("Content-Transfer-Encoding"))
+
+	body, err := io.ReadAll(quotedprintable.NewReader(message.Body))
+	require.NoError(t, err)
+
+	return message.Header, strings.ReplaceAll(string(body), "\r\n", "\n")
+}
+
+type testSmtpMail struct {
+	from string
+	to   string
+	data string
+}
+
+// テスト用の最低限のSMTPサーバ
+type testSmtpServer struct {
+	address  string
+	auth     string
+	mails    []*testSmtpMail
+	rejectTo []string // RCPTで拒否する宛先
+}
+
+func startTestSmtpServer(t *testing.T, rejectTo ...string) *testSmtpServer {
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server := &testSmtpServer{address: listener.Addr().String(), rejectTo: rejectTo}
+
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		server.serve(conn)
+	}()
+
+	t.Cleanup(func() {
+		listener.Close()
+		wg.Wait()
+	})
+
+	return server
+}
+
+func (s *testSmtpServer) serve(conn net.Conn) {
+
+	reader := bufio.NewReader(conn)
+	reply := func(line string) {
+		fmt.Fprintf(conn, "%s\r\n", line)
+	}
+
+	reply("220 localhost ESMTP test")
+
+	var current *testSmtpMail
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+
+		switch command {
+		case "EHLO":
+			reply("250-localhost")
+			reply("250 AUTH PLAIN")
+		case "AUTH":
+			auth, _ := base64.StdEncoding.DecodeString(strings.Fields(line)[2])
+			s.auth = string(auth)
+			reply("235 OK")
+		case "MAIL":
+			current = &testSmtpMail{from: strings.TrimPrefix(line, "MAIL FROM:")}
+			reply("250 OK")
+		case "RCPT":
+			current.to = strings.TrimPrefix(line, "RCPT TO:")
+			if slices.Contains(s.rejectTo, current.to) {
+				reply("550 No such user")
+				continue
+			}
+			reply("250 OK")
+		case "DATA":
+			reply("354 Go ahead")
+			data := new(strings.Builder)
+			for {
+				dataLine, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(dataLine)
+			}
+			current.data = data.String()
+			s.mails = append(s.mails, current)
+			reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
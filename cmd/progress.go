@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/onozaty/maildir-stats/maildir"
+)
+
+// 端末に出力する場合の表示更新間隔
+const progressRefreshInterval = 500 * time.Millisecond
+
+// 集計の進捗状況を出力する
+// 端末に対しては1行を書き換えながら表示し、それ以外(ファイルやパイプ)には一定間隔でログ形式の行を出力する
+type progressReporter struct {
+	writer      io.Writer
+	totalUsers  int
+	interactive bool
+	interval    time.Duration
+	now         func() time.Time
+	startTime   time.Time
+	lastReport  time.Time
+}
+
+func newProgressReporter(writer io.Writer, totalUsers int, logInterval time.Duration) *progressReporter {
+
+	interactive := isTerminal(writer)
+	interval := logInterval
+	if interactive {
+		interval = progressRefreshInterval
+	}
+
+	return &progressReporter{
+		writer:      writer,
+		totalUsers:  totalUsers,
+		interactive: interactive,
+		interval:    interval,
+		now:         time.Now,
+	}
+}
+
+func (r *progressReporter) start() {
+	r.startTime = r.now()
+	r.lastReport = r.startTime
+}
+
+func (r *progressReporter) report(progress maildir.Progress) {
+
+	now := r.now()
+	// ユーザの切り替わりも含め、一定間隔以内であれば出力しない
+	if now.Sub(r.lastReport) < r.interval {
+		return
+	}
+	r.lastReport = now
+
+	r.print(progress, now, false)
+}
+
+func (r *progressReporter) finish(progress maildir.Progress) {
+	r.print(progress, r.now(), true)
+}
+
+func (r *progressReporter) print(progress maildir.Progress, now time.Time, done bool) {
+
+	elapsed := now.Sub(r.startTime)
+
+	// 処理中のユーザは完了していないので除く
+	completedUsers := progress.UserCount - 1
+	if done {
+		completedUsers = progress.UserCount
+	}
+	if completedUsers < 0 {
+		completedUsers = 0
+	}
+
+	mailsPerSec := float64(0)
+	if elapsed > 0 {
+		mailsPerSec = float64(progress.MailCount) / elapsed.Seconds()
+	}
+
+	eta := time.Duration(-1) // 不明
+	if done {
+		eta = 0
+	} else if completedUsers > 0 {
+		remaining := r.totalUsers - completedUsers
+		eta = time.Duration(float64(elapsed) / float64(completedUsers) * float64(remaining)).Round(time.Second)
+	}
+
+	if r.interactive {
+		fmt.Fprintf(r.writer, "\r\x1b[K[%d/%d] %s mails/s  user: %s  ETA: %s",
+			completedUsers, r.totalUsers,
+			humanize.Comma(int64(mailsPerSec)),
+			progress.UserName,
+			formatETA(eta))
+		if done {
+			fmt.Fprintf(r.writer, "\n")
+		}
+		return
+	}
+
+	msg := "progress"
+	if done {
+		msg = "done"
+	}
+	fmt.Fprintf(r.writer, "time=%s msg=%s users=%d total_users=%d mails=%d bytes=%d mails_per_sec=%.1f current_user=%q elapsed=%s eta=%s\n",
+		now.UTC().Format(time.RFC3339),
+		msg,
+		completedUsers, r.totalUsers,
+		progress.MailCount, progress.TotalSize,
+		mailsPerSec,
+		progress.UserName,
+		elapsed.Round(time.Second),
+		formatETA(eta))
+}
+
+func formatETA(eta time.Duration) string {
+
+	if eta < 0 {
+		return "unknown"
+	}
+
+	seconds := int64(eta.Round(time.Second).Seconds())
+	return fmt.Sprintf("%02d:%02d:%02d", seconds/3600, seconds%3600/60, seconds%60)
+}
+
+func isTerminal(writer io.Writer) bool {
+
+	file, ok := writer.(*os.File)
+	if !ok {
+		return false
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
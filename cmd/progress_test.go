@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/onozaty/maildir-stats/maildir"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProgressReporter_Log(t *testing.T) {
+
+	// ARRANGE
+	buf := new(bytes.Buffer)
+	reporter := newProgressReporter(buf, 4, 10*time.Second)
+
+	now := time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC)
+	reporter.now = func() time.Time { return now }
+
+	// ACT
+	reporter.start()
+
+	now = now.Add(5 * time.Second)
+	reporter.report(maildir.Progress{UserName: "user1", UserCount: 1, MailCount: 10, TotalSize: 100}) // 間隔以内なので出力されない
+
+	now = now.Add(15 * time.Second)
+	reporter.report(maildir.Progress{UserName: "user2", UserCount: 2, MailCount: 40, TotalSize: 400})
+
+	now = now.Add(1 * time.Second)
+	reporter.report(maildir.Progress{UserName: "user2", UserCount: 2, MailCount: 41, TotalSize: 410}) // 間隔以内なので出力されない
+
+	now = now.Add(19 * time.Second)
+	reporter.finish(maildir.Progress{UserName: "user4", UserCount: 4, MailCount: 80, TotalSize: 800})
+
+	// ASSERT
+	expected := `time=2023-03-01T00:00:20Z msg=progress users=1 total_users=4 mails=40 bytes=400 mails_per_sec=2.0 current_user="user2" elapsed=20s eta=00:01:00
+time=2023-03-01T00:00:40Z msg=done users=4 total_users=4 mails=80 bytes=800 mails_per_sec=2.0 current_user="user4" elapsed=40s eta=00:00:00
+`
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestProgressReporter_Interactive(t *testing.T) {
+
+	// ARRANGE
+	buf := new(bytes.Buffer)
+	reporter := newProgressReporter(buf, 3, 10*time.Second)
+	reporter.interactive = true // 端末への出力として扱う
+	reporter.interval = progressRefreshInterval
+
+	now := time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC)
+	reporter.now = func() time.Time { return now }
+
+	// ACT
+	reporter.start()
+
+	now = now.Add(1 * time.Second)
+	reporter.report(maildir.Progress{UserName: "user1", UserCount: 1, MailCount: 1500, TotalSize: 100})
+
+	now = now.Add(1 * time.Second)
+	reporter.report(maildir.Progress{UserName: "user2", UserCount: 2, MailCount: 3000, TotalSize: 400})
+
+	reporter.finish(maildir.Progress{UserName: "user3", UserCount: 3, MailCount: 3000, TotalSize: 400})
+
+	// ASSERT
+	expected := "\r\x1b[K[0/3] 1,500 mails/s  user: user1  ETA: unknown" +
+		"\r\x1b[K[1/3] 1,500 mails/s  user: user2  ETA: 00:00:04" +
+		"\r\x1b[K[3/3] 1,500 mails/s  user: user3  ETA: 00:00:00\n"
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestFormatETA(t *testing.T) {
+
+	assert.Equal(t, "unknown", formatETA(-1))
+	assert.Equal(t, "00:00:00", formatETA(0))
+	assert.Equal(t, "00:01:05", formatETA(65*time.Second))
+	assert.Equal(t, "27:46:40", formatETA(100000*time.Second))
+}
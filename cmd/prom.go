@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/onozaty/maildir-stats/maildir"
+)
+
+// Prometheusのメトリクスの値
+type promSample struct {
+	labels [][2]string // ラベル名と値
+	value  float64
+}
+
+const promLastSuccessMetricName = "maildir_last_success_timestamp_seconds"
+
+// Prometheusのテキスト形式(node_exporterのtextfile collector向け)で出力する
+// lastSuccessはエラー無く集計できた最後の日時で、分からない場合(ゼロ値)は出力しない
+func printPromTextfile(
+	writer io.Writer,
+	userAggregator *maildir.UserAggregator,
+	userFolderAggregator *maildir.PerUserAggregator[*maildir.FolderAggregator],
+	userMonthAggregator *maildir.PerUserAggregator[*maildir.TimeAggregator],
+	errorCount int,
+	scanStart time.Time,
+	scanEnd time.Time,
+	lastSuccess time.Time) {
+
+	// User
+	{
+		results := append([]*maildir.AggregateResult{}, userAggregator.Results()...)
+		maildir.SortByName(results)
+
+		mails := []promSample{}
+		sizes := []promSample{}
+		for _, result := range results {
+			labels := [][2]string{{"user", result.Name}}
+			mails = append(mails, promSample{labels, float64(result.Count)})
+			sizes = append(sizes, promSample{labels, float64(result.TotalSize)})
+		}
+
+		printPromMetric(writer, "maildir_user_mails", "Number of mails per user.", mails)
+		printPromMetric(writer, "maildir_user_size_bytes", "Total size of mails per user in bytes.", sizes)
+	}
+
+	// Folder
+	{
+		mails, sizes := perUserPromSamples(userFolderAggregator.Results(), "folder")
+		printPromMetric(writer, "maildir_folder_mails", "Number of mails per user and folder.", mails)
+		printPromMetric(writer, "maildir_folder_size_bytes", "Total size of mails per user and folder in bytes.", sizes)
+	}
+
+	// Month
+	{
+		mails, sizes := perUserPromSamples(userMonthAggregator.Results(), "month")
+		printPromMetric(writer, "maildir_month_mails", "Number of mails per user and received month.", mails)
+		printPromMetric(writer, "maildir_month_size_bytes", "Total size of mails per user and received month in bytes.", sizes)
+	}
+
+	// Scan
+	printPromMetric(writer, "maildir_scan_errors", "Number of mail folders that could not be read in the last scan.", []promSample{{nil, float64(errorCount)}})
+	printPromMetric(writer, "maildir_scan_duration_seconds", "Duration of the last scan in seconds.", []promSample{{nil, scanEnd.Sub(scanStart).Seconds()}})
+	if !lastSuccess.IsZero() {
+		printPromMetric(writer, promLastSuccessMetricName, "Unix time of the last successful scan.", []promSample{{nil, float64(lastSuccess.UnixMilli()) / 1000}})
+	}
+}
+
+// エラー無く集計できた最後の日時
+// エラーがあった場合は、前回出力したファイルの値を引き継ぐ(無い場合はゼロ値)
+func promLastSuccess(outputPath string, errorCount int, scanEnd time.Time) time.Time {
+
+	if errorCount == 0 {
+		return scanEnd
+	}
+	if outputPath == "" {
+		return time.Time{}
+	}
+
+	file, err := os.Open(outputPath)
+	if err != nil {
+		return time.Time{}
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || fields[0] != promLastSuccessMetricName {
+			continue
+		}
+
+		value, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return time.Time{}
+		}
+		return time.UnixMilli(int64(math.Round(value * 1000)))
+	}
+
+	return time.Time{}
+}
+
+func perUserPromSamples[T interface {
+	maildir.Aggregator
+	Results() []*maildir.AggregateResult
+}](perUserResults []*maildir.PerUserResult[T], labelName string) ([]promSample, []promSample) {
+
+	perUserResults = append([]*maildir.PerUserResult[T]{}, perUserResults...)
+	sort.Slice(perUserResults, func(i, j int) bool {
+		return perUserResults[i].UserName < perUserResults[j].UserName
+	})
+
+	mails := []promSample{}
+	sizes := []promSample{}
+	for _, perUserResult := range perUserResults {
+		results := perUserResult.Aggregator.Results()
+		maildir.SortByName(results)
+
+		for _, result := range results {
+			name := result.Name
+			if labelName == "month" && name == "" {
+				// 日時が分からないもの
+				name = "unknown"
+			}
+
+			labels := [][2]string{{"user", perUserResult.UserName}, {labelName, name}}
+			mails = append(mails, promSample{labels, float64(result.Count)})
+			sizes = append(sizes, promSample{labels, float64(result.TotalSize)})
+		}
+	}
+
+	return mails, sizes
+}
+
+func printPromMetric(writer io.Writer, name string, help string, samples []promSample) {
+
+	fmt.Fprintf(writer, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(writer, "# TYPE %s gauge\n", name)
+
+	for _, sample := range samples {
+		labels := []string{}
+		for _, label := range sample.labels {
+			labels = append(labels, fmt.Sprintf("%s=\"%s\"", label[0], escapePromLabelValue(label[1])))
+		}
+
+		if len(labels) == 0 {
+			fmt.Fprintf(writer, "%s %s\n", name, strconv.FormatFloat(sample.value, 'f', -1, 64))
+		} else {
+			fmt.Fprintf(writer, "%s{%s} %s\n", name, strings.Join(labels, ","), strconv.FormatFloat(sample.value, 'f', -1, 64))
+		}
+	}
+}
+
+// ラベルの値では、バックスラッシュ、ダブルクォート、改行をエスケープする
+func escapePromLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
@@ -0,0 +1,311 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/onozaty/maildir-stats/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllCmd_PromTextfile(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	maildir := "Maildir"
+
+	users := setupTestAllMaildir(t, temp, maildir)
+
+	// テスト用にメソッド差し替え
+	loadPasswd = func(passwdPath string) ([]user.User, error) {
+		return users, nil
+	}
+
+	outputPath := filepath.Join(t.TempDir(), "maildir.prom")
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"all",
+		"-d", maildir,
+		"--inbox-name", "INBOX",
+		"--format", "prom-textfile",
+		"--output", outputPath,
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(t, "", buf.String())
+
+	content, err := os.ReadFile(outputPath)
+	require.NoError(t, err)
+
+	// 実行毎に変わる値は置き換えて比較
+	result := regexp.MustCompile(`(?m)^(maildir_scan_duration_seconds|maildir_last_success_timestamp_seconds) [0-9.e-]+$`).ReplaceAllString(string(content), "$1 X")
+	expected := `# HELP maildir_user_mails Number of mails per user.
+# TYPE maildir_user_mails gauge
+maildir_user_mails{user="user1"} 6
+maildir_user_mails{user="user2"} 2
+maildir_user_mails{user="user3"} 3
+maildir_user_mails{user="user4"} 0
+# HELP maildir_user_size_bytes Total size of mails per user in bytes.
+# TYPE maildir_user_size_bytes gauge
+maildir_user_size_bytes{user="user1"} 21
+maildir_user_size_bytes{user="user2"} 300
+maildir_user_size_bytes{user="user3"} 6000
+maildir_user_size_bytes{user="user4"} 0
+# HELP maildir_folder_mails Number of mails per user and folder.
+# TYPE maildir_folder_mails gauge
+maildir_folder_mails{user="user1",folder="A"} 2
+maildir_folder_mails{user="user1",folder="B"} 2
+maildir_folder_mails{user="user1",folder="INBOX"} 2
+maildir_folder_mails{user="user2",folder="INBOX"} 1
+maildir_folder_mails{user="user2",folder="Z"} 1
+maildir_folder_mails{user="user3",folder="INBOX"} 3
+maildir_folder_mails{user="user4",folder="INBOX"} 0
+# HELP maildir_folder_size_bytes Total size of mails per user and folder in bytes.
+# TYPE maildir_folder_size_bytes gauge
+maildir_folder_size_bytes{user="user1",folder="A"} 7
+maildir_folder_size_bytes{user="user1",folder="B"} 11
+maildir_folder_size_bytes{user="user1",folder="INBOX"} 3
+maildir_folder_size_bytes{user="user2",folder="INBOX"} 100
+maildir_folder_size_bytes{user="user2",folder="Z"} 200
+maildir_folder_size_bytes{user="user3",folder="INBOX"} 6000
+maildir_folder_size_bytes{user="user4",folder="INBOX"} 0
+# HELP maildir_month_mails Number of mails per user and received month.
+# TYPE maildir_month_mails gauge
+maildir_month_mails{user="user1",month="2022-11"} 2
+maildir_month_mails{user="user1",month="2022-12"} 2
+maildir_month_mails{user="user1",month="2023-01"} 1
+maildir_month_mails{user="user1",month="2023-02"} 1
+maildir_month_mails{user="user2",month="2021-12"} 2
+maildir_month_mails{user="user3",month="2022-11"} 1
+maildir_month_mails{user="user3",month="2022-12"} 1
+maildir_month_mails{user="user3",month="2023-01"} 1
+# HELP maildir_month_size_bytes Total size of mails per user and received month in bytes.
+# TYPE maildir_month_size_bytes gauge
+maildir_month_size_bytes{user="user1",month="2022-11"} 6
+maildir_month_size_bytes{user="user1",month="2022-12"} 8
+maildir_month_size_bytes{user="user1",month="2023-01"} 3
+maildir_month_size_bytes{user="user1",month="2023-02"} 4
+maildir_month_size_bytes{user="user2",month="2021-12"} 300
+maildir_month_size_bytes{user="user3",month="2022-11"} 1000
+maildir_month_size_bytes{user="user3",month="2022-12"} 2000
+maildir_month_size_bytes{user="user3",month="2023-01"} 3000
+# HELP maildir_scan_errors Number of mail folders that could not be read in the last scan.
+# TYPE maildir_scan_errors gauge
+maildir_scan_errors 0
+# HELP maildir_scan_duration_seconds Duration of the last scan in seconds.
+# TYPE maildir_scan_duration_seconds gauge
+maildir_scan_duration_seconds X
+# HELP maildir_last_success_timestamp_seconds Unix time of the last successful scan.
+# TYPE maildir_last_success_timestamp_seconds gauge
+maildir_last_success_timestamp_seconds X
+`
+	assert.Equal(t, expected, result)
+
+	// node_exporterから読めるように
+	info, err := os.Stat(outputPath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+
+	// 一時ファイルは残らない
+	entries, err := os.ReadDir(filepath.Dir(outputPath))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestAllCmd_PromTextfile_Stdout(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	maildir := "Maildir"
+
+	users := setupTestAllMaildir(t, temp, maildir)
+
+	// テスト用にメソッド差し替え
+	loadPasswd = func(passwdPath string) ([]user.User, error) {
+		return users, nil
+	}
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"all",
+		"-d", maildir,
+		"--format", "prom-textfile",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	result := buf.String()
+	// INBOXの名前を指定しない場合は空
+	assert.Contains(t, result, "maildir_folder_mails{user=\"user3\",folder=\"\"} 3\n")
+	assert.Contains(t, result, "maildir_scan_errors 0\n")
+}
+
+func TestAllCmd_PromTextfile_Errors(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		previous string
+		expected string
+	}{
+		// 前回の値を引き継ぐ
+		{"previous", "maildir_scan_errors 0\nmaildir_last_success_timestamp_seconds 1677628800.123\n", "maildir_last_success_timestamp_seconds 1677628800.123\n"},
+		// 前回の値が無い場合は出力しない
+		{"no previous", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			// ARRANGE
+			temp := t.TempDir()
+			maildir := "Maildir"
+
+			users := setupTestAllMaildir(t, temp, maildir)
+
+			// Maildirはあるが、その配下にnew/cur/tmpが無い
+			homeDir := createDir(t, temp, "user9")
+			users = append(users, user.User{Name: "user9", HomeDir: homeDir})
+			createDir(t, homeDir, "Maildir")
+
+			// テスト用にメソッド差し替え
+			loadPasswd = func(passwdPath string) ([]user.User, error) {
+				return users, nil
+			}
+
+			outputPath := filepath.Join(t.TempDir(), "maildir.prom")
+			if tt.previous != "" {
+				createFile(t, outputPath, tt.previous)
+			}
+
+			rootCmd := newRootCmd()
+			rootCmd.SetArgs([]string{
+				"all",
+				"-d", maildir,
+				"--format", "prom-textfile",
+				"--output", outputPath,
+				"--on-error", "skip",
+			})
+
+			buf := new(bytes.Buffer)
+			rootCmd.SetOutput(buf)
+
+			// ACT
+			err := rootCmd.Execute()
+
+			// ASSERT
+			require.NoError(t, err)
+
+			content, err := os.ReadFile(outputPath)
+			require.NoError(t, err)
+
+			result := string(content)
+			assert.Contains(t, result, "maildir_user_mails{user=\"user1\"} 6\n")
+			assert.Contains(t, result, "maildir_scan_errors 1\n")
+
+			lastSuccess := regexp.MustCompile(`(?m)^maildir_last_success_timestamp_seconds .*\n`).FindString(result)
+			assert.Equal(t, tt.expected, lastSuccess)
+		})
+	}
+}
+
+func TestAllCmd_Output(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	maildir := "Maildir"
+
+	users := setupTestAllMaildir(t, temp, maildir)
+
+	// テスト用にメソッド差し替え
+	loadPasswd = func(passwdPath string) ([]user.User, error) {
+		return users, nil
+	}
+
+	outputPath := filepath.Join(t.TempDir(), "report.txt")
+	createFile(t, outputPath, "old")
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"all",
+		"-d", maildir,
+		"--output", outputPath,
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(t, "", buf.String())
+
+	content, err := os.ReadFile(outputPath)
+	require.NoError(t, err)
+
+	expected := `[Summary]
+Number of mails : 11
+Total size      : 6,321 byte
+
+`
+	assert.Equal(t, expected, string(content))
+}
+
+func TestAllCmd_InvalidFormat(t *testing.T) {
+
+	// ARRANGE
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"all",
+		"-d", "Maildir",
+		"--format", "xxx",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "invalid format 'xxx'")
+}
+
+func TestWriteOutput_DirectoryNotFound(t *testing.T) {
+
+	// ARRANGE
+	outputPath := filepath.Join(t.TempDir(), "xxx", "maildir.prom")
+
+	// ACT
+	err := writeOutput(outputPath, nil, func(writer io.Writer) {})
+
+	// ASSERT
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestEscapePromLabelValue(t *testing.T) {
+
+	assert.Equal(t, `a\\b\"c\nd`, escapePromLabelValue("a\\b\"c\nd"))
+	assert.Equal(t, "受信箱", escapePromLabelValue("受信箱"))
+}
@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/onozaty/maildir-stats/maildir"
+	"github.com/spf13/cobra"
+)
+
+func newPurgeCmd() *cobra.Command {
+
+	subCmd := &cobra.Command{
+		Use:   "purge",
+		Short: "Delete old mails in the specified folders",
+		RunE: func(cmd *cobra.Command, args []string) error {
+
+			maildirPath, _ := cmd.Flags().GetString("dir")
+			mailFolderNames, _ := cmd.Flags().GetStringSlice("folder")
+
+			olderThanStr, _ := cmd.Flags().GetString("older-than")
+			olderThan, err := parseAge(olderThanStr)
+			if err != nil {
+				return err
+			}
+
+			flags, _ := cmd.Flags().GetString("flag")
+			inboxFolderName, _ := cmd.Flags().GetString("inbox-name")
+
+			execute, _ := cmd.Flags().GetBool("execute")
+			auditLogPath, _ := cmd.Flags().GetString("audit-log")
+			if execute && auditLogPath == "" {
+				return fmt.Errorf("--audit-log is required with --execute")
+			}
+
+			// 引数の解析に成功した時点で、エラーが起きてもUsageは表示しない
+			cmd.SilenceUsage = true
+
+			return runPurge(
+				maildirPath,
+				maildir.SelectCondition{
+					MailFolderNames: mailFolderNames,
+					Before:          time.Now().Add(-olderThan),
+					Flags:           flags,
+				},
+				inboxFolderName,
+				execute,
+				auditLogPath,
+				cmd.OutOrStdout())
+		},
+	}
+
+	subCmd.Flags().StringP("dir", "d", "", "User maildir path.")
+	subCmd.MarkFlagRequired("dir")
+	subCmd.Flags().StringSliceP("folder", "", nil, "Target folder names. (can be specified multiple times)")
+	subCmd.MarkFlagRequired("folder")
+	subCmd.Flags().StringP("older-than", "", "", "Target mails older than this. (e.g. 30d, 2w, 12h)")
+	subCmd.MarkFlagRequired("older-than")
+	subCmd.Flags().StringP("flag", "", "", "Target mails with all of these maildir flags. (e.g. T)")
+	subCmd.Flags().StringP("inbox-name", "", "", "The name of the inbox folder. (default \"\")")
+	subCmd.Flags().BoolP("execute", "", false, "Actually delete mails. Without this, only reports what would be deleted (dry run).")
+	subCmd.Flags().StringP("audit-log", "", "", "Audit log file path to append deleted mails. (required with --execute)")
+
+	return subCmd
+}
+
+func runPurge(maildirPath string, condition maildir.SelectCondition, inboxFolderName string, execute bool, auditLogPath string, writer io.Writer) error {
+
+	selectAggregator := maildir.NewSelectAggregator(condition)
+	if err := maildir.AggregateMailFolders(maildirPath, inboxFolderName, selectAggregator); err != nil {
+		return err
+	}
+
+	if !execute {
+		// Dry run
+		results := selectAggregator.FolderResults()
+		printSummaryReport(writer, results)
+		fmt.Fprintf(writer, "\n")
+		printFolderResults(writer, results, NameAsc)
+		fmt.Fprintf(writer, "\n")
+		fmt.Fprintf(writer, "Dry run: no mails were deleted. Specify --execute to delete them.\n")
+		return nil
+	}
+
+	auditLog, err := os.OpenFile(auditLogPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer auditLog.Close()
+
+	purged, purgeErr := maildir.PurgeMails(maildirPath, selectAggregator.Results(), auditLog)
+
+	// エラーとなった場合も、それまでに削除したものは出力しておく
+	results := maildir.FolderResultsOf(purged)
+	printSummaryReport(writer, results)
+	fmt.Fprintf(writer, "\n")
+	printFolderResults(writer, results, NameAsc)
+	fmt.Fprintf(writer, "\n")
+
+	return purgeErr
+}
+
+// 日数(d)、週(w)の指定にも対応した期間の解析
+func parseAge(str string) (time.Duration, error) {
+
+	units := map[string]time.Duration{
+		"d": 24 * time.Hour,
+		"w": 7 * 24 * time.Hour,
+	}
+
+	for suffix, unit := range units {
+		if strings.HasSuffix(str, suffix) {
+			n, err := strconv.Atoi(strings.TrimSuffix(str, suffix))
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("invalid age '%s'", str)
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+
+	duration, err := time.ParseDuration(str)
+	if err != nil || duration < 0 {
+		return 0, fmt.Errorf("invalid age '%s'", str)
+	}
+	return duration, nil
+}
@@ -0,0 +1,218 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPurgeCmd_DryRun(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	setupTestPurgeMaildir(t, temp)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"purge",
+		"-d", temp,
+		"--folder", "Trash",
+		"--folder", "Junk",
+		"--older-than", "30d",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	result := buf.String()
+	expected := `[Summary]
+Number of mails : 3
+Total size      : 33 byte
+
+[Folder]
+  Name  | Number of mails | Total size(byte)  
+--------+-----------------+-------------------
+  Junk  |               1 |               21  
+  Trash |               2 |               12  
+
+Dry run: no mails were deleted. Specify --execute to delete them.
+`
+	assert.Equal(t, expected, result)
+
+	// 削除されていないこと
+	assert.FileExists(t, filepath.Join(temp, ".Trash", "cur", "1640995200.M1:2,ST"))
+}
+
+func TestPurgeCmd_Execute(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	setupTestPurgeMaildir(t, temp)
+	createFile(t, filepath.Join(temp, "maildirsize"), "1000000S,1000C\n")
+
+	auditLogPath := filepath.Join(t.TempDir(), "audit.log")
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"purge",
+		"-d", temp,
+		"--folder", "Trash",
+		"--older-than", "2w",
+		"--flag", "T",
+		"--execute",
+		"--audit-log", auditLogPath,
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	result := buf.String()
+	expected := `[Summary]
+Number of mails : 1
+Total size      : 11 byte
+
+[Folder]
+  Name  | Number of mails | Total size(byte)  
+--------+-----------------+-------------------
+  Trash |               1 |               11  
+
+`
+	assert.Equal(t, expected, result)
+
+	assert.NoFileExists(t, filepath.Join(temp, ".Trash", "cur", "1640995200.M1:2,ST"))
+	assert.FileExists(t, filepath.Join(temp, ".Trash", "cur", "1640995200.M2:2,S"))
+
+	auditLog, err := os.ReadFile(auditLogPath)
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(
+		string(auditLog),
+		"\tdeleted\tTrash\t11\t"+filepath.Join(temp, ".Trash", "cur", "1640995200.M1:2,ST")+"\n"))
+
+	maildirSize, err := os.ReadFile(filepath.Join(temp, "maildirsize"))
+	require.NoError(t, err)
+	assert.Equal(t, "1000000S,1000C\n-11 -1\n", string(maildirSize))
+}
+
+func TestPurgeCmd_ExecuteWithoutAuditLog(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	setupTestPurgeMaildir(t, temp)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"purge",
+		"-d", temp,
+		"--folder", "Trash",
+		"--older-than", "30d",
+		"--execute",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "--audit-log is required with --execute")
+
+	// 削除されていないこと
+	assert.FileExists(t, filepath.Join(temp, ".Trash", "cur", "1640995200.M1:2,ST"))
+}
+
+func TestPurgeCmd_InvalidOlderThan(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"purge",
+		"-d", temp,
+		"--folder", "Trash",
+		"--older-than", "30x",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "invalid age '30x'")
+}
+
+func TestParseAge(t *testing.T) {
+
+	tests := []struct {
+		str      string
+		expected time.Duration
+	}{
+		{"30d", 30 * 24 * time.Hour},
+		{"2w", 14 * 24 * time.Hour},
+		{"12h", 12 * time.Hour},
+		{"0d", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.str, func(t *testing.T) {
+			duration, err := parseAge(tt.str)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, duration)
+		})
+	}
+
+	for _, str := range []string{"", "d", "-1d", "1.5d", "abc"} {
+		t.Run("invalid "+str, func(t *testing.T) {
+			_, err := parseAge(str)
+			require.EqualError(t, err, "invalid age '"+str+"'")
+		})
+	}
+}
+
+func setupTestPurgeMaildir(t *testing.T, rootMailFolderPath string) {
+
+	recent := strconv.FormatInt(time.Now().Unix(), 10)
+
+	// INBOX
+	createMailFolder(t, rootMailFolderPath, []mail{
+		{"cur/1640995200.M1:2,ST", 1}, // 対象フォルダではない
+	})
+
+	// その他フォルダ
+	{
+		sub := createDir(t, rootMailFolderPath, ".Trash")
+		createMailFolder(t, sub, []mail{
+			{"cur/1640995200.M1:2,ST", 11},
+			{"cur/1640995200.M2:2,S", 1},
+			{"cur/" + recent + ".M3:2,ST", 13}, // 新しいので対象外
+		})
+	}
+	{
+		sub := createDir(t, rootMailFolderPath, ".Junk")
+		createMailFolder(t, sub, []mail{
+			{"new/1640995200.M1", 21},
+		})
+	}
+}
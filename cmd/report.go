@@ -0,0 +1,192 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/onozaty/maildir-stats/maildir"
+)
+
+// --format markdown、--template に渡すレポートの内容
+type reportData struct {
+	GeneratedAt time.Time
+	Host        string
+	Summary     *reportSummary
+	Sections    []*reportSection
+	Errors      []*maildir.AggregateError
+}
+
+type reportSummary struct {
+	Users     int
+	Count     int64
+	TotalSize int64
+}
+
+// 集計結果の表 (-u、-y、-m、--sender、--sender-domain で指定したもの)
+type reportSection struct {
+	Title     string // User, Year, Month, Sender, Sender domain
+	NameTitle string // 名前の列の見出し
+	Rows      []*maildir.AggregateResult
+}
+
+// タイトルで表を探す(無い場合はnil)
+// テンプレートで {{with .Section "User"}} のように使う
+func (d *reportData) Section(title string) *reportSection {
+
+	for _, section := range d.Sections {
+		if section.Title == title {
+			return section
+		}
+	}
+	return nil
+}
+
+func newReportData(
+	condition allReportCondition,
+	userAggregator *maildir.UserAggregator,
+	yearAggregator *maildir.TimeAggregator,
+	monthAggregator *maildir.TimeAggregator,
+	senderAggregator *maildir.SenderAggregator,
+	senderDomainAggregator *maildir.SenderAggregator,
+	errors []*maildir.AggregateError,
+	generatedAt time.Time) *reportData {
+
+	host, _ := hostname()
+
+	data := &reportData{
+		GeneratedAt: generatedAt,
+		Host:        host,
+		Summary:     &reportSummary{},
+		Sections:    []*reportSection{},
+		Errors:      errors,
+	}
+
+	for _, result := range userAggregator.Results() {
+		data.Summary.Users++
+		data.Summary.Count += result.Count
+		data.Summary.TotalSize += result.TotalSize
+	}
+
+	// 表形式の出力と同じ順、同じ並び順にする
+	if condition.reportUser {
+		results := append([]*maildir.AggregateResult{}, userAggregator.Results()...)
+		sortResults(results, condition.reportUserSortCondition)
+		data.Sections = append(data.Sections, &reportSection{"User", "Name", results})
+	}
+
+	if condition.reportYear {
+		results := yearAggregator.Results()
+		sortResults(results, condition.reportYearSortCondition)
+		data.Sections = append(data.Sections, &reportSection{"Year", "Year", results})
+	}
+
+	if condition.reportMonth {
+		results := monthAggregator.Results()
+		sortResults(results, condition.reportMonthSortCondition)
+		data.Sections = append(data.Sections, &reportSection{"Month", "Month", results})
+	}
+
+	for _, sender := range []struct {
+		report     bool
+		title      string
+		nameTitle  string
+		aggregator *maildir.SenderAggregator
+	}{
+		{condition.reportSender, "Sender", "Sender", senderAggregator},
+		{condition.reportSenderDomain, "Sender domain", "Domain", senderDomainAggregator},
+	} {
+		if !sender.report {
+			continue
+		}
+
+		results := sender.aggregator.Results()
+		sortResults(results, condition.reportSenderSortCondition)
+		if condition.reportSenderTop > 0 && len(results) > condition.reportSenderTop {
+			results = results[:condition.reportSenderTop]
+		}
+		data.Sections = append(data.Sections, &reportSection{sender.title, sender.nameTitle, results})
+	}
+
+	return data
+}
+
+// GitHub Flavored Markdownの表で出力する
+func printMarkdownReport(writer io.Writer, data *reportData) {
+
+	fmt.Fprintf(writer, "# maildir-stats report\n")
+	fmt.Fprintf(writer, "\n")
+	fmt.Fprintf(writer, "Generated at %s", data.GeneratedAt.Format("2006-01-02 15:04:05 MST"))
+	if data.Host != "" {
+		fmt.Fprintf(writer, " on %s", escapeMarkdown(data.Host))
+	}
+	fmt.Fprintf(writer, "\n")
+
+	// Summary
+	fmt.Fprintf(writer, "\n## Summary\n\n")
+	fmt.Fprintf(writer, "| Item | Value |\n")
+	fmt.Fprintf(writer, "|---|---:|\n")
+	fmt.Fprintf(writer, "| Number of users | %s |\n", humanize.Comma(int64(data.Summary.Users)))
+	fmt.Fprintf(writer, "| Number of mails | %s |\n", humanize.Comma(data.Summary.Count))
+	fmt.Fprintf(writer, "| Total size(byte) | %s |\n", humanize.Comma(data.Summary.TotalSize))
+
+	for _, section := range data.Sections {
+		fmt.Fprintf(writer, "\n## %s\n\n", section.Title)
+		fmt.Fprintf(writer, "| %s | Number of mails | Total size(byte) |\n", section.NameTitle)
+		fmt.Fprintf(writer, "|---|---:|---:|\n")
+		for _, row := range section.Rows {
+			fmt.Fprintf(writer, "| %s | %s | %s |\n", escapeMarkdown(row.Name), humanize.Comma(row.Count), humanize.Comma(row.TotalSize))
+		}
+	}
+
+	// Errors
+	if len(data.Errors) > 0 {
+		fmt.Fprintf(writer, "\n## Errors\n\n")
+		fmt.Fprintf(writer, "| User | Folder | Error |\n")
+		fmt.Fprintf(writer, "|---|---|---|\n")
+		for _, err := range data.Errors {
+			fmt.Fprintf(writer, "| %s | %s | %s |\n", escapeMarkdown(err.UserName), escapeMarkdown(err.MailFolderName), escapeMarkdown(err.Err.Error()))
+		}
+	}
+}
+
+// 表のセルの区切り(|)や改行で、表が崩れないように
+func escapeMarkdown(value string) string {
+
+	return strings.NewReplacer(
+		`\`, `\\`,
+		`|`, `\|`,
+		"\r\n", " ",
+		"\n", " ",
+	).Replace(value)
+}
+
+func loadReportTemplate(templatePath string) (*template.Template, error) {
+
+	content, err := os.ReadFile(templatePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return template.New("report").Funcs(template.FuncMap{
+		"bytes": func(size int64) string {
+			return humanize.Bytes(uint64(size))
+		},
+		"comma": humanize.Comma,
+	}).Parse(string(content))
+}
+
+// テンプレートの実行に失敗した場合に、途中までの内容を出力しないように、一度バッファに出力する
+func renderReportTemplate(reportTemplate *template.Template, data *reportData) ([]byte, error) {
+
+	buffer := &bytes.Buffer{}
+	if err := reportTemplate.Execute(buffer, data); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
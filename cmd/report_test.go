@@ -0,0 +1,304 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/onozaty/maildir-stats/maildir"
+	"github.com/onozaty/maildir-stats/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllCmd_Markdown(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	maildirName := "Maildir"
+
+	users := setupTestAllMaildir(t, temp, maildirName)
+
+	// テスト用にメソッド差し替え
+	loadPasswd = func(passwdPath string) ([]user.User, error) {
+		return users, nil
+	}
+	hostname = func() (string, error) {
+		return "mail01", nil
+	}
+	t.Cleanup(func() { hostname = os.Hostname })
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"all",
+		"-d", maildirName,
+		"-u",
+		"-y",
+		"--sort-user", "size-desc",
+		"--format", "markdown",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// 日時は実行時のものになるので、1行目以降を比較
+	header, body, _ := strings.Cut(buf.String(), "\n\n## Summary\n")
+	assert.True(t, strings.HasPrefix(header, "# maildir-stats report\n\nGenerated at "))
+	assert.True(t, strings.HasSuffix(header, " on mail01"))
+
+	expected := `
+| Item | Value |
+|---|---:|
+| Number of users | 4 |
+| Number of mails | 11 |
+| Total size(byte) | 6,321 |
+
+## User
+
+| Name | Number of mails | Total size(byte) |
+|---|---:|---:|
+| user3 | 3 | 6,000 |
+| user2 | 2 | 300 |
+| user1 | 6 | 21 |
+| user4 | 0 | 0 |
+
+## Year
+
+| Year | Number of mails | Total size(byte) |
+|---|---:|---:|
+| 2021 | 2 | 300 |
+| 2022 | 6 | 3,014 |
+| 2023 | 3 | 3,007 |
+`
+	assert.Equal(t, expected, body)
+}
+
+func TestPrintMarkdownReport(t *testing.T) {
+
+	// ARRANGE
+	data := &reportData{
+		GeneratedAt: time.Date(2023, 3, 1, 12, 34, 56, 0, time.UTC),
+		Host:        "mail01",
+		Summary:     &reportSummary{Users: 1, Count: 1234, TotalSize: 5678901},
+		Sections: []*reportSection{
+			{
+				Title:     "Sender",
+				NameTitle: "Sender",
+				Rows: []*maildir.AggregateResult{
+					{Name: "a|b@example.com", Count: 1234, TotalSize: 5678901},
+				},
+			},
+		},
+		Errors: []*maildir.AggregateError{
+			{UserName: "user1", MailFolderName: "A|B", Err: os.ErrPermission},
+		},
+	}
+
+	buf := new(bytes.Buffer)
+
+	// ACT
+	printMarkdownReport(buf, data)
+
+	// ASSERT
+	expected := `# maildir-stats report
+
+Generated at 2023-03-01 12:34:56 UTC on mail01
+
+## Summary
+
+| Item | Value |
+|---|---:|
+| Number of users | 1 |
+| Number of mails | 1,234 |
+| Total size(byte) | 5,678,901 |
+
+## Sender
+
+| Sender | Number of mails | Total size(byte) |
+|---|---:|---:|
+| a\|b@example.com | 1,234 | 5,678,901 |
+
+## Errors
+
+| User | Folder | Error |
+|---|---|---|
+| user1 | A\|B | permission denied |
+`
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestEscapeMarkdown(t *testing.T) {
+
+	assert.Equal(t, "abc", escapeMarkdown("abc"))
+	assert.Equal(t, `a\|b`, escapeMarkdown("a|b"))
+	assert.Equal(t, `a\\\|b`, escapeMarkdown(`a\|b`))
+	assert.Equal(t, "a b c", escapeMarkdown("a\r\nb\nc"))
+}
+
+func TestAllCmd_Template(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	maildirName := "Maildir"
+
+	users := setupTestAllMaildir(t, temp, maildirName)
+
+	// テスト用にメソッド差し替え
+	loadPasswd = func(passwdPath string) ([]user.User, error) {
+		return users, nil
+	}
+	hostname = func() (string, error) {
+		return "mail01", nil
+	}
+	t.Cleanup(func() { hostname = os.Hostname })
+
+	templatePath := filepath.Join(t.TempDir(), "report.tmpl")
+	err := os.WriteFile(templatePath, []byte(`host={{.Host}} year={{.GeneratedAt.Year | printf "%d" | len}}
+users={{.Summary.Users}} mails={{comma .Summary.Count}} size={{bytes .Summary.TotalSize}}
+{{range .Sections}}[{{.Title}}]
+{{range .Rows}}{{.Name}},{{.Count}},{{.TotalSize}}
+{{end}}{{end}}{{with .Section "User"}}top={{(index .Rows 0).Name}}
+{{end}}{{if not (.Section "Month")}}no month
+{{end}}errors={{len .Errors}}
+`), 0644)
+	require.NoError(t, err)
+
+	outputPath := filepath.Join(t.TempDir(), "report.txt")
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"all",
+		"-d", maildirName,
+		"-u",
+		"--sort-user", "count-desc",
+		"--template", templatePath,
+		"--output", outputPath,
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err = rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(t, "", buf.String())
+
+	content, err := os.ReadFile(outputPath)
+	require.NoError(t, err)
+
+	expected := `host=mail01 year=4
+users=4 mails=11 size=6.3 kB
+[User]
+user1,6,21
+user3,3,6000
+user2,2,300
+user4,0,0
+top=user1
+no month
+errors=0
+`
+	assert.Equal(t, expected, string(content))
+}
+
+func TestAllCmd_Template_WithFormat(t *testing.T) {
+
+	// ARRANGE
+	templatePath := filepath.Join(t.TempDir(), "report.tmpl")
+	err := os.WriteFile(templatePath, []byte("{{.Host}}"), 0644)
+	require.NoError(t, err)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"all",
+		"-d", "Maildir",
+		"--template", templatePath,
+		"--format", "markdown",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err = rootCmd.Execute()
+
+	// ASSERT
+	require.Error(t, err)
+	assert.Equal(t, "--template cannot be used with --format markdown", err.Error())
+}
+
+func TestAllCmd_Template_ParseError(t *testing.T) {
+
+	// ARRANGE
+	templatePath := filepath.Join(t.TempDir(), "report.tmpl")
+	err := os.WriteFile(templatePath, []byte("{{.Host"), 0644)
+	require.NoError(t, err)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"all",
+		"-d", "Maildir",
+		"--template", templatePath,
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err = rootCmd.Execute()
+
+	// ASSERT
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "template: report:1: unclosed action")
+}
+
+func TestAllCmd_Template_ExecuteError(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	maildirName := "Maildir"
+
+	users := setupTestAllMaildir(t, temp, maildirName)
+
+	// テスト用にメソッド差し替え
+	loadPasswd = func(passwdPath string) ([]user.User, error) {
+		return users, nil
+	}
+
+	templatePath := filepath.Join(t.TempDir(), "report.tmpl")
+	err := os.WriteFile(templatePath, []byte("{{.Host}} {{.Unknown}}"), 0644)
+	require.NoError(t, err)
+
+	outputPath := filepath.Join(t.TempDir(), "report.txt")
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"all",
+		"-d", maildirName,
+		"--template", templatePath,
+		"--output", outputPath,
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err = rootCmd.Execute()
+
+	// ASSERT
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "can't evaluate field Unknown")
+
+	// 途中までの内容も出力しない
+	assert.NoFileExists(t, outputPath)
+}
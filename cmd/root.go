@@ -1,7 +1,9 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"os"
 
 	"github.com/spf13/cobra"
 )
@@ -14,22 +16,43 @@ func newRootCmd() *cobra.Command {
 		Run: func(cmd *cobra.Command, args []string) {
 			_ = cmd.Help()
 		},
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			// 設定ファイルの誤りはフラグの誤りとして扱う(checkではUNKNOWNとなるように)
+			if err := applyConfig(cmd); err != nil {
+				return cmd.FlagErrorFunc()(cmd, err)
+			}
+			return nil
+		},
 		SilenceErrors: true,
 		CompletionOptions: cobra.CompletionOptions{
 			HiddenDefaultCmd: true,
 		},
 	}
 
+	rootCmd.PersistentFlags().StringP("config", "", "", "Config file path. (default ~/.config/maildir-stats/config.yaml or /etc/maildir-stats.yaml)")
+	rootCmd.PersistentFlags().StringP("profile", "", "", "Profile name in config file. (or MAILDIR_STATS_PROFILE)")
+
 	rootCmd.AddCommand(newVersionCmd())
 	rootCmd.AddCommand(newUserCmd())
 	rootCmd.AddCommand(newAllCmd())
 	rootCmd.AddCommand(newUserListCmd())
+	rootCmd.AddCommand(newDuplicatesCmd())
+	rootCmd.AddCommand(newPurgeCmd())
+	rootCmd.AddCommand(newArchiveCmd())
+	rootCmd.AddCommand(newImapCmd())
+	rootCmd.AddCommand(newVerifyCmd())
+	rootCmd.AddCommand(newHealthCmd())
+	rootCmd.AddCommand(newCheckCmd())
+	rootCmd.AddCommand(newAlertCmd())
+	rootCmd.AddCommand(newNotifyCmd())
+	rootCmd.AddCommand(newExploreCmd())
+	rootCmd.AddCommand(newServeCmd())
 
 	for _, c := range rootCmd.Commands() {
 		// フラグ以外は受け付けないように
 		c.Args = func(cmd *cobra.Command, args []string) error {
 			if len(args) > 0 {
-				return fmt.Errorf("only flags can be specified")
+				return cmd.FlagErrorFunc()(cmd, fmt.Errorf("only flags can be specified"))
 			}
 			return nil
 		}
@@ -40,8 +63,23 @@ func newRootCmd() *cobra.Command {
 	return rootCmd
 }
 
+// 終了コードを指定するためのエラー(メッセージは出力済みのもの)
+type exitCodeError struct {
+	code int
+}
+
+func (e *exitCodeError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
 func Execute() {
 
 	rootCmd := newRootCmd()
-	cobra.CheckErr(rootCmd.Execute())
+	err := rootCmd.Execute()
+
+	var exitErr *exitCodeError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.code)
+	}
+	cobra.CheckErr(err)
 }
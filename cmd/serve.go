@@ -0,0 +1,435 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/onozaty/maildir-stats/maildir"
+	"github.com/spf13/cobra"
+)
+
+func newServeCmd() *cobra.Command {
+
+	subCmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve statistics over a JSON REST API (and a web UI with --ui)",
+		RunE: func(cmd *cobra.Command, args []string) error {
+
+			maildirName, _ := cmd.Flags().GetString("mail-dir")
+			mailSpoolPath, _ := cmd.Flags().GetString("mail-spool")
+			listenAddress, _ := cmd.Flags().GetString("listen")
+			ui, _ := cmd.Flags().GetBool("ui")
+			inboxFolderName, _ := cmd.Flags().GetString("inbox-name")
+
+			errorPolicy, err := getErrorPolicy(cmd.Flags(), "on-error")
+			if err != nil { // 許可されていなパラメータの可能性あり
+				return err
+			}
+
+			storageFormat, err := getStorageFormat(cmd.Flags(), "format-in")
+			if err != nil { // 許可されていなパラメータの可能性あり
+				return err
+			}
+
+			// 引数の解析に成功した時点で、エラーが起きてもUsageは表示しない
+			cmd.SilenceUsage = true
+
+			cache := newServeCache(func() (*serveSnapshot, error) {
+				return scanServeSnapshot(maildirName, mailSpoolPath, storageFormat, inboxFolderName, errorPolicy)
+			})
+
+			// 最初の集計に失敗した場合は、返せるものが無いので終了
+			if err := cache.refresh(); err != nil {
+				return err
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Listening on http://%s/\n", listenAddress)
+
+			server := &http.Server{
+				Addr:              listenAddress,
+				Handler:           newServeHandler(cache, ui),
+				ReadHeaderTimeout: 10 * time.Second,
+			}
+			return server.ListenAndServe()
+		},
+	}
+
+	subCmd.Flags().StringP("mail-dir", "d", "", "User maildir name. (directory of mbox files with --format-in mbox, dbox root with --format-in dbox)")
+	subCmd.MarkFlagRequired("mail-dir")
+	subCmd.Flags().StringP("listen", "", "localhost:8080", "Address to listen on. (host:port)")
+	subCmd.Flags().BoolP("ui", "", false, "Serve the web UI at /.")
+	subCmd.Flags().StringP("on-error", "", "fail", "Behavior when a mail folder cannot be read.\ncan be specified: fail, warn, skip")
+	subCmd.Flags().StringP("format-in", "", "maildir", "Format of the mailbox.\ncan be specified: maildir, mbox, dbox, auto")
+	subCmd.Flags().StringP("mail-spool", "", "/var/spool/mail", "Mail spool directory of inbox mbox files. (used with --format-in mbox, auto)")
+	subCmd.Flags().StringP("inbox-name", "", "INBOX", "The name of the inbox folder.")
+
+	return subCmd
+}
+
+// 1回の集計結果
+type serveSnapshot struct {
+	users          []*maildir.AggregateResult
+	folders        map[string][]*maildir.AggregateResult // ユーザ毎のフォルダ
+	months         map[string][]*maildir.AggregateResult // ユーザ毎の月
+	errors         []*maildir.AggregateError
+	scanStartedAt  time.Time
+	scanFinishedAt time.Time
+}
+
+// 最後の集計結果を保持し、要求に応じて集計し直す
+type serveCache struct {
+	scan      func() (*serveSnapshot, error)
+	scanMutex sync.Mutex // 集計は同時に1つのみ
+
+	mutex    sync.RWMutex
+	snapshot *serveSnapshot
+}
+
+func newServeCache(scan func() (*serveSnapshot, error)) *serveCache {
+	return &serveCache{
+		scan: scan,
+	}
+}
+
+// 集計し直す
+// 集計に失敗した場合は、前回の結果をそのまま残す
+func (c *serveCache) refresh() error {
+
+	snapshot, err := c.scan()
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.snapshot = snapshot
+
+	return nil
+}
+
+func (c *serveCache) current() *serveSnapshot {
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.snapshot
+}
+
+func scanServeSnapshot(maildirName string, mailSpoolPath string, storageFormat maildir.StorageFormat, inboxFolderName string, errorPolicy ErrorPolicy) (*serveSnapshot, error) {
+
+	// 集計し直す時には、ユーザの追加、削除も反映する
+	users, err := loadPasswd(passwdPath)
+	if err != nil {
+		return nil, err
+	}
+
+	userAggregator := maildir.NewUserAggregator()
+	userFolderAggregator := maildir.NewPerUserAggregator(maildir.NewFolderAggregator)
+	userMonthAggregator := maildir.NewPerUserAggregator(maildir.NewMonthAggregator)
+
+	scanStartedAt := time.Now()
+
+	errorCollector := newErrorCollector(errorPolicy)
+	err = maildir.AggregateUserMailboxesWithErrorHandler(
+		maildir.UserMailboxes(users, maildirName, mailSpoolPath, storageFormat),
+		inboxFolderName,
+		maildir.NewMultiAggregator([]maildir.Aggregator{userAggregator, userFolderAggregator, userMonthAggregator}),
+		errorCollector.handle)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &serveSnapshot{
+		users:          userAggregator.Results(),
+		folders:        map[string][]*maildir.AggregateResult{},
+		months:         map[string][]*maildir.AggregateResult{},
+		errors:         errorCollector.errors,
+		scanStartedAt:  scanStartedAt,
+		scanFinishedAt: time.Now(),
+	}
+	for _, perUserResult := range userFolderAggregator.Results() {
+		snapshot.folders[perUserResult.UserName] = perUserResult.Aggregator.Results()
+	}
+	for _, perUserResult := range userMonthAggregator.Results() {
+		snapshot.months[perUserResult.UserName] = perUserResult.Aggregator.Results()
+	}
+
+	return snapshot, nil
+}
+
+// APIで返す集計結果
+type serveResult struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+	Size  int64  `json:"size"`
+}
+
+type serveSummary struct {
+	Host                string        `json:"host"`
+	Users               int           `json:"users"`
+	Count               int64         `json:"count"`
+	Size                int64         `json:"size"`
+	ScanStartedAt       time.Time     `json:"scanStartedAt"`
+	ScanFinishedAt      time.Time     `json:"scanFinishedAt"`
+	ScanDurationSeconds float64       `json:"scanDurationSeconds"`
+	Errors              []*serveError `json:"errors"`
+}
+
+type serveError struct {
+	User   string `json:"user"`
+	Folder string `json:"folder"`
+	Error  string `json:"error"`
+}
+
+// 一覧の並び順、絞り込みの条件(クエリパラメータ)
+type serveQuery struct {
+	sortCondition SortCondition
+	bounds        userListCondition
+	limit         int
+}
+
+func newServeHandler(cache *serveCache, ui bool) http.Handler {
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/summary", cache.handleSummary)
+	mux.HandleFunc("/api/users", cache.handleUsers)
+	mux.HandleFunc("/api/users/", cache.handleUser)
+	mux.HandleFunc("/api/refresh", cache.handleRefresh)
+
+	if ui {
+		mux.HandleFunc("/", handleServeUI)
+	}
+
+	return mux
+}
+
+// GET /api/summary
+func (c *serveCache) handleSummary(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodGet {
+		writeServeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	writeServeJSON(w, http.StatusOK, c.current().summary())
+}
+
+// GET /api/users
+func (c *serveCache) handleUsers(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodGet {
+		writeServeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	query, err := parseServeQuery(r.URL.Query())
+	if err != nil {
+		writeServeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writeServeJSON(w, http.StatusOK, map[string]any{
+		"users": query.apply(c.current().users),
+	})
+}
+
+// GET /api/users/{name}/folders
+// GET /api/users/{name}/months
+func (c *serveCache) handleUser(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodGet {
+		writeServeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	userName, kind, found := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/users/"), "/")
+	if !found || (kind != "folders" && kind != "months") {
+		writeServeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	query, err := parseServeQuery(r.URL.Query())
+	if err != nil {
+		writeServeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	snapshot := c.current()
+	resultsByUser := snapshot.folders
+	if kind == "months" {
+		resultsByUser = snapshot.months
+	}
+
+	results, ok := resultsByUser[userName]
+	if !ok {
+		writeServeError(w, http.StatusNotFound, fmt.Sprintf("user '%s' not found", userName))
+		return
+	}
+
+	if kind == "months" {
+		// 受信日時が不明なものは、他の出力形式と同じくunknownとする
+		months := []*maildir.AggregateResult{}
+		for _, result := range results {
+			name := result.Name
+			if name == "" {
+				name = "unknown"
+			}
+			months = append(months, &maildir.AggregateResult{Name: name, Count: result.Count, TotalSize: result.TotalSize})
+		}
+		results = months
+	}
+
+	writeServeJSON(w, http.StatusOK, map[string]any{
+		"user": userName,
+		kind:   query.apply(results),
+	})
+}
+
+// POST /api/refresh
+func (c *serveCache) handleRefresh(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		writeServeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	// 集計中に要求された場合は、集計を重ねて行わない
+	if !c.scanMutex.TryLock() {
+		writeServeError(w, http.StatusConflict, "scan is already running")
+		return
+	}
+	defer c.scanMutex.Unlock()
+
+	if err := c.refresh(); err != nil {
+		writeServeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeServeJSON(w, http.StatusOK, c.current().summary())
+}
+
+func (s *serveSnapshot) summary() *serveSummary {
+
+	host, _ := hostname()
+
+	summary := &serveSummary{
+		Host:                host,
+		Users:               len(s.users),
+		ScanStartedAt:       s.scanStartedAt,
+		ScanFinishedAt:      s.scanFinishedAt,
+		ScanDurationSeconds: s.scanFinishedAt.Sub(s.scanStartedAt).Seconds(),
+		Errors:              []*serveError{},
+	}
+	for _, result := range s.users {
+		summary.Count += result.Count
+		summary.Size += result.TotalSize
+	}
+	for _, err := range s.errors {
+		summary.Errors = append(summary.Errors, &serveError{User: err.UserName, Folder: err.MailFolderName, Error: err.Err.Error()})
+	}
+
+	return summary
+}
+
+// sort: 並び順 (name-asc, name-desc, count-asc, count-desc, size-asc, size-desc)
+// size-lower, size-upper, count-lower, count-upper: user-listと同じ範囲での絞り込み
+// limit: 件数 (0の場合は全件)
+func parseServeQuery(values url.Values) (*serveQuery, error) {
+
+	query := &serveQuery{
+		sortCondition: NameAsc,
+		bounds: userListCondition{
+			sizeUpper:  math.MaxInt64,
+			countUpper: math.MaxInt64,
+		},
+	}
+
+	if str := values.Get("sort"); str != "" {
+		sortCondition, err := parseSortCondition(str)
+		if err != nil {
+			return nil, err
+		}
+		query.sortCondition = sortCondition
+	}
+
+	for _, bound := range []struct {
+		name  string
+		value *int64
+	}{
+		{"size-lower", &query.bounds.sizeLower},
+		{"size-upper", &query.bounds.sizeUpper},
+		{"count-lower", &query.bounds.countLower},
+		{"count-upper", &query.bounds.countUpper},
+	} {
+		str := values.Get(bound.name)
+		if str == "" {
+			continue
+		}
+
+		value, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s '%s'", bound.name, str)
+		}
+		*bound.value = value
+	}
+
+	if str := values.Get("limit"); str != "" {
+		limit, err := strconv.Atoi(str)
+		if err != nil || limit < 0 {
+			return nil, fmt.Errorf("invalid limit '%s'", str)
+		}
+		query.limit = limit
+	}
+
+	return query, nil
+}
+
+func (q *serveQuery) apply(results []*maildir.AggregateResult) []*serveResult {
+
+	matchResults := []*maildir.AggregateResult{}
+	for _, result := range results {
+		if q.bounds.within(result) {
+			matchResults = append(matchResults, result)
+		}
+	}
+
+	sortResults(matchResults, q.sortCondition)
+	if q.limit > 0 && len(matchResults) > q.limit {
+		matchResults = matchResults[:q.limit]
+	}
+
+	serveResults := []*serveResult{}
+	for _, result := range matchResults {
+		serveResults = append(serveResults, &serveResult{Name: result.Name, Count: result.Count, Size: result.TotalSize})
+	}
+	return serveResults
+}
+
+func writeServeJSON(w http.ResponseWriter, status int, value any) {
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeServeError(w http.ResponseWriter, status int, message string) {
+	writeServeJSON(w, status, map[string]string{"error": message})
+}
+
+// GET /
+func handleServeUI(w http.ResponseWriter, r *http.Request) {
+
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, serveUIPage)
+}
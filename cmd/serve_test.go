@@ -0,0 +1,231 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/onozaty/maildir-stats/maildir"
+	"github.com/onozaty/maildir-stats/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeHandler_Users(t *testing.T) {
+
+	// ARRANGE
+	server, _ := startTestServeServer(t, true)
+
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{"", `{"users":[{"name":"user1","count":6,"size":21},{"name":"user2","count":2,"size":300},{"name":"user3","count":3,"size":6000},{"name":"user4","count":0,"size":0}]}`},
+		{"?sort=size-desc&limit=2", `{"users":[{"name":"user3","count":3,"size":6000},{"name":"user2","count":2,"size":300}]}`},
+		{"?sort=count-asc&size-lower=1&size-upper=300", `{"users":[{"name":"user2","count":2,"size":300},{"name":"user1","count":6,"size":21}]}`},
+		{"?count-lower=3&count-upper=5", `{"users":[{"name":"user3","count":3,"size":6000}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			// ACT
+			status, body := getTestServe(t, server.URL+"/api/users"+tt.query)
+
+			// ASSERT
+			assert.Equal(t, http.StatusOK, status)
+			assert.Equal(t, tt.expected+"\n", body)
+		})
+	}
+}
+
+func TestServeHandler_Folders(t *testing.T) {
+
+	// ARRANGE
+	server, _ := startTestServeServer(t, true)
+
+	// ACT
+	status, body := getTestServe(t, server.URL+"/api/users/user1/folders?sort=size-desc")
+
+	// ASSERT
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, `{"folders":[{"name":"B","count":2,"size":11},{"name":"A","count":2,"size":7},{"name":"INBOX","count":2,"size":3}],"user":"user1"}`+"\n", body)
+}
+
+func TestServeHandler_Months(t *testing.T) {
+
+	// ARRANGE
+	server, _ := startTestServeServer(t, true)
+
+	// ACT
+	status, body := getTestServe(t, server.URL+"/api/users/user2/months")
+
+	// ASSERT
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, `{"months":[{"name":"2021-12","count":2,"size":300}],"user":"user2"}`+"\n", body)
+}
+
+func TestServeHandler_Summary(t *testing.T) {
+
+	// ARRANGE
+	hostname = func() (string, error) {
+		return "mail01", nil
+	}
+	t.Cleanup(func() { hostname = os.Hostname })
+
+	server, _ := startTestServeServer(t, true)
+
+	// ACT
+	status, body := getTestServe(t, server.URL+"/api/summary")
+
+	// ASSERT
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, `{"host":"mail01","users":4,"count":11,"size":6321,"scanStartedAt":"`)
+	assert.Contains(t, body, `"errors":[]}`)
+}
+
+func TestServeHandler_Refresh(t *testing.T) {
+
+	// ARRANGE
+	server, temp := startTestServeServer(t, true)
+
+	// 集計後にメールを追加
+	createFile(t, filepath.Join(temp, "user4", "Maildir", "cur", "1675209600"), strings.Repeat("x", 10))
+
+	// 再集計するまでは前回の結果
+	_, before := getTestServe(t, server.URL+"/api/users/user4/folders")
+	assert.Equal(t, `{"folders":[{"name":"INBOX","count":0,"size":0}],"user":"user4"}`+"\n", before)
+
+	// ACT
+	response, err := http.Post(server.URL+"/api/refresh", "", nil)
+	require.NoError(t, err)
+	response.Body.Close()
+
+	// ASSERT
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	_, after := getTestServe(t, server.URL+"/api/users/user4/folders")
+	assert.Equal(t, `{"folders":[{"name":"INBOX","count":1,"size":10}],"user":"user4"}`+"\n", after)
+}
+
+func TestServeHandler_Refresh_Error(t *testing.T) {
+
+	// ARRANGE
+	server, _ := startTestServeServer(t, true)
+
+	// 再集計時に失敗するように
+	loadPasswd = func(passwdPath string) ([]user.User, error) {
+		return nil, fmt.Errorf("open /etc/passwd: permission denied")
+	}
+
+	// ACT
+	response, err := http.Post(server.URL+"/api/refresh", "", nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	response.Body.Close()
+
+	// ASSERT
+	assert.Equal(t, http.StatusInternalServerError, response.StatusCode)
+	assert.Equal(t, `{"error":"open /etc/passwd: permission denied"}`+"\n", string(body))
+
+	// 前回の結果が残る
+	_, users := getTestServe(t, server.URL+"/api/users?limit=1")
+	assert.Equal(t, `{"users":[{"name":"user1","count":6,"size":21}]}`+"\n", users)
+}
+
+func TestServeHandler_Errors(t *testing.T) {
+
+	// ARRANGE
+	server, _ := startTestServeServer(t, false)
+
+	tests := []struct {
+		method   string
+		path     string
+		status   int
+		expected string
+	}{
+		{http.MethodGet, "/api/users?sort=xxx", http.StatusBadRequest, `{"error":"invalid sort condition 'xxx'"}`},
+		{http.MethodGet, "/api/users?size-lower=1GB", http.StatusBadRequest, `{"error":"invalid size-lower '1GB'"}`},
+		{http.MethodGet, "/api/users?limit=-1", http.StatusBadRequest, `{"error":"invalid limit '-1'"}`},
+		{http.MethodGet, "/api/users/user9/folders", http.StatusNotFound, `{"error":"user 'user9' not found"}`},
+		{http.MethodGet, "/api/users/user1/years", http.StatusNotFound, `{"error":"not found"}`},
+		{http.MethodPost, "/api/users", http.StatusMethodNotAllowed, `{"error":"method not allowed"}`},
+		{http.MethodGet, "/api/refresh", http.StatusMethodNotAllowed, `{"error":"method not allowed"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			// ACT
+			request, err := http.NewRequest(tt.method, server.URL+tt.path, nil)
+			require.NoError(t, err)
+			response, err := http.DefaultClient.Do(request)
+			require.NoError(t, err)
+			defer response.Body.Close()
+
+			// ASSERT
+			body, err := io.ReadAll(response.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.status, response.StatusCode)
+			assert.Equal(t, tt.expected+"\n", string(body))
+		})
+	}
+
+	// --uiが無い場合は画面は表示しない
+	status, _ := getTestServe(t, server.URL+"/")
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+func TestServeHandler_UI(t *testing.T) {
+
+	// ARRANGE
+	server, _ := startTestServeServer(t, true)
+
+	// ACT
+	status, body := getTestServe(t, server.URL+"/")
+
+	// ASSERT
+	assert.Equal(t, http.StatusOK, status)
+	assert.True(t, strings.HasPrefix(body, "<!DOCTYPE html>\n"))
+	assert.Contains(t, body, `fetch("/api/refresh", { method: "POST" })`)
+
+	status, _ = getTestServe(t, server.URL+"/xxx")
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+func startTestServeServer(t *testing.T, ui bool) (*httptest.Server, string) {
+
+	temp := t.TempDir()
+	users := setupTestAllMaildir(t, temp, "Maildir")
+
+	// テスト用にメソッド差し替え
+	loadPasswd = func(passwdPath string) ([]user.User, error) {
+		return users, nil
+	}
+
+	cache := newServeCache(func() (*serveSnapshot, error) {
+		return scanServeSnapshot("Maildir", "", maildir.MaildirStorage, "INBOX", ErrorFail)
+	})
+	require.NoError(t, cache.refresh())
+
+	server := httptest.NewServer(newServeHandler(cache, ui))
+	t.Cleanup(server.Close)
+
+	return server, temp
+}
+
+func getTestServe(t *testing.T, url string) (int, string) {
+
+	response, err := http.Get(url)
+	require.NoError(t, err)
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+
+	return response.StatusCode, string(body)
+}
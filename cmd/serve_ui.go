@@ -0,0 +1,250 @@
+package cmd
+
+// serve --ui で表示する画面
+// 外部のファイルは参照せず、/api/* の結果を表示する
+const serveUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>maildir-stats</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.6em; margin-bottom: 0.2em; }
+h2 { font-size: 1.2em; margin-top: 1.5em; }
+.generated { color: #666; }
+.summary { display: flex; flex-wrap: wrap; gap: 1em; margin: 1.5em 0; }
+.summary div { border: 1px solid #ddd; border-radius: 6px; padding: 0.8em 1.2em; min-width: 10em; }
+.summary .label { color: #666; font-size: 0.85em; }
+.summary .value { font-size: 1.4em; font-weight: bold; }
+.filter { margin: 1em 0; }
+.filter input { width: 8em; }
+.columns { display: flex; flex-wrap: wrap; gap: 2em; }
+table { border-collapse: collapse; min-width: 24em; }
+th, td { padding: 0.3em 0.8em; border-bottom: 1px solid #eee; text-align: left; }
+th { cursor: pointer; user-select: none; background: #f6f6f6; }
+th.asc::after { content: " \25B2"; }
+th.desc::after { content: " \25BC"; }
+.num { text-align: right; }
+tr.link { cursor: pointer; }
+tr.link:hover, tr.selected { background: #eef4fb; }
+.error { color: #c00; }
+</style>
+</head>
+<body>
+<h1>maildir-stats</h1>
+<div class="generated"><span id="scanned"></span> <button id="refresh">Refresh</button> <span id="message"></span></div>
+
+<div class="summary">
+<div><div class="label">Number of users</div><div class="value" id="summary-users"></div></div>
+<div><div class="label">Number of mails</div><div class="value" id="summary-count"></div></div>
+<div><div class="label">Total size</div><div class="value" id="summary-size"></div></div>
+<div><div class="label">Errors</div><div class="value" id="summary-errors"></div></div>
+</div>
+
+<form class="filter" id="filter">
+Size <input name="size-lower" placeholder="lower"> - <input name="size-upper" placeholder="upper">
+Count <input name="count-lower" placeholder="lower"> - <input name="count-upper" placeholder="upper">
+<button type="submit">Filter</button>
+</form>
+
+<div class="columns">
+<div>
+<h2>Users</h2>
+<table id="users"></table>
+</div>
+<div id="detail" hidden>
+<h2 id="detail-title"></h2>
+<h2>Folders</h2>
+<table id="folders"></table>
+<h2>Months</h2>
+<table id="months"></table>
+</div>
+</div>
+
+<div id="errors" hidden>
+<h2>Errors</h2>
+<table id="error-list"></table>
+</div>
+
+<script>
+(function () {
+  var state = {
+    users: { sort: "name-asc" },
+    folders: { sort: "name-asc" },
+    months: { sort: "name-asc" },
+    selectedUser: null
+  };
+
+  function comma(value) {
+    return Number(value).toLocaleString("en-US");
+  }
+
+  function bytes(value) {
+    var units = ["B", "kB", "MB", "GB", "TB", "PB"];
+    var size = Number(value);
+    var i = 0;
+    while (size >= 1000 && i < units.length - 1) {
+      size /= 1000;
+      i++;
+    }
+    return (i == 0 ? size : size.toFixed(1)) + " " + units[i];
+  }
+
+  function filterQuery() {
+    var params = new URLSearchParams();
+    var inputs = document.getElementById("filter").elements;
+    for (var i = 0; i < inputs.length; i++) {
+      if (inputs[i].name && inputs[i].value) {
+        params.set(inputs[i].name, inputs[i].value);
+      }
+    }
+    return params;
+  }
+
+  function getJSON(url) {
+    return fetch(url).then(function (response) {
+      return response.json().then(function (body) {
+        if (!response.ok) {
+          throw new Error(body.error);
+        }
+        return body;
+      });
+    });
+  }
+
+  function showMessage(text) {
+    var message = document.getElementById("message");
+    message.textContent = text;
+    message.className = text ? "error" : "";
+  }
+
+  function renderTable(table, key, nameTitle, rows, onClick) {
+    table.textContent = "";
+
+    var head = table.createTHead().insertRow();
+    [["name", nameTitle, ""], ["count", "Number of mails", "num"], ["size", "Total size(byte)", "num"]].forEach(function (column) {
+      var th = document.createElement("th");
+      th.textContent = column[1];
+      th.className = column[2];
+      if (state[key].sort.indexOf(column[0] + "-") == 0) {
+        th.className += " " + state[key].sort.substring(column[0].length + 1);
+      }
+      th.addEventListener("click", function () {
+        var current = state[key].sort;
+        state[key].sort = column[0] + (current == column[0] + "-asc" ? "-desc" : "-asc");
+        load(key);
+      });
+      head.appendChild(th);
+    });
+
+    var body = table.createTBody();
+    rows.forEach(function (row) {
+      var tr = body.insertRow();
+      tr.insertCell().textContent = row.name;
+      var count = tr.insertCell();
+      count.textContent = comma(row.count);
+      count.className = "num";
+      var size = tr.insertCell();
+      size.textContent = comma(row.size);
+      size.title = bytes(row.size);
+      size.className = "num";
+      if (onClick) {
+        tr.className = "link" + (row.name == state.selectedUser ? " selected" : "");
+        tr.addEventListener("click", function () {
+          onClick(row);
+        });
+      }
+    });
+  }
+
+  function loadSummary() {
+    return getJSON("/api/summary").then(function (summary) {
+      document.getElementById("scanned").textContent =
+        "Scanned at " + new Date(summary.scanFinishedAt).toLocaleString() +
+        " on " + summary.host + " (" + summary.scanDurationSeconds.toFixed(1) + "s)";
+      document.getElementById("summary-users").textContent = comma(summary.users);
+      document.getElementById("summary-count").textContent = comma(summary.count);
+      document.getElementById("summary-size").textContent = bytes(summary.size);
+      document.getElementById("summary-errors").textContent = comma(summary.errors.length);
+
+      var errors = document.getElementById("error-list");
+      errors.textContent = "";
+      summary.errors.forEach(function (error) {
+        var tr = errors.insertRow();
+        tr.insertCell().textContent = error.user;
+        tr.insertCell().textContent = error.folder;
+        tr.insertCell().textContent = error.error;
+      });
+      document.getElementById("errors").hidden = summary.errors.length == 0;
+    });
+  }
+
+  function load(key) {
+    var params = filterQuery();
+    params.set("sort", state[key].sort);
+
+    if (key == "users") {
+      return getJSON("/api/users?" + params).then(function (body) {
+        renderTable(document.getElementById("users"), "users", "Name", body.users, function (row) {
+          state.selectedUser = row.name;
+          load("users");
+          load("folders");
+          load("months");
+        });
+      }).catch(function (error) {
+        showMessage(error.message);
+      });
+    }
+
+    if (state.selectedUser == null) {
+      return Promise.resolve();
+    }
+
+    var url = "/api/users/" + encodeURIComponent(state.selectedUser) + "/" + key + "?" + params;
+    return getJSON(url).then(function (body) {
+      document.getElementById("detail").hidden = false;
+      document.getElementById("detail-title").textContent = body.user;
+      renderTable(document.getElementById(key), key, key == "folders" ? "Folder" : "Month", body[key]);
+    }).catch(function (error) {
+      // 集計し直した結果、ユーザが無くなった場合など
+      document.getElementById("detail").hidden = true;
+      state.selectedUser = null;
+      showMessage(error.message);
+    });
+  }
+
+  function loadAll() {
+    showMessage("");
+    return Promise.all([loadSummary(), load("users"), load("folders"), load("months")]);
+  }
+
+  document.getElementById("filter").addEventListener("submit", function (event) {
+    event.preventDefault();
+    loadAll();
+  });
+
+  document.getElementById("refresh").addEventListener("click", function () {
+    var button = this;
+    button.disabled = true;
+    showMessage("");
+    fetch("/api/refresh", { method: "POST" }).then(function (response) {
+      return response.json().then(function (body) {
+        if (!response.ok) {
+          throw new Error(body.error);
+        }
+        return loadAll();
+      });
+    }).catch(function (error) {
+      showMessage(error.message);
+    }).then(function () {
+      button.disabled = false;
+    });
+  });
+
+  loadAll();
+})();
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// 1パケットの最大サイズ(断片化しないように、一般的なMTUに収まる大きさで)
+const statsdMaxPacketSize = 1432
+
+// StatsDのgaugeとしてUDPで送信する
+// 例: maildir.folder.user1.INBOX.count:10|g
+func sendStatsd(address string, prefix string, points []*metricPoint) error {
+
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	packet := new(strings.Builder)
+	flush := func() error {
+		if packet.Len() == 0 {
+			return nil
+		}
+		_, err := conn.Write([]byte(packet.String()))
+		packet.Reset()
+		return err
+	}
+
+	for _, point := range points {
+		for _, line := range statsdLines(prefix, point) {
+			if packet.Len() > 0 && packet.Len()+1+len(line) > statsdMaxPacketSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+
+			if packet.Len() > 0 {
+				packet.WriteString("\n")
+			}
+			packet.WriteString(line)
+		}
+	}
+
+	return flush()
+}
+
+func statsdLines(prefix string, point *metricPoint) []string {
+
+	names := []string{}
+	if prefix != "" {
+		names = append(names, prefix)
+	}
+	names = append(names, point.measurement)
+	for _, tag := range point.tags {
+		names = append(names, sanitizeStatsdName(tag[1]))
+	}
+	name := strings.Join(names, ".")
+
+	return []string{
+		fmt.Sprintf("%s.count:%d|g", name, point.count),
+		fmt.Sprintf("%s.bytes:%d|g", name, point.size),
+	}
+}
+
+// 英数字と"-"以外は、名前の区切り(.)やStatsDの書式で使われる文字も含めて、"_"に続けてUTF-8のバイトを16進で表す
+// "_"自体は"__"とし、異なる名前(日本語のフォルダ名など)が同じ名前にならないようにする
+// 例: 受信箱 -> _E5_8F_97_E4_BF_A1_E7_AE_B1、a.b -> a_2Eb、a_b -> a__b
+func sanitizeStatsdName(value string) string {
+
+	if value == "" {
+		return "_"
+	}
+
+	sanitized := new(strings.Builder)
+	for _, b := range []byte(value) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9', b == '-':
+			sanitized.WriteByte(b)
+		case b == '_':
+			sanitized.WriteString("__")
+		default:
+			fmt.Fprintf(sanitized, "_%02X", b)
+		}
+	}
+	return sanitized.String()
+}
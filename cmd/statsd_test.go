@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/onozaty/maildir-stats/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllCmd_Statsd(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	maildir := "Maildir"
+
+	users := setupTestAllMaildir(t, temp, maildir)
+
+	// テスト用にメソッド差し替え
+	loadPasswd = func(passwdPath string) ([]user.User, error) {
+		return users, nil
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"all",
+		"-d", maildir,
+		"--inbox-name", "INBOX",
+		"--statsd", conn.LocalAddr().String(),
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err = rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// 通常の出力も行われる
+	assert.True(t, strings.HasPrefix(buf.String(), "[Summary]\n"))
+
+	lines := receiveTestStatsdLines(t, conn, 40)
+	expected := []string{
+		"maildir.user.user1.count:6|g",
+		"maildir.user.user1.bytes:21|g",
+		"maildir.user.user2.count:2|g",
+		"maildir.user.user2.bytes:300|g",
+		"maildir.user.user3.count:3|g",
+		"maildir.user.user3.bytes:6000|g",
+		"maildir.user.user4.count:0|g",
+		"maildir.user.user4.bytes:0|g",
+		"maildir.folder.user1.A.count:2|g",
+		"maildir.folder.user1.A.bytes:7|g",
+		"maildir.folder.user1.B.count:2|g",
+		"maildir.folder.user1.B.bytes:11|g",
+		"maildir.folder.user1.INBOX.count:2|g",
+		"maildir.folder.user1.INBOX.bytes:3|g",
+		"maildir.folder.user2.INBOX.count:1|g",
+		"maildir.folder.user2.INBOX.bytes:100|g",
+		"maildir.folder.user2.Z.count:1|g",
+		"maildir.folder.user2.Z.bytes:200|g",
+		"maildir.folder.user3.INBOX.count:3|g",
+		"maildir.folder.user3.INBOX.bytes:6000|g",
+		"maildir.folder.user4.INBOX.count:0|g",
+		"maildir.folder.user4.INBOX.bytes:0|g",
+		"maildir.year.2021.count:2|g",
+		"maildir.year.2021.bytes:300|g",
+		"maildir.year.2022.count:6|g",
+		"maildir.year.2022.bytes:3014|g",
+		"maildir.year.2023.count:3|g",
+		"maildir.year.2023.bytes:3007|g",
+		"maildir.month.2021-12.count:2|g",
+		"maildir.month.2021-12.bytes:300|g",
+		"maildir.month.2022-11.count:3|g",
+		"maildir.month.2022-11.bytes:1006|g",
+		"maildir.month.2022-12.count:3|g",
+		"maildir.month.2022-12.bytes:2008|g",
+		"maildir.month.2023-01.count:2|g",
+		"maildir.month.2023-01.bytes:3003|g",
+		"maildir.month.2023-02.count:1|g",
+		"maildir.month.2023-02.bytes:4|g",
+	}
+	assert.Equal(t, expected, lines)
+}
+
+func TestSendStatsd_SplitPackets(t *testing.T) {
+
+	// ARRANGE
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	points := []*metricPoint{}
+	for i := 0; i < 100; i++ {
+		points = append(points, &metricPoint{"folder", [][2]string{{"user", "user1"}, {"folder", strings.Repeat("x", 20)}}, int64(i), int64(i)})
+	}
+
+	// ACT
+	err = sendStatsd(conn.LocalAddr().String(), "", points)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	packets := 0
+	lines := 0
+	buffer := make([]byte, 65536)
+	for lines < 200 {
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		n, _, err := conn.ReadFrom(buffer)
+		require.NoError(t, err)
+
+		assert.LessOrEqual(t, n, statsdMaxPacketSize)
+		assert.True(t, strings.HasPrefix(string(buffer[:n]), "folder.user1.xxxxxxxxxxxxxxxxxxxx."))
+		packets++
+		lines += len(strings.Split(string(buffer[:n]), "\n"))
+	}
+
+	assert.Equal(t, 200, lines)
+	assert.Greater(t, packets, 1)
+}
+
+func TestSanitizeStatsdName(t *testing.T) {
+
+	assert.Equal(t, "a_2Eb_3Ac_7Cd-e_20f", sanitizeStatsdName("a.b:c|d-e f"))
+	assert.Equal(t, "user__1", sanitizeStatsdName("user_1"))
+	assert.Equal(t, "_E5_8F_97_E4_BF_A1_E7_AE_B1", sanitizeStatsdName("受信箱"))
+	assert.Equal(t, "_", sanitizeStatsdName(""))
+}
+
+func TestSanitizeStatsdName_Collision(t *testing.T) {
+
+	// 置き換えると同じになりうる名前
+	names := []string{
+		"", "_", "__", "_2E", ".", "a.b", "a_b", "a b", "a_2Eb",
+		"受信箱", "送信済", "下書き", "迷惑", "ゴミ箱", "あ", "い",
+	}
+
+	// ACT
+	sanitizedNames := map[string]string{}
+	for _, name := range names {
+		sanitized := sanitizeStatsdName(name)
+
+		// ASSERT
+		assert.Regexp(t, `^[A-Za-z0-9_-]+$`, sanitized)
+		if other, ok := sanitizedNames[sanitized]; ok {
+			assert.Failf(t, "collision", "'%s' and '%s' are both sanitized to '%s'", other, name, sanitized)
+		}
+		sanitizedNames[sanitized] = name
+	}
+}
+
+func receiveTestStatsdLines(t *testing.T, conn net.PacketConn, maxLines int) []string {
+
+	lines := []string{}
+	buffer := make([]byte, 65536)
+	for len(lines) < maxLines {
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(500*time.Millisecond)))
+		n, _, err := conn.ReadFrom(buffer)
+		if err != nil {
+			// 全て受信した
+			break
+		}
+		lines = append(lines, strings.Split(string(buffer[:n]), "\n")...)
+	}
+
+	return lines
+}
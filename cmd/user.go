@@ -35,27 +35,65 @@ func newUserCmd() *cobra.Command {
 				return err
 			}
 
+			reportSender, _ := cmd.Flags().GetBool("sender")
+			reportSenderDomain, _ := cmd.Flags().GetBool("sender-domain")
+			reportSenderSortCondition, err := getSortCondition(cmd.Flags(), "sort-sender")
+			if err != nil { // 許可されていなパラメータの可能性あり
+				return err
+			}
+			reportSenderTop, _ := cmd.Flags().GetInt("sender-top")
+
+			reportAttachments, _ := cmd.Flags().GetBool("attachments")
+			reportAttachmentsSortCondition, err := getSortCondition(cmd.Flags(), "sort-attachments")
+			if err != nil { // 許可されていなパラメータの可能性あり
+				return err
+			}
+
 			inboxFolderName, _ := cmd.Flags().GetString("inbox-name")
 
+			storageFormat, err := getStorageFormat(cmd.Flags(), "format-in")
+			if err != nil { // 許可されていなパラメータの可能性あり
+				return err
+			}
+
+			archivePath, _ := cmd.Flags().GetString("archive")
+			if archivePath != "" && storageFormat != maildir.MaildirStorage {
+				return fmt.Errorf("--archive supports only --format-in maildir")
+			}
+
+			errorPolicy, err := getErrorPolicy(cmd.Flags(), "on-error")
+			if err != nil { // 許可されていなパラメータの可能性あり
+				return err
+			}
+
 			// 引数の解析に成功した時点で、エラーが起きてもUsageは表示しない
 			cmd.SilenceUsage = true
 
 			return runUserReport(
 				maildirPath,
 				userReportCondition{
-					reportFolder:              reportFolder,
-					reportFolderSortCondition: reportFolderSortCondition,
-					reportYear:                reportYear,
-					reportYearSortCondition:   reportYearSortCondition,
-					reportMonth:               reportMonth,
-					reportMonthSortCondition:  reportMonthSortCondition,
+					reportFolder:                   reportFolder,
+					reportFolderSortCondition:      reportFolderSortCondition,
+					reportYear:                     reportYear,
+					reportYearSortCondition:        reportYearSortCondition,
+					reportMonth:                    reportMonth,
+					reportMonthSortCondition:       reportMonthSortCondition,
+					reportSender:                   reportSender,
+					reportSenderDomain:             reportSenderDomain,
+					reportSenderSortCondition:      reportSenderSortCondition,
+					reportSenderTop:                reportSenderTop,
+					reportAttachments:              reportAttachments,
+					reportAttachmentsSortCondition: reportAttachmentsSortCondition,
+					errorPolicy:                    errorPolicy,
+					storageFormat:                  storageFormat,
+					archivePath:                    archivePath,
 				},
 				inboxFolderName,
 				cmd.OutOrStdout())
 		},
 	}
 
-	subCmd.Flags().StringP("dir", "d", "", "User maildir path.")
+	subCmd.Flags().StringP("dir", "d", "", "User maildir path. (mbox file or directory with --format-in mbox, dbox root with --format-in dbox, path in the archive with --archive)")
 	subCmd.MarkFlagRequired("dir")
 
 	subCmd.Flags().BoolP("folder", "f", false, "Report by folder.")
@@ -64,19 +102,37 @@ func newUserCmd() *cobra.Command {
 	subCmd.Flags().StringP("sort-year", "", "name-asc", "Sorting condition for report by year.\ncan be specified: name-asc, name-desc, count-asc, count-desc, size-asc, size-desc")
 	subCmd.Flags().BoolP("month", "m", false, "Report by month.")
 	subCmd.Flags().StringP("sort-month", "", "name-asc", "Sorting condition for report by month.\ncan be specified: name-asc, name-desc, count-asc, count-desc, size-asc, size-desc")
+	subCmd.Flags().BoolP("sender", "", false, "Report by sender address. (reads mail headers)")
+	subCmd.Flags().BoolP("sender-domain", "", false, "Report by sender domain. (reads mail headers)")
+	subCmd.Flags().StringP("sort-sender", "", "size-desc", "Sorting condition for report by sender and sender domain.\ncan be specified: name-asc, name-desc, count-asc, count-desc, size-asc, size-desc")
+	subCmd.Flags().IntP("sender-top", "", 10, "Number of senders to report. (0 means all)")
+	subCmd.Flags().BoolP("attachments", "", false, "Report attachments by content type and extension. (reads whole mails)")
+	subCmd.Flags().StringP("sort-attachments", "", "size-desc", "Sorting condition for report by attachments.\ncan be specified: name-asc, name-desc, count-asc, count-desc, size-asc, size-desc")
 
 	subCmd.Flags().StringP("inbox-name", "", "", "The name of the inbox folder. (default \"\")")
+	subCmd.Flags().StringP("on-error", "", "fail", "Behavior when a mail folder cannot be read.\ncan be specified: fail, warn, skip")
+	subCmd.Flags().StringP("format-in", "", "maildir", "Format of the mailbox.\ncan be specified: maildir, mbox, dbox, auto")
+	subCmd.Flags().StringP("archive", "", "", "Read the maildir in the tar (or tar.gz) archive without extracting it.")
 
 	return subCmd
 }
 
 type userReportCondition struct {
-	reportFolder              bool
-	reportFolderSortCondition SortCondition
-	reportYear                bool
-	reportYearSortCondition   SortCondition
-	reportMonth               bool
-	reportMonthSortCondition  SortCondition
+	reportFolder                   bool
+	reportFolderSortCondition      SortCondition
+	reportYear                     bool
+	reportYearSortCondition        SortCondition
+	reportMonth                    bool
+	reportMonthSortCondition       SortCondition
+	reportSender                   bool
+	reportSenderDomain             bool
+	reportSenderSortCondition      SortCondition
+	reportSenderTop                int
+	reportAttachments              bool
+	reportAttachmentsSortCondition SortCondition
+	errorPolicy                    ErrorPolicy
+	storageFormat                  maildir.StorageFormat
+	archivePath                    string
 }
 
 func runUserReport(maildirPath string, condition userReportCondition, inboxFolderName string, writer io.Writer) error {
@@ -87,6 +143,9 @@ func runUserReport(maildirPath string, condition userReportCondition, inboxFolde
 
 	var yearAggregator *maildir.TimeAggregator
 	var monthAggregator *maildir.TimeAggregator
+	var senderAggregator *maildir.SenderAggregator
+	var senderDomainAggregator *maildir.SenderAggregator
+	var attachmentAggregator *maildir.AttachmentAggregator
 
 	if condition.reportYear {
 		yearAggregator = maildir.NewYearAggregator()
@@ -96,9 +155,41 @@ func runUserReport(maildirPath string, condition userReportCondition, inboxFolde
 		monthAggregator = maildir.NewMonthAggregator()
 		aggregators = append(aggregators, monthAggregator)
 	}
+	// 送信者での集計を行う場合のみ、メールのヘッダが読み込まれる
+	if condition.reportSender {
+		senderAggregator = maildir.NewSenderAggregator()
+		aggregators = append(aggregators, senderAggregator)
+	}
+	if condition.reportSenderDomain {
+		senderDomainAggregator = maildir.NewSenderDomainAggregator()
+		aggregators = append(aggregators, senderDomainAggregator)
+	}
+	if condition.reportAttachments {
+		attachmentAggregator = maildir.NewAttachmentAggregator()
+		aggregators = append(aggregators, attachmentAggregator)
+	}
 
-	if err := maildir.AggregateMailFolders(maildirPath, inboxFolderName, maildir.NewMultiAggregator(aggregators)); err != nil {
-		return err
+	errorCollector := newErrorCollector(condition.errorPolicy)
+	if condition.archivePath != "" {
+		// アーカイブ内のMaildir++
+		archive, err := maildir.OpenTarFS(condition.archivePath)
+		if err != nil {
+			return err
+		}
+
+		store := maildir.NewMaildirFSStore(archive, archiveEntryPath(maildirPath), inboxFolderName)
+		if err := maildir.AggregateMailStoreWithErrorHandler(store, maildir.NewMultiAggregator(aggregators), errorCollector.handle); err != nil {
+			return err
+		}
+	} else {
+		mailbox, err := maildir.MailboxOf(maildirPath, condition.storageFormat)
+		if err != nil {
+			return err
+		}
+
+		if err := maildir.AggregateMailboxWithErrorHandler(mailbox, inboxFolderName, maildir.NewMultiAggregator(aggregators), errorCollector.handle); err != nil {
+			return err
+		}
 	}
 
 	// Summary
@@ -123,5 +214,34 @@ func runUserReport(maildirPath string, condition userReportCondition, inboxFolde
 		fmt.Fprintf(writer, "\n")
 	}
 
-	return nil
+	// Sender
+	if condition.reportSender {
+		printSenderReport(writer, senderAggregator, condition.reportSenderSortCondition, condition.reportSenderTop, "Sender", "Sender")
+		fmt.Fprintf(writer, "\n")
+	}
+
+	// Sender domain
+	if condition.reportSenderDomain {
+		printSenderReport(writer, senderDomainAggregator, condition.reportSenderSortCondition, condition.reportSenderTop, "Sender domain", "Domain")
+		fmt.Fprintf(writer, "\n")
+	}
+
+	// Attachments
+	if condition.reportAttachments {
+		mailboxSize := int64(0)
+		for _, result := range folderAggregator.Results() {
+			mailboxSize += result.TotalSize
+		}
+
+		printAttachmentReport(writer, attachmentAggregator, condition.reportAttachmentsSortCondition, mailboxSize)
+		fmt.Fprintf(writer, "\n")
+	}
+
+	// Errors
+	if errors := errorCollector.reportErrors(); len(errors) > 0 {
+		printErrorReport(writer, errors, false)
+		fmt.Fprintf(writer, "\n")
+	}
+
+	return errorCollector.result()
 }
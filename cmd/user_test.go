@@ -1,7 +1,9 @@
 package cmd
 
 import (
+	"archive/tar"
 	"bytes"
+	"compress/gzip"
 	"io/fs"
 	"os"
 	"path/filepath"
@@ -975,6 +977,226 @@ Total size      : 3,340 byte
 	assert.Equal(t, expected, result)
 }
 
+func TestUserCmd_Sender(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	setupTestSenderMaildir(t, temp)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"user",
+		"-d", temp,
+		"--sender",
+		"--sender-domain",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	result := buf.String()
+	expected := `[Summary]
+Number of mails : 6
+Total size      : 269 byte
+
+[Sender]
+  Sender           | Number of mails | Total size(byte)  
+-------------------+-----------------+-------------------
+  news@example.net |               2 |              165  
+  a@example.com    |               2 |               61  
+  b@example.org    |               1 |               27  
+                   |               1 |               16  
+
+[Sender domain]
+  Domain      | Number of mails | Total size(byte)  
+--------------+-----------------+-------------------
+  example.net |               2 |              165  
+  example.com |               2 |               61  
+  example.org |               1 |               27  
+              |               1 |               16  
+
+`
+	assert.Equal(t, expected, result)
+}
+
+func TestUserCmd_Sender_SortTop(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	setupTestSenderMaildir(t, temp)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"user",
+		"-d", temp,
+		"--sender",
+		"--sort-sender", "count-desc",
+		"--sender-top", "2",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	result := buf.String()
+	expected := `[Summary]
+Number of mails : 6
+Total size      : 269 byte
+
+[Sender]
+  Sender           | Number of mails | Total size(byte)  
+-------------------+-----------------+-------------------
+  news@example.net |               2 |              165  
+  a@example.com    |               2 |               61  
+
+`
+	assert.Equal(t, expected, result)
+}
+
+func TestUserCmd_Attachments(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	createMailFolder(t, temp, []mail{})
+	createFile(t, filepath.Join(temp, "cur", "1675209600"), strings.ReplaceAll(`Content-Type: multipart/mixed; boundary="b1"
+
+--b1
+Content-Type: text/plain
+
+body
+--b1
+Content-Type: application/pdf
+Content-Disposition: attachment; filename="a.pdf"
+Content-Transfer-Encoding: base64
+
+`+strings.Repeat("QUJD", 100)+`
+--b1
+Content-Type: image/jpeg; name="b.JPG"
+Content-Transfer-Encoding: base64
+
+`+strings.Repeat("QUJD", 20)+`
+--b1--
+`, "\n", "\r\n"))
+	{
+		sub := createDir(t, temp, ".A")
+		createMailFolder(t, sub, []mail{
+			{"cur/1672531200", 212}, // 2023-01-01
+		})
+	}
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"user",
+		"-d", temp,
+		"--attachments",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	result := buf.String()
+	expected := `[Summary]
+Number of mails : 2
+Total size      : 1,000 byte
+
+[Attachment type]
+  Type            | Number of attachments | Total size(byte) | Ratio  
+------------------+-----------------------+------------------+--------
+  application/pdf |                     1 |              300 | 40.0%  
+  image/jpeg      |                     1 |               60 |  8.0%  
+
+[Attachment extension]
+  Extension | Number of attachments | Total size(byte) | Ratio  
+------------+-----------------------+------------------+--------
+  .pdf      |                     1 |              300 | 40.0%  
+  .jpg      |                     1 |               60 |  8.0%  
+
+`
+	assert.Equal(t, expected, result)
+}
+
+func TestUserCmd_Attachments_OnErrorWarn(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	createMailFolder(t, temp, []mail{})
+	createFile(t, filepath.Join(temp, "cur", "1675209600"), "Content-Type: application/pdf\r\n\r\nPDF\r\n")
+	{
+		// 読み込めないメール(ディレクトリへのシンボリックリンク)
+		sub := createDir(t, temp, ".A")
+		createMailFolder(t, sub, []mail{})
+		if err := os.Symlink(sub, filepath.Join(sub, "cur", "1672531200")); err != nil {
+			t.Skip("symlink is not supported:", err)
+		}
+	}
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"user",
+		"-d", temp,
+		"--attachments",
+		"--on-error", "warn",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	// 読み込めないメールがあっても中断せず、そのメールフォルダをエラーとして出力する
+	require.EqualError(t, err, "1 error(s) occurred during aggregation")
+
+	result := buf.String()
+	assert.Contains(t, result, `[Attachment type]
+  Type            | Number of attachments | Total size(byte) | Ratio  
+------------------+-----------------------+------------------+--------
+  application/pdf |                     1 |                5 |`)
+	assert.Contains(t, result, "[Errors]\n")
+	assert.Contains(t, result, "  A      | read ")
+}
+
+func TestUserCmd_InvalidSortAttachments(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	setupTestUserMaildir(t, temp)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"user",
+		"-d", temp,
+		"--attachments",
+		"--sort-attachments", "xxx",
+	})
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "invalid sort condition 'xxx'")
+}
+
 func TestUserCmd_MaildirNotFound(t *testing.T) {
 
 	// ARRANGE
@@ -998,6 +1220,133 @@ func TestUserCmd_MaildirNotFound(t *testing.T) {
 	assert.Contains(t, err.Error(), expect)
 }
 
+func TestUserCmd_OnErrorWarn(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	setupTestUserMaildir(t, temp)
+
+	{
+		// フォルダ名としておかしなもの(修正UTF-7としてデコードできない者)
+		sub := createDir(t, temp, ".&A")
+		createMailFolder(t, sub, []mail{
+			{"cur/1672531200", 10000}, // 2023-01-01
+		})
+	}
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"user",
+		"-d", temp,
+		"-f",
+		"--on-error", "warn",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "1 error(s) occurred during aggregation")
+
+	result := buf.String()
+	expected := `[Summary]
+Number of mails : 10
+Total size      : 3,340 byte
+
+[Folder]
+  Name   | Number of mails | Total size(byte)  
+---------+-----------------+-------------------
+         |               4 |               10  
+  A      |               2 |               30  
+  B      |               2 |              300  
+  C      |               0 |                0  
+  テスト |               2 |            3,000  
+
+[Errors]
+  Folder | Error                                           
+---------+-------------------------------------------------
+  &A     | &A is invalid folder name: utf7: invalid UTF-7  
+
+`
+	assert.Equal(t, expected, result)
+}
+
+func TestUserCmd_OnErrorFail(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	setupTestUserMaildir(t, temp)
+
+	{
+		// フォルダ名としておかしなもの(修正UTF-7としてデコードできない者)
+		sub := createDir(t, temp, ".&A")
+		createMailFolder(t, sub, []mail{
+			{"cur/1672531200", 10000}, // 2023-01-01
+		})
+	}
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"user",
+		"-d", temp,
+		"--on-error", "fail",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "&A is invalid folder name: utf7: invalid UTF-7")
+	assert.Equal(t, "", buf.String())
+}
+
+func TestUserCmd_InvalidOnError(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	setupTestUserMaildir(t, temp)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"user",
+		"-d", temp,
+		"--on-error", "xxx",
+	})
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "invalid error policy 'xxx'")
+}
+
+func TestUserCmd_InvalidSortSender(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	setupTestUserMaildir(t, temp)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"user",
+		"-d", temp,
+		"--sender",
+		"--sort-sender", "xxx",
+	})
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "invalid sort condition 'xxx'")
+}
+
 func TestUserCmd_InvalidSortFolder(t *testing.T) {
 
 	// ARRANGE
@@ -1061,6 +1410,299 @@ func TestUserCmd_InvalidSortMonth(t *testing.T) {
 	require.EqualError(t, err, "invalid sort condition 'xxx'")
 }
 
+func TestUserCmd_FormatInMbox(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	createFile(t, filepath.Join(temp, "Sent.mbox"), "From a@example.com Sat Jan  1 00:00:00 2022\nSubject: a\n\nbody\n\nFrom b@example.com Sun Jan  2 00:00:00 2022\nSubject: b\n\nbody\n")
+	createFile(t, filepath.Join(temp, "Trash"), "From a@example.com Sat Jan  1 00:00:00 2022\nSubject: c\n\nbody\n")
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"user",
+		"-d", temp,
+		"--format-in", "mbox",
+		"-f",
+		"-y",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	result := buf.String()
+	expected := `[Summary]
+Number of mails : 3
+Total size      : 51 byte
+
+[Folder]
+  Name  | Number of mails | Total size(byte)  
+--------+-----------------+-------------------
+  Sent  |               2 |               34  
+  Trash |               1 |               17  
+
+[Year]
+  Year | Number of mails | Total size(byte)  
+-------+-----------------+-------------------
+  2022 |               3 |               51  
+
+`
+	assert.Equal(t, expected, result)
+}
+
+func TestUserCmd_FormatInAuto(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	setupTestUserMaildir(t, temp)
+
+	mboxPath := filepath.Join(t.TempDir(), "user1")
+	createFile(t, mboxPath, "From a@example.com Sat Jan  1 00:00:00 2022\nSubject: a\n\nbody\n")
+
+	for _, path := range []string{temp, mboxPath} {
+
+		rootCmd := newRootCmd()
+		rootCmd.SetArgs([]string{
+			"user",
+			"-d", path,
+			"--format-in", "auto",
+		})
+
+		buf := new(bytes.Buffer)
+		rootCmd.SetOutput(buf)
+
+		// ACT
+		err := rootCmd.Execute()
+
+		// ASSERT
+		require.NoError(t, err)
+
+		if path == temp {
+			assert.Equal(t, "[Summary]\nNumber of mails : 10\nTotal size      : 3,340 byte\n\n", buf.String())
+		} else {
+			assert.Equal(t, "[Summary]\nNumber of mails : 1\nTotal size      : 17 byte\n\n", buf.String())
+		}
+	}
+}
+
+func TestUserCmd_FormatInDbox(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	// sdbox
+	inbox := filepath.Join(temp, "mailboxes", "INBOX", "dbox-Mails")
+	require.NoError(t, os.MkdirAll(inbox, 0777))
+	createFile(t, filepath.Join(inbox, "u.1"), "2 M36 C61cf9980\n\x01\x02N                                  0000000000000011\nSubject: a\n\nbody\n\n\x01\x03\nR61cf9980\n\n")
+	sent := filepath.Join(temp, "mailboxes", "Sent", "dbox-Mails")
+	require.NoError(t, os.MkdirAll(sent, 0777))
+	createFile(t, filepath.Join(sent, "u.1"), "2 M36 C61cf9980\n\x01\x02N                                  0000000000000013\nSubject: b\n\nbody b\n\n\x01\x03\nR6200ce00\n\n")
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"user",
+		"-d", temp,
+		"--format-in", "dbox",
+		"--inbox-name", "INBOX",
+		"-f",
+		"-m",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	result := buf.String()
+	expected := `[Summary]
+Number of mails : 2
+Total size      : 36 byte
+
+[Folder]
+  Name  | Number of mails | Total size(byte)  
+--------+-----------------+-------------------
+  INBOX |               1 |               17  
+  Sent  |               1 |               19  
+
+[Month]
+  Month   | Number of mails | Total size(byte)  
+----------+-----------------+-------------------
+  2022-01 |               1 |               17  
+  2022-02 |               1 |               19  
+
+`
+	assert.Equal(t, expected, result)
+}
+
+func TestUserCmd_InvalidFormatIn(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"user",
+		"-d", temp,
+		"--format-in", "mh",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "invalid input format 'mh'")
+}
+
+func TestUserCmd_Archive(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	src := createDir(t, temp, "src")
+	maildirPath := filepath.Join(src, "home", "user1", "Maildir")
+	require.NoError(t, os.MkdirAll(maildirPath, 0777))
+	setupTestUserMaildir(t, maildirPath)
+
+	archivePath := filepath.Join(temp, "backup.tar.gz")
+	createTarGzArchive(t, archivePath, src)
+
+	// 展開した状態と同じ結果になること
+	expected := executeUserCmd(t, "-d", maildirPath, "-f", "-y", "-m")
+
+	// ACT
+	result := executeUserCmd(t, "-d", "/home/user1/Maildir", "--archive", archivePath, "-f", "-y", "-m")
+
+	// ASSERT
+	assert.Equal(t, expected, result)
+	assert.Contains(t, result, "Number of mails : 10")
+}
+
+func TestUserCmd_Archive_MaildirNotFound(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	src := createDir(t, temp, "src")
+	createFile(t, filepath.Join(src, "dummy"), "")
+
+	archivePath := filepath.Join(temp, "backup.tar.gz")
+	createTarGzArchive(t, archivePath, src)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"user",
+		"-d", "home/user1/Maildir",
+		"--archive", archivePath,
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "home/user1/Maildir")
+}
+
+func TestUserCmd_Archive_InvalidFormatIn(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"user",
+		"-d", "home/user1/Maildir",
+		"--archive", filepath.Join(temp, "backup.tar.gz"),
+		"--format-in", "mbox",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "--archive supports only --format-in maildir")
+}
+
+func executeUserCmd(t *testing.T, args ...string) string {
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs(append([]string{"user"}, args...))
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	err := rootCmd.Execute()
+	require.NoError(t, err)
+
+	return buf.String()
+}
+
+// srcDir配下をtar.gzにする(srcDirからの相対パスをエントリ名とする)
+func createTarGzArchive(t *testing.T, archivePath string, srcDir string) {
+
+	file, err := os.Create(archivePath)
+	require.NoError(t, err)
+	defer file.Close()
+
+	gzipWriter := gzip.NewWriter(file)
+	defer gzipWriter.Close()
+
+	tarWriter := tar.NewWriter(gzipWriter)
+	defer tarWriter.Close()
+
+	err = filepath.WalkDir(srcDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == srcDir {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			return err
+		}
+		header.Name = "./" + filepath.ToSlash(rel)
+
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		_, err = tarWriter.Write(data)
+		return err
+	})
+	require.NoError(t, err)
+}
+
 func setupTestUserMaildir(t *testing.T, rootMailFolderPath string) {
 
 	// INBOX
@@ -1103,6 +1745,22 @@ func setupTestUserMaildir(t *testing.T, rootMailFolderPath string) {
 	}
 }
 
+func setupTestSenderMaildir(t *testing.T, rootMailFolderPath string) {
+
+	// INBOX
+	createMailFolder(t, rootMailFolderPath, []mail{})
+	createFile(t, filepath.Join(rootMailFolderPath, "cur", "1675209600"), "From: a@example.com\r\n\r\nbody1")
+	createFile(t, filepath.Join(rootMailFolderPath, "cur", "1675209601"), "From: B <B@example.org>\r\n\r\n")
+	createFile(t, filepath.Join(rootMailFolderPath, "new", "1675209602"), "From: News <news@example.net>\r\n\r\n"+strings.Repeat("x", 65))
+	createFile(t, filepath.Join(rootMailFolderPath, "new", "1675209603"), "Subject: no from")
+
+	// その他フォルダ
+	sub := createDir(t, rootMailFolderPath, ".A")
+	createMailFolder(t, sub, []mail{})
+	createFile(t, filepath.Join(sub, "cur", "1675209604"), "From: \"A\" <a@example.com>\r\n\r\nbody")
+	createFile(t, filepath.Join(sub, "cur", "1675209605"), "From: news@example.net\r\n\r\n"+strings.Repeat("x", 41))
+}
+
 func createDir(t *testing.T, parent string, name string) string {
 
 	dir := filepath.Join(parent, name)
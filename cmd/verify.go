@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/dustin/go-humanize"
+	"github.com/olekukonko/tablewriter"
+	"github.com/onozaty/maildir-stats/maildir"
+	"github.com/spf13/cobra"
+)
+
+func newVerifyCmd() *cobra.Command {
+
+	subCmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Verify consistency between mail files and dovecot-uidlist",
+		RunE: func(cmd *cobra.Command, args []string) error {
+
+			maildirPath, _ := cmd.Flags().GetString("dir")
+			inboxFolderName, _ := cmd.Flags().GetString("inbox-name")
+
+			// 引数の解析に成功した時点で、エラーが起きてもUsageは表示しない
+			cmd.SilenceUsage = true
+
+			return runVerify(maildirPath, inboxFolderName, cmd.OutOrStdout())
+		},
+	}
+
+	subCmd.Flags().StringP("dir", "d", "", "User maildir path.")
+	subCmd.MarkFlagRequired("dir")
+	subCmd.Flags().StringP("inbox-name", "", "", "The name of the inbox folder. (default \"\")")
+
+	return subCmd
+}
+
+func runVerify(maildirPath string, inboxFolderName string, writer io.Writer) error {
+
+	results, err := maildir.VerifyMaildir(maildirPath, inboxFolderName)
+	if err != nil {
+		return err
+	}
+
+	problemCount := 0
+	for _, result := range results {
+		if result.HasProblem() {
+			problemCount++
+		}
+	}
+
+	// Summary
+	fmt.Fprintf(writer, "[Summary]\n")
+	fmt.Fprintf(writer, "Number of folders              : %s\n", humanize.Comma(int64(len(results))))
+	fmt.Fprintf(writer, "Number of inconsistent folders : %s\n", humanize.Comma(int64(problemCount)))
+	fmt.Fprintf(writer, "\n")
+
+	// Folder
+	fmt.Fprintf(writer, "[Folder]\n")
+	{
+		table := newVerifyTable(writer)
+		table.SetColumnAlignment([]int{tablewriter.ALIGN_LEFT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT})
+		table.SetHeader([]string{"Name", "Number of files", "Uidlist entries", "Missing in uidlist", "Missing files", "Size mismatches"})
+
+		for _, result := range results {
+			if !result.UidlistFound {
+				// uidlistが無い場合は比較できない
+				table.Append([]string{result.MailFolderName, humanize.Comma(result.FileCount), "-", "-", "-", "-"})
+				continue
+			}
+
+			table.Append([]string{
+				result.MailFolderName,
+				humanize.Comma(result.FileCount),
+				humanize.Comma(result.UidlistCount),
+				humanize.Comma(int64(len(result.MissingInUidlist))),
+				humanize.Comma(int64(len(result.MissingFiles))),
+				humanize.Comma(int64(len(result.SizeMismatches))),
+			})
+		}
+		table.Render()
+		fmt.Fprintf(writer, "\n")
+	}
+
+	// Missing in uidlist
+	printVerifyFileReport(writer, "Missing in uidlist", results, func(result *maildir.VerifyResult) []string {
+		return result.MissingInUidlist
+	})
+
+	// Missing files
+	printVerifyFileReport(writer, "Missing files", results, func(result *maildir.VerifyResult) []string {
+		return result.MissingFiles
+	})
+
+	// Size mismatches
+	mismatchCount := 0
+	for _, result := range results {
+		mismatchCount += len(result.SizeMismatches)
+	}
+	if mismatchCount > 0 {
+		fmt.Fprintf(writer, "[Size mismatches]\n")
+
+		table := newVerifyTable(writer)
+		table.SetColumnAlignment([]int{tablewriter.ALIGN_LEFT, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT})
+		table.SetHeader([]string{"Folder", "File", "Expected size(byte)", "Actual size(byte)"})
+
+		for _, result := range results {
+			for _, mismatch := range result.SizeMismatches {
+				table.Append([]string{result.MailFolderName, mismatch.FileName, humanize.Comma(mismatch.ExpectedSize), humanize.Comma(mismatch.ActualSize)})
+			}
+		}
+		table.Render()
+		fmt.Fprintf(writer, "\n")
+	}
+
+	// 不整合がある場合は終了コードで分かるように
+	if problemCount > 0 {
+		return fmt.Errorf("inconsistencies found in %d folder(s)", problemCount)
+	}
+	return nil
+}
+
+func printVerifyFileReport(writer io.Writer, title string, results []*maildir.VerifyResult, files func(result *maildir.VerifyResult) []string) {
+
+	count := 0
+	for _, result := range results {
+		count += len(files(result))
+	}
+	if count == 0 {
+		return
+	}
+
+	fmt.Fprintf(writer, "[%s]\n", title)
+
+	table := newVerifyTable(writer)
+	table.SetHeader([]string{"Folder", "File"})
+
+	for _, result := range results {
+		for _, file := range files(result) {
+			table.Append([]string{result.MailFolderName, file})
+		}
+	}
+	table.Render()
+	fmt.Fprintf(writer, "\n")
+}
+
+func newVerifyTable(writer io.Writer) *tablewriter.Table {
+
+	table := tablewriter.NewWriter(writer)
+	table.SetAutoFormatHeaders(false)
+	table.SetAutoWrapText(false)
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetBorder(false)
+
+	return table
+}
@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyCmd(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	setupTestVerifyMaildir(t, temp)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"verify",
+		"-d", temp,
+		"--inbox-name", "INBOX",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "inconsistencies found in 2 folder(s)")
+
+	result := buf.String()
+	expected := `[Summary]
+Number of folders              : 3
+Number of inconsistent folders : 2
+
+[Folder]
+  Name  | Number of files | Uidlist entries | Missing in uidlist | Missing files | Size mismatches  
+--------+-----------------+-----------------+--------------------+---------------+------------------
+  INBOX |               2 |               2 |                  1 |             1 |               1  
+  Sent  |               1 |               - |                  - |             - |               -  
+  Trash |               1 |               1 |                  0 |             0 |               0  
+
+[Missing in uidlist]
+  Folder | File                   
+---------+------------------------
+  INBOX  | 1672531202.M3.host:2,  
+
+[Missing files]
+  Folder | File                    
+---------+-------------------------
+  INBOX  | 1672531209.M9.host,S=3  
+
+[Size mismatches]
+  Folder | File                       | Expected size(byte) | Actual size(byte)  
+---------+----------------------------+---------------------+--------------------
+  INBOX  | 1672531200.M1.host,S=5:2,S |                   4 |                 5  
+
+`
+	assert.Equal(t, expected, result)
+}
+
+func TestVerifyCmd_NoProblem(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	createMailFolder(t, temp, []mail{})
+	createFile(t, filepath.Join(temp, "cur", "1672531200.M1.host,S=5:2,S"), "12345")
+	createFile(t, filepath.Join(temp, "dovecot-uidlist"), "3 V1 N2\n1 :1672531200.M1.host,S=5\n")
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"verify",
+		"-d", temp,
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	result := buf.String()
+	expected := `[Summary]
+Number of folders              : 1
+Number of inconsistent folders : 0
+
+[Folder]
+  Name | Number of files | Uidlist entries | Missing in uidlist | Missing files | Size mismatches  
+-------+-----------------+-----------------+--------------------+---------------+------------------
+       |               1 |               1 |                  0 |             0 |               0  
+
+`
+	assert.Equal(t, expected, result)
+}
+
+func TestVerifyCmd_MaildirNotFound(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	maildir := filepath.Join(temp, "xxx") // 存在しないディレクトリ
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"verify",
+		"-d", maildir,
+	})
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	// OSによってエラーメッセージが異なるのでファイル名部分だけチェック
+	expect := "open " + maildir
+	assert.Contains(t, err.Error(), expect)
+}
+
+func setupTestVerifyMaildir(t *testing.T, rootMailFolderPath string) {
+
+	// INBOX
+	createMailFolder(t, rootMailFolderPath, []mail{})
+	createFile(t, filepath.Join(rootMailFolderPath, "cur", "1672531200.M1.host,S=5:2,S"), "12345")
+	createFile(t, filepath.Join(rootMailFolderPath, "cur", "1672531202.M3.host:2,"), "123")
+	createFile(t, filepath.Join(rootMailFolderPath, "dovecot-uidlist"),
+		"3 V1 N10\n1 S4 :1672531200.M1.host,S=5:2,S\n9 :1672531209.M9.host,S=3\n")
+
+	// uidlistが無いフォルダ
+	{
+		sub := createDir(t, rootMailFolderPath, ".Sent")
+		createMailFolder(t, sub, []mail{})
+		createFile(t, filepath.Join(sub, "cur", "1672531200.M5.host"), "1")
+	}
+
+	// 不整合が無いフォルダ
+	{
+		sub := createDir(t, rootMailFolderPath, ".Trash")
+		createMailFolder(t, sub, []mail{})
+		createFile(t, filepath.Join(sub, "cur", "1672531200.M6.host"), "1")
+		createFile(t, filepath.Join(sub, "dovecot-uidlist"), "3 V1 N2\n1 :1672531200.M6.host\n")
+	}
+}
@@ -0,0 +1,466 @@
+package maildir
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+type ArchiveFormat int
+
+const (
+	MboxGzArchive ArchiveFormat = iota
+	TarZstArchive
+)
+
+func (f ArchiveFormat) extension() string {
+	switch f {
+	case TarZstArchive:
+		return ".tar.zst"
+	default:
+		return ".mbox.gz"
+	}
+}
+
+// 作成したアーカイブファイルと、そこに格納したメール
+type ArchiveFile struct {
+	Path  string
+	Year  int
+	Mails []*SelectedMail
+}
+
+// アーカイブに書き込んだメールと、その内容のハッシュ値(検証用)
+type archivedEntry struct {
+	mail *SelectedMail
+	name string
+	hash []byte
+}
+
+// メールを年毎のアーカイブファイル(archive-YYYY.mbox.gz など)に書き出し、元のメールを削除する
+// アーカイブファイルは書き出した後に読み直して内容を検証し、問題が無かった場合のみ元のメールを削除する
+// 同名のアーカイブファイルが既にある場合は、archive-YYYY.1.mbox.gz のように連番を付けて別ファイルとする
+func ArchiveMails(rootMailFolderPath string, mails []*SelectedMail, outputDirPath string, format ArchiveFormat, auditLog io.Writer) ([]*ArchiveFile, error) {
+
+	mailsByYear := map[int][]*SelectedMail{}
+	years := []int{}
+	for _, mail := range mails {
+		year := mail.Time.Year()
+		if _, ok := mailsByYear[year]; !ok {
+			years = append(years, year)
+		}
+		mailsByYear[year] = append(mailsByYear[year], mail)
+	}
+	sort.Ints(years)
+
+	archiveFiles := []*ArchiveFile{}
+	removed := []*SelectedMail{}
+
+	archiveErr := func() error {
+		for _, year := range years {
+			archiveFile, err := archiveYear(rootMailFolderPath, mailsByYear[year], outputDirPath, year, format)
+			if err != nil {
+				return err
+			}
+			if archiveFile == nil {
+				// 対象のメールが全て移動、削除されていた
+				continue
+			}
+			archiveFiles = append(archiveFiles, archiveFile)
+
+			for _, mail := range archiveFile.Mails {
+				// 削除したのに記録が無い状態にならないよう、監査ログに書き込んでから削除する
+				if err := writeAuditLog(auditLog, "archived", mail); err != nil {
+					return err
+				}
+
+				if err := os.Remove(mail.Path); err != nil && !os.IsNotExist(err) {
+					// アーカイブには格納済みだが、元のメールは残っている
+					if auditErr := writeAuditLog(auditLog, "not-deleted", mail); auditErr != nil {
+						return auditErr
+					}
+					return err
+				}
+				removed = append(removed, mail)
+			}
+		}
+		return nil
+	}()
+
+	if err := updateMaildirSize(rootMailFolderPath, removed); err != nil {
+		if archiveErr == nil {
+			archiveErr = err
+		}
+	}
+
+	return archiveFiles, archiveErr
+}
+
+func archiveYear(rootMailFolderPath string, mails []*SelectedMail, outputDirPath string, year int, format ArchiveFormat) (*ArchiveFile, error) {
+
+	// 書き込み途中のものが残らないように、一時ファイルに書き出して検証後にリネームする
+	temp, err := os.CreateTemp(outputDirPath, ".archive-*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	tempPath := temp.Name()
+	defer os.Remove(tempPath)
+
+	var entries []*archivedEntry
+	switch format {
+	case TarZstArchive:
+		entries, err = writeTarZst(temp, rootMailFolderPath, mails)
+	default:
+		entries, err = writeMboxGz(temp, mails)
+	}
+	if err != nil {
+		temp.Close()
+		return nil, err
+	}
+
+	if err := temp.Close(); err != nil {
+		return nil, err
+	}
+
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	switch format {
+	case TarZstArchive:
+		err = verifyTarZst(tempPath, entries)
+	default:
+		err = verifyMboxGz(tempPath, entries)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	archivePath, err := newArchivePath(outputDirPath, year, format)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Rename(tempPath, archivePath); err != nil {
+		return nil, err
+	}
+
+	archivedMails := []*SelectedMail{}
+	for _, entry := range entries {
+		archivedMails = append(archivedMails, entry.mail)
+	}
+
+	return &ArchiveFile{
+		Path:  archivePath,
+		Year:  year,
+		Mails: archivedMails,
+	}, nil
+}
+
+func newArchivePath(outputDirPath string, year int, format ArchiveFormat) (string, error) {
+
+	baseName := "archive-" + strconv.Itoa(year)
+
+	for i := 0; ; i++ {
+		name := baseName
+		if i > 0 {
+			name += "." + strconv.Itoa(i)
+		}
+
+		path := filepath.Join(outputDirPath, name+format.extension())
+		if _, err := os.Stat(path); err != nil {
+			if os.IsNotExist(err) {
+				return path, nil
+			}
+			return "", err
+		}
+	}
+}
+
+// mboxrd形式で書き出す
+// 本文中の "From " で始まる行(先頭に">"が続くものも含む)は、先頭に">"を付けてエスケープする
+func writeMboxGz(writer io.Writer, mails []*SelectedMail) ([]*archivedEntry, error) {
+
+	gzipWriter := gzip.NewWriter(writer)
+	entries := []*archivedEntry{}
+
+	for _, mail := range mails {
+		hash, err := writeMboxMessage(gzipWriter, mail)
+		if err != nil {
+			if os.IsNotExist(err) {
+				// 集計後に移動、削除されたものは対象外
+				continue
+			}
+			return nil, err
+		}
+
+		entries = append(entries, &archivedEntry{
+			mail: mail,
+			hash: hash,
+		})
+	}
+
+	if err := gzipWriter.Close(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func writeMboxMessage(writer io.Writer, mail *SelectedMail) ([]byte, error) {
+
+	file, err := os.Open(mail.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if _, err := fmt.Fprintf(writer, "From MAILER-DAEMON %s\n", mail.Time.UTC().Format(time.ANSIC)); err != nil {
+		return nil, err
+	}
+
+	hash := sha256.New()
+	reader := bufio.NewReader(file)
+	lastLine := []byte{}
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			hash.Write(line)
+			if isMboxFromLine(line) {
+				if _, err := writer.Write([]byte(">")); err != nil {
+					return nil, err
+				}
+			}
+			if _, err := writer.Write(line); err != nil {
+				return nil, err
+			}
+			lastLine = line
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// 最後が改行で終わっていない場合は改行を補う
+	if len(lastLine) == 0 || lastLine[len(lastLine)-1] != '\n' {
+		hash.Write([]byte("\n"))
+		if _, err := writer.Write([]byte("\n")); err != nil {
+			return nil, err
+		}
+	}
+
+	// メッセージ間の区切りの空行
+	if _, err := writer.Write([]byte("\n")); err != nil {
+		return nil, err
+	}
+
+	return hash.Sum(nil), nil
+}
+
+// ">"が0個以上続いた後に "From " が来る行
+func isMboxFromLine(line []byte) bool {
+	return bytes.HasPrefix(bytes.TrimLeft(line, ">"), []byte("From "))
+}
+
+func verifyMboxGz(path string, entries []*archivedEntry) error {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("archive verification failed: %w", err)
+	}
+
+	hashes := [][]byte{}
+	var current hash.Hash
+	var pendingBlank []byte // 区切りの空行かどうかは次の行を見るまで分からない
+
+	finishMessage := func() {
+		if current != nil {
+			hashes = append(hashes, current.Sum(nil))
+		}
+	}
+
+	reader := bufio.NewReader(gzipReader)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("archive verification failed: %w", err)
+		}
+
+		if len(line) > 0 {
+			if bytes.HasPrefix(line, []byte("From ")) {
+				// 次のメッセージの開始
+				finishMessage()
+				current = sha256.New()
+				pendingBlank = nil
+			} else if current != nil {
+				if pendingBlank != nil {
+					current.Write(pendingBlank)
+					pendingBlank = nil
+				}
+				if string(line) == "\n" {
+					pendingBlank = line
+				} else if isMboxFromLine(line) {
+					current.Write(line[1:])
+				} else {
+					current.Write(line)
+				}
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+	finishMessage()
+
+	return verifyHashes(entries, hashes)
+}
+
+func writeTarZst(writer io.Writer, rootMailFolderPath string, mails []*SelectedMail) ([]*archivedEntry, error) {
+
+	zstdWriter, err := zstd.NewWriter(writer)
+	if err != nil {
+		return nil, err
+	}
+	tarWriter := tar.NewWriter(zstdWriter)
+	entries := []*archivedEntry{}
+
+	for _, mail := range mails {
+		name, err := filepath.Rel(rootMailFolderPath, mail.Path)
+		if err != nil {
+			return nil, err
+		}
+		name = filepath.ToSlash(name)
+
+		hash, err := writeTarEntry(tarWriter, name, mail)
+		if err != nil {
+			if os.IsNotExist(err) {
+				// 集計後に移動、削除されたものは対象外
+				continue
+			}
+			return nil, err
+		}
+
+		entries = append(entries, &archivedEntry{
+			mail: mail,
+			name: name,
+			hash: hash,
+		})
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return nil, err
+	}
+	if err := zstdWriter.Close(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func writeTarEntry(tarWriter *tar.Writer, name string, mail *SelectedMail) ([]byte, error) {
+
+	file, err := os.Open(mail.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0600,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}
+	if err := tarWriter.WriteHeader(header); err != nil {
+		return nil, err
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(tarWriter, io.TeeReader(file, hash)); err != nil {
+		return nil, err
+	}
+
+	return hash.Sum(nil), nil
+}
+
+func verifyTarZst(path string, entries []*archivedEntry) error {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	zstdReader, err := zstd.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("archive verification failed: %w", err)
+	}
+	defer zstdReader.Close()
+
+	tarReader := tar.NewReader(zstdReader)
+	hashes := [][]byte{}
+
+	for index := 0; ; index++ {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("archive verification failed: %w", err)
+		}
+
+		if index < len(entries) && header.Name != entries[index].name {
+			return fmt.Errorf("archive verification failed: unexpected entry '%s'", header.Name)
+		}
+
+		hash := sha256.New()
+		if _, err := io.Copy(hash, tarReader); err != nil {
+			return fmt.Errorf("archive verification failed: %w", err)
+		}
+		hashes = append(hashes, hash.Sum(nil))
+	}
+
+	return verifyHashes(entries, hashes)
+}
+
+func verifyHashes(entries []*archivedEntry, hashes [][]byte) error {
+
+	if len(entries) != len(hashes) {
+		return fmt.Errorf("archive verification failed: expected %d mails, but %d", len(entries), len(hashes))
+	}
+
+	for i, entry := range entries {
+		if !bytes.Equal(entry.hash, hashes[i]) {
+			return fmt.Errorf("archive verification failed: content mismatch '%s'", entry.mail.Path)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,231 @@
+package maildir
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiveMails_MboxGz(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	output := t.TempDir()
+
+	setupTestArchiveMaildir(t, temp)
+	createFile(t, filepath.Join(temp, maildirSizeFileName), "1000000S,1000C\n")
+
+	mails := testArchiveMails(temp)
+	auditLog := new(bytes.Buffer)
+
+	// ACT
+	archiveFiles, err := ArchiveMails(temp, mails, output, MboxGzArchive, auditLog)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	assert.Equal(
+		t,
+		[]*ArchiveFile{
+			{Path: filepath.Join(output, "archive-2021.mbox.gz"), Year: 2021, Mails: []*SelectedMail{mails[2]}},
+			{Path: filepath.Join(output, "archive-2022.mbox.gz"), Year: 2022, Mails: []*SelectedMail{mails[0], mails[1]}},
+		},
+		archiveFiles)
+
+	assert.Equal(
+		t,
+		"From MAILER-DAEMON Sat Jan  1 00:00:00 2022\n"+
+			"Subject: a\n\n>From here\n>>From there\n\n"+
+			"From MAILER-DAEMON Sat Jan  1 00:00:00 2022\n"+
+			"Subject: b\n\nno newline\n\n",
+		readGzip(t, filepath.Join(output, "archive-2022.mbox.gz")))
+	assert.Equal(
+		t,
+		"From MAILER-DAEMON Fri Jan  1 00:00:00 2021\n"+
+			"Subject: c\n\n\n",
+		readGzip(t, filepath.Join(output, "archive-2021.mbox.gz")))
+
+	// 元のメールは削除されている
+	for _, mail := range mails {
+		assert.NoFileExists(t, mail.Path)
+	}
+
+	maildirSize, err := os.ReadFile(filepath.Join(temp, maildirSizeFileName))
+	require.NoError(t, err)
+	assert.Equal(t, "1000000S,1000C\n-68 -3\n", string(maildirSize))
+
+	assert.Contains(t, auditLog.String(), "\tarchived\tTrash\t12\t"+mails[2].Path+"\n")
+}
+
+func TestArchiveMails_TarZst(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	output := t.TempDir()
+
+	setupTestArchiveMaildir(t, temp)
+	mails := testArchiveMails(temp)
+
+	// 同名のファイルが既にある場合は連番が付く
+	createFile(t, filepath.Join(output, "archive-2022.tar.zst"), "")
+
+	// ACT
+	archiveFiles, err := ArchiveMails(temp, mails, output, TarZstArchive, io.Discard)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	assert.Equal(
+		t,
+		[]*ArchiveFile{
+			{Path: filepath.Join(output, "archive-2021.tar.zst"), Year: 2021, Mails: []*SelectedMail{mails[2]}},
+			{Path: filepath.Join(output, "archive-2022.1.tar.zst"), Year: 2022, Mails: []*SelectedMail{mails[0], mails[1]}},
+		},
+		archiveFiles)
+
+	assert.Equal(
+		t,
+		map[string]string{
+			"cur/1640995200.M1:2,S": "Subject: a\n\nFrom here\n>From there\n",
+			"new/1640995200.M2":     "Subject: b\n\nno newline",
+		},
+		readTarZst(t, filepath.Join(output, "archive-2022.1.tar.zst")))
+	assert.Equal(
+		t,
+		map[string]string{
+			".Trash/cur/1609459200.M3:2,ST": "Subject: c\n\n",
+		},
+		readTarZst(t, filepath.Join(output, "archive-2021.tar.zst")))
+
+	for _, mail := range mails {
+		assert.NoFileExists(t, mail.Path)
+	}
+	// maildirsizeが無い場合は作成しない
+	assert.NoFileExists(t, filepath.Join(temp, maildirSizeFileName))
+}
+
+func TestArchiveMails_NotExist(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	output := t.TempDir()
+
+	mails := []*SelectedMail{
+		{MailFolderName: "", Path: filepath.Join(temp, "cur", "1"), Size: 1, Time: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	// ACT
+	archiveFiles, err := ArchiveMails(temp, mails, output, MboxGzArchive, io.Discard)
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Empty(t, archiveFiles)
+
+	// 一時ファイルも含めて何も作られない
+	entries, err := os.ReadDir(output)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestArchiveMails_AuditLogError(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	output := t.TempDir()
+
+	setupTestArchiveMaildir(t, temp)
+	mails := testArchiveMails(temp)
+
+	// ACT
+	_, err := ArchiveMails(temp, mails, output, MboxGzArchive, &errorWriter{errors.New("disk full")})
+
+	// ASSERT
+	require.EqualError(t, err, "disk full")
+
+	// 監査ログに書き込めなかったものは削除しない
+	for _, mail := range mails {
+		assert.FileExists(t, mail.Path)
+	}
+}
+
+func TestIsMboxFromLine(t *testing.T) {
+
+	assert.True(t, isMboxFromLine([]byte("From a\n")))
+	assert.True(t, isMboxFromLine([]byte(">From a\n")))
+	assert.True(t, isMboxFromLine([]byte(">>From a\n")))
+	assert.False(t, isMboxFromLine([]byte("From:\n")))
+	assert.False(t, isMboxFromLine([]byte(" From a\n")))
+}
+
+func setupTestArchiveMaildir(t *testing.T, rootMailFolderPath string) {
+
+	createDir(t, rootMailFolderPath, "cur")
+	createDir(t, rootMailFolderPath, "new")
+	createFile(t, filepath.Join(rootMailFolderPath, "cur", "1640995200.M1:2,S"), "Subject: a\n\nFrom here\n>From there\n")
+	createFile(t, filepath.Join(rootMailFolderPath, "new", "1640995200.M2"), "Subject: b\n\nno newline")
+
+	sub := createDir(t, rootMailFolderPath, ".Trash")
+	createDir(t, sub, "cur")
+	createFile(t, filepath.Join(sub, "cur", "1609459200.M3:2,ST"), "Subject: c\n\n")
+}
+
+func testArchiveMails(rootMailFolderPath string) []*SelectedMail {
+
+	return []*SelectedMail{
+		{MailFolderName: "", Path: filepath.Join(rootMailFolderPath, "cur", "1640995200.M1:2,S"), Size: 34, Time: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{MailFolderName: "", Path: filepath.Join(rootMailFolderPath, "new", "1640995200.M2"), Size: 22, Time: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{MailFolderName: "Trash", Path: filepath.Join(rootMailFolderPath, ".Trash", "cur", "1609459200.M3:2,ST"), Size: 12, Time: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+}
+
+func readGzip(t *testing.T, path string) string {
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	reader, err := gzip.NewReader(file)
+	require.NoError(t, err)
+
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+
+	return string(data)
+}
+
+func readTarZst(t *testing.T, path string) map[string]string {
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	zstdReader, err := zstd.NewReader(file)
+	require.NoError(t, err)
+	defer zstdReader.Close()
+
+	contents := map[string]string{}
+	tarReader := tar.NewReader(zstdReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+
+		data, err := io.ReadAll(tarReader)
+		require.NoError(t, err)
+		contents[header.Name] = string(data)
+	}
+
+	return contents
+}
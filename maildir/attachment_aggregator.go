@@ -0,0 +1,236 @@
+package maildir
+
+import (
+	"bufio"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	netmail "net/mail"
+	"path/filepath"
+	"strings"
+)
+
+// ネストしたマルチパートを辿る深さの上限
+const maxMultipartDepth = 10
+
+type attachment struct {
+	contentType string
+	fileName    string
+	size        int64 // デコード後のバイト数
+	encodedSize int64 // メール内での(エンコードされたままの)バイト数
+}
+
+// 添付ファイルをContent-Type毎、拡張子毎に集計
+// サイズはデコード後のバイト数
+// メールの読み込みは集計の呼び出し元で行い、読み込めない場合はメールフォルダのエラーとなる
+type AttachmentAggregator struct {
+	resultByType           map[string]*AggregateResult
+	resultByExtension      map[string]*AggregateResult
+	encodedSizeByType      map[string]int64
+	encodedSizeByExtension map[string]int64
+}
+
+func NewAttachmentAggregator() *AttachmentAggregator {
+	return &AttachmentAggregator{
+		resultByType:           map[string]*AggregateResult{},
+		resultByExtension:      map[string]*AggregateResult{},
+		encodedSizeByType:      map[string]int64{},
+		encodedSizeByExtension: map[string]int64{},
+	}
+}
+
+func (a *AttachmentAggregator) StartUser(userName string) {
+	// 何もしない
+}
+
+func (a *AttachmentAggregator) StartMailFolder(mailFolderName string) {
+	// 何もしない
+}
+
+func (a *AttachmentAggregator) Aggregate(mail mailInfo) {
+
+	for _, attachment := range mail.attachments {
+		extension := strings.ToLower(filepath.Ext(attachment.fileName))
+
+		addResult(a.resultByType, attachment.contentType, attachment.size)
+		addResult(a.resultByExtension, extension, attachment.size)
+		a.encodedSizeByType[attachment.contentType] += attachment.encodedSize
+		a.encodedSizeByExtension[extension] += attachment.encodedSize
+	}
+}
+
+func (a *AttachmentAggregator) NeedsAttachments() bool {
+	return true
+}
+
+func (a *AttachmentAggregator) TypeResults() []*AggregateResult {
+	return resultsOf(a.resultByType)
+}
+
+func (a *AttachmentAggregator) ExtensionResults() []*AggregateResult {
+	return resultsOf(a.resultByExtension)
+}
+
+// Content-Type毎の、メール内での(エンコードされたままの)バイト数
+// メールボックスのサイズと比較する場合は、こちらを使う
+func (a *AttachmentAggregator) TypeEncodedSizes() map[string]int64 {
+	return a.encodedSizeByType
+}
+
+// 拡張子毎の、メール内での(エンコードされたままの)バイト数
+func (a *AttachmentAggregator) ExtensionEncodedSizes() map[string]int64 {
+	return a.encodedSizeByExtension
+}
+
+func addResult(resultByName map[string]*AggregateResult, name string, size int64) {
+
+	result, ok := resultByName[name]
+	if !ok {
+		result = &AggregateResult{
+			Name:      name,
+			Count:     0,
+			TotalSize: 0,
+		}
+		resultByName[name] = result
+	}
+
+	result.Count++
+	result.TotalSize += size
+}
+
+func resultsOf(resultByName map[string]*AggregateResult) []*AggregateResult {
+
+	results := []*AggregateResult{}
+
+	for _, result := range resultByName {
+		results = append(results, result)
+	}
+
+	return results
+}
+
+func readAttachments(mail mailInfo) ([]attachment, error) {
+
+	content, err := mail.openContent()
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+
+	reader := &errorRecordReader{reader: content}
+	message, err := netmail.ReadMessage(bufio.NewReader(reader))
+	if reader.err != nil {
+		return nil, reader.err
+	}
+	if err != nil {
+		// メールとして解釈できないものは添付ファイル無しとして扱う
+		return []attachment{}, nil
+	}
+
+	attachments := []attachment{}
+	walkPart(&attachments, message.Header, message.Body, 0)
+
+	// メールの形式が不正で途中までしか辿れなかった場合も、それまでに見つかったものは対象とする
+	// ただしファイルの読み込み自体に失敗した場合はエラー
+	return attachments, reader.err
+}
+
+// パートを辿って、添付ファイルを集める
+// 本文はストリームとして読み捨てながらサイズを数えるので、メールの大きさによらずメモリの使用量は一定
+func walkPart(attachments *[]attachment, header partHeader, body io.Reader, depth int) {
+
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType = "text/plain"
+		params = map[string]string{}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") && depth < maxMultipartDepth {
+		boundary := params["boundary"]
+		if boundary == "" {
+			return
+		}
+
+		reader := multipart.NewReader(body, boundary)
+		for {
+			part, err := reader.NextRawPart()
+			if err != nil {
+				// io.EOF(終端)もしくは形式不正
+				return
+			}
+			walkPart(attachments, part.Header, part, depth+1)
+		}
+	}
+
+	fileName := attachmentFileName(header, params)
+	disposition, _, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+
+	if disposition != "attachment" && fileName == "" && strings.HasPrefix(mediaType, "text/") {
+		// 本文
+		return
+	}
+
+	encoded := &countReader{reader: body}
+	size, _ := io.Copy(io.Discard, decodeBody(header, encoded))
+	// デコード時に読み残したものも、エンコードされたサイズには含める
+	io.Copy(io.Discard, encoded)
+
+	*attachments = append(*attachments, attachment{
+		contentType: mediaType,
+		fileName:    fileName,
+		size:        size,
+		encodedSize: encoded.count,
+	})
+}
+
+// 読み込んだバイト数を数える
+type countReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (r *countReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.count += int64(n)
+	return n, err
+}
+
+// net/mail.Header と net/textproto.MIMEHeader の両方を扱えるように
+type partHeader interface {
+	Get(key string) string
+}
+
+func attachmentFileName(header partHeader, contentTypeParams map[string]string) string {
+
+	fileName := ""
+	if _, params, err := mime.ParseMediaType(header.Get("Content-Disposition")); err == nil {
+		fileName = params["filename"]
+	}
+	if fileName == "" {
+		fileName = contentTypeParams["name"]
+	}
+
+	// RFC2047形式でエンコードされているものはデコード
+	// 未知の文字コードでデコードできない場合でも、拡張子部分は取れるのでそのまま扱う
+	decoder := new(mime.WordDecoder)
+	if decoded, err := decoder.DecodeHeader(fileName); err == nil {
+		fileName = decoded
+	}
+
+	return fileName
+}
+
+func decodeBody(header partHeader, body io.Reader) io.Reader {
+
+	// NextRawPartを使っているので、quoted-printableもここでデコードする
+	switch strings.ToLower(strings.TrimSpace(header.Get("Content-Transfer-Encoding"))) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	default:
+		return body
+	}
+}
@@ -0,0 +1,226 @@
+package maildir
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregateMailFolders_AttachmentAggregator(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	setupTestAttachmentMaildir(t, temp)
+
+	// ACT
+	aggregator := NewAttachmentAggregator()
+	err := AggregateMailFolders(temp, "", aggregator)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	{
+		results := aggregator.TypeResults()
+		SortByName(results)
+		assert.Equal(
+			t,
+			[]*AggregateResult{
+				{Name: "application/octet-stream", Count: 1, TotalSize: 3},
+				{Name: "application/pdf", Count: 3, TotalSize: 27},
+				{Name: "image/png", Count: 1, TotalSize: 4},
+				{Name: "text/csv", Count: 1, TotalSize: 7},
+			},
+			results,
+		)
+	}
+	{
+		results := aggregator.ExtensionResults()
+		SortByName(results)
+		assert.Equal(
+			t,
+			[]*AggregateResult{
+				{Name: "", Count: 3, TotalSize: 16},
+				{Name: ".csv", Count: 1, TotalSize: 7},
+				{Name: ".pdf", Count: 2, TotalSize: 18},
+			},
+			results,
+		)
+	}
+
+	// メール内でのサイズ(base64などでエンコードされたまま)
+	assert.Equal(
+		t,
+		map[string]int64{
+			"application/octet-stream": 3,
+			"application/pdf":          37, // 14 + 14 + 9
+			"image/png":                8,
+			"text/csv":                 9,
+		},
+		aggregator.TypeEncodedSizes(),
+	)
+	assert.Equal(
+		t,
+		map[string]int64{
+			"":     25, // 14 + 8 + 3
+			".csv": 9,
+			".pdf": 23, // 14 + 9
+		},
+		aggregator.ExtensionEncodedSizes(),
+	)
+}
+
+func TestAggregateMailStoreWithErrorHandler_AttachmentReadError(t *testing.T) {
+
+	// ARRANGE
+	fsys := readErrorFS{
+		MapFS: fstest.MapFS{
+			"Maildir/new":      {Mode: fs.ModeDir},
+			"Maildir/cur/1":    {Data: []byte(crlf("Content-Type: application/pdf\n\nPDF\n"))},
+			"Maildir/.A/cur/2": {Data: []byte(crlf("Content-Type: application/pdf\n\nPDF\n"))},
+		},
+		name: "Maildir/.A/cur/2",
+	}
+
+	aggregator := NewAttachmentAggregator()
+	errors := []*AggregateError{}
+
+	// ACT
+	err := AggregateMailStoreWithErrorHandler(NewMaildirFSStore(fsys, "Maildir", "INBOX"), NewMultiAggregator([]Aggregator{aggregator}), func(err *AggregateError) error {
+		errors = append(errors, err)
+		return nil
+	})
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// 読み込めなかったメールは、そのメールフォルダのエラーとしてエラーハンドラに渡される
+	require.Len(t, errors, 1)
+	assert.Equal(t, "A", errors[0].MailFolderName)
+	assert.EqualError(t, errors[0].Err, "read error")
+
+	assert.Equal(
+		t,
+		[]*AggregateResult{
+			{Name: "application/pdf", Count: 1, TotalSize: 5},
+		},
+		aggregator.TypeResults(),
+	)
+}
+
+// 指定のファイルだけ、読み込みに失敗する
+type readErrorFS struct {
+	fstest.MapFS
+	name string
+}
+
+func (f readErrorFS) Open(name string) (fs.File, error) {
+
+	file, err := f.MapFS.Open(name)
+	if err != nil || name != f.name {
+		return file, err
+	}
+	return &readErrorFile{file}, nil
+}
+
+type readErrorFile struct {
+	fs.File
+}
+
+func (f *readErrorFile) Read(p []byte) (int, error) {
+	return 0, errors.New("read error")
+}
+
+func setupTestAttachmentMaildir(t *testing.T, rootMailFolderPath string) {
+
+	// INBOX
+	createMailFolder(t, rootMailFolderPath, []mail{})
+
+	// 本文(alternative) + PDF(base64) + CSV(quoted-printable) + インライン画像
+	createFile(t, filepath.Join(rootMailFolderPath, "cur", "1"), crlf(`From: a@example.com
+Subject: attachments
+MIME-Version: 1.0
+Content-Type: multipart/mixed; boundary="b1"
+
+--b1
+Content-Type: multipart/alternative; boundary="b2"
+
+--b2
+Content-Type: text/plain; charset=utf-8
+
+body
+--b2
+Content-Type: text/html; charset=utf-8
+
+<p>body</p>
+--b2--
+--b1
+Content-Type: application/pdf; name="a.pdf"
+Content-Disposition: attachment; filename="=?UTF-8?B?44OG44K544OILlBERg==?="
+Content-Transfer-Encoding: base64
+
+cGRmLWRh
+dGEx
+--b1
+Content-Type: text/csv
+Content-Disposition: attachment; filename*=UTF-8''%E3%83%87%E3%83%BC%E3%82%BF.csv
+Content-Transfer-Encoding: quoted-printable
+
+a,b=3D
+1
+--b1
+Content-Type: image/png
+Content-Disposition: inline
+Content-Transfer-Encoding: base64
+
+iVBORw==
+--b1--
+`))
+
+	// 本文のみ
+	createFile(t, filepath.Join(rootMailFolderPath, "cur", "2"), crlf(`From: a@example.com
+Content-Type: text/plain
+
+body
+`))
+
+	// その他フォルダ
+	sub := createDir(t, rootMailFolderPath, ".A")
+	createMailFolder(t, sub, []mail{})
+
+	// メール全体が添付ファイル
+	createFile(t, filepath.Join(sub, "cur", "1"), crlf(`From: a@example.com
+Content-Type: application/pdf
+Content-Transfer-Encoding: base64
+
+MTIzNDU2Nzg5
+`))
+
+	// 拡張子が異なるものと、ファイル名が無いもの
+	createFile(t, filepath.Join(sub, "cur", "2"), crlf(`From: a@example.com
+Content-Type: multipart/mixed; boundary=xyz
+
+--xyz
+Content-Type: application/pdf
+Content-Disposition: attachment; filename=b.PDF
+
+PDFDATA12
+--xyz
+Content-Type: application/octet-stream
+
+abc
+--xyz--
+`))
+
+	// メールとして解釈できないもの
+	createFile(t, filepath.Join(sub, "cur", "3"), "xxxxx")
+}
+
+func crlf(s string) string {
+	return strings.ReplaceAll(s, "\n", "\r\n")
+}
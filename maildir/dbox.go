@@ -0,0 +1,546 @@
+package maildir
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dovecotのdbox(sdbox/mdbox)形式
+//
+//	sdbox: <root>/mailboxes/<フォルダ>/dbox-Mails/u.<UID> (1ファイル1メール)
+//	mdbox: <root>/storage/m.<番号> (1ファイルに複数メール)
+//
+// mdboxのメールがどのフォルダに属するかはインデックスにしか無いので、
+// フォルダ毎のインデックス(mailboxes/<フォルダ>/dbox-Mails/dovecot.index)でメールのmap_uidを、
+// storageのマップインデックス(storage/dovecot.map.index)でmap_uidからファイルと位置を求める
+// どのフォルダからも参照されていないメールは mdboxStorageFolderName のフォルダとして扱う
+const (
+	dboxMailboxesDirName   = "mailboxes"
+	dboxMailsDirName       = "dbox-Mails"
+	dboxIndexFileName      = "dovecot.index"
+	mdboxStorageDirName    = "storage"
+	mdboxMapIndexFileName  = "dovecot.map.index"
+	mdboxStorageFolderName = "(storage)"
+)
+
+// インデックスの拡張の名前
+const (
+	mdboxMailboxExtName = "mdbox" // フォルダのメールのレコード: map_uid(4) save_date(4)
+	mdboxMapExtName     = "map"   // マップのレコード: file_id(4) offset(4) size(4)
+	mdboxRefExtName     = "ref"   // マップのレコードの参照数(2)
+)
+
+var (
+	dboxMagicPre  = []byte("\x01\x02")
+	dboxMagicPost = []byte("\n\x01\x03\n")
+)
+
+// Dovecotのdbox(sdbox/mdbox)形式の格納場所
+type DboxStore struct {
+	rootPath        string
+	inboxFolderName string
+	mdboxMails      map[string][]mdboxMail // mdboxの場合の、フォルダ(Path)毎のメールの位置(MailFoldersで読み込む)
+}
+
+// mdboxのメールのstorage内での位置
+type mdboxMail struct {
+	fileID uint32 // m.<file_id>
+	offset int64  // メールヘッダの位置
+}
+
+func NewDboxStore(rootPath string, inboxFolderName string) *DboxStore {
+	return &DboxStore{
+		rootPath:        rootPath,
+		inboxFolderName: inboxFolderName,
+	}
+}
+
+func (s *DboxStore) MailFolders() []MailFolder {
+
+	folders := []MailFolder{}
+
+	mailboxesPath := filepath.Join(s.rootPath, dboxMailboxesDirName)
+	if _, err := os.Stat(mailboxesPath); err == nil {
+		folders = s.appendSdboxMailFolders(folders, mailboxesPath, "")
+	}
+
+	// storageがあればmdbox
+	storagePath := filepath.Join(s.rootPath, mdboxStorageDirName)
+	if _, err := os.Stat(storagePath); err == nil {
+		return s.mdboxMailFolders(folders, storagePath)
+	}
+
+	return folders
+}
+
+// mailboxes配下のフォルダに、インデックスからメールを割り当てる
+func (s *DboxStore) mdboxMailFolders(folders []MailFolder, storagePath string) []MailFolder {
+
+	s.mdboxMails = map[string][]mdboxMail{}
+
+	mailByMapUID, err := readMdboxMap(storagePath)
+	if err != nil {
+		// メールの位置が分からないので、全てのフォルダが読めない
+		return []MailFolder{{Name: mdboxStorageFolderName, Err: err}}
+	}
+
+	referenced := map[uint32]bool{}
+	mdboxFolders := []MailFolder{}
+	for _, folder := range folders {
+		if folder.Err != nil {
+			mdboxFolders = append(mdboxFolders, folder)
+			continue
+		}
+
+		mapUIDs, err := readMdboxMailbox(folder.Path)
+		if err != nil {
+			mdboxFolders = append(mdboxFolders, MailFolder{Name: folder.Name, Err: err})
+			continue
+		}
+
+		mails := []mdboxMail{}
+		for _, mapUID := range mapUIDs {
+			if mail, ok := mailByMapUID[mapUID]; ok {
+				mails = append(mails, mail)
+				referenced[mapUID] = true
+			}
+		}
+
+		s.mdboxMails[folder.Path] = mails
+		mdboxFolders = append(mdboxFolders, folder)
+	}
+
+	// どのフォルダからも参照されていないもの(フォルダのインデックスが失われた場合など)
+	unreferenced := []mdboxMail{}
+	for mapUID, mail := range mailByMapUID {
+		if !referenced[mapUID] {
+			unreferenced = append(unreferenced, mail)
+		}
+	}
+	if len(unreferenced) > 0 {
+		s.mdboxMails[storagePath] = unreferenced
+		mdboxFolders = append(mdboxFolders, MailFolder{Name: mdboxStorageFolderName, Path: storagePath})
+	}
+
+	return mdboxFolders
+}
+
+// map_uid毎の、storage内のメールの位置
+// 参照数が0のもの(全てのフォルダから削除され、まだ purge されていないもの)は対象外
+func readMdboxMap(storagePath string) (map[uint32]mdboxMail, error) {
+
+	index, err := readDovecotIndex(filepath.Join(storagePath, mdboxMapIndexFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	mailByMapUID := map[uint32]mdboxMail{}
+	for mapUID, values := range index.records {
+		record := values[mdboxMapExtName]
+		if len(record) < 8 || uintLE(values[mdboxRefExtName]) == 0 {
+			continue
+		}
+
+		mailByMapUID[mapUID] = mdboxMail{
+			fileID: binary.LittleEndian.Uint32(record),
+			offset: int64(binary.LittleEndian.Uint32(record[4:])),
+		}
+	}
+
+	return mailByMapUID, nil
+}
+
+// フォルダのメールのmap_uid(UID順)
+// インデックスが無いフォルダは、まだメールが無いものとして扱う
+func readMdboxMailbox(mailsPath string) ([]uint32, error) {
+
+	index, err := readDovecotIndex(filepath.Join(mailsPath, dboxIndexFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []uint32{}, nil
+		}
+		return nil, err
+	}
+
+	mapUIDs := []uint32{}
+	for _, uid := range index.uids() {
+		if record := index.records[uid][mdboxMailboxExtName]; len(record) >= 4 {
+			mapUIDs = append(mapUIDs, binary.LittleEndian.Uint32(record))
+		}
+	}
+
+	return mapUIDs, nil
+}
+
+// mailboxes配下を辿って、dbox-Mailsを持つディレクトリをフォルダとする
+// 階層は "/" 区切りのフォルダ名とする(例: mailboxes/A/B -> A/B)
+func (s *DboxStore) appendSdboxMailFolders(folders []MailFolder, dirPath string, parentName string) []MailFolder {
+
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return append(folders, MailFolder{Name: parentName, Err: err})
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Name() == dboxMailsDirName {
+			continue
+		}
+
+		encodedName := entry.Name()
+		if parentName != "" {
+			encodedName = parentName + "/" + encodedName
+		}
+
+		mailFolderName, err := decodeFolderName(encodedName)
+		if err != nil {
+			// デコードできない場合は、デコード前の名前でエラーとして扱う
+			folders = append(folders, MailFolder{Name: encodedName, Err: err})
+			continue
+		}
+		if mailFolderName == "INBOX" {
+			mailFolderName = s.inboxFolderName
+		}
+
+		mailboxPath := filepath.Join(dirPath, entry.Name())
+		mailsPath := filepath.Join(mailboxPath, dboxMailsDirName)
+		if _, err := os.Stat(mailsPath); err == nil {
+			folders = append(folders, MailFolder{Name: mailFolderName, Path: mailsPath})
+		}
+
+		// 子フォルダ
+		folders = s.appendSdboxMailFolders(folders, mailboxPath, encodedName)
+	}
+
+	return folders
+}
+
+func (s *DboxStore) WalkMails(folder MailFolder, fn func(mail Mail) error) error {
+
+	if mails, ok := s.mdboxMails[folder.Path]; ok {
+		return s.walkMdboxMails(mails, fn)
+	}
+
+	// sdboxは u.<UID>
+	entries, err := os.ReadDir(folder.Path)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), "u.") {
+			continue
+		}
+
+		if err := walkDboxFile(filepath.Join(folder.Path, entry.Name()), fn); err != nil {
+			if os.IsNotExist(err) {
+				// 集計中に移動、削除されたものは対象外
+				continue
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mdboxのメールを、ファイル毎、位置順に読み込んで渡す
+func (s *DboxStore) walkMdboxMails(mails []mdboxMail, fn func(mail Mail) error) error {
+
+	sortedMails := append([]mdboxMail{}, mails...)
+	sort.Slice(sortedMails, func(i, j int) bool {
+		if sortedMails[i].fileID != sortedMails[j].fileID {
+			return sortedMails[i].fileID < sortedMails[j].fileID
+		}
+		return sortedMails[i].offset < sortedMails[j].offset
+	})
+
+	var file *dboxFile
+	defer func() {
+		if file != nil {
+			file.Close()
+		}
+	}()
+
+	for _, mdboxMail := range sortedMails {
+		path := filepath.Join(s.rootPath, mdboxStorageDirName, "m."+strconv.FormatUint(uint64(mdboxMail.fileID), 10))
+
+		if file == nil || file.path != path {
+			if file != nil {
+				file.Close()
+				file = nil
+			}
+
+			opened, err := openDboxFile(path)
+			if err != nil {
+				if os.IsNotExist(err) {
+					// 集計中に purge などで移動、削除されたものは対象外
+					continue
+				}
+				return err
+			}
+			file = opened
+		}
+
+		mail, _, err := file.readMail(mdboxMail.offset)
+		if err == io.EOF {
+			return fmt.Errorf("%s is invalid dbox file: no mail at offset %d", path, mdboxMail.offset)
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := fn(mail); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// dboxファイル内のメールを順に渡す
+func walkDboxFile(path string, fn func(mail Mail) error) error {
+
+	file, err := openDboxFile(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	offset := file.headerSize
+	for {
+		mail, next, err := file.readMail(offset)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := fn(mail); err != nil {
+			return err
+		}
+		offset = next
+	}
+}
+
+// dboxファイル
+//
+//	ファイルヘッダ:     2 M<メールヘッダのサイズ(16進)> C<作成日時(16進)>\n
+//	メールヘッダ:       \x01\x02N <...> <メールのサイズ(16進)>\n
+//	メール本体
+//	メタデータ:         \n\x01\x03\n に続いて <キー1文字><値>\n の行、空行で終わり
+//
+// 日時はメタデータの受信日時(R)、無い場合は保存日時(S)、それも無い場合はファイルの作成日時とする
+type dboxFile struct {
+	path              string
+	file              *os.File
+	headerSize        int64 // ファイルヘッダのサイズ(最初のメールの位置)
+	messageHeaderSize int64
+	createTime        time.Time
+	multiple          bool // mdboxのファイル(1ファイルに複数メール)
+}
+
+func openDboxFile(path string) (*dboxFile, error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	fileHeader, err := bufio.NewReader(file).ReadString('\n')
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s is invalid dbox file: %w", path, err)
+	}
+
+	fields := strings.Fields(fileHeader)
+	if len(fields) == 0 || fields[0] != "2" {
+		file.Close()
+		return nil, fmt.Errorf("%s is unsupported dbox file version", path)
+	}
+
+	dboxFile := &dboxFile{
+		path:       path,
+		file:       file,
+		headerSize: int64(len(fileHeader)),
+		createTime: time.Unix(0, 0).UTC(),
+		multiple:   strings.HasPrefix(filepath.Base(path), "m."),
+	}
+	for _, field := range fields[1:] {
+		value, err := strconv.ParseInt(field[1:], 16, 64)
+		if err != nil {
+			continue
+		}
+		switch field[0] {
+		case 'M':
+			dboxFile.messageHeaderSize = value
+		case 'C':
+			dboxFile.createTime = time.Unix(value, 0).UTC()
+		}
+	}
+
+	return dboxFile, nil
+}
+
+func (f *dboxFile) Close() error {
+	return f.file.Close()
+}
+
+// offset(メールヘッダの位置)のメールと、次のメールの位置を返す
+// ファイルの末尾の場合は io.EOF を返す
+func (f *dboxFile) readMail(offset int64) (Mail, int64, error) {
+
+	reader := bufio.NewReader(io.NewSectionReader(f.file, offset, math.MaxInt64-offset))
+	messageHeader, err := readDboxMessageHeader(reader, f.messageHeaderSize)
+	if err == io.EOF {
+		return Mail{}, 0, io.EOF
+	}
+	if err != nil {
+		return Mail{}, 0, fmt.Errorf("%s is invalid dbox file: %w", f.path, err)
+	}
+
+	size, err := dboxMessageSize(messageHeader)
+	if err != nil {
+		return Mail{}, 0, fmt.Errorf("%s is invalid dbox file: %w", f.path, err)
+	}
+	start := offset + int64(len(messageHeader))
+
+	// メール本体は読まずに、その後ろのメタデータを読み込む
+	metadataOffset := start + size
+	metadataReader := bufio.NewReader(io.NewSectionReader(f.file, metadataOffset, math.MaxInt64-metadataOffset))
+	metadata, metadataSize, err := readDboxMetadata(metadataReader)
+	if err != nil {
+		return Mail{}, 0, fmt.Errorf("%s is invalid dbox file: %w", f.path, err)
+	}
+
+	mail := Mail{
+		Size: size,
+		Time: dboxTime(metadata, f.createTime),
+		Path: f.path,
+		Open: sectionOpener(f.path, start, size),
+	}
+	if f.multiple {
+		// 同じファイル内のメールを区別できるように、先頭からの位置を付けておく
+		mail.Path = f.path + "#" + strconv.FormatInt(start, 10)
+	}
+
+	return mail, metadataOffset + metadataSize, nil
+}
+
+func readDboxMessageHeader(reader *bufio.Reader, size int64) ([]byte, error) {
+
+	var header []byte
+	if size > 0 {
+		header = make([]byte, size)
+		n, err := io.ReadFull(reader, header)
+		if err == io.EOF || (err == io.ErrUnexpectedEOF && n == 0) {
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		// ファイルヘッダにサイズが無い場合は行で判断する
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		header = line
+	}
+
+	if !bytes.HasPrefix(header, dboxMagicPre) {
+		return nil, fmt.Errorf("invalid message header")
+	}
+
+	return header, nil
+}
+
+// メールヘッダの最後の項目がメールのサイズ
+func dboxMessageSize(messageHeader []byte) (int64, error) {
+
+	fields := strings.Fields(string(messageHeader[len(dboxMagicPre):]))
+	if len(fields) < 2 {
+		return 0, fmt.Errorf("invalid message header")
+	}
+
+	size, err := strconv.ParseInt(fields[len(fields)-1], 16, 64)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("invalid message size '%s'", fields[len(fields)-1])
+	}
+
+	return size, nil
+}
+
+// メタデータを読み込み、キー毎の値と読み込んだサイズを返す
+func readDboxMetadata(reader *bufio.Reader) (map[byte]string, int64, error) {
+
+	magic := make([]byte, len(dboxMagicPost))
+	if _, err := io.ReadFull(reader, magic); err != nil {
+		return nil, 0, err
+	}
+	if !bytes.Equal(magic, dboxMagicPost) {
+		return nil, 0, fmt.Errorf("invalid metadata")
+	}
+
+	metadata := map[byte]string{}
+	size := int64(len(magic))
+
+	for {
+		line, err := reader.ReadString('\n')
+		size += int64(len(line))
+		if err == io.EOF && len(line) == 0 {
+			// 末尾の空行が無いものも許容
+			return metadata, size, nil
+		}
+		if err != nil && err != io.EOF {
+			return nil, 0, err
+		}
+
+		line = strings.TrimRight(line, "\n")
+		if line == "" {
+			return metadata, size, nil
+		}
+		metadata[line[0]] = line[1:]
+
+		if err == io.EOF {
+			return metadata, size, nil
+		}
+	}
+}
+
+func dboxTime(metadata map[byte]string, createTime time.Time) time.Time {
+
+	for _, key := range []byte{'R', 'S'} {
+		if value, ok := metadata[key]; ok {
+			if unixtime, err := strconv.ParseInt(value, 16, 64); err == nil {
+				return time.Unix(unixtime, 0).UTC()
+			}
+		}
+	}
+
+	return createTime
+}
+
+// isDbox はmailboxesもしくはstorageがあればdboxとみなす
+func isDbox(path string) bool {
+
+	for _, subName := range []string{dboxMailboxesDirName, mdboxStorageDirName} {
+		if info, err := os.Stat(filepath.Join(path, subName)); err == nil && info.IsDir() {
+			return true
+		}
+	}
+	return false
+}
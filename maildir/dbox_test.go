@@ -0,0 +1,313 @@
+package maildir
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregateDbox_Sdbox(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	setupTestSdbox(t, temp)
+
+	aggregator := NewSelectAggregator(SelectCondition{})
+
+	// ACT
+	err := AggregateMailStore(NewDboxStore(temp, "INBOX"), aggregator)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	mailboxes := filepath.Join(temp, "mailboxes")
+	assert.Equal(
+		t,
+		[]*SelectedMail{
+			{MailFolderName: "INBOX", Path: filepath.Join(mailboxes, "INBOX", "dbox-Mails", "u.1"), Size: 11, Time: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)},
+			{MailFolderName: "INBOX", Path: filepath.Join(mailboxes, "INBOX", "dbox-Mails", "u.2"), Size: 12, Time: time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC)},
+			{MailFolderName: "Sent", Path: filepath.Join(mailboxes, "Sent", "dbox-Mails", "u.1"), Size: 21, Time: time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)},
+			{MailFolderName: "Sent/あ", Path: filepath.Join(mailboxes, "Sent", "&MEI-", "dbox-Mails", "u.1"), Size: 31, Time: time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC)},
+		},
+		aggregator.Results())
+}
+
+func TestAggregateDbox_Mdbox(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	storage := createDir(t, temp, "storage")
+	mailboxes := createDir(t, temp, "mailboxes")
+
+	createTime := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	header := dboxFileHeader(true, createTime)
+	message1 := dboxMessage("Subject: a\n\nbody\n", time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+	message2 := dboxMessage("Subject: b\n\nbody b\n", time.Time{})
+	message3 := dboxMessage("Subject: c\n\nbody c\n", time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC))
+	message4 := dboxMessage("Subject: d\n\nbody dd\n", time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC))
+
+	createFile(t, filepath.Join(storage, "m.1"), header+message1+message2+message3)
+	createFile(t, filepath.Join(storage, "m.2"), header+message4)
+
+	offset1 := len(header)
+	offset2 := offset1 + len(message1)
+	offset3 := offset2 + len(message2)
+	offset4 := len(header)
+
+	// map_uid毎の m.<file_id> 内の位置と参照数
+	mapRecord := func(mapUID uint32, fileID uint32, offset int, size int, ref uint16) []byte {
+		record := indexRecord(20, mapUID, 4, leUint32s(fileID, uint32(offset), uint32(size)))
+		binary.LittleEndian.PutUint16(record[16:], ref)
+		return record
+	}
+	createFile(t, filepath.Join(storage, "dovecot.map.index"), string(dovecotIndexFile(
+		[]testIndexExt{{"map", 4, 12}, {"ref", 16, 2}},
+		20,
+		[][]byte{
+			mapRecord(1, 1, offset1, len(message1), 1),
+			mapRecord(2, 1, offset2, len(message2), 2),
+			mapRecord(3, 1, offset3, len(message3), 0), // 参照数が0(削除済み)は対象外
+			mapRecord(4, 2, offset4, len(message4), 1), // どのフォルダからも参照されていない
+		},
+		1, 0)))
+
+	// フォルダ毎のメールのmap_uid
+	inbox := createDir(t, createDir(t, mailboxes, "INBOX"), "dbox-Mails")
+	createFile(t, filepath.Join(inbox, "dovecot.index"), string(dovecotIndexFile(
+		[]testIndexExt{{"mdbox", 4, 8}},
+		12,
+		[][]byte{
+			indexRecord(12, 1, 4, leUint32s(2, 0)),
+			indexRecord(12, 2, 4, leUint32s(1, 0)),
+		},
+		1, 0)))
+
+	// インデックスファイルが無く、トランザクションログのみ
+	sent := createDir(t, createDir(t, mailboxes, "Sent"), "dbox-Mails")
+	createFile(t, filepath.Join(sent, "dovecot.index.log"), string(dovecotLogFile(1,
+		dovecotLogTransaction(dovecotLogAppend, leUint32s(1, 0)),
+		dovecotLogTransaction(dovecotLogExtIntro, dovecotLogExtIntroData(dovecotLogNewExtID, "mdbox", 8)),
+		dovecotLogTransaction(dovecotLogExtRecUpdate, leUint32s(1, 2, 0)))))
+
+	// インデックスが無いフォルダはメール無し
+	createDir(t, createDir(t, mailboxes, "Trash"), "dbox-Mails")
+
+	aggregator := NewSelectAggregator(SelectCondition{})
+
+	// ACT
+	err := AggregateMailStore(NewDboxStore(temp, "INBOX"), aggregator)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	path1 := filepath.Join(storage, "m.1") + "#" + strconv.Itoa(offset1+len(dboxMessageHeader(0)))
+	path2 := filepath.Join(storage, "m.1") + "#" + strconv.Itoa(offset2+len(dboxMessageHeader(0)))
+	path4 := filepath.Join(storage, "m.2") + "#" + strconv.Itoa(offset4+len(dboxMessageHeader(0)))
+
+	assert.Equal(
+		t,
+		[]*SelectedMail{
+			// ファイル内の位置順
+			{MailFolderName: "INBOX", Path: path1, Size: 17, Time: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)},
+			// 日時がメタデータに無い場合はファイルの作成日時
+			{MailFolderName: "INBOX", Path: path2, Size: 19, Time: createTime},
+			{MailFolderName: "Sent", Path: path2, Size: 19, Time: createTime},
+			{MailFolderName: "(storage)", Path: path4, Size: 20, Time: time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC)},
+		},
+		aggregator.Results())
+}
+
+func TestAggregateDbox_MdboxInvalidIndex(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	storage := createDir(t, temp, "storage")
+	inbox := createDir(t, createDir(t, createDir(t, temp, "mailboxes"), "INBOX"), "dbox-Mails")
+
+	createFile(t, filepath.Join(storage, "dovecot.map.index"), string(dovecotIndexFile([]testIndexExt{}, 8, [][]byte{}, 1, 0)))
+	createFile(t, filepath.Join(inbox, "dovecot.index"), "index")
+
+	store := NewDboxStore(temp, "INBOX")
+
+	// ACT
+	folders := store.MailFolders()
+
+	// ASSERT
+	require.Len(t, folders, 1)
+	assert.Equal(t, "INBOX", folders[0].Name)
+	require.Error(t, folders[0].Err)
+	assert.Contains(t, folders[0].Err.Error(), "is invalid index file: header is too short")
+}
+
+func TestAggregateDbox_MdboxMapNotFound(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	createDir(t, temp, "storage")
+	createDir(t, createDir(t, createDir(t, temp, "mailboxes"), "INBOX"), "dbox-Mails")
+
+	store := NewDboxStore(temp, "INBOX")
+
+	// ACT
+	folders := store.MailFolders()
+
+	// ASSERT
+	require.Len(t, folders, 1)
+	assert.Equal(t, "(storage)", folders[0].Name)
+	require.Error(t, folders[0].Err)
+	assert.True(t, os.IsNotExist(folders[0].Err))
+}
+
+func TestWalkDboxFile_Content(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	path := filepath.Join(temp, "m.1")
+	createFile(t, path,
+		dboxFileHeader(false, time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))+
+			dboxMessage("From: a@example.com\nSubject: a\n\nbody\n", time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))+
+			dboxMessage("From: b@example.net\nSubject: b\n\nbody b\n", time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)))
+
+	mails := []Mail{}
+
+	// ACT
+	err := walkDboxFile(path, func(mail Mail) error {
+		mails = append(mails, mail)
+		return nil
+	})
+
+	// ASSERT
+	require.NoError(t, err)
+	require.Len(t, mails, 2)
+
+	for i, expected := range []string{"From: a@example.com\nSubject: a\n\nbody\n", "From: b@example.net\nSubject: b\n\nbody b\n"} {
+		content, err := mails[i].Open()
+		require.NoError(t, err)
+		data, err := io.ReadAll(content)
+		require.NoError(t, err)
+		content.Close()
+
+		assert.Equal(t, expected, string(data))
+	}
+}
+
+func TestAggregateDbox_Header(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	mails := createDir(t, createDir(t, createDir(t, temp, "mailboxes"), "INBOX"), "dbox-Mails")
+	path := filepath.Join(mails, "u.1")
+	createFile(t, path,
+		dboxFileHeader(true, time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))+
+			dboxMessage("From: a@example.com\nSubject: a\n\nbody\n", time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)))
+
+	aggregator := NewSenderAggregator()
+
+	// ACT
+	err := AggregateMailStore(NewDboxStore(temp, "INBOX"), aggregator)
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(t, []*AggregateResult{{Name: "a@example.com", Count: 1, TotalSize: 37}}, aggregator.Results())
+}
+
+func TestWalkDboxFile_Invalid(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		content string
+		message string
+	}{
+		{"empty", "", "is invalid dbox file: EOF"},
+		{"version", "1 M22 C0\n", "is unsupported dbox file version"},
+		{"message header", dboxFileHeader(false, time.Time{}) + "xx\n", "is invalid dbox file: invalid message header"},
+		{"message size", dboxFileHeader(false, time.Time{}) + "\x01\x02N zz\n", "is invalid dbox file: invalid message size 'zz'"},
+		{"truncated", dboxFileHeader(false, time.Time{}) + dboxMessageHeader(100) + "abc", "is invalid dbox file: EOF"},
+		{"metadata", dboxFileHeader(false, time.Time{}) + dboxMessageHeader(3) + "abcxxxx", "is invalid dbox file: invalid metadata"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// ARRANGE
+			temp := t.TempDir()
+			path := filepath.Join(temp, "u.1")
+			createFile(t, path, tt.content)
+
+			// ACT
+			err := walkDboxFile(path, func(mail Mail) error { return nil })
+
+			// ASSERT
+			require.EqualError(t, err, path+" "+tt.message)
+		})
+	}
+}
+
+func TestIsDbox(t *testing.T) {
+
+	temp := t.TempDir()
+
+	sdbox := createDir(t, temp, "sdbox")
+	createDir(t, sdbox, "mailboxes")
+	mdbox := createDir(t, temp, "mdbox")
+	createDir(t, mdbox, "storage")
+	other := createDir(t, temp, "other")
+
+	assert.True(t, isDbox(sdbox))
+	assert.True(t, isDbox(mdbox))
+	assert.False(t, isDbox(other))
+}
+
+func setupTestSdbox(t *testing.T, rootPath string) {
+
+	mailboxes := createDir(t, rootPath, "mailboxes")
+
+	inbox := createDir(t, createDir(t, mailboxes, "INBOX"), "dbox-Mails")
+	createFile(t, filepath.Join(inbox, "u.1"),
+		dboxFileHeader(true, time.Time{})+dboxMessage(strings.Repeat("a", 11), time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)))
+	createFile(t, filepath.Join(inbox, "u.2"),
+		dboxFileHeader(true, time.Time{})+dboxMessage(strings.Repeat("a", 12), time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC)))
+	createFile(t, filepath.Join(inbox, "dovecot.index"), "index") // 対象外
+
+	sentDir := createDir(t, mailboxes, "Sent")
+	sent := createDir(t, sentDir, "dbox-Mails")
+	createFile(t, filepath.Join(sent, "u.1"),
+		dboxFileHeader(true, time.Time{})+dboxMessage(strings.Repeat("a", 21), time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)))
+
+	// 子フォルダ(名前は修正UTF-7)
+	child := createDir(t, createDir(t, sentDir, "&MEI-"), "dbox-Mails")
+	createFile(t, filepath.Join(child, "u.1"),
+		dboxFileHeader(true, time.Time{})+dboxMessage(strings.Repeat("a", 31), time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC)))
+}
+
+// withSize: ファイルヘッダにメールヘッダのサイズを含めるか
+func dboxFileHeader(withSize bool, createTime time.Time) string {
+	if !withSize {
+		return fmt.Sprintf("2 C%x\n", createTime.Unix())
+	}
+	return fmt.Sprintf("2 M%x C%x\n", len(dboxMessageHeader(0)), createTime.Unix())
+}
+
+func dboxMessageHeader(size int) string {
+	return fmt.Sprintf("\x01\x02N %s %016x\n", strings.Repeat(" ", 32), size)
+}
+
+func dboxMetadata(receivedTime time.Time) string {
+	metadata := "\n\x01\x03\n"
+	if !receivedTime.IsZero() {
+		metadata += fmt.Sprintf("R%x\n", receivedTime.Unix())
+	}
+	return metadata + "G0123456789abcdef\nZ10\n\n"
+}
+
+func dboxMessage(content string, receivedTime time.Time) string {
+	return dboxMessageHeader(len(content)) + content + dboxMetadata(receivedTime)
+}
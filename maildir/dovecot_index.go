@@ -0,0 +1,407 @@
+package maildir
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+
+	"golang.org/x/exp/slices"
+)
+
+// Dovecotのインデックス(dovecot.index)とトランザクションログ(dovecot.index.log)
+//
+// mdboxで、メールがどのフォルダに属するか(フォルダ毎のインデックス)と、
+// storageのどのファイルのどの位置にあるか(storageのマップインデックス)を知るために読み込む
+// インデックスファイルはある時点までの状態で、それ以降の変更はトランザクションログにしか無いので、
+// インデックスファイルを読んだ上で、その続きからトランザクションログを適用する
+// (小さいフォルダでは、インデックスファイルが無くトランザクションログのみのこともある)
+//
+// メールのUIDと、拡張(mdbox、map、refなど)のレコードのデータだけを扱う
+type dovecotIndex struct {
+	extNames []string                     // 拡張の番号順の名前
+	records  map[uint32]map[string][]byte // UID毎の、拡張の名前毎のレコード
+}
+
+const (
+	dovecotIndexMajorVersion     = 7
+	dovecotIndexBaseHeaderSize   = 120
+	dovecotIndexCompatLittleEnd  = 0x01
+	dovecotLogMajorVersion       = 1
+	dovecotLogMinHeaderSize      = 40
+	dovecotLogTransactionHdrSize = 8
+)
+
+// トランザクションの種類
+const (
+	dovecotLogExpunge       = 0x00000001
+	dovecotLogAppend        = 0x00000002
+	dovecotLogExtIntro      = 0x00000040
+	dovecotLogExtReset      = 0x00000080
+	dovecotLogExtRecUpdate  = 0x00000200
+	dovecotLogExtAtomicInc  = 0x00001000
+	dovecotLogExpungeGUID   = 0x00002000
+	dovecotLogTypeMask      = 0x0fffffff
+	dovecotLogExpungeProt   = 0x0000cd90 // 壊れたログで削除しないように、削除の種類には必ず付いている
+	dovecotLogExternal      = 0x10000000 // 実際に行われた変更(付いていない削除は要求のみ)
+	dovecotLogNewExtID      = 0xffffffff
+	dovecotLogIndexRecSize  = 8  // 追加されるレコード(UID、フラグ)
+	dovecotLogExpungeGUIDSz = 20 // UID、GUID
+)
+
+func newDovecotIndex() *dovecotIndex {
+	return &dovecotIndex{
+		extNames: []string{},
+		records:  map[uint32]map[string][]byte{},
+	}
+}
+
+// インデックスファイルとトランザクションログを読み込む
+// indexPathはインデックスファイルのパスで、トランザクションログはその .log、.log.2
+// いずれのファイルも無い場合は os.IsNotExist で判別できるエラーとなる
+func readDovecotIndex(indexPath string) (*dovecotIndex, error) {
+
+	index := newDovecotIndex()
+	found := false
+
+	// インデックスファイルに反映済みのトランザクションログの位置
+	logSeq := uint32(0)
+	logOffset := uint32(0)
+
+	data, err := os.ReadFile(indexPath)
+	if err == nil {
+		found = true
+		if logSeq, logOffset, err = index.readIndexFile(data); err != nil {
+			return nil, fmt.Errorf("%s is invalid index file: %w", indexPath, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	// ローテートされた古いもの(.log.2)から順に適用
+	logs := []*dovecotLog{}
+	for _, logPath := range []string{indexPath + ".log.2", indexPath + ".log"} {
+		data, err := os.ReadFile(logPath)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		found = true
+
+		log, err := parseDovecotLog(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s is invalid transaction log: %w", logPath, err)
+		}
+		logs = append(logs, log)
+	}
+
+	if !found {
+		return nil, &fs.PathError{Op: "open", Path: indexPath, Err: fs.ErrNotExist}
+	}
+
+	sort.Slice(logs, func(i, j int) bool {
+		return logs[i].fileSeq < logs[j].fileSeq
+	})
+	for _, log := range logs {
+		if log.fileSeq < logSeq {
+			// インデックスファイルに反映済み
+			continue
+		}
+
+		start := log.headerSize
+		if log.fileSeq == logSeq && int(logOffset) > start {
+			start = int(logOffset)
+		}
+		index.applyLog(log.data, start)
+	}
+
+	return index, nil
+}
+
+// UIDの昇順
+func (x *dovecotIndex) uids() []uint32 {
+
+	uids := []uint32{}
+	for uid := range x.records {
+		uids = append(uids, uid)
+	}
+	sort.Slice(uids, func(i, j int) bool {
+		return uids[i] < uids[j]
+	})
+	return uids
+}
+
+// インデックスファイルを読み込み、反映済みのトランザクションログの位置(ファイルの番号、オフセット)を返す
+//
+//	ヘッダ:     major_version(1) minor_version(1) base_header_size(2) header_size(4) record_size(4) compat_flags(1) ...
+//	            messages_count(4, 32バイト目) ... log_file_seq(4, 60バイト目) log_file_tail_offset(4) log_file_head_offset(4) ...
+//	拡張ヘッダ: base_header_sizeからheader_sizeまで
+//	レコード:   header_sizeから、record_sizeのレコードがmessages_count個(先頭がUID、拡張のデータはそれぞれの位置)
+func (x *dovecotIndex) readIndexFile(data []byte) (uint32, uint32, error) {
+
+	if len(data) < dovecotIndexBaseHeaderSize {
+		return 0, 0, errors.New("header is too short")
+	}
+	if data[0] != dovecotIndexMajorVersion {
+		return 0, 0, fmt.Errorf("unsupported version %d", data[0])
+	}
+	if data[12]&dovecotIndexCompatLittleEnd == 0 {
+		return 0, 0, errors.New("unsupported byte order")
+	}
+
+	le := binary.LittleEndian
+	baseHeaderSize := int(le.Uint16(data[2:]))
+	headerSize := int(le.Uint32(data[4:]))
+	recordSize := int(le.Uint32(data[8:]))
+	messagesCount := int(le.Uint32(data[32:]))
+	logSeq := le.Uint32(data[60:])
+	logOffset := le.Uint32(data[68:])
+
+	if baseHeaderSize < dovecotIndexBaseHeaderSize || headerSize < baseHeaderSize || headerSize > len(data) || recordSize < 4 {
+		return 0, 0, errors.New("invalid header size")
+	}
+	if headerSize+messagesCount*recordSize > len(data) {
+		return 0, 0, errors.New("records are truncated")
+	}
+
+	type ext struct {
+		name         string
+		recordOffset int
+		recordSize   int
+	}
+	exts := []ext{}
+
+	// 拡張ヘッダ
+	//	hdr_size(4) reset_id(4) record_offset(2) record_size(2) record_align(2) name_size(2) 名前 (8バイト境界まで埋める) ヘッダのデータ (8バイト境界まで埋める)
+	offset := baseHeaderSize
+	for offset < headerSize {
+		if offset+16 > headerSize {
+			return 0, 0, errors.New("invalid extension header")
+		}
+		extHeaderSize := int(le.Uint32(data[offset:]))
+		recordOffset := int(le.Uint16(data[offset+8:]))
+		extRecordSize := int(le.Uint16(data[offset+10:]))
+		nameSize := int(le.Uint16(data[offset+14:]))
+
+		nameOffset := offset + 16
+		if nameOffset+nameSize > headerSize {
+			return 0, 0, errors.New("invalid extension header")
+		}
+		name := string(data[nameOffset : nameOffset+nameSize])
+
+		offset = align(nameOffset+nameSize, 8) + extHeaderSize
+		if offset > headerSize || recordOffset+extRecordSize > recordSize {
+			return 0, 0, fmt.Errorf("invalid extension header '%s'", name)
+		}
+		offset = align(offset, 8)
+
+		exts = append(exts, ext{name, recordOffset, extRecordSize})
+		x.extNames = append(x.extNames, name)
+	}
+
+	// レコード
+	for i := 0; i < messagesCount; i++ {
+		record := data[headerSize+i*recordSize : headerSize+(i+1)*recordSize]
+		uid := le.Uint32(record)
+
+		values := map[string][]byte{}
+		for _, ext := range exts {
+			if ext.recordSize == 0 {
+				continue
+			}
+			values[ext.name] = append([]byte{}, record[ext.recordOffset:ext.recordOffset+ext.recordSize]...)
+		}
+		x.records[uid] = values
+	}
+
+	return logSeq, logOffset, nil
+}
+
+type dovecotLog struct {
+	fileSeq    uint32
+	headerSize int
+	data       []byte
+}
+
+// トランザクションログのヘッダ
+//
+//	major_version(1) minor_version(1) hdr_size(2) indexid(4) file_seq(4) ...
+func parseDovecotLog(data []byte) (*dovecotLog, error) {
+
+	if len(data) < dovecotLogMinHeaderSize {
+		return nil, errors.New("header is too short")
+	}
+	if data[0] != dovecotLogMajorVersion {
+		return nil, fmt.Errorf("unsupported version %d", data[0])
+	}
+
+	headerSize := int(binary.LittleEndian.Uint16(data[2:]))
+	if headerSize < dovecotLogMinHeaderSize || headerSize > len(data) {
+		return nil, errors.New("invalid header size")
+	}
+
+	return &dovecotLog{
+		fileSeq:    binary.LittleEndian.Uint32(data[8:]),
+		headerSize: headerSize,
+		data:       data,
+	}, nil
+}
+
+// startの位置からトランザクションを順に適用する
+//
+//	トランザクション: size(4、dovecotLogSizeで変換) type(4) データ
+//
+// 書き込み途中などで解釈できないものがあれば、そこまでとする
+func (x *dovecotIndex) applyLog(data []byte, start int) {
+
+	le := binary.LittleEndian
+
+	// 拡張のレコードの更新などは、直前の拡張の宣言(EXT_INTRO)のものが対象
+	currentExt := ""
+	currentExtRecordSize := 0
+
+	offset := start
+	for offset+dovecotLogTransactionHdrSize <= len(data) {
+		size := int(dovecotLogSize(data[offset:]))
+		if size < dovecotLogTransactionHdrSize || offset+size > len(data) {
+			return
+		}
+
+		transactionType := le.Uint32(data[offset+4:])
+		body := data[offset+dovecotLogTransactionHdrSize : offset+size]
+		offset += size
+
+		typ := transactionType & dovecotLogTypeMask
+		if typ&dovecotLogExpungeProt == dovecotLogExpungeProt {
+			if transactionType&dovecotLogExternal == 0 {
+				// 削除の要求のみで、まだ削除されていない
+				continue
+			}
+
+			switch typ &^ dovecotLogExpungeProt {
+			case dovecotLogExpunge:
+				// uid1(4) uid2(4) の範囲
+				for i := 0; i+8 <= len(body); i += 8 {
+					for uid := range x.records {
+						if uid >= le.Uint32(body[i:]) && uid <= le.Uint32(body[i+4:]) {
+							delete(x.records, uid)
+						}
+					}
+				}
+			case dovecotLogExpungeGUID:
+				// uid(4) guid(16)
+				for i := 0; i+dovecotLogExpungeGUIDSz <= len(body); i += dovecotLogExpungeGUIDSz {
+					delete(x.records, le.Uint32(body[i:]))
+				}
+			}
+			continue
+		}
+
+		switch typ {
+		case dovecotLogAppend:
+			// uid(4) flags(1) padding(3)
+			for i := 0; i+dovecotLogIndexRecSize <= len(body); i += dovecotLogIndexRecSize {
+				uid := le.Uint32(body[i:])
+				if _, ok := x.records[uid]; !ok {
+					x.records[uid] = map[string][]byte{}
+				}
+			}
+
+		case dovecotLogExtIntro:
+			// ext_id(4) reset_id(4) hdr_size(4) record_size(2) record_align(2) flags(2) name_size(2) 名前 (4バイト境界まで埋める)
+			for i := 0; i+20 <= len(body); {
+				extID := le.Uint32(body[i:])
+				recordSize := int(le.Uint16(body[i+12:]))
+				nameSize := int(le.Uint16(body[i+18:]))
+				if i+20+nameSize > len(body) {
+					return
+				}
+				name := string(body[i+20 : i+20+nameSize])
+
+				if name == "" {
+					// 既に登録済みの拡張は番号で指定される
+					if extID == dovecotLogNewExtID || int(extID) >= len(x.extNames) {
+						return
+					}
+					name = x.extNames[extID]
+				} else if !slices.Contains(x.extNames, name) {
+					x.extNames = append(x.extNames, name)
+				}
+
+				currentExt = name
+				currentExtRecordSize = recordSize
+				i = align(i+20+nameSize, 4)
+			}
+
+		case dovecotLogExtReset:
+			// new_reset_id(4) preserve_data(1) padding(3)
+			if len(body) >= 5 && body[4] == 0 {
+				for _, values := range x.records {
+					delete(values, currentExt)
+				}
+			}
+
+		case dovecotLogExtRecUpdate:
+			// uid(4) データ(拡張のレコードサイズ) (4バイト境界まで埋める)
+			entrySize := align(4+currentExtRecordSize, 4)
+			for i := 0; i+entrySize <= len(body); i += entrySize {
+				if values, ok := x.records[le.Uint32(body[i:])]; ok {
+					values[currentExt] = append([]byte{}, body[i+4:i+4+currentExtRecordSize]...)
+				}
+			}
+
+		case dovecotLogExtAtomicInc:
+			// uid(4) diff(4、符号付き)
+			for i := 0; i+8 <= len(body); i += 8 {
+				values, ok := x.records[le.Uint32(body[i:])]
+				if !ok {
+					continue
+				}
+				value := make([]byte, currentExtRecordSize)
+				copy(value, values[currentExt])
+				putUintLE(value, uintLE(value)+uint64(int64(int32(le.Uint32(body[i+4:])))))
+				values[currentExt] = value
+			}
+		}
+	}
+}
+
+// トランザクションのサイズは、書き込み途中のものを判別できるように、
+// 各バイトの最上位ビットを立てた7ビットずつ(先頭のバイトが上位)で、4で割った値が格納されている
+func dovecotLogSize(data []byte) uint32 {
+
+	if data[0]&0x80 == 0 || data[1]&0x80 == 0 || data[2]&0x80 == 0 || data[3]&0x80 == 0 {
+		return 0
+	}
+
+	return uint32(data[3]&0x7f)<<2 |
+		uint32(data[2]&0x7f)<<9 |
+		uint32(data[1]&0x7f)<<16 |
+		uint32(data[0]&0x7f)<<23
+}
+
+// 拡張のレコードの値(リトルエンディアンの符号なし整数)
+func uintLE(data []byte) uint64 {
+
+	value := uint64(0)
+	for i := len(data) - 1; i >= 0; i-- {
+		value = value<<8 | uint64(data[i])
+	}
+	return value
+}
+
+func putUintLE(data []byte, value uint64) {
+
+	for i := range data {
+		data[i] = byte(value)
+		value >>= 8
+	}
+}
+
+func align(size int, alignment int) int {
+	return (size + alignment - 1) / alignment * alignment
+}
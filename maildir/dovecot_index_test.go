@@ -0,0 +1,245 @@
+package maildir
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadDovecotIndex_IndexFile(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	indexPath := filepath.Join(temp, "dovecot.index")
+	createFile(t, indexPath, string(dovecotIndexFile(
+		[]testIndexExt{{"mdbox", 4, 8}},
+		12,
+		[][]byte{
+			indexRecord(12, 1, 4, leUint32s(10, 0)),
+			indexRecord(12, 2, 4, leUint32s(20, 0)),
+		},
+		1, 0)))
+
+	// ACT
+	index, err := readDovecotIndex(indexPath)
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(t, []uint32{1, 2}, index.uids())
+	assert.Equal(t, leUint32s(10, 0), index.records[1]["mdbox"])
+	assert.Equal(t, leUint32s(20, 0), index.records[2]["mdbox"])
+}
+
+func TestReadDovecotIndex_Log(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	indexPath := filepath.Join(temp, "dovecot.index")
+
+	// インデックスファイルに反映済み(この後ろからが対象)
+	applied := dovecotLogTransaction(dovecotLogExpungeProt|dovecotLogExpunge|dovecotLogExternal, leUint32s(2, 2))
+	createFile(t, indexPath, string(dovecotIndexFile(
+		[]testIndexExt{{"mdbox", 4, 8}},
+		12,
+		[][]byte{
+			indexRecord(12, 1, 4, leUint32s(10, 0)),
+			indexRecord(12, 2, 4, leUint32s(20, 0)),
+		},
+		2, uint32(dovecotLogMinHeaderSize+len(applied)))))
+
+	// 古いログは反映済み
+	createFile(t, indexPath+".log.2", string(dovecotLogFile(1,
+		dovecotLogTransaction(dovecotLogExpungeProt|dovecotLogExpunge|dovecotLogExternal, leUint32s(1, 2)))))
+
+	createFile(t, indexPath+".log", string(dovecotLogFile(2,
+		applied,
+		dovecotLogTransaction(dovecotLogAppend, append(leUint32s(3, 0), leUint32s(4, 0)...)),
+		dovecotLogTransaction(dovecotLogExtIntro, dovecotLogExtIntroData(0, "", 8)), // 登録済みの拡張は番号で指定
+		dovecotLogTransaction(dovecotLogExtRecUpdate, leUint32s(3, 30, 0, 4, 40, 0)),
+		dovecotLogTransaction(dovecotLogExpungeProt|dovecotLogExpunge|dovecotLogExternal, leUint32s(1, 1)),
+		// 要求のみのものは対象外
+		dovecotLogTransaction(dovecotLogExpungeProt|dovecotLogExpunge, leUint32s(4, 4)),
+		// 書き込み途中のものは対象外
+		[]byte{0x00, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00})))
+
+	// ACT
+	index, err := readDovecotIndex(indexPath)
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(t, []uint32{2, 3, 4}, index.uids())
+	assert.Equal(t, leUint32s(20, 0), index.records[2]["mdbox"])
+	assert.Equal(t, leUint32s(30, 0), index.records[3]["mdbox"])
+	assert.Equal(t, leUint32s(40, 0), index.records[4]["mdbox"])
+}
+
+func TestReadDovecotIndex_LogOnly(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	indexPath := filepath.Join(temp, "dovecot.map.index")
+
+	createFile(t, indexPath+".log", string(dovecotLogFile(1,
+		dovecotLogTransaction(dovecotLogAppend, append(leUint32s(1, 0), leUint32s(2, 0)...)),
+		dovecotLogTransaction(dovecotLogExtIntro, append(dovecotLogExtIntroData(dovecotLogNewExtID, "map", 12), dovecotLogExtIntroData(dovecotLogNewExtID, "ref", 2)...)),
+		dovecotLogTransaction(dovecotLogExtAtomicInc, leUint32s(1, 2, 2, 1)),
+		dovecotLogTransaction(dovecotLogExtAtomicInc, leUint32s(1, 0xffffffff)), // -1
+		dovecotLogTransaction(dovecotLogExtIntro, dovecotLogExtIntroData(dovecotLogNewExtID, "map", 12)),
+		dovecotLogTransaction(dovecotLogExtRecUpdate, leUint32s(1, 1, 100, 10, 2, 2, 200, 20)))))
+
+	// ACT
+	index, err := readDovecotIndex(indexPath)
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(t, []string{"map", "ref"}, index.extNames)
+	assert.Equal(t, []uint32{1, 2}, index.uids())
+	assert.Equal(t, leUint32s(1, 100, 10), index.records[1]["map"])
+	assert.Equal(t, []byte{1, 0}, index.records[1]["ref"])
+	assert.Equal(t, leUint32s(2, 200, 20), index.records[2]["map"])
+	assert.Equal(t, []byte{1, 0}, index.records[2]["ref"])
+}
+
+func TestReadDovecotIndex_NotFound(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	// ACT
+	_, err := readDovecotIndex(filepath.Join(temp, "dovecot.index"))
+
+	// ASSERT
+	require.Error(t, err)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestReadDovecotIndex_Invalid(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		file    string
+		content []byte
+		message string
+	}{
+		{"short index", "dovecot.index", []byte("index"), "is invalid index file: header is too short"},
+		{"index version", "dovecot.index", append([]byte{6}, make([]byte, dovecotIndexBaseHeaderSize)...), "is invalid index file: unsupported version 6"},
+		{"truncated records", "dovecot.index", dovecotIndexFile([]testIndexExt{}, 8, [][]byte{make([]byte, 8)}, 1, 0)[:dovecotIndexBaseHeaderSize+4], "is invalid index file: records are truncated"},
+		{"short log", "dovecot.index.log", []byte("log"), "is invalid transaction log: header is too short"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			// ARRANGE
+			temp := t.TempDir()
+			createFile(t, filepath.Join(temp, tt.file), string(tt.content))
+
+			// ACT
+			_, err := readDovecotIndex(filepath.Join(temp, "dovecot.index"))
+
+			// ASSERT
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.message)
+		})
+	}
+}
+
+type testIndexExt struct {
+	name         string
+	recordOffset int
+	recordSize   int
+}
+
+// インデックスファイル(拡張ヘッダのデータは無し)
+func dovecotIndexFile(exts []testIndexExt, recordSize int, records [][]byte, logSeq uint32, logOffset uint32) []byte {
+
+	le := binary.LittleEndian
+
+	extHeaders := []byte{}
+	for _, ext := range exts {
+		extHeader := make([]byte, 16)
+		le.PutUint16(extHeader[8:], uint16(ext.recordOffset))
+		le.PutUint16(extHeader[10:], uint16(ext.recordSize))
+		le.PutUint16(extHeader[14:], uint16(len(ext.name)))
+		extHeader = append(extHeader, ext.name...)
+		extHeaders = append(extHeaders, extHeader...)
+		extHeaders = append(extHeaders, make([]byte, align(len(extHeader), 8)-len(extHeader))...)
+	}
+
+	header := make([]byte, dovecotIndexBaseHeaderSize)
+	header[0] = dovecotIndexMajorVersion
+	le.PutUint16(header[2:], dovecotIndexBaseHeaderSize)
+	le.PutUint32(header[4:], uint32(dovecotIndexBaseHeaderSize+len(extHeaders)))
+	le.PutUint32(header[8:], uint32(recordSize))
+	header[12] = dovecotIndexCompatLittleEnd
+	le.PutUint32(header[32:], uint32(len(records)))
+	le.PutUint32(header[60:], logSeq)
+	le.PutUint32(header[68:], logOffset)
+
+	data := append(header, extHeaders...)
+	for _, record := range records {
+		data = append(data, record...)
+	}
+	return data
+}
+
+// UIDと、拡張のデータをその位置に置いたレコード
+func indexRecord(recordSize int, uid uint32, extOffset int, extData []byte) []byte {
+
+	record := make([]byte, recordSize)
+	binary.LittleEndian.PutUint32(record, uid)
+	copy(record[extOffset:], extData)
+	return record
+}
+
+func dovecotLogFile(fileSeq uint32, transactions ...[]byte) []byte {
+
+	header := make([]byte, dovecotLogMinHeaderSize)
+	header[0] = dovecotLogMajorVersion
+	binary.LittleEndian.PutUint16(header[2:], dovecotLogMinHeaderSize)
+	binary.LittleEndian.PutUint32(header[8:], fileSeq)
+
+	data := header
+	for _, transaction := range transactions {
+		data = append(data, transaction...)
+	}
+	return data
+}
+
+func dovecotLogTransaction(transactionType uint32, body []byte) []byte {
+
+	value := uint32(dovecotLogTransactionHdrSize+len(body)) >> 2
+
+	transaction := []byte{
+		0x80 | byte(value>>21&0x7f),
+		0x80 | byte(value>>14&0x7f),
+		0x80 | byte(value>>7&0x7f),
+		0x80 | byte(value&0x7f),
+		0, 0, 0, 0,
+	}
+	binary.LittleEndian.PutUint32(transaction[4:], transactionType)
+	return append(transaction, body...)
+}
+
+func dovecotLogExtIntroData(extID uint32, name string, recordSize int) []byte {
+
+	data := make([]byte, 20)
+	binary.LittleEndian.PutUint32(data, extID)
+	binary.LittleEndian.PutUint16(data[12:], uint16(recordSize))
+	binary.LittleEndian.PutUint16(data[18:], uint16(len(name)))
+	data = append(data, name...)
+	return append(data, make([]byte, align(len(data), 4)-len(data))...)
+}
+
+func leUint32s(values ...uint32) []byte {
+
+	data := make([]byte, len(values)*4)
+	for i, value := range values {
+		binary.LittleEndian.PutUint32(data[i*4:], value)
+	}
+	return data
+}
@@ -0,0 +1,182 @@
+package maildir
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+type DuplicateKeyType int
+
+const (
+	MessageIDKey DuplicateKeyType = iota
+	ContentHashKey
+)
+
+type DuplicateMail struct {
+	MailFolderName string
+	Path           string
+	Size           int64
+}
+
+// 同じメールとみなされたものの集まり
+// 先頭のメールを残すものとし、それ以降を重複として扱う
+type DuplicateGroup struct {
+	Key   string
+	Mails []*DuplicateMail
+}
+
+// 残すメールのフォルダと、重複しているメールのフォルダの組み合わせ毎の集計結果
+type DuplicateFolderPairResult struct {
+	MailFolderName          string
+	DuplicateMailFolderName string
+	Count                   int64
+	TotalSize               int64
+}
+
+type DuplicateAggregator struct {
+	keyType        DuplicateKeyType
+	groups         []*DuplicateGroup
+	groupByKey     map[string]*DuplicateGroup
+	mailFolderName string
+	err            error
+}
+
+func NewDuplicateAggregator(keyType DuplicateKeyType) *DuplicateAggregator {
+	return &DuplicateAggregator{
+		keyType:    keyType,
+		groups:     []*DuplicateGroup{},
+		groupByKey: map[string]*DuplicateGroup{},
+	}
+}
+
+func (a *DuplicateAggregator) StartUser(userName string) {
+	// 何もしない
+}
+
+func (a *DuplicateAggregator) StartMailFolder(mailFolderName string) {
+	a.mailFolderName = mailFolderName
+}
+
+func (a *DuplicateAggregator) Aggregate(mail mailInfo) {
+
+	if a.err != nil {
+		return
+	}
+
+	key, err := a.keyOf(mail)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// 集計中に移動、削除されたものは対象外
+			return
+		}
+		a.err = err
+		return
+	}
+	if key == "" {
+		// Message-IDが無いものは判定できないので対象外
+		return
+	}
+
+	group, ok := a.groupByKey[key]
+	if !ok {
+		group = &DuplicateGroup{
+			Key:   key,
+			Mails: []*DuplicateMail{},
+		}
+		a.groupByKey[key] = group
+		a.groups = append(a.groups, group)
+	}
+
+	group.Mails = append(group.Mails, &DuplicateMail{
+		MailFolderName: a.mailFolderName,
+		Path:           mail.path,
+		Size:           mail.size,
+	})
+}
+
+// メールが読み込めなかった場合のエラー
+func (a *DuplicateAggregator) Err() error {
+	return a.err
+}
+
+// 重複があったもの(2通以上のもの)を、最初に見つかった順で返す
+func (a *DuplicateAggregator) Results() []*DuplicateGroup {
+
+	results := []*DuplicateGroup{}
+	for _, group := range a.groups {
+		if len(group.Mails) > 1 {
+			results = append(results, group)
+		}
+	}
+
+	return results
+}
+
+func (a *DuplicateAggregator) FolderPairResults() []*DuplicateFolderPairResult {
+
+	resultByPair := map[[2]string]*DuplicateFolderPairResult{}
+	results := []*DuplicateFolderPairResult{}
+
+	for _, group := range a.Results() {
+		original := group.Mails[0]
+		for _, duplicate := range group.Mails[1:] {
+			pair := [2]string{original.MailFolderName, duplicate.MailFolderName}
+
+			result, ok := resultByPair[pair]
+			if !ok {
+				result = &DuplicateFolderPairResult{
+					MailFolderName:          original.MailFolderName,
+					DuplicateMailFolderName: duplicate.MailFolderName,
+				}
+				resultByPair[pair] = result
+				results = append(results, result)
+			}
+
+			result.Count++
+			result.TotalSize += duplicate.Size
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].MailFolderName == results[j].MailFolderName {
+			return results[i].DuplicateMailFolderName < results[j].DuplicateMailFolderName
+		}
+		return results[i].MailFolderName < results[j].MailFolderName
+	})
+
+	return results
+}
+
+// Message-IDで判定する場合は、ヘッダを読み込んでもらう
+func (a *DuplicateAggregator) NeedsHeader() bool {
+	return a.keyType == MessageIDKey
+}
+
+func (a *DuplicateAggregator) keyOf(mail mailInfo) (string, error) {
+
+	switch a.keyType {
+	case ContentHashKey:
+		content, err := mail.openContent()
+		if err != nil {
+			return "", err
+		}
+		defer content.Close()
+
+		hash := sha256.New()
+		if _, err := io.Copy(hash, content); err != nil {
+			return "", err
+		}
+		return "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+
+	default:
+		messageID := strings.TrimSpace(mail.header.Get("Message-Id"))
+		if messageID == "" {
+			return "", nil
+		}
+		return "message-id:" + messageID, nil
+	}
+}
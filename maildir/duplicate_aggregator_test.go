@@ -0,0 +1,154 @@
+package maildir
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregateMailFolders_DuplicateAggregator_MessageID(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	// INBOX
+	createMailFolder(t, temp, []mail{})
+	createFile(t, filepath.Join(temp, "cur", "1"), "Message-ID: <a@example.com>\r\nSubject: a\r\n\r\nbody")
+	createFile(t, filepath.Join(temp, "cur", "2"), "Message-ID: <b@example.com>\r\n\r\nbody")
+	createFile(t, filepath.Join(temp, "cur", "3"), "Subject: no id\r\n\r\nbody")
+	createFile(t, filepath.Join(temp, "cur", "4"), "")
+
+	// その他フォルダ
+	sentDir := createDir(t, temp, ".Sent")
+	createMailFolder(t, sentDir, []mail{})
+	createFile(t, filepath.Join(sentDir, "new", "1"), "Message-Id: <a@example.com>\r\nSubject: a\r\n\r\nbody2")
+	createFile(t, filepath.Join(sentDir, "cur", "2"), "Subject: no id\r\n\r\nbody")
+
+	archiveDir := createDir(t, temp, ".Archive")
+	createMailFolder(t, archiveDir, []mail{})
+	createFile(t, filepath.Join(archiveDir, "cur", "1"), "Message-ID: <a@example.com>\r\n\r\n")
+	createFile(t, filepath.Join(archiveDir, "cur", "2"), "Message-ID: <b@example.com>\r\n\r\nbody")
+	createFile(t, filepath.Join(archiveDir, "cur", "3"), "Message-ID: <b@example.com>\r\n\r\nbody")
+
+	// ACT
+	aggregator := NewDuplicateAggregator(MessageIDKey)
+	err := AggregateMailFolders(temp, "INBOX", aggregator)
+
+	// ASSERT
+	require.NoError(t, err)
+	require.NoError(t, aggregator.Err())
+
+	assert.Equal(
+		t,
+		[]*DuplicateGroup{
+			{
+				Key: "message-id:<a@example.com>",
+				Mails: []*DuplicateMail{
+					{MailFolderName: "INBOX", Path: filepath.Join(temp, "cur", "1"), Size: 47},
+					{MailFolderName: "Archive", Path: filepath.Join(archiveDir, "cur", "1"), Size: 31},
+					{MailFolderName: "Sent", Path: filepath.Join(sentDir, "new", "1"), Size: 48},
+				},
+			},
+			{
+				Key: "message-id:<b@example.com>",
+				Mails: []*DuplicateMail{
+					{MailFolderName: "INBOX", Path: filepath.Join(temp, "cur", "2"), Size: 35},
+					{MailFolderName: "Archive", Path: filepath.Join(archiveDir, "cur", "2"), Size: 35},
+					{MailFolderName: "Archive", Path: filepath.Join(archiveDir, "cur", "3"), Size: 35},
+				},
+			},
+		},
+		aggregator.Results(),
+	)
+
+	assert.Equal(
+		t,
+		[]*DuplicateFolderPairResult{
+			{MailFolderName: "INBOX", DuplicateMailFolderName: "Archive", Count: 3, TotalSize: 101},
+			{MailFolderName: "INBOX", DuplicateMailFolderName: "Sent", Count: 1, TotalSize: 48},
+		},
+		aggregator.FolderPairResults(),
+	)
+}
+
+func TestAggregateMailFolders_DuplicateAggregator_ContentHash(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	// INBOX
+	createMailFolder(t, temp, []mail{})
+	createFile(t, filepath.Join(temp, "cur", "1"), "Message-ID: <a@example.com>\r\n\r\nbody")
+	createFile(t, filepath.Join(temp, "cur", "2"), "Message-ID: <a@example.com>\r\n\r\nbody2") // Message-IDは同じでも内容が異なる
+
+	// その他フォルダ
+	sentDir := createDir(t, temp, ".Sent")
+	createMailFolder(t, sentDir, []mail{})
+	createFile(t, filepath.Join(sentDir, "cur", "1"), "Message-ID: <a@example.com>\r\n\r\nbody")
+	createFile(t, filepath.Join(sentDir, "cur", "2"), "x") // Message-ID無しでも対象
+
+	trashDir := createDir(t, temp, ".Trash")
+	createMailFolder(t, trashDir, []mail{})
+	createFile(t, filepath.Join(trashDir, "cur", "1"), "x")
+
+	// ACT
+	aggregator := NewDuplicateAggregator(ContentHashKey)
+	err := AggregateMailFolders(temp, "", aggregator)
+
+	// ASSERT
+	require.NoError(t, err)
+	require.NoError(t, aggregator.Err())
+
+	assert.Equal(
+		t,
+		[]*DuplicateGroup{
+			{
+				Key: "sha256:1da75e8f3be4ff01c02c573848e1b47b6dc02f05462d734592901d6f83aa745d",
+				Mails: []*DuplicateMail{
+					{MailFolderName: "", Path: filepath.Join(temp, "cur", "1"), Size: 35},
+					{MailFolderName: "Sent", Path: filepath.Join(sentDir, "cur", "1"), Size: 35},
+				},
+			},
+			{
+				Key: "sha256:2d711642b726b04401627ca9fbac32f5c8530fb1903cc4db02258717921a4881",
+				Mails: []*DuplicateMail{
+					{MailFolderName: "Sent", Path: filepath.Join(sentDir, "cur", "2"), Size: 1},
+					{MailFolderName: "Trash", Path: filepath.Join(trashDir, "cur", "1"), Size: 1},
+				},
+			},
+		},
+		aggregator.Results(),
+	)
+
+	assert.Equal(
+		t,
+		[]*DuplicateFolderPairResult{
+			{MailFolderName: "", DuplicateMailFolderName: "Sent", Count: 1, TotalSize: 35},
+			{MailFolderName: "Sent", DuplicateMailFolderName: "Trash", Count: 1, TotalSize: 1},
+		},
+		aggregator.FolderPairResults(),
+	)
+}
+
+func TestAggregateMailFolders_DuplicateAggregator_NoDuplicate(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	createMailFolder(t, temp, []mail{})
+	createFile(t, filepath.Join(temp, "cur", "1"), "Message-ID: <a@example.com>\r\n\r\nbody")
+	createFile(t, filepath.Join(temp, "cur", "2"), "Message-ID: <b@example.com>\r\n\r\nbody")
+
+	// ACT
+	aggregator := NewDuplicateAggregator(MessageIDKey)
+	err := AggregateMailFolders(temp, "", aggregator)
+
+	// ASSERT
+	require.NoError(t, err)
+	require.NoError(t, aggregator.Err())
+
+	assert.Equal(t, []*DuplicateGroup{}, aggregator.Results())
+	assert.Equal(t, []*DuplicateFolderPairResult{}, aggregator.FolderPairResults())
+}
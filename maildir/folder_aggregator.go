@@ -1,13 +1,15 @@
 package maildir
 
 type FolderAggregator struct {
-	results []*AggregateResult
-	current *AggregateResult
+	results      []*AggregateResult
+	resultByName map[string]*AggregateResult
+	current      *AggregateResult
 }
 
 func NewFolderAggregator() *FolderAggregator {
 	return &FolderAggregator{
-		results: []*AggregateResult{},
+		results:      []*AggregateResult{},
+		resultByName: map[string]*AggregateResult{},
 	}
 }
 
@@ -17,12 +19,19 @@ func (a *FolderAggregator) StartUser(userName string) {
 
 func (a *FolderAggregator) StartMailFolder(mailFolderName string) {
 
+	// Maildirとmboxが混在している場合など、同じ名前のフォルダは合算する
+	if result, ok := a.resultByName[mailFolderName]; ok {
+		a.current = result
+		return
+	}
+
 	a.current = &AggregateResult{
 		Name:      mailFolderName,
 		Count:     0,
 		TotalSize: 0,
 	}
 	a.results = append(a.results, a.current)
+	a.resultByName[mailFolderName] = a.current
 }
 
 func (a *FolderAggregator) Aggregate(mail mailInfo) {
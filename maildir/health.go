@@ -0,0 +1,123 @@
+package maildir
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+type HealthIssueKind int
+
+const (
+	StaleTmpFile  HealthIssueKind = iota // tmpに残ったままのファイル(配送の失敗など)
+	MalformedName                        // new、curにある、Maildirの名前の形式になっていないファイル
+	NonFileEntry                         // new、curにある、ファイル以外のもの(ディレクトリ、シンボリックリンクなど)
+)
+
+func (k HealthIssueKind) String() string {
+	switch k {
+	case StaleTmpFile:
+		return "stale tmp file"
+	case MalformedName:
+		return "malformed name"
+	default:
+		return "non-file entry"
+	}
+}
+
+type HealthIssue struct {
+	Kind           HealthIssueKind
+	UserName       string
+	MailFolderName string
+	Path           string
+	Size           int64
+	ModTime        time.Time
+	Mode           os.FileMode
+}
+
+// Maildirのファイル名の形式
+// 例: 1674617693.M958571P8888.localhost,S=545,W=562:2,S
+var maildirFileNamePattern = regexp.MustCompile(`^[0-9]+\.[^.:]+\.[^:]+(:[12],.*)?$`)
+
+// Maildir++の各フォルダで、tmpに残っている古いファイルや、new、curにある想定外のものを探す
+// tmpのファイルは、更新日時がstaleBeforeより前のものを対象とする
+func CheckMaildirHealth(userName string, rootMailFolderPath string, inboxFolderName string, staleBefore time.Time) ([]*HealthIssue, error) {
+
+	store := NewMaildirStore(rootMailFolderPath, inboxFolderName)
+
+	issues := []*HealthIssue{}
+	for _, folder := range store.MailFolders() {
+		if folder.Err != nil {
+			return nil, folder.Err
+		}
+
+		folderPath := filepath.Join(rootMailFolderPath, folder.Path)
+		newIssue := func(kind HealthIssueKind, path string, info os.FileInfo) *HealthIssue {
+			return &HealthIssue{
+				Kind:           kind,
+				UserName:       userName,
+				MailFolderName: folder.Name,
+				Path:           path,
+				Size:           info.Size(),
+				ModTime:        info.ModTime(),
+				Mode:           info.Mode(),
+			}
+		}
+
+		// tmp
+		err := walkHealthEntries(filepath.Join(folderPath, "tmp"), func(path string, info os.FileInfo) {
+			if info.Mode().IsRegular() && info.ModTime().Before(staleBefore) {
+				issues = append(issues, newIssue(StaleTmpFile, path, info))
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		// new、cur
+		for _, subName := range []string{"new", "cur"} {
+			err := walkHealthEntries(filepath.Join(folderPath, subName), func(path string, info os.FileInfo) {
+				switch {
+				case !info.Mode().IsRegular():
+					issues = append(issues, newIssue(NonFileEntry, path, info))
+				case !maildirFileNamePattern.MatchString(info.Name()):
+					issues = append(issues, newIssue(MalformedName, path, info))
+				}
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return issues, nil
+}
+
+// ディレクトリ直下のエントリを順に渡す(ディレクトリが無い場合は何もしない)
+// シンボリックリンクはリンク先ではなく、リンク自体の情報を渡す
+func walkHealthEntries(dirPath string, fn func(path string, info os.FileInfo)) error {
+
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				// 確認中に移動、削除されたものは対象外
+				continue
+			}
+			return err
+		}
+
+		fn(filepath.Join(dirPath, entry.Name()), info)
+	}
+
+	return nil
+}
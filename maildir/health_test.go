@@ -0,0 +1,126 @@
+package maildir
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckMaildirHealth(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	now := time.Date(2023, 3, 10, 0, 0, 0, 0, time.UTC)
+	old := now.Add(-48 * time.Hour)
+
+	createMailFolder(t, temp, []mail{})
+	createFile(t, filepath.Join(temp, "tmp", "1678060800.M1.host"), "12345") // 古いもの
+	require.NoError(t, os.Chtimes(filepath.Join(temp, "tmp", "1678060800.M1.host"), old, old))
+	createFile(t, filepath.Join(temp, "tmp", "1678406400.M2.host"), "1") // 新しいもの(配送中)
+	require.NoError(t, os.Chtimes(filepath.Join(temp, "tmp", "1678406400.M2.host"), now, now))
+	createFile(t, filepath.Join(temp, "cur", "1678060800.M3.host,S=3:2,S"), "123")
+	createFile(t, filepath.Join(temp, "new", "1678060800.M4.host"), "1234")
+	createFile(t, filepath.Join(temp, "cur", "mail.txt"), "123")   // 名前の形式が異なる
+	createDir(t, filepath.Join(temp, "new"), "1678060800.M5.host") // ディレクトリ
+
+	{
+		sub := createDir(t, temp, ".Sent")
+		createMailFolder(t, sub, []mail{})
+		createFile(t, filepath.Join(sub, "tmp", "1678060800.M6.host"), "123")
+		require.NoError(t, os.Chtimes(filepath.Join(sub, "tmp", "1678060800.M6.host"), old, old))
+		createFile(t, filepath.Join(sub, "cur", "1678060800:2,S"), "1") // 名前の形式が異なる
+	}
+	{
+		// tmpなどが無いフォルダ
+		createDir(t, temp, ".Empty")
+	}
+
+	// ACT
+	issues, err := CheckMaildirHealth("user1", temp, "INBOX", now.Add(-36*time.Hour))
+
+	// ASSERT
+	require.NoError(t, err)
+	require.Len(t, issues, 5)
+
+	assert.Equal(t, StaleTmpFile, issues[0].Kind)
+	assert.Equal(t, "user1", issues[0].UserName)
+	assert.Equal(t, "INBOX", issues[0].MailFolderName)
+	assert.Equal(t, filepath.Join(temp, "tmp", "1678060800.M1.host"), issues[0].Path)
+	assert.Equal(t, int64(5), issues[0].Size)
+	assert.Equal(t, old, issues[0].ModTime.UTC())
+
+	assert.Equal(t, NonFileEntry, issues[1].Kind)
+	assert.Equal(t, filepath.Join(temp, "new", "1678060800.M5.host"), issues[1].Path)
+	assert.True(t, issues[1].Mode.IsDir())
+
+	assert.Equal(t, MalformedName, issues[2].Kind)
+	assert.Equal(t, filepath.Join(temp, "cur", "mail.txt"), issues[2].Path)
+
+	assert.Equal(t, StaleTmpFile, issues[3].Kind)
+	assert.Equal(t, "Sent", issues[3].MailFolderName)
+	assert.Equal(t, int64(3), issues[3].Size)
+
+	assert.Equal(t, MalformedName, issues[4].Kind)
+	assert.Equal(t, filepath.Join(temp, ".Sent", "cur", "1678060800:2,S"), issues[4].Path)
+}
+
+func TestCheckMaildirHealth_Symlink(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	createMailFolder(t, temp, []mail{})
+	createFile(t, filepath.Join(temp, "target"), "1")
+	if err := os.Symlink(filepath.Join(temp, "target"), filepath.Join(temp, "cur", "1678060800.M1.host")); err != nil {
+		t.Skip("symlink is not supported:", err)
+	}
+
+	// ACT
+	issues, err := CheckMaildirHealth("", temp, "", time.Now())
+
+	// ASSERT
+	require.NoError(t, err)
+	require.Len(t, issues, 1)
+	assert.Equal(t, NonFileEntry, issues[0].Kind)
+	assert.True(t, issues[0].Mode&os.ModeSymlink != 0)
+}
+
+func TestCheckMaildirHealth_MaildirNotFound(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	maildir := filepath.Join(temp, "xxx") // 存在しないディレクトリ
+
+	// ACT
+	_, err := CheckMaildirHealth("", maildir, "", time.Now())
+
+	// ASSERT
+	require.Error(t, err)
+	// OSによってエラーメッセージが異なるのでファイル名部分だけチェック
+	assert.Contains(t, err.Error(), "open "+maildir)
+}
+
+func TestMaildirFileNamePattern(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		expected bool
+	}{
+		{"1674617693.M958571P8888.localhost.localdomain,S=545,W=562:2,S", true},
+		{"1674617693.M958571P8888.localhost", true},
+		{"1674617693.M958571P8888.localhost:2,", true},
+		{"1674617693.12345_1.localhost:1,experimental", true},
+		{"1674617693", false},
+		{"1674617693.localhost", false},
+		{"mail.1.localhost", false},
+		{"1674617693.M1.localhost:3,S", false},
+		{".1674617693.M1.localhost", false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, maildirFileNamePattern.MatchString(tt.name), tt.name)
+	}
+}
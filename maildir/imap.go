@@ -0,0 +1,279 @@
+package maildir
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+// STATUSでフォルダ内のメールの合計サイズを取得する項目 (RFC 8438)
+// サーバがSTATUS=SIZEに対応している場合のみ指定できる
+const imapStatusSize imap.StatusItem = "SIZE"
+
+// IMAPサーバ上のメールボックス
+// ログイン済みのクライアントを受け取り、LIST、STATUS、FETCHでフォルダとメールの情報を取得する
+type ImapStore struct {
+	client          *client.Client
+	serverName      string
+	inboxFolderName string
+}
+
+func NewImapStore(c *client.Client, serverName string, inboxFolderName string) *ImapStore {
+	return &ImapStore{
+		client:          c,
+		serverName:      serverName,
+		inboxFolderName: inboxFolderName,
+	}
+}
+
+func (s *ImapStore) MailFolders() []MailFolder {
+
+	mailboxes := make(chan *imap.MailboxInfo, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- s.client.List("", "*", mailboxes)
+	}()
+
+	infos := []*imap.MailboxInfo{}
+	for info := range mailboxes {
+		infos = append(infos, info)
+	}
+	if err := <-done; err != nil {
+		// 一覧が取得できない場合は、INBOXも含めて辿れない
+		return []MailFolder{{Name: s.inboxFolderName, Err: err}}
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+
+	folders := []MailFolder{}
+	for _, info := range infos {
+		if hasMailboxAttr(info, imap.NoSelectAttr) {
+			// 階層のためだけのもの(選択できないもの)は対象外
+			continue
+		}
+
+		if strings.EqualFold(info.Name, "INBOX") {
+			folders = append(folders, MailFolder{Name: s.inboxFolderName, Path: info.Name})
+			continue
+		}
+
+		mailFolderName, err := decodeFolderName(info.Name)
+		if err != nil {
+			folders = append(folders, MailFolder{Name: info.Name, Err: err})
+			continue
+		}
+		folders = append(folders, MailFolder{Name: mailFolderName, Path: info.Name})
+	}
+
+	return folders
+}
+
+func (s *ImapStore) WalkMails(folder MailFolder, fn func(mail Mail) error) error {
+
+	// STATUS=SIZEに対応している場合は、FETCHした結果の確認用に合計サイズも取得する
+	statusSize, err := s.client.Support("STATUS=" + string(imapStatusSize))
+	if err != nil {
+		return err
+	}
+	statusItems := []imap.StatusItem{imap.StatusMessages}
+	if statusSize {
+		statusItems = append(statusItems, imapStatusSize)
+	}
+
+	// 選択する前に件数を確認し、空のフォルダは読み込まない
+	status, err := s.client.Status(folder.Path, statusItems)
+	if err != nil {
+		return err
+	}
+	if status.Messages == 0 {
+		return nil
+	}
+
+	// 既読などのフラグを変えないように読み取り専用で選択する
+	if _, err := s.client.Select(folder.Path, true); err != nil {
+		return err
+	}
+
+	seqSet := new(imap.SeqSet)
+	seqSet.AddRange(1, 0) // 1:*
+
+	messages := make(chan *imap.Message, 100)
+	done := make(chan error, 1)
+	go func() {
+		done <- s.client.Fetch(seqSet, []imap.FetchItem{imap.FetchUid, imap.FetchRFC822Size, imap.FetchInternalDate, imap.FetchFlags}, messages)
+	}()
+
+	// メールの内容を読む集計ではFETCH中に別のコマンドを発行することになるので、先に全て受け取っておく
+	mails := []Mail{}
+	for message := range messages {
+		mails = append(mails, Mail{
+			Size:  int64(message.Size),
+			Time:  message.InternalDate.UTC(),
+			Flags: imapFlags(message.Flags),
+			Path:  s.mailURL(folder.Path, message.Uid),
+			Open:  s.opener(message.Uid),
+		})
+	}
+	if err := <-done; err != nil {
+		return err
+	}
+
+	if statusSize {
+		if err := s.checkStatusSize(folder.Path, statusItems, status, mails); err != nil {
+			return fmt.Errorf("%s: %w", folder.Path, err)
+		}
+	}
+
+	for _, mail := range mails {
+		if err := fn(mail); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// FETCHしたメールが、STATUSのSIZEと一致するか確認する
+// 一致しない場合でも、STATUSとFETCHの間にメールが入れ替わった(件数は同じ)だけのこともあるので、
+// もう一度STATUSを取得し、それと一致するか、STATUS自体が変わっていれば(集計中に変更されている)エラーにはしない
+// 変わらないSTATUSと一致しない場合のみエラーとする
+func (s *ImapStore) checkStatusSize(mailboxName string, statusItems []imap.StatusItem, status *imap.MailboxStatus, mails []Mail) error {
+
+	err := checkImapStatusSize(status, mails)
+	if err == nil {
+		return nil
+	}
+
+	recheckedStatus, statusErr := s.client.Status(mailboxName, statusItems)
+	if statusErr != nil {
+		return statusErr
+	}
+
+	if checkImapStatusSize(recheckedStatus, mails) == nil {
+		return nil
+	}
+	if recheckedStatus.Messages != status.Messages ||
+		fmt.Sprint(recheckedStatus.Items[imapStatusSize]) != fmt.Sprint(status.Items[imapStatusSize]) {
+		return nil
+	}
+
+	return err
+}
+
+// STATUSのSIZEと、FETCHしたRFC822.SIZEの合計が一致するか確認する
+// STATUSとFETCHの間にメールが増減した場合は比較できないので、件数が同じ場合のみ確認する
+func checkImapStatusSize(status *imap.MailboxStatus, mails []Mail) error {
+
+	value, ok := status.Items[imapStatusSize]
+	if !ok || value == nil {
+		// 対応していると言いつつ返さないサーバ
+		return nil
+	}
+
+	size, err := strconv.ParseInt(fmt.Sprint(value), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid STATUS SIZE '%v'", value)
+	}
+
+	if len(mails) != int(status.Messages) {
+		return nil
+	}
+
+	totalSize := int64(0)
+	for _, mail := range mails {
+		totalSize += mail.Size
+	}
+
+	if totalSize != size {
+		return fmt.Errorf("total size of mails %d does not match STATUS SIZE %d", totalSize, size)
+	}
+
+	return nil
+}
+
+// RFC 5092 のIMAP URL形式で表す
+// 例: imap://mail.example.com/INBOX;UID=20
+func (s *ImapStore) mailURL(mailboxName string, uid uint32) string {
+	return fmt.Sprintf("imap://%s/%s;UID=%d", s.serverName, url.PathEscape(mailboxName), uid)
+}
+
+// 選択中のフォルダから、UIDで内容を取得する
+func (s *ImapStore) opener(uid uint32) func() (io.ReadCloser, error) {
+
+	return func() (io.ReadCloser, error) {
+
+		seqSet := new(imap.SeqSet)
+		seqSet.AddNum(uid)
+
+		// BODY.PEEK[]で取得し、既読にはしない
+		section := &imap.BodySectionName{Peek: true}
+
+		messages := make(chan *imap.Message, 1)
+		done := make(chan error, 1)
+		go func() {
+			done <- s.client.UidFetch(seqSet, []imap.FetchItem{section.FetchItem()}, messages)
+		}()
+
+		var content []byte
+		var readErr error
+		for message := range messages {
+			if literal := message.GetBody(section); literal != nil && readErr == nil {
+				content, readErr = io.ReadAll(literal)
+			}
+		}
+		if err := <-done; err != nil {
+			return nil, err
+		}
+		if readErr != nil {
+			return nil, readErr
+		}
+		if content == nil {
+			return nil, fmt.Errorf("UID %d is not found", uid)
+		}
+
+		return io.NopCloser(bytes.NewReader(content)), nil
+	}
+}
+
+func hasMailboxAttr(info *imap.MailboxInfo, attr string) bool {
+
+	for _, a := range info.Attributes {
+		if strings.EqualFold(a, attr) {
+			return true
+		}
+	}
+	return false
+}
+
+// IMAPのフラグを、Maildirのフラグ(アルファベット順)にする
+// 例: \Seen \Flagged -> FS
+func imapFlags(flags []string) string {
+
+	maildirFlags := map[string]string{
+		strings.ToLower(imap.AnsweredFlag): "R",
+		strings.ToLower(imap.DeletedFlag):  "T",
+		strings.ToLower(imap.DraftFlag):    "D",
+		strings.ToLower(imap.FlaggedFlag):  "F",
+		strings.ToLower(imap.SeenFlag):     "S",
+		"$forwarded":                       "P",
+	}
+
+	letters := []string{}
+	for _, flag := range flags {
+		if letter, ok := maildirFlags[strings.ToLower(flag)]; ok {
+			letters = append(letters, letter)
+		}
+	}
+	sort.Strings(letters)
+
+	return strings.Join(letters, "")
+}
@@ -0,0 +1,382 @@
+package maildir
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/commands"
+	"github.com/emersion/go-imap/responses"
+	"github.com/emersion/go-imap/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImapStore(t *testing.T) {
+
+	// ARRANGE
+	addr := startTestImapServer(t, map[string][]testImapMessage{
+		"INBOX": {
+			{flags: []string{imap.SeenFlag}, date: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), body: "Subject: a\r\n\r\nbody"},
+			{flags: []string{}, date: time.Date(2022, 2, 1, 9, 0, 0, 0, time.FixedZone("JST", 9*60*60)), body: "Subject: b\r\n\r\nbody b"},
+		},
+		"Sent": {
+			{flags: []string{imap.SeenFlag, imap.AnsweredFlag}, date: time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC), body: "Subject: c\r\n\r\nc"},
+		},
+		"&MEI-": {},
+	})
+	c := loginTestImapServer(t, addr)
+
+	aggregator := NewSelectAggregator(SelectCondition{})
+
+	// ACT
+	err := AggregateMailStore(NewImapStore(c, "localhost", "INBOX"), aggregator)
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(
+		t,
+		[]*SelectedMail{
+			{MailFolderName: "INBOX", Path: "imap://localhost/INBOX;UID=1", Size: 18, Time: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)},
+			{MailFolderName: "INBOX", Path: "imap://localhost/INBOX;UID=2", Size: 20, Time: time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC)},
+			{MailFolderName: "Sent", Path: "imap://localhost/Sent;UID=1", Size: 15, Time: time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC)},
+		},
+		aggregator.Results())
+
+	folderAggregator := NewFolderAggregator()
+	err = AggregateMailStore(NewImapStore(c, "localhost", "INBOX"), folderAggregator)
+	require.NoError(t, err)
+
+	results := folderAggregator.Results()
+	SortByName(results)
+	assert.Equal(
+		t,
+		[]*AggregateResult{
+			{Name: "INBOX", Count: 2, TotalSize: 38},
+			{Name: "Sent", Count: 1, TotalSize: 15},
+			{Name: "あ", Count: 0, TotalSize: 0},
+		},
+		results)
+}
+
+func TestImapStore_Flags(t *testing.T) {
+
+	// ARRANGE
+	addr := startTestImapServer(t, map[string][]testImapMessage{
+		"INBOX": {
+			{flags: []string{imap.SeenFlag}, body: "Subject: a\r\n\r\nbody"},
+			{flags: []string{}, body: "Subject: b\r\n\r\nbody b"},
+			{flags: []string{imap.SeenFlag, imap.DeletedFlag}, body: "Subject: c\r\n\r\nc"},
+		},
+	})
+	c := loginTestImapServer(t, addr)
+
+	aggregator := NewSelectAggregator(SelectCondition{Flags: "ST"})
+
+	// ACT
+	err := AggregateMailStore(NewImapStore(c, "localhost", ""), aggregator)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	results := aggregator.Results()
+	require.Len(t, results, 1)
+	assert.Equal(t, "imap://localhost/INBOX;UID=3", results[0].Path)
+}
+
+func TestImapStore_Header(t *testing.T) {
+
+	// ARRANGE
+	addr := startTestImapServer(t, map[string][]testImapMessage{
+		"INBOX": {
+			{body: "From: a@example.com\r\n\r\nbody"},
+			{body: "From: b@example.net\r\n\r\nbody b"},
+		},
+		"Sent": {
+			{body: "From: a@example.com\r\n\r\nsent"},
+		},
+	})
+	c := loginTestImapServer(t, addr)
+
+	aggregator := NewSenderDomainAggregator()
+
+	// ACT
+	err := AggregateMailStore(NewImapStore(c, "localhost", ""), aggregator)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	results := aggregator.Results()
+	SortByName(results)
+	assert.Equal(
+		t,
+		[]*AggregateResult{
+			{Name: "example.com", Count: 2, TotalSize: 54},
+			{Name: "example.net", Count: 1, TotalSize: 29},
+		},
+		results)
+}
+
+func TestImapStore_StatusSize(t *testing.T) {
+
+	// ARRANGE
+	addr := startTestImapServer(
+		t,
+		map[string][]testImapMessage{
+			"INBOX": {
+				{body: "Subject: a\r\n\r\nbody"},
+				{body: "Subject: b\r\n\r\nbody b"},
+			},
+		},
+		&testStatusSizeExtension{})
+	c := loginTestImapServer(t, addr)
+
+	folderAggregator := NewFolderAggregator()
+
+	// ACT
+	err := AggregateMailStore(NewImapStore(c, "localhost", "INBOX"), folderAggregator)
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(
+		t,
+		[]*AggregateResult{
+			{Name: "INBOX", Count: 2, TotalSize: 38},
+		},
+		folderAggregator.Results())
+}
+
+func TestImapStore_StatusSizeMismatch(t *testing.T) {
+
+	// ARRANGE
+	addr := startTestImapServer(
+		t,
+		map[string][]testImapMessage{
+			"INBOX": {
+				{body: "Subject: a\r\n\r\nbody"},
+				{body: "Subject: b\r\n\r\nbody b"},
+			},
+		},
+		&testStatusSizeExtension{sizeDeltas: []uint32{1}})
+	c := loginTestImapServer(t, addr)
+
+	// ACT
+	err := AggregateMailStore(NewImapStore(c, "localhost", "INBOX"), NewFolderAggregator())
+
+	// ASSERT
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "INBOX: total size of mails 38 does not match STATUS SIZE 39")
+}
+
+func TestImapStore_StatusSizeChanged(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		sizeDeltas []uint32
+	}{
+		// STATUSとFETCHの間にメールが入れ替わり、再度のSTATUSとは一致する
+		{"recheck matches", []uint32{1, 0}},
+		// 確認中もメールが入れ替わり続けている
+		{"status changes", []uint32{1, 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			// ARRANGE
+			addr := startTestImapServer(
+				t,
+				map[string][]testImapMessage{
+					"INBOX": {
+						{body: "Subject: a\r\n\r\nbody"},
+						{body: "Subject: b\r\n\r\nbody b"},
+					},
+				},
+				&testStatusSizeExtension{sizeDeltas: tt.sizeDeltas})
+			c := loginTestImapServer(t, addr)
+
+			folderAggregator := NewFolderAggregator()
+
+			// ACT
+			err := AggregateMailStore(NewImapStore(c, "localhost", "INBOX"), folderAggregator)
+
+			// ASSERT
+			require.NoError(t, err)
+			assert.Equal(
+				t,
+				[]*AggregateResult{
+					{Name: "INBOX", Count: 2, TotalSize: 38},
+				},
+				folderAggregator.Results())
+		})
+	}
+}
+
+func TestImapStore_InvalidFolderName(t *testing.T) {
+
+	// ARRANGE
+	addr := startTestImapServer(t, map[string][]testImapMessage{
+		"&A": {},
+	})
+	c := loginTestImapServer(t, addr)
+
+	// ACT
+	folders := NewImapStore(c, "localhost", "INBOX").MailFolders()
+
+	// ASSERT
+	require.Len(t, folders, 2)
+	assert.Equal(t, "&A", folders[0].Name)
+	assert.EqualError(t, folders[0].Err, "&A is invalid folder name: utf7: invalid UTF-7")
+	assert.Equal(t, MailFolder{Name: "INBOX", Path: "INBOX"}, folders[1])
+}
+
+func TestImapFlags(t *testing.T) {
+
+	tests := []struct {
+		flags    []string
+		expected string
+	}{
+		{[]string{}, ""},
+		{[]string{imap.SeenFlag}, "S"},
+		{[]string{imap.SeenFlag, imap.FlaggedFlag, imap.AnsweredFlag}, "FRS"},
+		{[]string{imap.DeletedFlag, imap.DraftFlag, "$Forwarded"}, "DPT"},
+		{[]string{"\\seen", imap.RecentFlag, "$Junk"}, "S"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, imapFlags(tt.flags))
+	}
+}
+
+type testImapMessage struct {
+	flags []string
+	date  time.Time
+	body  string
+}
+
+// go-imapのメモリ上のバックエンドでIMAPサーバを起動する
+// ユーザ名とパスワードは username / password
+func startTestImapServer(t *testing.T, mailboxes map[string][]testImapMessage, extensions ...server.Extension) string {
+
+	be := memory.New()
+	u, err := be.Login(nil, "username", "password")
+	require.NoError(t, err)
+
+	// 初期状態で入っているメッセージは消しておく
+	inbox, err := u.GetMailbox("INBOX")
+	require.NoError(t, err)
+	inbox.(*memory.Mailbox).Messages = nil
+
+	for name, messages := range mailboxes {
+		if name != "INBOX" {
+			require.NoError(t, u.CreateMailbox(name))
+		}
+
+		mailbox, err := u.GetMailbox(name)
+		require.NoError(t, err)
+
+		for _, message := range messages {
+			date := message.date
+			if date.IsZero() {
+				date = time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+			}
+			require.NoError(t, mailbox.CreateMessage(message.flags, date, bytes.NewBufferString(message.body)))
+		}
+	}
+
+	s := server.New(be)
+	s.AllowInsecureAuth = true
+	s.Enable(extensions...)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	go s.Serve(listener)
+	t.Cleanup(func() { s.Close() })
+
+	return listener.Addr().String()
+}
+
+func loginTestImapServer(t *testing.T, addr string) *client.Client {
+
+	c, err := client.Dial(addr)
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Logout() })
+
+	require.NoError(t, c.Login("username", "password"))
+
+	return c
+}
+
+// STATUS=SIZE (RFC 8438) に対応したサーバとして振る舞わせる
+// SIZEはメールのサイズの合計に、STATUSの回数目の sizeDeltas (以降は最後のもの) を加えたものを返す
+type testStatusSizeExtension struct {
+	sizeDeltas []uint32
+	count      int
+}
+
+func (e *testStatusSizeExtension) Capabilities(c server.Conn) []string {
+	return []string{"STATUS=SIZE"}
+}
+
+func (e *testStatusSizeExtension) Command(name string) server.HandlerFactory {
+
+	if name != "STATUS" {
+		return nil
+	}
+	return func() server.Handler {
+		return &testStatusSizeHandler{extension: e}
+	}
+}
+
+func (e *testStatusSizeExtension) sizeDelta() uint32 {
+
+	if len(e.sizeDeltas) == 0 {
+		return 0
+	}
+
+	index := e.count
+	if index >= len(e.sizeDeltas) {
+		index = len(e.sizeDeltas) - 1
+	}
+	e.count++
+
+	return e.sizeDeltas[index]
+}
+
+type testStatusSizeHandler struct {
+	commands.Status
+	extension *testStatusSizeExtension
+}
+
+func (h *testStatusSizeHandler) Handle(conn server.Conn) error {
+
+	mailbox, err := conn.Context().User.GetMailbox(h.Mailbox)
+	if err != nil {
+		return err
+	}
+
+	status, err := mailbox.Status(h.Items)
+	if err != nil {
+		return err
+	}
+
+	items := map[imap.StatusItem]interface{}{}
+	for _, item := range h.Items {
+		items[item] = status.Items[item]
+		if item == imapStatusSize {
+			size := h.extension.sizeDelta()
+			for _, message := range mailbox.(*memory.Mailbox).Messages {
+				size += message.Size
+			}
+			items[item] = size
+		}
+	}
+	status.Items = items
+
+	return conn.WriteResp(&responses.Status{Mailbox: status})
+}
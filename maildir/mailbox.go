@@ -0,0 +1,165 @@
+package maildir
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/onozaty/maildir-stats/user"
+)
+
+type StorageFormat int
+
+const (
+	MaildirStorage StorageFormat = iota
+	MboxStorage
+	DboxStorage
+	AutoStorage // ディレクトリの内容から判定
+)
+
+// メールの格納場所
+// 複数の形式を合わせて持つことができ、その場合は全てを集計する
+type Mailbox struct {
+	MaildirPath   string // Maildir++のルート
+	MboxDirPath   string // フォルダ毎のmboxファイルを置いたディレクトリ
+	MboxInboxPath string // INBOXとなるmboxファイル(/var/spool/mail/<user> など)
+	DboxPath      string // Dovecotのsdbox/mdboxのルート
+}
+
+func (m Mailbox) isEmpty() bool {
+	return m.MaildirPath == "" && m.MboxDirPath == "" && m.MboxInboxPath == "" && m.DboxPath == ""
+}
+
+type UserMailbox struct {
+	UserName string
+	Mailbox  Mailbox
+}
+
+// 指定されたパスを、形式に応じたメールの格納場所として扱う
+// mbox(もしくは自動判定)の場合、ファイルであればINBOXのmboxファイル、ディレクトリであればmboxファイルを置いたディレクトリとする
+func MailboxOf(path string, format StorageFormat) (Mailbox, error) {
+
+	switch format {
+	case MaildirStorage:
+		return Mailbox{MaildirPath: path}, nil
+	case DboxStorage:
+		return Mailbox{DboxPath: path}, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return Mailbox{}, err
+	}
+
+	if !info.IsDir() {
+		return Mailbox{MboxInboxPath: path}, nil
+	}
+
+	if format == AutoStorage {
+		if isMaildir(path) {
+			return Mailbox{MaildirPath: path}, nil
+		}
+		if isDbox(path) {
+			return Mailbox{DboxPath: path}, nil
+		}
+	}
+
+	return Mailbox{MboxDirPath: path}, nil
+}
+
+// ユーザ毎のメールの格納場所を取得する(格納場所が無いユーザは除く)
+// homeディレクトリ配下のmailDirNameに加えて、mbox(もしくは自動判定)の場合は spoolDirPath/<ユーザ名> のmboxファイルも対象とする
+func UserMailboxes(users []user.User, mailDirName string, spoolDirPath string, format StorageFormat) []UserMailbox {
+
+	mailboxes := []UserMailbox{}
+	for _, user := range users {
+
+		mailbox := Mailbox{}
+
+		mailDirPath := filepath.Join(user.HomeDir, mailDirName)
+		if info, err := os.Stat(mailDirPath); err == nil && info.IsDir() {
+			switch {
+			case format == MaildirStorage || (format == AutoStorage && isMaildir(mailDirPath)):
+				mailbox.MaildirPath = mailDirPath
+			case format == DboxStorage || (format == AutoStorage && isDbox(mailDirPath)):
+				mailbox.DboxPath = mailDirPath
+			default:
+				mailbox.MboxDirPath = mailDirPath
+			}
+		}
+
+		if (format == MboxStorage || format == AutoStorage) && spoolDirPath != "" {
+			spoolPath := filepath.Join(spoolDirPath, user.Name)
+			if info, err := os.Stat(spoolPath); err == nil && !info.IsDir() {
+				mailbox.MboxInboxPath = spoolPath
+			}
+		}
+
+		if mailbox.isEmpty() {
+			continue
+		}
+
+		mailboxes = append(mailboxes, UserMailbox{
+			UserName: user.Name,
+			Mailbox:  mailbox,
+		})
+	}
+
+	return mailboxes
+}
+
+// curもしくはnewがあればMaildirとみなす
+func isMaildir(path string) bool {
+
+	for _, subName := range []string{"cur", "new"} {
+		if info, err := os.Stat(filepath.Join(path, subName)); err == nil && info.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
+func AggregateUserMailboxesWithErrorHandler(mailboxes []UserMailbox, inboxFolderName string, aggregator Aggregator, errorHandler ErrorHandler) error {
+
+	for _, mailbox := range mailboxes {
+		aggregator.StartUser(mailbox.UserName)
+		if err := aggregateMailbox(mailbox.UserName, mailbox.Mailbox, inboxFolderName, aggregator, errorHandler); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func AggregateMailboxWithErrorHandler(mailbox Mailbox, inboxFolderName string, aggregator Aggregator, errorHandler ErrorHandler) error {
+	return aggregateMailbox("", mailbox, inboxFolderName, aggregator, errorHandler)
+}
+
+func aggregateMailbox(userName string, mailbox Mailbox, inboxFolderName string, aggregator Aggregator, errorHandler ErrorHandler) error {
+
+	for _, store := range mailbox.stores(inboxFolderName) {
+		if err := aggregateMailStore(userName, store, aggregator, errorHandler); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m Mailbox) stores(inboxFolderName string) []MailStore {
+
+	stores := []MailStore{}
+
+	if m.MaildirPath != "" {
+		stores = append(stores, NewMaildirStore(m.MaildirPath, inboxFolderName))
+	}
+	if m.MboxInboxPath != "" {
+		stores = append(stores, NewMboxFileStore(m.MboxInboxPath, inboxFolderName))
+	}
+	if m.MboxDirPath != "" {
+		stores = append(stores, NewMboxDirStore(m.MboxDirPath))
+	}
+	if m.DboxPath != "" {
+		stores = append(stores, NewDboxStore(m.DboxPath, inboxFolderName))
+	}
+
+	return stores
+}
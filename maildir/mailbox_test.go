@@ -0,0 +1,208 @@
+package maildir
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/onozaty/maildir-stats/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMailboxOf(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	maildirPath := createDir(t, temp, "Maildir")
+	createMailFolder(t, maildirPath, []mail{})
+	mboxDirPath := createDir(t, temp, "mail")
+	mboxPath := filepath.Join(temp, "inbox")
+	createFile(t, mboxPath, "")
+	dboxPath := createDir(t, temp, "sdbox")
+	createDir(t, dboxPath, "mailboxes")
+
+	tests := []struct {
+		name     string
+		path     string
+		format   StorageFormat
+		expected Mailbox
+	}{
+		{"maildir", maildirPath, MaildirStorage, Mailbox{MaildirPath: maildirPath}},
+		{"maildir(not checked)", mboxPath, MaildirStorage, Mailbox{MaildirPath: mboxPath}},
+		{"mbox file", mboxPath, MboxStorage, Mailbox{MboxInboxPath: mboxPath}},
+		{"mbox dir", mboxDirPath, MboxStorage, Mailbox{MboxDirPath: mboxDirPath}},
+		{"mbox dir(maildir)", maildirPath, MboxStorage, Mailbox{MboxDirPath: maildirPath}},
+		{"auto maildir", maildirPath, AutoStorage, Mailbox{MaildirPath: maildirPath}},
+		{"auto mbox file", mboxPath, AutoStorage, Mailbox{MboxInboxPath: mboxPath}},
+		{"auto mbox dir", mboxDirPath, AutoStorage, Mailbox{MboxDirPath: mboxDirPath}},
+		{"dbox", dboxPath, DboxStorage, Mailbox{DboxPath: dboxPath}},
+		{"auto dbox", dboxPath, AutoStorage, Mailbox{DboxPath: dboxPath}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// ACT
+			mailbox, err := MailboxOf(tt.path, tt.format)
+
+			// ASSERT
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, mailbox)
+		})
+	}
+}
+
+func TestMailboxOf_NotFound(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	path := filepath.Join(temp, "notfound")
+
+	// ACT
+	_, err := MailboxOf(path, AutoStorage)
+
+	// ASSERT
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "stat "+path)
+}
+
+func TestUserMailboxes(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	spool := createDir(t, temp, "spool")
+
+	// user1: Maildir
+	home1 := createDir(t, temp, "user1")
+	maildir1 := createDir(t, home1, "Maildir")
+	createMailFolder(t, maildir1, []mail{})
+
+	// user2: mbox(ディレクトリとspool)
+	home2 := createDir(t, temp, "user2")
+	mboxDir2 := createDir(t, home2, "Maildir")
+	createFile(t, filepath.Join(spool, "user2"), "")
+
+	// user3: spoolのみ
+	home3 := createDir(t, temp, "user3")
+	createFile(t, filepath.Join(spool, "user3"), "")
+
+	// user4: 無し
+	home4 := createDir(t, temp, "user4")
+
+	// user5: Maildirとspool(自動判定では両方とも対象)
+	home5 := createDir(t, temp, "user5")
+	maildir5 := createDir(t, home5, "Maildir")
+	createMailFolder(t, maildir5, []mail{})
+	createFile(t, filepath.Join(spool, "user5"), "")
+
+	users := []user.User{
+		{Name: "user1", HomeDir: home1},
+		{Name: "user2", HomeDir: home2},
+		{Name: "user3", HomeDir: home3},
+		{Name: "user4", HomeDir: home4},
+		{Name: "user5", HomeDir: home5},
+	}
+
+	// ACT
+	maildirMailboxes := UserMailboxes(users, "Maildir", spool, MaildirStorage)
+	mboxMailboxes := UserMailboxes(users, "Maildir", spool, MboxStorage)
+	autoMailboxes := UserMailboxes(users, "Maildir", spool, AutoStorage)
+
+	// ASSERT
+	assert.Equal(
+		t,
+		[]UserMailbox{
+			{UserName: "user1", Mailbox: Mailbox{MaildirPath: maildir1}},
+			{UserName: "user2", Mailbox: Mailbox{MaildirPath: mboxDir2}},
+			{UserName: "user5", Mailbox: Mailbox{MaildirPath: maildir5}},
+		},
+		maildirMailboxes)
+	assert.Equal(
+		t,
+		[]UserMailbox{
+			{UserName: "user1", Mailbox: Mailbox{MboxDirPath: maildir1}},
+			{UserName: "user2", Mailbox: Mailbox{MboxDirPath: mboxDir2, MboxInboxPath: filepath.Join(spool, "user2")}},
+			{UserName: "user3", Mailbox: Mailbox{MboxInboxPath: filepath.Join(spool, "user3")}},
+			{UserName: "user5", Mailbox: Mailbox{MboxDirPath: maildir5, MboxInboxPath: filepath.Join(spool, "user5")}},
+		},
+		mboxMailboxes)
+	assert.Equal(
+		t,
+		[]UserMailbox{
+			{UserName: "user1", Mailbox: Mailbox{MaildirPath: maildir1}},
+			{UserName: "user2", Mailbox: Mailbox{MboxDirPath: mboxDir2, MboxInboxPath: filepath.Join(spool, "user2")}},
+			{UserName: "user3", Mailbox: Mailbox{MboxInboxPath: filepath.Join(spool, "user3")}},
+			{UserName: "user5", Mailbox: Mailbox{MaildirPath: maildir5, MboxInboxPath: filepath.Join(spool, "user5")}},
+		},
+		autoMailboxes)
+}
+
+func TestAggregateUserMailboxesWithErrorHandler(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	// Maildirとmboxの混在
+	maildirPath := createDir(t, temp, "Maildir")
+	createMailFolder(t, maildirPath, []mail{
+		{"cur/1640995200", 1},
+	})
+	{
+		sub := createDir(t, maildirPath, ".Sent")
+		createMailFolder(t, sub, []mail{
+			{"cur/1640995200", 2},
+		})
+	}
+
+	mboxDirPath := createDir(t, temp, "mail")
+	createFile(t, filepath.Join(mboxDirPath, "Sent.mbox"), testMboxFromA+testMboxMessageA)
+
+	mboxPath := filepath.Join(temp, "spool")
+	createFile(t, mboxPath, testMboxFromB+testMboxMessageB)
+
+	mailboxes := []UserMailbox{
+		{UserName: "user1", Mailbox: Mailbox{MaildirPath: maildirPath}},
+		{UserName: "user2", Mailbox: Mailbox{MboxDirPath: mboxDirPath, MboxInboxPath: mboxPath}},
+		{UserName: "user3", Mailbox: Mailbox{MboxInboxPath: filepath.Join(temp, "notfound")}},
+	}
+
+	userAggregator := NewUserAggregator()
+	folderAggregator := NewFolderAggregator()
+	errors := []*AggregateError{}
+
+	// ACT
+	err := AggregateUserMailboxesWithErrorHandler(
+		mailboxes, "INBOX", NewMultiAggregator([]Aggregator{userAggregator, folderAggregator}),
+		func(err *AggregateError) error {
+			errors = append(errors, err)
+			return nil
+		})
+
+	// ASSERT
+	require.NoError(t, err)
+
+	userResults := userAggregator.Results()
+	SortByName(userResults)
+	assert.Equal(
+		t,
+		[]*AggregateResult{
+			{Name: "user1", Count: 2, TotalSize: 3},
+			{Name: "user2", Count: 2, TotalSize: int64(len(testMboxMessageA) + len(testMboxMessageB))},
+			{Name: "user3", Count: 0, TotalSize: 0},
+		},
+		userResults)
+
+	folderResults := folderAggregator.Results()
+	SortByName(folderResults)
+	assert.Equal(
+		t,
+		[]*AggregateResult{
+			{Name: "INBOX", Count: 2, TotalSize: int64(1 + len(testMboxMessageB))},
+			{Name: "Sent", Count: 2, TotalSize: int64(2 + len(testMboxMessageA))},
+		},
+		folderResults)
+
+	require.Len(t, errors, 1)
+	assert.Equal(t, "user3", errors[0].UserName)
+	assert.Equal(t, "INBOX", errors[0].MailFolderName)
+}
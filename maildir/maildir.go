@@ -1,9 +1,13 @@
 package maildir
 
 import (
+	"bufio"
 	"fmt"
+	"io"
 	"io/fs"
+	netmail "net/mail"
 	"os"
+	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -14,72 +18,191 @@ import (
 )
 
 type mailInfo struct {
-	size int64
-	time time.Time
+	size        int64
+	time        time.Time
+	flags       string
+	path        string
+	header      netmail.Header                // HeaderAggregatorがヘッダを必要とした場合のみ設定
+	attachments []attachment                  // AttachmentsAggregatorが添付ファイルを必要とした場合のみ設定
+	open        func() (io.ReadCloser, error) // メールの内容を読み込む(未設定の場合はpathのファイル)
+}
+
+// メールの内容を読み込む
+func (m mailInfo) openContent() (io.ReadCloser, error) {
+	if m.open != nil {
+		return m.open()
+	}
+	return os.Open(m.path)
+}
+
+// 集計中に発生したエラー
+type AggregateError struct {
+	UserName       string
+	MailFolderName string
+	Err            error
+}
+
+func (e *AggregateError) Error() string {
+	if e.UserName == "" {
+		return fmt.Sprintf("folder '%s': %s", e.MailFolderName, e.Err)
+	}
+	return fmt.Sprintf("user '%s' folder '%s': %s", e.UserName, e.MailFolderName, e.Err)
+}
+
+func (e *AggregateError) Unwrap() error {
+	return e.Err
+}
+
+// 集計中にエラーが発生した際に呼び出される
+// nilを返した場合はエラーとなったメールフォルダをスキップして集計を継続し、
+// エラーを返した場合はそこで集計を中断する
+type ErrorHandler func(err *AggregateError) error
+
+func failOnError(err *AggregateError) error {
+	return err.Err
 }
 
 func AggregateUsers(users []user.User, maildirName string, inboxFolderName string, aggregator Aggregator) error {
+	return AggregateUsersWithErrorHandler(users, maildirName, inboxFolderName, aggregator, failOnError)
+}
 
-	for _, user := range users {
+func AggregateUsersWithErrorHandler(users []user.User, maildirName string, inboxFolderName string, aggregator Aggregator, errorHandler ErrorHandler) error {
+
+	mailboxes := UserMailboxes(users, maildirName, "", MaildirStorage)
+	return AggregateUserMailboxesWithErrorHandler(mailboxes, inboxFolderName, aggregator, errorHandler)
+}
+
+// ユーザのhomeディレクトリにメールディレクトリがあるユーザ(集計対象のユーザ)に絞り込む
+func UsersWithMaildir(users []user.User, maildirName string) []user.User {
 
-		// ユーザのhomeディレクトリにメールディレクトリがあった場合のみ対象に
+	targetUsers := []user.User{}
+	for _, user := range users {
 		userMailFolderPath := filepath.Join(user.HomeDir, maildirName)
 		if file, err := os.Stat(userMailFolderPath); err != nil || !file.IsDir() {
 			continue
 		}
-
-		aggregator.StartUser(user.Name)
-		if err := AggregateMailFolders(userMailFolderPath, inboxFolderName, aggregator); err != nil {
-			return err
-		}
+		targetUsers = append(targetUsers, user)
 	}
-	return nil
+
+	return targetUsers
 }
 
 func AggregateMailFolders(rootMailFolderPath string, inboxFolderName string, aggregator Aggregator) error {
+	return AggregateMailFoldersWithErrorHandler(rootMailFolderPath, inboxFolderName, aggregator, failOnError)
+}
 
-	// ルート(INBOX)
-	aggregator.StartMailFolder(inboxFolderName)
-	if err := aggregateMailFolder(rootMailFolderPath, false, aggregator); err != nil {
-		return err
+func AggregateMailFoldersWithErrorHandler(rootMailFolderPath string, inboxFolderName string, aggregator Aggregator, errorHandler ErrorHandler) error {
+	return AggregateMailStoreWithErrorHandler(NewMaildirStore(rootMailFolderPath, inboxFolderName), aggregator, errorHandler)
+}
+
+// ヘッダを必要とするAggregator
+type HeaderAggregator interface {
+	Aggregator
+	NeedsHeader() bool
+}
+
+func needsHeader(aggregator Aggregator) bool {
+	headerAggregator, ok := aggregator.(HeaderAggregator)
+	return ok && headerAggregator.NeedsHeader()
+}
+
+// 添付ファイル(メール全体の内容)を必要とするAggregator
+type AttachmentsAggregator interface {
+	Aggregator
+	NeedsAttachments() bool
+}
+
+func needsAttachments(aggregator Aggregator) bool {
+	attachmentsAggregator, ok := aggregator.(AttachmentsAggregator)
+	return ok && attachmentsAggregator.NeedsAttachments()
+}
+
+// 一部のメールフォルダのみを対象とするAggregator
+// 対象外のメールフォルダは辿らない(読めないものもエラーにしない)
+type MailFolderSelector interface {
+	Aggregator
+	NeedsMailFolder(mailFolderName string) bool
+}
+
+func needsMailFolder(aggregator Aggregator, mailFolderName string) bool {
+	mailFolderSelector, ok := aggregator.(MailFolderSelector)
+	return !ok || mailFolderSelector.NeedsMailFolder(mailFolderName)
+}
+
+// Maildir++形式の格納場所
+// ルートがINBOX、"."で始まるディレクトリがその他メールフォルダ(名前は修正UTF-7でエンコード)
+type MaildirStore struct {
+	fsys            fs.FS // nilの場合はOSのファイルシステム
+	rootPath        string
+	inboxFolderName string
+}
+
+func NewMaildirStore(rootMailFolderPath string, inboxFolderName string) *MaildirStore {
+	return &MaildirStore{
+		rootPath:        rootMailFolderPath,
+		inboxFolderName: inboxFolderName,
 	}
+}
 
-	// その他メールフォルダ
-	entries, err := os.ReadDir(rootMailFolderPath)
+// fs.FS上のMaildir++(アーカイブ内のものなど)
+// rootMailFolderPathはfs.FS内でのパス("/"区切り)
+func NewMaildirFSStore(fsys fs.FS, rootMailFolderPath string, inboxFolderName string) *MaildirStore {
+
+	if rootMailFolderPath == "" {
+		rootMailFolderPath = "."
+	}
+
+	return &MaildirStore{
+		fsys:            fsys,
+		rootPath:        rootMailFolderPath,
+		inboxFolderName: inboxFolderName,
+	}
+}
+
+func (s *MaildirStore) MailFolders() []MailFolder {
+
+	entries, err := s.readDir(s.join())
 	if err != nil {
-		return err
+		// ルートが読めない場合は、INBOXもその他メールフォルダも辿れないので、エラーのみとする
+		// (INBOXとしても返すと、同じ原因のエラーが2つになる)
+		return []MailFolder{{Name: s.inboxFolderName, Err: err}}
 	}
 
+	// ルート(INBOX)
+	folders := []MailFolder{{Name: s.inboxFolderName, Path: ""}}
+
+	// その他メールフォルダ
+
 	for _, entry := range entries {
 		// ディレクトリの先頭が"."になっているものがメールフォルダ
 		if entry.IsDir() && strings.HasPrefix(entry.Name(), ".") {
 			mailFolderName, err := decodeFolderName(entry.Name()[1:])
 			if err != nil {
-				return err
+				// デコードできない場合は、デコード前の名前でエラーとして扱う
+				folders = append(folders, MailFolder{Name: entry.Name()[1:], Err: err})
+				continue
 			}
 
-			aggregator.StartMailFolder(mailFolderName)
-			// その他メールフォルダは作成直後にcurフォルダなどが無いことがあるので無かったらスキップするように設定
-			if err := aggregateMailFolder(filepath.Join(rootMailFolderPath, entry.Name()), true, aggregator); err != nil {
-				return err
-			}
+			folders = append(folders, MailFolder{Name: mailFolderName, Path: entry.Name()})
 		}
 	}
 
-	return nil
+	return folders
 }
 
-func aggregateMailFolder(mailFolderPath string, skipSubdirMissing bool, aggregator Aggregator) error {
+func (s *MaildirStore) WalkMails(folder MailFolder, fn func(mail Mail) error) error {
+
+	// その他メールフォルダは作成直後にcurフォルダなどが無いことがあるので無かったらスキップ
+	skipSubdirMissing := folder.Path != ""
 
 	// tmpにあるのは配送中のものなので対象から除いておく
 	for _, subName := range []string{"new", "cur"} {
-		subDir := filepath.Join(mailFolderPath, subName)
-		if _, err := os.Stat(subDir); os.IsNotExist(err) && skipSubdirMissing {
-			// サブディレクトリが無いことを無視する場合はスキップ
+		subDir := s.join(folder.Path, subName)
+		if _, err := s.stat(subDir); os.IsNotExist(err) && skipSubdirMissing {
 			continue
 		}
 
-		if err := aggregateMails(filepath.Join(mailFolderPath, subName), aggregator); err != nil {
+		if err := s.walkMails(subDir, fn); err != nil {
 			return err
 		}
 	}
@@ -87,9 +210,9 @@ func aggregateMailFolder(mailFolderPath string, skipSubdirMissing bool, aggregat
 	return nil
 }
 
-func aggregateMails(dirPath string, aggregator Aggregator) error {
+func (s *MaildirStore) walkMails(dirPath string, fn func(mail Mail) error) error {
 
-	entries, err := os.ReadDir(dirPath)
+	entries, err := s.readDir(dirPath)
 	if err != nil {
 		return err
 	}
@@ -101,15 +224,104 @@ func aggregateMails(dirPath string, aggregator Aggregator) error {
 
 		info, err := entry.Info()
 		if err != nil {
+			if os.IsNotExist(err) {
+				// 集計中に移動、削除されたものは対象外
+				continue
+			}
 			return err
 		}
 
-		aggregator.Aggregate(mailInfoOf(info))
+		mail := mailInfoOf(info)
+		mailPath := s.joinPath(dirPath, entry.Name())
+
+		if err := fn(Mail{
+			Size:  mail.size,
+			Time:  mail.time,
+			Flags: mail.flags,
+			Path:  mailPath,
+			Open:  s.opener(mailPath),
+		}); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+// ルートからの相対パスを、ファイルシステム上のパスにする
+func (s *MaildirStore) join(elem ...string) string {
+	return s.joinPath(append([]string{s.rootPath}, elem...)...)
+}
+
+func (s *MaildirStore) joinPath(elem ...string) string {
+	if s.fsys == nil {
+		return filepath.Join(elem...)
+	}
+	return path.Join(elem...)
+}
+
+func (s *MaildirStore) readDir(name string) ([]fs.DirEntry, error) {
+	if s.fsys == nil {
+		return os.ReadDir(name)
+	}
+	return fs.ReadDir(s.fsys, name)
+}
+
+func (s *MaildirStore) stat(name string) (fs.FileInfo, error) {
+	if s.fsys == nil {
+		return os.Stat(name)
+	}
+	return fs.Stat(s.fsys, name)
+}
+
+func (s *MaildirStore) opener(name string) func() (io.ReadCloser, error) {
+	if s.fsys == nil {
+		// Pathのファイルをそのまま開く
+		return nil
+	}
+	return func() (io.ReadCloser, error) {
+		return s.fsys.Open(name)
+	}
+}
+
+// 先頭のヘッダ部分だけを読み込む
+// ヘッダとして解釈できないものは、空のヘッダとして扱う
+func readMailHeader(mail mailInfo) (netmail.Header, error) {
+
+	content, err := mail.openContent()
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+
+	reader := &errorRecordReader{reader: content}
+	message, err := netmail.ReadMessage(bufio.NewReader(reader))
+	if reader.err != nil {
+		// ファイルの読み込み自体に失敗
+		return nil, reader.err
+	}
+	if err != nil {
+		return netmail.Header{}, nil
+	}
+
+	return message.Header, nil
+}
+
+// 読み込み時のエラー(EOF以外)を記録する
+// ヘッダの形式が不正なことによるエラーと区別するために利用
+type errorRecordReader struct {
+	reader io.Reader
+	err    error
+}
+
+func (r *errorRecordReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
+
 func decodeFolderName(encodedName string) (string, error) {
 	decoder := utf7.Encoding.NewDecoder()
 	decodedName, err := decoder.String(encodedName)
@@ -133,7 +345,21 @@ func mailInfoOf(fileInfo fs.FileInfo) mailInfo {
 	time := time.Unix(unixtime, 0).UTC() // UTCで扱う
 
 	return mailInfo{
-		time: time,
-		size: fileInfo.Size(),
+		time:  time,
+		flags: mailFlags(fileInfo.Name()),
+		size:  fileInfo.Size(),
+	}
+}
+
+// ファイル名の":2,"以降がフラグ
+// 例: 1674617693.M958571P8888.localhost.localdomain,S=545,W=562:2,ST
+//
+//	-> ST
+func mailFlags(fileName string) string {
+
+	index := strings.LastIndex(fileName, ":2,")
+	if index == -1 {
+		return ""
 	}
+	return fileName[index+3:]
 }
@@ -185,6 +185,126 @@ func TestAggregateUsers_FolderNotFound(t *testing.T) {
 	assert.Contains(t, err.Error(), expect)
 }
 
+func TestAggregateUsersWithErrorHandler(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	users := []user.User{}
+	{
+		// user1
+		userName := "user1"
+		homeDir := createDir(t, temp, userName)
+		users = append(users, user.User{
+			Name:    userName,
+			HomeDir: homeDir,
+		})
+
+		mailDir := createDir(t, homeDir, "Maildir")
+		// INBOXのcur,newが無い
+		{
+			sub := createDir(t, mailDir, ".A")
+			createMailFolder(t, sub, []mail{
+				{"new/1672531200", 11}, // 2023-01-01
+			})
+		}
+	}
+	{
+		// user2
+		userName := "user2"
+		homeDir := createDir(t, temp, userName)
+		users = append(users, user.User{
+			Name:    userName,
+			HomeDir: homeDir,
+		})
+
+		mailDir := createDir(t, homeDir, "Maildir")
+		createMailFolder(t, mailDir, []mail{
+			{"cur/1640908800", 1}, // 2021-12-31
+		})
+		{
+			// デコードできないフォルダ名
+			sub := createDir(t, mailDir, ".&A")
+			createMailFolder(t, sub, []mail{
+				{"new/1638316800", 11}, // 2021-12-01
+			})
+		}
+		{
+			sub := createDir(t, mailDir, ".Z")
+			createMailFolder(t, sub, []mail{
+				{"new/1638316800", 12}, // 2021-12-01
+			})
+		}
+	}
+
+	userAggregator := NewUserAggregator()
+	errors := []*AggregateError{}
+
+	// ACT
+	err := AggregateUsersWithErrorHandler(users, "Maildir", "INBOX", userAggregator, func(err *AggregateError) error {
+		errors = append(errors, err)
+		return nil
+	})
+
+	// ASSERT
+	require.NoError(t, err)
+	{
+		results := userAggregator.Results()
+		SortByName(results)
+		assert.Equal(
+			t,
+			[]*AggregateResult{
+				{Name: "user1", Count: 1, TotalSize: 11},
+				{Name: "user2", Count: 2, TotalSize: 13},
+			},
+			results,
+		)
+	}
+
+	require.Len(t, errors, 2)
+	assert.Equal(t, "user1", errors[0].UserName)
+	assert.Equal(t, "INBOX", errors[0].MailFolderName)
+	// OSによってエラーメッセージが異なるのでファイル名部分だけチェック
+	assert.Contains(t, errors[0].Error(), "user 'user1' folder 'INBOX': open "+filepath.Join(temp, "user1", "Maildir", "new"))
+
+	assert.Equal(t, "user2", errors[1].UserName)
+	assert.Equal(t, "&A", errors[1].MailFolderName)
+	assert.EqualError(t, errors[1], "user 'user2' folder '&A': &A is invalid folder name: utf7: invalid UTF-7")
+}
+
+func TestAggregateUsersWithErrorHandler_Abort(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	users := []user.User{}
+	for _, userName := range []string{"user1", "user2"} {
+		homeDir := createDir(t, temp, userName)
+		users = append(users, user.User{
+			Name:    userName,
+			HomeDir: homeDir,
+		})
+
+		// 配下に何もなし
+		createDir(t, homeDir, "Maildir")
+	}
+
+	userAggregator := NewUserAggregator()
+	count := 0
+
+	// ACT
+	err := AggregateUsersWithErrorHandler(users, "Maildir", "", userAggregator, func(err *AggregateError) error {
+		count++
+		return err
+	})
+
+	// ASSERT
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "user 'user1' folder '': open ")
+	// 最初のエラーで中断
+	assert.Equal(t, 1, count)
+}
+
 func TestAggregateMailFolders(t *testing.T) {
 
 	// ARRANGE
@@ -404,6 +524,33 @@ func TestAggregateMailFolders_RootFolderNotFound(t *testing.T) {
 	assert.Contains(t, err.Error(), expect)
 }
 
+func TestAggregateMailFoldersWithErrorHandler_RootFolderNotFound(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	rootMailFolderPath := filepath.Join(temp, "xx") // 存在しないフォルダ
+
+	aggregator := NewFolderAggregator()
+	errors := []*AggregateError{}
+
+	// ACT
+	err := AggregateMailFoldersWithErrorHandler(rootMailFolderPath, "INBOX", aggregator, func(err *AggregateError) error {
+		errors = append(errors, err)
+		return nil
+	})
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// ルートが読めないことによるエラーは1つだけ
+	require.Len(t, errors, 1)
+	assert.Equal(t, "INBOX", errors[0].MailFolderName)
+	// OSによってエラーメッセージが異なるのでファイル名部分だけチェック
+	assert.Contains(t, errors[0].Err.Error(), "open "+rootMailFolderPath)
+
+	assert.Empty(t, aggregator.Results())
+}
+
 func TestAggregateMailFolders_InvalidFolderName(t *testing.T) {
 
 	// ARRANGE
@@ -431,6 +578,57 @@ func TestAggregateMailFolders_InvalidFolderName(t *testing.T) {
 	assert.EqualError(t, err, "&A is invalid folder name: utf7: invalid UTF-7")
 }
 
+func TestAggregateMailFoldersWithErrorHandler(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	// INBOX
+	createMailFolder(t, temp, []mail{
+		{"new/1", 1},
+	})
+
+	// その他フォルダ
+	{
+		sub := createDir(t, temp, ".&A")
+		createMailFolder(t, sub, []mail{
+			{"cur/2", 2},
+		})
+	}
+	{
+		sub := createDir(t, temp, ".B")
+		createMailFolder(t, sub, []mail{
+			{"cur/3", 3},
+		})
+	}
+
+	aggregator := NewFolderAggregator()
+	errors := []*AggregateError{}
+
+	// ACT
+	err := AggregateMailFoldersWithErrorHandler(temp, "", aggregator, func(err *AggregateError) error {
+		errors = append(errors, err)
+		return nil
+	})
+
+	// ASSERT
+	require.NoError(t, err)
+
+	results := aggregator.Results()
+	SortByName(results)
+	assert.Equal(
+		t,
+		[]*AggregateResult{
+			{Name: "", Count: 1, TotalSize: 1},
+			{Name: "B", Count: 1, TotalSize: 3},
+		},
+		results,
+	)
+
+	require.Len(t, errors, 1)
+	assert.EqualError(t, errors[0], "folder '&A': &A is invalid folder name: utf7: invalid UTF-7")
+}
+
 func TestAggregateMailFolder(t *testing.T) {
 
 	// ARRANGE
@@ -452,7 +650,10 @@ func TestAggregateMailFolder(t *testing.T) {
 	// ACT
 	aggregator := NewFolderAggregator()
 	aggregator.StartMailFolder("INBOX")
-	err := aggregateMailFolder(temp, false, aggregator)
+	err := NewMaildirStore(temp, "INBOX").WalkMails(MailFolder{Name: "INBOX", Path: ""}, func(mail Mail) error {
+		aggregator.Aggregate(mailInfo{size: mail.Size, time: mail.Time, flags: mail.Flags, path: mail.Path})
+		return nil
+	})
 
 	// ASSERT
 	require.NoError(t, err)
@@ -485,7 +686,10 @@ func TestAggregateMailFolder_SubFolderNotFound(t *testing.T) {
 	// ACT
 	aggregator := NewFolderAggregator()
 	aggregator.StartMailFolder("INBOX")
-	err := aggregateMailFolder(temp, false, aggregator)
+	err := NewMaildirStore(temp, "INBOX").WalkMails(MailFolder{Name: "INBOX", Path: ""}, func(mail Mail) error {
+		aggregator.Aggregate(mailInfo{size: mail.Size, time: mail.Time, flags: mail.Flags, path: mail.Path})
+		return nil
+	})
 
 	// ASSERT
 	require.Error(t, err)
@@ -511,7 +715,11 @@ func TestAggregateMailFolder_SubFolderNotFound_Skip(t *testing.T) {
 	// ACT
 	aggregator := NewFolderAggregator()
 	aggregator.StartMailFolder("INBOX")
-	err := aggregateMailFolder(temp, true, aggregator) // 存在しなくてもスキップするよう指定
+	// INBOX以外のフォルダは、new、curが存在しなくてもスキップ
+	err := NewMaildirStore(filepath.Dir(temp), "INBOX").WalkMails(MailFolder{Name: "INBOX", Path: filepath.Base(temp)}, func(mail Mail) error {
+		aggregator.Aggregate(mailInfo{size: mail.Size, time: mail.Time, flags: mail.Flags, path: mail.Path})
+		return nil
+	})
 
 	// ASSERT
 	require.NoError(t, err)
@@ -566,6 +774,21 @@ func TestMailInfoOf(t *testing.T) {
 		// ASSERT
 		assert.Equal(t, int64(1), mail.size)
 		assert.Equal(t, "2017-04-11T20:16:33Z", mail.time.Format(time.RFC3339))
+		assert.Equal(t, "", mail.flags)
+	}
+
+	{
+		// ARRANGE
+		// -> フラグ付き
+		fileInfo := createFile(t, filepath.Join(temp, "1491941793.10000000.example.com:2,FS"), "12")
+
+		// ACT
+		mail := mailInfoOf(fileInfo)
+
+		// ASSERT
+		assert.Equal(t, int64(2), mail.size)
+		assert.Equal(t, "2017-04-11T20:16:33Z", mail.time.Format(time.RFC3339))
+		assert.Equal(t, "FS", mail.flags)
 	}
 
 	{
@@ -595,6 +818,13 @@ func TestMailInfoOf(t *testing.T) {
 	}
 }
 
+func TestMailFlags(t *testing.T) {
+
+	assert.Equal(t, "ST", mailFlags("1674617693.M958571P8888.localhost.localdomain,S=545,W=562:2,ST"))
+	assert.Equal(t, "", mailFlags("1674617693.M958571P8888.localhost.localdomain,S=545,W=562:2,"))
+	assert.Equal(t, "", mailFlags("1674617693.M958571P8888.localhost.localdomain"))
+}
+
 func createDir(t *testing.T, parent string, name string) string {
 
 	dir := filepath.Join(parent, name)
@@ -0,0 +1,283 @@
+package maildir
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 1メールのヘッダとして保持する上限(これを超えた部分は読み捨てる)
+const maxMboxHeaderSize = 256 * 1024
+
+// From_行の日時の形式
+// 例: From user@example.com Sat Jan  1 00:00:00 2022
+var mboxTimeLayouts = []string{
+	"Mon Jan 2 15:04:05 2006",
+	"Mon Jan 2 15:04:05 2006 -0700",
+	"Mon Jan 2 15:04:05 -0700 2006",
+	"Mon Jan 2 15:04:05 MST 2006",
+	"Mon Jan 2 15:04 2006",
+}
+
+// mboxファイルの格納場所
+// INBOXなどの1ファイル、もしくはフォルダ毎のmboxファイルを置いたディレクトリ
+type MboxStore struct {
+	filePath       string
+	mailFolderName string
+	dirPath        string
+}
+
+// 1つのmboxファイルを指定した名前のフォルダとして扱う
+func NewMboxFileStore(mboxPath string, mailFolderName string) *MboxStore {
+	return &MboxStore{
+		filePath:       mboxPath,
+		mailFolderName: mailFolderName,
+	}
+}
+
+// ディレクトリ内のmboxファイルを、ファイル名(拡張子 .mbox は除く)をフォルダ名として扱う
+// mbox形式でないファイルは対象外
+func NewMboxDirStore(mboxDirPath string) *MboxStore {
+	return &MboxStore{
+		dirPath: mboxDirPath,
+	}
+}
+
+func (s *MboxStore) MailFolders() []MailFolder {
+
+	if s.dirPath == "" {
+		return []MailFolder{{Name: s.mailFolderName, Path: s.filePath}}
+	}
+
+	entries, err := os.ReadDir(s.dirPath)
+	if err != nil {
+		return []MailFolder{{Name: "", Err: err}}
+	}
+
+	folders := []MailFolder{}
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		mboxPath := filepath.Join(s.dirPath, entry.Name())
+		mailFolderName := strings.TrimSuffix(entry.Name(), ".mbox")
+
+		isMbox, err := isMboxFile(mboxPath)
+		if err != nil {
+			folders = append(folders, MailFolder{Name: mailFolderName, Err: err})
+			continue
+		}
+		if !isMbox {
+			continue
+		}
+
+		folders = append(folders, MailFolder{Name: mailFolderName, Path: mboxPath})
+	}
+
+	return folders
+}
+
+func (s *MboxStore) WalkMails(folder MailFolder, fn func(mail Mail) error) error {
+	return walkMbox(folder.Path, fn)
+}
+
+// mbox内の1メール
+type mboxMessage struct {
+	path     string
+	start    int64 // From_行の次の行の位置
+	time     time.Time
+	header   bytes.Buffer
+	inHeader bool
+}
+
+// mboxファイルをメールに分割する
+// 空行の後(もしくはファイル先頭)の "From " で始まる行を区切りとし、日時はFrom_行から取得する
+func walkMbox(mboxPath string, fn func(mail Mail) error) error {
+
+	file, err := os.Open(mboxPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReaderSize(file, 64*1024)
+
+	var current *mboxMessage
+	offset := int64(0)
+	lineStart := true
+	// 直前の行が空行の場合はそのサイズ、空行以外の場合は-1
+	// ファイル先頭も区切りとみなせるように0から始める
+	prevBlankSize := int64(0)
+
+	finish := func(end int64) error {
+		if current == nil {
+			return nil
+		}
+		if prevBlankSize > 0 {
+			// 区切りの空行はメールに含めない
+			end -= prevBlankSize
+		}
+		return fn(current.mail(end - current.start))
+	}
+
+	for {
+		// 長い行でもバッファを超えて読み込まないように、ReadSliceで行の途中までを扱う
+		line, err := reader.ReadSlice('\n')
+		if err != nil && err != bufio.ErrBufferFull && err != io.EOF {
+			return err
+		}
+
+		if len(line) > 0 {
+			if lineStart && prevBlankSize >= 0 && bytes.HasPrefix(line, []byte("From ")) {
+				if err := finish(offset); err != nil {
+					return err
+				}
+				current = &mboxMessage{
+					path:     mboxPath,
+					start:    offset + int64(len(line)),
+					time:     mboxTime(string(line)),
+					inHeader: true,
+				}
+			} else if current != nil && current.inHeader {
+				if lineStart && isBlankLine(line) {
+					current.inHeader = false
+				} else if current.header.Len() < maxMboxHeaderSize {
+					current.header.Write(line)
+				}
+			}
+
+			complete := line[len(line)-1] == '\n'
+			if complete && lineStart && isBlankLine(line) {
+				prevBlankSize = int64(len(line))
+			} else {
+				prevBlankSize = -1
+			}
+			lineStart = complete
+			offset += int64(len(line))
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	return finish(offset)
+}
+
+func isBlankLine(line []byte) bool {
+	return len(bytes.TrimRight(line, "\r\n")) == 0
+}
+
+func (m *mboxMessage) mail(size int64) Mail {
+
+	return Mail{
+		Size:  size,
+		Time:  m.time,
+		Flags: mboxFlags(m.header.Bytes()),
+		// 同じファイル内のメールを区別できるように、先頭からの位置を付けておく
+		Path: m.path + "#" + strconv.FormatInt(m.start, 10),
+		Open: sectionOpener(m.path, m.start, size),
+	}
+}
+
+// ファイルの一部分をメールの内容として読み込む
+func sectionOpener(path string, start int64, size int64) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		return &sectionReadCloser{
+			SectionReader: io.NewSectionReader(file, start, size),
+			file:          file,
+		}, nil
+	}
+}
+
+type sectionReadCloser struct {
+	*io.SectionReader
+	file *os.File
+}
+
+func (r *sectionReadCloser) Close() error {
+	return r.file.Close()
+}
+
+// From_行から日時を取得する
+// 解釈できない場合は、Maildirでファイル名から取得できなかった場合と同じくUnix時間の0とする
+func mboxTime(fromLine string) time.Time {
+
+	// 先頭の"From"と送信者を除いた部分が日時
+	fields := strings.Fields(fromLine)
+	if len(fields) >= 3 {
+		// 日の部分が1桁の場合に空白が2つになっているものがあるので、空白を揃えてから解析する
+		value := strings.Join(fields[2:], " ")
+		for _, layout := range mboxTimeLayouts {
+			if t, err := time.Parse(layout, value); err == nil {
+				return t.UTC()
+			}
+		}
+	}
+
+	return time.Unix(0, 0).UTC()
+}
+
+// Status、X-Statusヘッダから、Maildirのフラグに変換する
+// Status: R(既読) -> S
+// X-Status: A(返信済) -> R, F(フラグ) -> F, D(削除) -> T, T(下書き) -> D
+func mboxFlags(header []byte) string {
+
+	flags := []string{}
+	for _, line := range strings.Split(string(header), "\n") {
+		name, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		value = strings.TrimSpace(value)
+
+		switch strings.ToLower(name) {
+		case "status":
+			if strings.Contains(value, "R") {
+				flags = append(flags, "S")
+			}
+		case "x-status":
+			for mboxFlag, maildirFlag := range map[string]string{"A": "R", "F": "F", "D": "T", "T": "D"} {
+				if strings.Contains(value, mboxFlag) {
+					flags = append(flags, maildirFlag)
+				}
+			}
+		}
+	}
+
+	// Maildirと同じくアルファベット順に
+	sort.Strings(flags)
+	return strings.Join(flags, "")
+}
+
+// 空のファイル、もしくは "From " で始まるファイルをmboxとみなす
+func isMboxFile(path string) (bool, error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	head := make([]byte, 5)
+	n, err := io.ReadFull(file, head)
+	if err == io.EOF {
+		return true, nil
+	}
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return false, err
+	}
+
+	return string(head[:n]) == "From ", nil
+}
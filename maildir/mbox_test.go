@@ -0,0 +1,255 @@
+package maildir
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testMboxFromA    = "From a@example.com Sat Jan  1 00:00:00 2022\n"
+	testMboxMessageA = "Subject: a\nStatus: RO\n\nbody\nFrom here is not separator\n"
+	testMboxFromB    = "From b@example.com Sun Jan  2 10:20:30 2022 +0900\n"
+	testMboxMessageB = "Subject: b\nStatus: RO\nX-Status: AF\n\nbody b\n"
+	testMboxFromC    = "From c@example.com\n"
+	testMboxMessageC = "Subject: c\n\nc\n"
+)
+
+func TestAggregateMbox(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	mboxPath := filepath.Join(temp, "inbox")
+	createFile(t, mboxPath,
+		testMboxFromA+testMboxMessageA+"\n"+
+			testMboxFromB+testMboxMessageB+"\n"+
+			testMboxFromC+testMboxMessageC+"\n")
+
+	aggregator := NewSelectAggregator(SelectCondition{})
+
+	// ACT
+	err := AggregateMailStore(NewMboxFileStore(mboxPath, "INBOX"), aggregator)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	offsetA := len(testMboxFromA)
+	offsetB := offsetA + len(testMboxMessageA) + 1 + len(testMboxFromB)
+	offsetC := offsetB + len(testMboxMessageB) + 1 + len(testMboxFromC)
+
+	assert.Equal(
+		t,
+		[]*SelectedMail{
+			{MailFolderName: "INBOX", Path: mboxPath + "#" + strconv.Itoa(offsetA), Size: int64(len(testMboxMessageA)), Time: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)},
+			{MailFolderName: "INBOX", Path: mboxPath + "#" + strconv.Itoa(offsetB), Size: int64(len(testMboxMessageB)), Time: time.Date(2022, 1, 2, 1, 20, 30, 0, time.UTC)},
+			{MailFolderName: "INBOX", Path: mboxPath + "#" + strconv.Itoa(offsetC), Size: int64(len(testMboxMessageC)), Time: time.Unix(0, 0).UTC()},
+		},
+		aggregator.Results())
+}
+
+func TestAggregateMbox_Flags(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	mboxPath := filepath.Join(temp, "inbox")
+	createFile(t, mboxPath,
+		testMboxFromA+testMboxMessageA+"\n"+
+			testMboxFromB+testMboxMessageB)
+
+	aggregator := NewSelectAggregator(SelectCondition{Flags: "FRS"})
+
+	// ACT
+	err := AggregateMailStore(NewMboxFileStore(mboxPath, "INBOX"), aggregator)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	results := aggregator.Results()
+	require.Len(t, results, 1)
+	assert.Equal(t, int64(len(testMboxMessageB)), results[0].Size)
+}
+
+func TestAggregateMbox_Header(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	mboxPath := filepath.Join(temp, "inbox")
+	createFile(t, mboxPath,
+		testMboxFromA+"From: A <a@example.com>\n"+testMboxMessageA+"\n"+
+			testMboxFromB+"From: b@example.net\n"+testMboxMessageB)
+
+	aggregator := NewSenderDomainAggregator()
+
+	// ACT
+	err := AggregateMailStore(NewMboxFileStore(mboxPath, "INBOX"), aggregator)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	results := aggregator.Results()
+	SortByName(results)
+	assert.Equal(
+		t,
+		[]*AggregateResult{
+			{Name: "example.com", Count: 1, TotalSize: int64(len("From: A <a@example.com>\n" + testMboxMessageA))},
+			{Name: "example.net", Count: 1, TotalSize: int64(len("From: b@example.net\n" + testMboxMessageB))},
+		},
+		results)
+}
+
+func TestAggregateMbox_Open(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	mboxPath := filepath.Join(temp, "inbox")
+	createFile(t, mboxPath,
+		testMboxFromA+testMboxMessageA+"\n"+
+			testMboxFromB+testMboxMessageB)
+
+	mails := []mailInfo{}
+	aggregator := &funcAggregator{aggregate: func(mail mailInfo) { mails = append(mails, mail) }}
+
+	// ACT
+	err := AggregateMailStore(NewMboxFileStore(mboxPath, "INBOX"), aggregator)
+
+	// ASSERT
+	require.NoError(t, err)
+	require.Len(t, mails, 2)
+
+	for i, expected := range []string{testMboxMessageA, testMboxMessageB} {
+		content, err := mails[i].openContent()
+		require.NoError(t, err)
+		data, err := io.ReadAll(content)
+		require.NoError(t, err)
+		content.Close()
+
+		assert.Equal(t, expected, string(data))
+	}
+}
+
+func TestAggregateMbox_Empty(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	mboxPath := filepath.Join(temp, "inbox")
+	createFile(t, mboxPath, "")
+
+	aggregator := NewSelectAggregator(SelectCondition{})
+
+	// ACT
+	err := AggregateMailStore(NewMboxFileStore(mboxPath, "INBOX"), aggregator)
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Empty(t, aggregator.Results())
+}
+
+func TestAggregateMbox_NotFound(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	mboxPath := filepath.Join(temp, "inbox")
+
+	aggregator := NewSelectAggregator(SelectCondition{})
+
+	// ACT
+	err := AggregateMailStore(NewMboxFileStore(mboxPath, "INBOX"), aggregator)
+
+	// ASSERT
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "open "+mboxPath)
+}
+
+func TestAggregateMboxFolders(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	createFile(t, filepath.Join(temp, "Sent.mbox"), testMboxFromA+testMboxMessageA)
+	createFile(t, filepath.Join(temp, "Trash"), testMboxFromA+testMboxMessageA+"\n"+testMboxFromB+testMboxMessageB)
+	createFile(t, filepath.Join(temp, "Empty"), "")
+	createFile(t, filepath.Join(temp, "Trash.msf"), "// index") // mbox以外は対象外
+	createFile(t, filepath.Join(temp, ".hidden"), testMboxFromA+testMboxMessageA)
+	createDir(t, temp, "Sub.sbd")
+
+	aggregator := NewFolderAggregator()
+
+	// ACT
+	err := AggregateMailStore(NewMboxDirStore(temp), aggregator)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	results := aggregator.Results()
+	SortByName(results)
+	assert.Equal(
+		t,
+		[]*AggregateResult{
+			{Name: "Empty", Count: 0, TotalSize: 0},
+			{Name: "Sent", Count: 1, TotalSize: int64(len(testMboxMessageA))},
+			{Name: "Trash", Count: 2, TotalSize: int64(len(testMboxMessageA) + len(testMboxMessageB))},
+		},
+		results)
+}
+
+func TestMboxTime(t *testing.T) {
+
+	tests := []struct {
+		line     string
+		expected time.Time
+	}{
+		{"From a@example.com Sat Jan  1 00:00:00 2022\n", time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"From a@example.com Sat Jan 1 09:00:00 2022 +0900\n", time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"From a@example.com Sat Jan 1 09:00:00 +0900 2022\n", time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"From a@example.com Sat Jan 1 00:00:00 UTC 2022\n", time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"From MAILER-DAEMON Sat Jan 15 12:34 2022\r\n", time.Date(2022, 1, 15, 12, 34, 0, 0, time.UTC)},
+		{"From a@example.com\n", time.Unix(0, 0).UTC()},
+		{"From a@example.com yesterday\n", time.Unix(0, 0).UTC()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			assert.Equal(t, tt.expected, mboxTime(tt.line))
+		})
+	}
+}
+
+func TestMboxFlags(t *testing.T) {
+
+	assert.Equal(t, "", mboxFlags([]byte("Subject: a\n")))
+	assert.Equal(t, "", mboxFlags([]byte("Status: O\n")))
+	assert.Equal(t, "S", mboxFlags([]byte("Status: RO\n")))
+	assert.Equal(t, "DFRST", mboxFlags([]byte("Status: RO\r\nX-Status: ADFT\r\n")))
+}
+
+func TestIsMboxFile(t *testing.T) {
+
+	temp := t.TempDir()
+
+	for name, content := range map[string]string{"empty": "", "mbox": "From a\n", "short": "Fro", "other": "Subject: a\n"} {
+		createFile(t, filepath.Join(temp, name), content)
+	}
+
+	for name, expected := range map[string]bool{"empty": true, "mbox": true, "short": false, "other": false} {
+		isMbox, err := isMboxFile(filepath.Join(temp, name))
+		require.NoError(t, err)
+		assert.Equal(t, expected, isMbox, name)
+	}
+
+	_, err := isMboxFile(filepath.Join(temp, "notfound"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+// テスト用に集計内容を受け取る
+type funcAggregator struct {
+	aggregate func(mail mailInfo)
+}
+
+func (a *funcAggregator) StartUser(userName string)             {}
+func (a *funcAggregator) StartMailFolder(mailFolderName string) {}
+func (a *funcAggregator) Aggregate(mail mailInfo)               { a.aggregate(mail) }
@@ -29,3 +29,33 @@ func (a *MultiAggregator) Aggregate(mail mailInfo) {
 		aggregator.Aggregate(mail)
 	}
 }
+
+func (a *MultiAggregator) NeedsHeader() bool {
+
+	for _, aggregator := range a.aggregators {
+		if needsHeader(aggregator) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *MultiAggregator) NeedsAttachments() bool {
+
+	for _, aggregator := range a.aggregators {
+		if needsAttachments(aggregator) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *MultiAggregator) NeedsMailFolder(mailFolderName string) bool {
+
+	for _, aggregator := range a.aggregators {
+		if needsMailFolder(aggregator, mailFolderName) {
+			return true
+		}
+	}
+	return false
+}
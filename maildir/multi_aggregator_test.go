@@ -82,3 +82,26 @@ func TestAggregateMailFolders_MultiAggregator(t *testing.T) {
 		)
 	}
 }
+
+func TestMultiAggregator_NeedsHeader(t *testing.T) {
+
+	assert.False(t, NewMultiAggregator([]Aggregator{NewFolderAggregator(), NewMonthAggregator()}).NeedsHeader())
+	assert.True(t, NewMultiAggregator([]Aggregator{NewFolderAggregator(), NewSenderAggregator()}).NeedsHeader())
+	assert.False(t, NewMultiAggregator([]Aggregator{NewDuplicateAggregator(ContentHashKey)}).NeedsHeader())
+	assert.True(t, NewMultiAggregator([]Aggregator{NewMultiAggregator([]Aggregator{NewDuplicateAggregator(MessageIDKey)})}).NeedsHeader())
+}
+
+func TestMultiAggregator_NeedsMailFolder(t *testing.T) {
+
+	selectAggregator := NewSelectAggregator(SelectCondition{MailFolderNames: []string{"Trash"}})
+	assert.True(t, NewMultiAggregator([]Aggregator{selectAggregator}).NeedsMailFolder("Trash"))
+	assert.False(t, NewMultiAggregator([]Aggregator{selectAggregator}).NeedsMailFolder("INBOX"))
+	assert.True(t, NewMultiAggregator([]Aggregator{selectAggregator, NewFolderAggregator()}).NeedsMailFolder("INBOX"))
+}
+
+func TestMultiAggregator_NeedsAttachments(t *testing.T) {
+
+	assert.False(t, NewMultiAggregator([]Aggregator{NewFolderAggregator(), NewSenderAggregator()}).NeedsAttachments())
+	assert.True(t, NewMultiAggregator([]Aggregator{NewFolderAggregator(), NewAttachmentAggregator()}).NeedsAttachments())
+	assert.True(t, NewMultiAggregator([]Aggregator{NewMultiAggregator([]Aggregator{NewAttachmentAggregator()})}).NeedsAttachments())
+}
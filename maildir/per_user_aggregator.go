@@ -0,0 +1,54 @@
+package maildir
+
+// ユーザ毎に、別々のAggregatorで集計する
+// (ユーザ毎のフォルダ、月毎の集計など)
+type PerUserAggregator[T Aggregator] struct {
+	newAggregator func() T
+	results       []*PerUserResult[T]
+	current       *PerUserResult[T]
+}
+
+type PerUserResult[T Aggregator] struct {
+	UserName   string
+	Aggregator T
+}
+
+func NewPerUserAggregator[T Aggregator](newAggregator func() T) *PerUserAggregator[T] {
+	return &PerUserAggregator[T]{
+		newAggregator: newAggregator,
+		results:       []*PerUserResult[T]{},
+	}
+}
+
+func (a *PerUserAggregator[T]) StartUser(userName string) {
+	a.current = &PerUserResult[T]{
+		UserName:   userName,
+		Aggregator: a.newAggregator(),
+	}
+	a.current.Aggregator.StartUser(userName)
+	a.results = append(a.results, a.current)
+}
+
+func (a *PerUserAggregator[T]) StartMailFolder(mailFolderName string) {
+	a.current.Aggregator.StartMailFolder(mailFolderName)
+}
+
+func (a *PerUserAggregator[T]) Aggregate(mail mailInfo) {
+	a.current.Aggregator.Aggregate(mail)
+}
+
+func (a *PerUserAggregator[T]) NeedsHeader() bool {
+	return needsHeader(a.newAggregator())
+}
+
+func (a *PerUserAggregator[T]) NeedsAttachments() bool {
+	return needsAttachments(a.newAggregator())
+}
+
+func (a *PerUserAggregator[T]) NeedsMailFolder(mailFolderName string) bool {
+	return needsMailFolder(a.newAggregator(), mailFolderName)
+}
+
+func (a *PerUserAggregator[T]) Results() []*PerUserResult[T] {
+	return a.results
+}
@@ -0,0 +1,103 @@
+package maildir
+
+import (
+	"testing"
+
+	"github.com/onozaty/maildir-stats/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregateUsers_PerUserAggregator(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	user1 := createDir(t, temp, "user1")
+	{
+		maildir := createDir(t, user1, "Maildir")
+		createMailFolder(t, maildir, []mail{
+			{"new/1675209600", 1}, // 2023-02-01
+			{"cur/1677542400", 2}, // 2023-02-28
+		})
+		sub := createDir(t, maildir, ".A")
+		createMailFolder(t, sub, []mail{
+			{"cur/1672531200", 3}, // 2023-01-01
+		})
+	}
+	user2 := createDir(t, temp, "user2")
+	{
+		maildir := createDir(t, user2, "Maildir")
+		createMailFolder(t, maildir, []mail{
+			{"cur/1672531200", 4}, // 2023-01-01
+		})
+	}
+
+	users := []user.User{
+		{Name: "user1", HomeDir: user1},
+		{Name: "user2", HomeDir: user2},
+	}
+
+	// ACT
+	folderAggregator := NewPerUserAggregator(NewFolderAggregator)
+	monthAggregator := NewPerUserAggregator(NewMonthAggregator)
+	err := AggregateUsers(users, "Maildir", "INBOX", NewMultiAggregator([]Aggregator{folderAggregator, monthAggregator}))
+
+	// ASSERT
+	require.NoError(t, err)
+
+	{
+		results := folderAggregator.Results()
+		require.Len(t, results, 2)
+
+		assert.Equal(t, "user1", results[0].UserName)
+		assert.Equal(
+			t,
+			[]*AggregateResult{
+				{Name: "INBOX", Count: 2, TotalSize: 3},
+				{Name: "A", Count: 1, TotalSize: 3},
+			},
+			results[0].Aggregator.Results())
+
+		assert.Equal(t, "user2", results[1].UserName)
+		assert.Equal(
+			t,
+			[]*AggregateResult{
+				{Name: "INBOX", Count: 1, TotalSize: 4},
+			},
+			results[1].Aggregator.Results())
+	}
+	{
+		results := monthAggregator.Results()
+		require.Len(t, results, 2)
+
+		user1Results := results[0].Aggregator.Results()
+		SortByName(user1Results)
+		assert.Equal(
+			t,
+			[]*AggregateResult{
+				{Name: "2023-01", Count: 1, TotalSize: 3},
+				{Name: "2023-02", Count: 2, TotalSize: 3},
+			},
+			user1Results)
+
+		assert.Equal(
+			t,
+			[]*AggregateResult{
+				{Name: "2023-01", Count: 1, TotalSize: 4},
+			},
+			results[1].Aggregator.Results())
+	}
+}
+
+func TestPerUserAggregator_NeedsHeader(t *testing.T) {
+
+	assert.False(t, NewPerUserAggregator(NewFolderAggregator).NeedsHeader())
+	assert.True(t, NewPerUserAggregator(NewSenderAggregator).NeedsHeader())
+}
+
+func TestPerUserAggregator_NeedsAttachments(t *testing.T) {
+
+	assert.False(t, NewPerUserAggregator(NewFolderAggregator).NeedsAttachments())
+	assert.True(t, NewPerUserAggregator(NewAttachmentAggregator).NeedsAttachments())
+}
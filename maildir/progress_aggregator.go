@@ -0,0 +1,41 @@
+package maildir
+
+// 集計の進捗状況
+type Progress struct {
+	UserName  string // 集計中のユーザ
+	UserCount int    // 集計を開始したユーザ数(集計中のユーザを含む)
+	MailCount int64
+	TotalSize int64
+}
+
+// 集計結果は持たず、進捗状況の通知だけを行う
+type ProgressAggregator struct {
+	progress Progress
+	notify   func(progress Progress)
+}
+
+func NewProgressAggregator(notify func(progress Progress)) *ProgressAggregator {
+	return &ProgressAggregator{
+		notify: notify,
+	}
+}
+
+func (a *ProgressAggregator) StartUser(userName string) {
+	a.progress.UserName = userName
+	a.progress.UserCount++
+	a.notify(a.progress)
+}
+
+func (a *ProgressAggregator) StartMailFolder(mailFolderName string) {
+	// 何もしない
+}
+
+func (a *ProgressAggregator) Aggregate(mail mailInfo) {
+	a.progress.MailCount++
+	a.progress.TotalSize += mail.size
+	a.notify(a.progress)
+}
+
+func (a *ProgressAggregator) Progress() Progress {
+	return a.progress
+}
@@ -0,0 +1,49 @@
+package maildir
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregateMailFolders_ProgressAggregator(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	createMailFolder(t, temp, []mail{
+		{"new/1675209600", 1},
+		{"cur/1677628800", 2},
+	})
+	{
+		sub := createDir(t, temp, ".A")
+		createMailFolder(t, sub, []mail{
+			{"new/1677715200", 10},
+		})
+	}
+
+	notified := []Progress{}
+	aggregator := NewProgressAggregator(func(progress Progress) {
+		notified = append(notified, progress)
+	})
+
+	// ACT
+	aggregator.StartUser("user1")
+	err := AggregateMailFolders(temp, "", aggregator)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	assert.Equal(
+		t,
+		[]Progress{
+			{UserName: "user1", UserCount: 1, MailCount: 0, TotalSize: 0},
+			{UserName: "user1", UserCount: 1, MailCount: 1, TotalSize: 1},
+			{UserName: "user1", UserCount: 1, MailCount: 2, TotalSize: 3},
+			{UserName: "user1", UserCount: 1, MailCount: 3, TotalSize: 13},
+		},
+		notified,
+	)
+	assert.Equal(t, Progress{UserName: "user1", UserCount: 1, MailCount: 3, TotalSize: 13}, aggregator.Progress())
+}
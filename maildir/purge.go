@@ -0,0 +1,97 @@
+package maildir
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Maildir++のquotaファイル
+const maildirSizeFileName = "maildirsize"
+
+// メールを削除し、削除したものを監査ログに書き込む
+// 削除したのに記録が無い状態にならないよう、監査ログに書き込んでから削除し、
+// 削除できなかった場合は、それを打ち消す行(not-deleted)を書き込む
+// 削除したメールを返す(既に存在しなかったものは含まない)
+// 途中でエラーとなった場合も、それまでに削除した分はmaildirsizeに反映する
+func PurgeMails(rootMailFolderPath string, mails []*SelectedMail, auditLog io.Writer) ([]*SelectedMail, error) {
+
+	purged := []*SelectedMail{}
+
+	purgeErr := func() error {
+		for _, mail := range mails {
+			if err := writeAuditLog(auditLog, "deleted", mail); err != nil {
+				return err
+			}
+
+			if err := os.Remove(mail.Path); err != nil {
+				auditErr := writeAuditLog(auditLog, "not-deleted", mail)
+				if os.IsNotExist(err) {
+					// 既に移動、削除されている
+					if auditErr != nil {
+						return auditErr
+					}
+					continue
+				}
+				return err
+			}
+			purged = append(purged, mail)
+		}
+		return nil
+	}()
+
+	if err := updateMaildirSize(rootMailFolderPath, purged); err != nil {
+		if purgeErr == nil {
+			purgeErr = err
+		}
+	}
+
+	return purged, purgeErr
+}
+
+func writeAuditLog(auditLog io.Writer, action string, mail *SelectedMail) error {
+
+	_, err := fmt.Fprintf(auditLog, "%s\t%s\t%s\t%d\t%s\n",
+		time.Now().UTC().Format(time.RFC3339), action, mail.MailFolderName, mail.Size, mail.Path)
+	if err != nil {
+		return err
+	}
+
+	// ファイルの場合は、メールを削除する前にディスクまで書き込んでおく
+	if syncer, ok := auditLog.(interface{ Sync() error }); ok {
+		return syncer.Sync()
+	}
+	return nil
+}
+
+// maildirsizeがある場合は、削除した分を差し引く行を追記する
+func updateMaildirSize(rootMailFolderPath string, removed []*SelectedMail) error {
+
+	if len(removed) == 0 {
+		return nil
+	}
+
+	maildirSizePath := filepath.Join(rootMailFolderPath, maildirSizeFileName)
+	if _, err := os.Stat(maildirSizePath); os.IsNotExist(err) {
+		return nil
+	}
+
+	totalSize := int64(0)
+	for _, mail := range removed {
+		totalSize += mail.Size
+	}
+
+	file, err := os.OpenFile(maildirSizePath, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(file, "%d %d\n", -totalSize, -len(removed)); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
@@ -0,0 +1,115 @@
+package maildir
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPurgeMails(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	createMailFolder(t, temp, []mail{
+		{"cur/1", 1},
+		{"cur/2", 2},
+		{"cur/3", 3},
+	})
+	createFile(t, filepath.Join(temp, maildirSizeFileName), "1000000S,1000C\n6 3\n")
+
+	mails := []*SelectedMail{
+		{MailFolderName: "", Path: filepath.Join(temp, "cur", "1"), Size: 1},
+		{MailFolderName: "", Path: filepath.Join(temp, "cur", "x"), Size: 10}, // 存在しない
+		{MailFolderName: "", Path: filepath.Join(temp, "cur", "3"), Size: 3},
+	}
+
+	auditLog := new(bytes.Buffer)
+
+	// ACT
+	purged, err := PurgeMails(temp, mails, auditLog)
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(t, []*SelectedMail{mails[0], mails[2]}, purged)
+
+	assert.NoFileExists(t, filepath.Join(temp, "cur", "1"))
+	assert.FileExists(t, filepath.Join(temp, "cur", "2"))
+	assert.NoFileExists(t, filepath.Join(temp, "cur", "3"))
+
+	lines := regexp.MustCompile(`(?m)^\S+\t`).ReplaceAllString(auditLog.String(), "") // 日時部分は除いて比較
+	assert.Equal(
+		t,
+		"deleted\t\t1\t"+filepath.Join(temp, "cur", "1")+"\n"+
+			"deleted\t\t10\t"+filepath.Join(temp, "cur", "x")+"\n"+
+			"not-deleted\t\t10\t"+filepath.Join(temp, "cur", "x")+"\n"+
+			"deleted\t\t3\t"+filepath.Join(temp, "cur", "3")+"\n",
+		lines)
+
+	maildirSize, err := os.ReadFile(filepath.Join(temp, maildirSizeFileName))
+	require.NoError(t, err)
+	assert.Equal(t, "1000000S,1000C\n6 3\n-4 -2\n", string(maildirSize))
+}
+
+func TestPurgeMails_NoMaildirSize(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	createMailFolder(t, temp, []mail{
+		{"cur/1", 1},
+	})
+
+	mails := []*SelectedMail{
+		{MailFolderName: "", Path: filepath.Join(temp, "cur", "1"), Size: 1},
+	}
+
+	auditLog := new(bytes.Buffer)
+
+	// ACT
+	purged, err := PurgeMails(temp, mails, auditLog)
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(t, mails, purged)
+	assert.NoFileExists(t, filepath.Join(temp, "cur", "1"))
+	// maildirsizeが無い場合は作成しない
+	assert.NoFileExists(t, filepath.Join(temp, maildirSizeFileName))
+}
+
+func TestPurgeMails_AuditLogError(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	createMailFolder(t, temp, []mail{
+		{"cur/1", 1},
+	})
+
+	mails := []*SelectedMail{
+		{MailFolderName: "", Path: filepath.Join(temp, "cur", "1"), Size: 1},
+	}
+
+	// ACT
+	purged, err := PurgeMails(temp, mails, &errorWriter{errors.New("disk full")})
+
+	// ASSERT
+	require.EqualError(t, err, "disk full")
+	assert.Empty(t, purged)
+	// 監査ログに書き込めなかったものは削除しない
+	assert.FileExists(t, filepath.Join(temp, "cur", "1"))
+}
+
+type errorWriter struct {
+	err error
+}
+
+func (w *errorWriter) Write(p []byte) (int, error) {
+	return 0, w.err
+}
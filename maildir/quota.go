@@ -0,0 +1,80 @@
+package maildir
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Maildir++のquota定義(0は無制限)
+type MaildirQuota struct {
+	Size  int64
+	Count int64
+}
+
+// maildirsizeの1行目から、quota定義を読み込む
+// 例: 1073741824S,10000C
+func ReadMaildirQuota(rootMailFolderPath string) (*MaildirQuota, error) {
+
+	path := filepath.Join(rootMailFolderPath, maildirSizeFileName)
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%s is invalid maildirsize: empty", path)
+	}
+
+	quota := &MaildirQuota{}
+	for _, field := range strings.Split(strings.TrimSpace(scanner.Text()), ",") {
+		if field == "" {
+			continue
+		}
+
+		value, err := strconv.ParseInt(field[:len(field)-1], 10, 64)
+		if err != nil || value < 0 {
+			return nil, fmt.Errorf("%s is invalid maildirsize: quota '%s'", path, field)
+		}
+
+		switch field[len(field)-1] {
+		case 'S':
+			quota.Size = value
+		case 'C':
+			quota.Count = value
+		default:
+			return nil, fmt.Errorf("%s is invalid maildirsize: quota '%s'", path, field)
+		}
+	}
+
+	return quota, nil
+}
+
+// quotaに対する使用率(%)
+// サイズと件数の両方が定義されている場合は、大きい方を返す
+// quotaが定義されていない場合は、okがfalse
+func (q *MaildirQuota) UsagePercent(size int64, count int64) (percent float64, ok bool) {
+
+	if q.Size > 0 {
+		percent = float64(size) * 100 / float64(q.Size)
+		ok = true
+	}
+	if q.Count > 0 {
+		countPercent := float64(count) * 100 / float64(q.Count)
+		if !ok || countPercent > percent {
+			percent = countPercent
+		}
+		ok = true
+	}
+
+	return percent, ok
+}
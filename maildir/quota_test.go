@@ -0,0 +1,100 @@
+package maildir
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadMaildirQuota(t *testing.T) {
+
+	tests := []struct {
+		content  string
+		expected MaildirQuota
+	}{
+		{"1000S,10C\n1000 10\n", MaildirQuota{Size: 1000, Count: 10}},
+		{"1000S\n", MaildirQuota{Size: 1000}},
+		{"10C", MaildirQuota{Count: 10}},
+		{"\n100 1\n", MaildirQuota{}},
+	}
+
+	for _, tt := range tests {
+		// ARRANGE
+		temp := t.TempDir()
+		createFile(t, filepath.Join(temp, "maildirsize"), tt.content)
+
+		// ACT
+		quota, err := ReadMaildirQuota(temp)
+
+		// ASSERT
+		require.NoError(t, err)
+		assert.Equal(t, tt.expected, *quota)
+	}
+}
+
+func TestReadMaildirQuota_Invalid(t *testing.T) {
+
+	tests := []struct {
+		content string
+		message string
+	}{
+		{"", "is invalid maildirsize: empty"},
+		{"1000X\n", "is invalid maildirsize: quota '1000X'"},
+		{"xS\n", "is invalid maildirsize: quota 'xS'"},
+		{"-1S\n", "is invalid maildirsize: quota '-1S'"},
+	}
+
+	for _, tt := range tests {
+		// ARRANGE
+		temp := t.TempDir()
+		path := filepath.Join(temp, "maildirsize")
+		createFile(t, path, tt.content)
+
+		// ACT
+		_, err := ReadMaildirQuota(temp)
+
+		// ASSERT
+		require.EqualError(t, err, path+" "+tt.message)
+	}
+}
+
+func TestReadMaildirQuota_NotFound(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	// ACT
+	_, err := ReadMaildirQuota(temp)
+
+	// ASSERT
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestMaildirQuota_UsagePercent(t *testing.T) {
+
+	tests := []struct {
+		quota   MaildirQuota
+		size    int64
+		count   int64
+		percent float64
+		ok      bool
+	}{
+		{MaildirQuota{Size: 1000, Count: 10}, 500, 8, 80, true},
+		{MaildirQuota{Size: 1000, Count: 10}, 900, 1, 90, true},
+		{MaildirQuota{Size: 1000}, 250, 100, 25, true},
+		{MaildirQuota{Count: 10}, 250, 5, 50, true},
+		{MaildirQuota{}, 250, 5, 0, false},
+	}
+
+	for _, tt := range tests {
+		// ACT
+		percent, ok := tt.quota.UsagePercent(tt.size, tt.count)
+
+		// ASSERT
+		assert.Equal(t, tt.percent, percent)
+		assert.Equal(t, tt.ok, ok)
+	}
+}
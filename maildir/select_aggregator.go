@@ -0,0 +1,148 @@
+package maildir
+
+import (
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slices"
+)
+
+// 対象とするメールの条件
+type SelectCondition struct {
+	MailFolderNames []string  // 対象のメールフォルダ(空の場合は全て)
+	Before          time.Time // この日時より前のもの(ゼロ値の場合は日時で絞り込まない)
+	Flags           string    // 全て付いているもの(例: "T" -> 削除フラグ付き)
+}
+
+type SelectedMail struct {
+	MailFolderName string
+	Path           string
+	Size           int64
+	Time           time.Time
+}
+
+// 条件に一致するメールを集める
+type SelectAggregator struct {
+	condition       SelectCondition
+	mailFolderName  string
+	selected        bool
+	mailFolderNames []string // 辿った対象のメールフォルダ
+	results         []*SelectedMail
+}
+
+func NewSelectAggregator(condition SelectCondition) *SelectAggregator {
+	return &SelectAggregator{
+		condition:       condition,
+		mailFolderNames: []string{},
+		results:         []*SelectedMail{},
+	}
+}
+
+func (a *SelectAggregator) StartUser(userName string) {
+	// 何もしない
+}
+
+func (a *SelectAggregator) StartMailFolder(mailFolderName string) {
+	a.mailFolderName = mailFolderName
+	a.selected = a.NeedsMailFolder(mailFolderName)
+	if a.selected {
+		a.mailFolderNames = append(a.mailFolderNames, mailFolderName)
+	}
+}
+
+func (a *SelectAggregator) NeedsMailFolder(mailFolderName string) bool {
+	return len(a.condition.MailFolderNames) == 0 || slices.Contains(a.condition.MailFolderNames, mailFolderName)
+}
+
+func (a *SelectAggregator) Aggregate(mail mailInfo) {
+
+	if !a.selected {
+		return
+	}
+
+	if !a.condition.Before.IsZero() {
+		// 日時が不明なものは、古いかどうか判断できないので対象外
+		if mail.time.Unix() == 0 || !mail.time.Before(a.condition.Before) {
+			return
+		}
+	}
+
+	for _, flag := range a.condition.Flags {
+		if !strings.ContainsRune(mail.flags, flag) {
+			return
+		}
+	}
+
+	a.results = append(a.results, &SelectedMail{
+		MailFolderName: a.mailFolderName,
+		Path:           mail.path,
+		Size:           mail.size,
+		Time:           mail.time,
+	})
+}
+
+func (a *SelectAggregator) Results() []*SelectedMail {
+	return a.results
+}
+
+// 辿った対象のメールフォルダの名前(条件に一致するメールが無かったものも含む)
+func (a *SelectAggregator) MailFolderNames() []string {
+	return a.mailFolderNames
+}
+
+// メールフォルダ毎に集計した結果
+func (a *SelectAggregator) FolderResults() []*AggregateResult {
+	return FolderResultsOf(a.results)
+}
+
+func FolderResultsOf(mails []*SelectedMail) []*AggregateResult {
+
+	resultByFolder := map[string]*AggregateResult{}
+	for _, mail := range mails {
+		addResult(resultByFolder, mail.MailFolderName, mail.Size)
+	}
+
+	return resultsOf(resultByFolder)
+}
+
+// 年毎に集計した結果
+func YearResultsOf(mails []*SelectedMail) []*AggregateResult {
+	return timeResultsOf(mails, yearName)
+}
+
+// 月毎に集計した結果
+func MonthResultsOf(mails []*SelectedMail) []*AggregateResult {
+	return timeResultsOf(mails, monthName)
+}
+
+func timeResultsOf(mails []*SelectedMail, timeToName func(time time.Time) string) []*AggregateResult {
+
+	resultByTime := map[string]*AggregateResult{}
+	for _, mail := range mails {
+		addResult(resultByTime, timeToName(mail.Time), mail.Size)
+	}
+
+	return resultsOf(resultByTime)
+}
+
+// 受信日時が指定の年のメール (YearResultsOf の結果の名前で指定、日時が不明なものは空)
+func YearMailsOf(mails []*SelectedMail, name string) []*SelectedMail {
+	return timeMailsOf(mails, name, yearName)
+}
+
+// 受信日時が指定の月のメール (MonthResultsOf の結果の名前で指定、日時が不明なものは空)
+func MonthMailsOf(mails []*SelectedMail, name string) []*SelectedMail {
+	return timeMailsOf(mails, name, monthName)
+}
+
+func timeMailsOf(mails []*SelectedMail, name string, timeToName func(time time.Time) string) []*SelectedMail {
+
+	results := []*SelectedMail{}
+	for _, mail := range mails {
+		if timeToName(mail.Time) == name {
+			results = append(results, mail)
+		}
+	}
+
+	return results
+}
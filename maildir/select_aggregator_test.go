@@ -0,0 +1,212 @@
+package maildir
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregateMailFolders_SelectAggregator(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	setupTestSelectMaildir(t, temp)
+
+	// ACT
+	aggregator := NewSelectAggregator(SelectCondition{
+		MailFolderNames: []string{"Trash", "Junk"},
+		Before:          time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC),
+	})
+	err := AggregateMailFolders(temp, "", aggregator)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	assert.Equal(
+		t,
+		[]*SelectedMail{
+			{MailFolderName: "Junk", Path: filepath.Join(temp, ".Junk", "cur", "1672531200.M2:2,S"), Size: 21, Time: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)},
+			{MailFolderName: "Trash", Path: filepath.Join(temp, ".Trash", "cur", "1640995200.M1:2,ST"), Size: 11, Time: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)},
+			{MailFolderName: "Trash", Path: filepath.Join(temp, ".Trash", "cur", "1672531200.M2:2,S"), Size: 12, Time: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)},
+		},
+		aggregator.Results(),
+	)
+
+	results := aggregator.FolderResults()
+	SortByName(results)
+	assert.Equal(
+		t,
+		[]*AggregateResult{
+			{Name: "Junk", Count: 1, TotalSize: 21},
+			{Name: "Trash", Count: 2, TotalSize: 23},
+		},
+		results,
+	)
+}
+
+func TestAggregateMailFolders_SelectAggregator_SkipFolders(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	setupTestSelectMaildir(t, temp)
+
+	// 対象外のフォルダは読めなくてもエラーにならない
+	createDir(t, temp, ".&A")
+
+	aggregator := NewSelectAggregator(SelectCondition{
+		MailFolderNames: []string{"Junk"},
+	})
+
+	// ACT
+	err := AggregateMailFolders(temp, "", aggregator)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	assert.Equal(
+		t,
+		[]*AggregateResult{
+			{Name: "Junk", Count: 1, TotalSize: 21},
+		},
+		aggregator.FolderResults())
+	assert.Equal(t, []string{"Junk"}, aggregator.MailFolderNames())
+}
+
+func TestAggregateMailFolders_SelectAggregator_Flags(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	setupTestSelectMaildir(t, temp)
+
+	// ACT
+	aggregator := NewSelectAggregator(SelectCondition{
+		Flags: "T",
+	})
+	err := AggregateMailFolders(temp, "INBOX", aggregator)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	assert.Equal(
+		t,
+		[]*SelectedMail{
+			{MailFolderName: "INBOX", Path: filepath.Join(temp, "cur", "1640995200.M1:2,FT"), Size: 1, Time: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)},
+			{MailFolderName: "Trash", Path: filepath.Join(temp, ".Trash", "cur", "1640995200.M1:2,ST"), Size: 11, Time: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)},
+		},
+		aggregator.Results(),
+	)
+}
+
+func TestAggregateMailFolders_SelectAggregator_TimeResults(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	setupTestSelectMaildir(t, temp)
+
+	aggregator := NewSelectAggregator(SelectCondition{
+		MailFolderNames: []string{"Trash"},
+	})
+	err := AggregateMailFolders(temp, "", aggregator)
+	require.NoError(t, err)
+
+	// ACT
+	yearResults := YearResultsOf(aggregator.Results())
+	monthResults := MonthResultsOf(aggregator.Results())
+
+	// ASSERT
+	SortByName(yearResults)
+	assert.Equal(
+		t,
+		[]*AggregateResult{
+			{Name: "", Count: 1, TotalSize: 14}, // 日時不明
+			{Name: "2022", Count: 1, TotalSize: 11},
+			{Name: "2023", Count: 2, TotalSize: 25},
+		},
+		yearResults,
+	)
+
+	SortByName(monthResults)
+	assert.Equal(
+		t,
+		[]*AggregateResult{
+			{Name: "", Count: 1, TotalSize: 14}, // 日時不明
+			{Name: "2022-01", Count: 1, TotalSize: 11},
+			{Name: "2023-01", Count: 1, TotalSize: 12},
+			{Name: "2023-02", Count: 1, TotalSize: 13},
+		},
+		monthResults,
+	)
+}
+
+func TestAggregateMailFolders_SelectAggregator_TimeMails(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	setupTestSelectMaildir(t, temp)
+
+	aggregator := NewSelectAggregator(SelectCondition{
+		MailFolderNames: []string{"Trash"},
+	})
+	err := AggregateMailFolders(temp, "", aggregator)
+	require.NoError(t, err)
+
+	// ACT
+	yearMails := YearMailsOf(aggregator.Results(), "2023")
+	monthMails := MonthMailsOf(aggregator.Results(), "2023-02")
+	unknownMails := MonthMailsOf(aggregator.Results(), "")
+	noMails := YearMailsOf(aggregator.Results(), "2021")
+
+	// ASSERT
+	assert.ElementsMatch(
+		t,
+		[]string{"1672531200.M2:2,S", "1675209600.M3:2,S"},
+		mailNamesOf(yearMails),
+	)
+	assert.Equal(t, []string{"1675209600.M3:2,S"}, mailNamesOf(monthMails))
+	assert.Equal(t, []string{"xxxxxxxxxx.M4:2,S"}, mailNamesOf(unknownMails)) // 日時不明
+	assert.Empty(t, noMails)
+}
+
+func mailNamesOf(mails []*SelectedMail) []string {
+
+	names := []string{}
+	for _, mail := range mails {
+		names = append(names, filepath.Base(mail.Path))
+	}
+	return names
+}
+
+func setupTestSelectMaildir(t *testing.T, rootMailFolderPath string) {
+
+	// INBOX
+	createMailFolder(t, rootMailFolderPath, []mail{
+		{"cur/1640995200.M1:2,FT", 1}, // 2022-01-01
+		{"cur/1672531200.M2:2,S", 2},  // 2023-01-01
+	})
+
+	// その他フォルダ
+	{
+		sub := createDir(t, rootMailFolderPath, ".Trash")
+		createMailFolder(t, sub, []mail{
+			{"cur/1640995200.M1:2,ST", 11}, // 2022-01-01
+			{"cur/1672531200.M2:2,S", 12},  // 2023-01-01
+			{"cur/1675209600.M3:2,S", 13},  // 2023-02-01 (対象外)
+			{"cur/xxxxxxxxxx.M4:2,S", 14},  // 日時不明 (対象外)
+		})
+	}
+	{
+		sub := createDir(t, rootMailFolderPath, ".Junk")
+		createMailFolder(t, sub, []mail{
+			{"cur/1672531200.M2:2,S", 21}, // 2023-01-01
+		})
+	}
+	{
+		sub := createDir(t, rootMailFolderPath, ".Trash.Sub")
+		createMailFolder(t, sub, []mail{
+			{"cur/1640995200.M1:2,S", 31}, // 2022-01-01 (フォルダが異なるので対象外)
+		})
+	}
+}
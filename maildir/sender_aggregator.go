@@ -0,0 +1,104 @@
+package maildir
+
+import (
+	netmail "net/mail"
+	"regexp"
+	"strings"
+)
+
+type SenderAggregator struct {
+	resultBySender map[string]*AggregateResult
+	headerToName   func(header netmail.Header) string
+}
+
+// 送信者(Fromのアドレス)毎に集計
+func NewSenderAggregator() *SenderAggregator {
+	return &SenderAggregator{
+		resultBySender: map[string]*AggregateResult{},
+		headerToName: func(header netmail.Header) string {
+			return senderAddress(header)
+		},
+	}
+}
+
+// 送信者のドメイン毎に集計
+func NewSenderDomainAggregator() *SenderAggregator {
+	return &SenderAggregator{
+		resultBySender: map[string]*AggregateResult{},
+		headerToName: func(header netmail.Header) string {
+			address := senderAddress(header)
+			if index := strings.LastIndex(address, "@"); index != -1 {
+				return address[index+1:]
+			}
+			return ""
+		},
+	}
+}
+
+func (a *SenderAggregator) StartUser(userName string) {
+	// 何もしない
+}
+
+func (a *SenderAggregator) StartMailFolder(mailFolderName string) {
+	// 何もしない
+}
+
+func (a *SenderAggregator) Aggregate(mail mailInfo) {
+
+	name := a.headerToName(mail.header)
+
+	result, ok := a.resultBySender[name]
+	if !ok {
+		result = &AggregateResult{
+			Name:      name,
+			Count:     0,
+			TotalSize: 0,
+		}
+		a.resultBySender[name] = result
+	}
+
+	result.Count++
+	result.TotalSize += mail.size
+}
+
+func (a *SenderAggregator) NeedsHeader() bool {
+	return true
+}
+
+func (a *SenderAggregator) Results() []*AggregateResult {
+
+	results := []*AggregateResult{}
+
+	for _, result := range a.resultBySender {
+		results = append(results, result)
+	}
+
+	return results
+}
+
+var angleAddrPattern = regexp.MustCompile(`<([^<>@\s]+@[^<>\s]+)>`)
+
+// Fromのアドレス部分を小文字で返す
+// 取得できない場合は空文字
+func senderAddress(header netmail.Header) string {
+
+	from := header.Get("From")
+	if from == "" {
+		return ""
+	}
+
+	if address, err := netmail.ParseAddress(from); err == nil {
+		return strings.ToLower(address.Address)
+	}
+
+	// 表示名が未知の文字コードでエンコードされている場合などは解析に失敗するので、
+	// アドレス部分だけを取り出す
+	if match := angleAddrPattern.FindStringSubmatch(from); match != nil {
+		return strings.ToLower(match[1])
+	}
+	if from := strings.TrimSpace(from); strings.Contains(from, "@") && !strings.ContainsAny(from, " <>") {
+		return strings.ToLower(from)
+	}
+
+	return ""
+}
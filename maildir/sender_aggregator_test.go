@@ -0,0 +1,92 @@
+package maildir
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregateMailFolders_SenderAggregator(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	setupTestSenderMaildir(t, temp)
+
+	// ACT
+	aggregator := NewSenderAggregator()
+	err := AggregateMailFolders(temp, "", aggregator)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	results := aggregator.Results()
+	SortByName(results)
+	assert.Equal(
+		t,
+		[]*AggregateResult{
+			{Name: "", Count: 3, TotalSize: 36},
+			{Name: "a@example.com", Count: 2, TotalSize: 61},
+			{Name: "b@example.com", Count: 1, TotalSize: 27},
+			{Name: "news@example.net", Count: 2, TotalSize: 109},
+		},
+		results,
+	)
+}
+
+func TestAggregateMailFolders_SenderDomainAggregator(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	setupTestSenderMaildir(t, temp)
+
+	// ACT
+	aggregator := NewSenderDomainAggregator()
+	err := AggregateMailFolders(temp, "", aggregator)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	results := aggregator.Results()
+	SortByName(results)
+	assert.Equal(
+		t,
+		[]*AggregateResult{
+			{Name: "", Count: 3, TotalSize: 36},
+			{Name: "example.com", Count: 3, TotalSize: 88},
+			{Name: "example.net", Count: 2, TotalSize: 109},
+		},
+		results,
+	)
+}
+
+func TestSenderAddress(t *testing.T) {
+
+	assert.Equal(t, "a@example.com", senderAddress(map[string][]string{"From": {"a@example.com"}}))
+	assert.Equal(t, "a@example.com", senderAddress(map[string][]string{"From": {"A <A@Example.com>"}}))
+	assert.Equal(t, "a@example.com", senderAddress(map[string][]string{"From": {"=?UTF-8?B?44OG44K544OI?= <a@example.com>"}}))
+	// 未知の文字コード
+	assert.Equal(t, "a@example.com", senderAddress(map[string][]string{"From": {"=?ISO-2022-JP?B?GyRCJUYlOSVIGyhC?= <a@example.com>"}}))
+	assert.Equal(t, "", senderAddress(map[string][]string{"From": {"xxxx"}}))
+	assert.Equal(t, "", senderAddress(map[string][]string{}))
+	assert.Equal(t, "", senderAddress(nil))
+}
+
+func setupTestSenderMaildir(t *testing.T, rootMailFolderPath string) {
+
+	// INBOX
+	createMailFolder(t, rootMailFolderPath, []mail{})
+	createFile(t, filepath.Join(rootMailFolderPath, "cur", "1"), "From: a@example.com\r\n\r\nbody1")
+	createFile(t, filepath.Join(rootMailFolderPath, "cur", "2"), "From: B <B@example.com>\r\n\r\n")
+	createFile(t, filepath.Join(rootMailFolderPath, "new", "3"), "From: News <news@example.net>\r\n\r\n"+"0123456789012345678901234567890123456789")
+	createFile(t, filepath.Join(rootMailFolderPath, "new", "4"), "Subject: no from\r\n\r\nbody")
+	createFile(t, filepath.Join(rootMailFolderPath, "new", "5"), "xxxxxxxxxxxx") // ヘッダとして解釈できない
+
+	// その他フォルダ
+	sub := createDir(t, rootMailFolderPath, ".A")
+	createMailFolder(t, sub, []mail{})
+	createFile(t, filepath.Join(sub, "cur", "1"), "From: \"A\" <a@example.com>\r\n\r\nbody")
+	createFile(t, filepath.Join(sub, "cur", "2"), "From: news@example.net\r\n\r\n0123456789")
+	createFile(t, filepath.Join(sub, "cur", "3"), "")
+}
@@ -0,0 +1,156 @@
+package maildir
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/onozaty/maildir-stats/user"
+)
+
+// メールの格納場所
+// Maildir++、mbox、dboxなどの形式毎に実装する
+type MailStore interface {
+	// メールフォルダの一覧
+	MailFolders() []MailFolder
+	// メールフォルダ内のメールを順に渡す
+	// fnがエラーを返した場合は、そこで中断してそのエラーを返す
+	WalkMails(folder MailFolder, fn func(mail Mail) error) error
+}
+
+type MailFolder struct {
+	Name string // フォルダ名(デコード済み)
+	Path string // 格納場所内でのフォルダの位置(実装毎に解釈)
+	Err  error  // フォルダとして扱えない場合のエラー(フォルダ名がデコードできない、一覧が取得できないなど)
+}
+
+type Mail struct {
+	Size  int64
+	Time  time.Time
+	Flags string
+	Path  string
+	Open  func() (io.ReadCloser, error) // nilの場合はPathのファイルを開く
+}
+
+type UserMailStore struct {
+	UserName string
+	Store    MailStore
+}
+
+// fs.FS上(アーカイブ内など)の、ユーザ毎のMaildir++を取得する(Maildir++が無いユーザは除く)
+// homeディレクトリは、fs.FSのルートからのパスとして扱う(/home/user1 -> home/user1)
+func UserMaildirFSStores(fsys fs.FS, users []user.User, mailDirName string, inboxFolderName string) []UserMailStore {
+
+	stores := []UserMailStore{}
+	for _, user := range users {
+
+		mailDirPath := strings.TrimPrefix(path.Join("/", user.HomeDir, mailDirName), "/")
+		if info, err := fs.Stat(fsys, mailDirPath); err != nil || !info.IsDir() {
+			continue
+		}
+
+		stores = append(stores, UserMailStore{
+			UserName: user.Name,
+			Store:    NewMaildirFSStore(fsys, mailDirPath, inboxFolderName),
+		})
+	}
+
+	return stores
+}
+
+func AggregateUserMailStoresWithErrorHandler(stores []UserMailStore, aggregator Aggregator, errorHandler ErrorHandler) error {
+
+	for _, store := range stores {
+		aggregator.StartUser(store.UserName)
+		if err := aggregateMailStore(store.UserName, store.Store, aggregator, errorHandler); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func AggregateMailStore(store MailStore, aggregator Aggregator) error {
+	return AggregateMailStoreWithErrorHandler(store, aggregator, failOnError)
+}
+
+func AggregateMailStoreWithErrorHandler(store MailStore, aggregator Aggregator, errorHandler ErrorHandler) error {
+	return aggregateMailStore("", store, aggregator, errorHandler)
+}
+
+func aggregateMailStore(userName string, store MailStore, aggregator Aggregator, errorHandler ErrorHandler) error {
+
+	handleError := func(mailFolderName string, err error) error {
+		return errorHandler(&AggregateError{
+			UserName:       userName,
+			MailFolderName: mailFolderName,
+			Err:            err,
+		})
+	}
+
+	// ヘッダの読み込みはメールを開く必要があるので、必要とされた場合のみ行う
+	readHeader := needsHeader(aggregator)
+	readAttachment := needsAttachments(aggregator)
+
+	for _, folder := range store.MailFolders() {
+		if !needsMailFolder(aggregator, folder.Name) {
+			continue
+		}
+
+		if folder.Err != nil {
+			if err := handleError(folder.Name, folder.Err); err != nil {
+				return err
+			}
+			continue
+		}
+
+		aggregator.StartMailFolder(folder.Name)
+
+		err := store.WalkMails(folder, func(mail Mail) error {
+
+			info := mailInfo{
+				size:  mail.Size,
+				time:  mail.Time,
+				flags: mail.Flags,
+				path:  mail.Path,
+				open:  mail.Open,
+			}
+
+			if readHeader {
+				header, err := readMailHeader(info)
+				if err != nil {
+					if os.IsNotExist(err) {
+						// 集計中に移動、削除されたものは対象外
+						return nil
+					}
+					return err
+				}
+				info.header = header
+			}
+
+			if readAttachment {
+				attachments, err := readAttachments(info)
+				if err != nil {
+					if os.IsNotExist(err) {
+						// 集計中に移動、削除されたものは対象外
+						return nil
+					}
+					return err
+				}
+				info.attachments = attachments
+			}
+
+			aggregator.Aggregate(info)
+			return nil
+		})
+		if err != nil {
+			if err := handleError(folder.Name, err); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
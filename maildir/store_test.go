@@ -0,0 +1,109 @@
+package maildir
+
+import (
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregateMailStore_FS(t *testing.T) {
+
+	// ARRANGE
+	mtime := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"home/user1/Maildir/new/1":                {Data: []byte("1"), ModTime: mtime},
+		"home/user1/Maildir/cur/2:2,S":            {Data: []byte("22"), ModTime: mtime},
+		"home/user1/Maildir/tmp/3":                {Data: []byte("333"), ModTime: mtime}, // tmpは対象外
+		"home/user1/Maildir/.Sent/cur/4:2,S":      {Data: []byte("4444"), ModTime: mtime},
+		"home/user1/Maildir/.&MEI-/cur/5":         {Data: []byte("55555"), ModTime: mtime},
+		"home/user1/Maildir/.Empty/maildirfolder": {Data: []byte{}, ModTime: mtime}, // new,curが無いフォルダ
+		"home/user1/Maildir/dovecot.index":        {Data: []byte("index"), ModTime: mtime},
+	}
+
+	aggregator := NewFolderAggregator()
+
+	// ACT
+	err := AggregateMailStore(NewMaildirFSStore(fsys, "home/user1/Maildir", "INBOX"), aggregator)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	results := aggregator.Results()
+	SortByName(results)
+	assert.Equal(
+		t,
+		[]*AggregateResult{
+			{Name: "Empty", Count: 0, TotalSize: 0},
+			{Name: "INBOX", Count: 2, TotalSize: 3},
+			{Name: "Sent", Count: 1, TotalSize: 4},
+			{Name: "あ", Count: 1, TotalSize: 5},
+		},
+		results)
+}
+
+func TestAggregateMailStore_FS_Header(t *testing.T) {
+
+	// ARRANGE
+	fsys := fstest.MapFS{
+		"new/1":       {Data: []byte("From: a@example.com\r\n\r\nbody")},
+		"cur/2:2,S":   {Data: []byte("From: b@example.net\r\n\r\nbody")},
+		".Sent/cur/3": {Data: []byte("From: a@example.com\r\n\r\nbody")},
+	}
+
+	aggregator := NewSenderDomainAggregator()
+
+	// ACT
+	err := AggregateMailStore(NewMaildirFSStore(fsys, "", ""), aggregator)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	results := aggregator.Results()
+	SortByName(results)
+	assert.Equal(
+		t,
+		[]*AggregateResult{
+			{Name: "example.com", Count: 2, TotalSize: 54},
+			{Name: "example.net", Count: 1, TotalSize: 27},
+		},
+		results)
+}
+
+func TestAggregateMailStore_FS_RootNotFound(t *testing.T) {
+
+	// ARRANGE
+	fsys := fstest.MapFS{}
+
+	aggregator := NewFolderAggregator()
+
+	// ACT
+	err := AggregateMailStore(NewMaildirFSStore(fsys, "xxx", "INBOX"), aggregator)
+
+	// ASSERT
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "open xxx")
+}
+
+func TestMaildirStore_MailFolders(t *testing.T) {
+
+	// ARRANGE
+	fsys := fstest.MapFS{
+		"cur/1":         {Data: []byte("1")},
+		".Sent/cur/1":   {Data: []byte("1")},
+		".&A/cur/1":     {Data: []byte("1")},
+		"dovecot.index": {Data: []byte("index")},
+	}
+
+	// ACT
+	folders := NewMaildirFSStore(fsys, "", "INBOX").MailFolders()
+
+	// ASSERT
+	require.Len(t, folders, 3)
+	assert.Equal(t, MailFolder{Name: "INBOX", Path: ""}, folders[0])
+	assert.Equal(t, "&A", folders[1].Name)
+	assert.Error(t, folders[1].Err)
+	assert.Equal(t, MailFolder{Name: "Sent", Path: ".Sent"}, folders[2])
+}
@@ -0,0 +1,363 @@
+package maildir
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// tar(tar.gz)アーカイブを展開せずに参照するfs.FS
+// 最初に全体を一度読んでエントリの一覧を作っておき、一覧やサイズ、日時はそこから返す
+// 内容の読み込みは、非圧縮のtarであれば該当位置から、圧縮されている場合は先頭から該当エントリまで読み進めて行う
+// (圧縮されたアーカイブで、メールの内容を読む集計を行うと時間がかかる)
+type TarFS struct {
+	archivePath string
+	compressed  bool
+	root        *tarEntry
+}
+
+type tarEntry struct {
+	name     string
+	size     int64
+	modTime  time.Time
+	isDir    bool
+	offset   int64  // 非圧縮の場合の、内容の開始位置
+	content  string // 圧縮されている場合に、内容を読むエントリの名前(ハードリンクの場合はリンク先)
+	children map[string]*tarEntry
+}
+
+// gzipのマジックナンバー
+var gzipMagic = []byte{0x1f, 0x8b}
+
+func OpenTarFS(archivePath string) (*TarFS, error) {
+
+	tarFS := &TarFS{
+		archivePath: archivePath,
+		root:        newTarDirEntry("."),
+	}
+
+	file, reader, err := tarFS.openTarReader()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	tarFS.compressed = reader.compressed
+
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s is invalid tar archive: %w", archivePath, err)
+		}
+
+		name, ok := tarEntryName(header.Name)
+		if !ok {
+			continue
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			tarFS.mkdirAll(name).modTime = header.ModTime
+		case tar.TypeReg:
+			offset := int64(0)
+			if !tarFS.compressed {
+				// ヘッダを読んだ直後の位置が内容の開始位置
+				if offset, err = file.Seek(0, io.SeekCurrent); err != nil {
+					return nil, err
+				}
+			}
+
+			dir := tarFS.mkdirAll(path.Dir(name))
+			dir.children[path.Base(name)] = &tarEntry{
+				name:    path.Base(name),
+				size:    header.Size,
+				modTime: header.ModTime,
+				offset:  offset,
+				content: name,
+			}
+		case tar.TypeLink:
+			// ハードリンクは、先に格納されているリンク先の内容とサイズを使う
+			// (cp -al などで作られたバックアップでは、同じメールがハードリンクで格納される)
+			linkName, ok := tarEntryName(header.Linkname)
+			if !ok {
+				continue
+			}
+			target, err := tarFS.lookup("link", linkName)
+			if err != nil || target.isDir {
+				// リンク先が無いものは対象外
+				continue
+			}
+
+			dir := tarFS.mkdirAll(path.Dir(name))
+			dir.children[path.Base(name)] = &tarEntry{
+				name:    path.Base(name),
+				size:    target.size,
+				modTime: header.ModTime,
+				offset:  target.offset,
+				content: target.content,
+			}
+		default:
+			// シンボリックリンクなどは対象外
+		}
+	}
+
+	return tarFS, nil
+}
+
+func (f *TarFS) Open(name string) (fs.File, error) {
+
+	entry, err := f.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry.isDir {
+		return &tarDir{entry: entry}, nil
+	}
+
+	content, err := f.openContent(entry)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &tarFile{entry: entry, ReadCloser: content}, nil
+}
+
+func (f *TarFS) Stat(name string) (fs.FileInfo, error) {
+
+	entry, err := f.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func (f *TarFS) ReadDir(name string) ([]fs.DirEntry, error) {
+
+	entry, err := f.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !entry.isDir {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fmt.Errorf("not a directory")}
+	}
+	return entry.dirEntries(), nil
+}
+
+func (f *TarFS) lookup(op string, name string) (*tarEntry, error) {
+
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	entry := f.root
+	if name == "." {
+		return entry, nil
+	}
+
+	for _, elem := range strings.Split(name, "/") {
+		child, ok := entry.children[elem]
+		if !ok {
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		entry = child
+	}
+
+	return entry, nil
+}
+
+func (f *TarFS) mkdirAll(name string) *tarEntry {
+
+	entry := f.root
+	if name == "." {
+		return entry
+	}
+
+	for _, elem := range strings.Split(name, "/") {
+		child, ok := entry.children[elem]
+		if !ok || !child.isDir {
+			child = newTarDirEntry(elem)
+			entry.children[elem] = child
+		}
+		entry = child
+	}
+
+	return entry
+}
+
+func (f *TarFS) openContent(entry *tarEntry) (io.ReadCloser, error) {
+
+	if !f.compressed {
+		return sectionOpener(f.archivePath, entry.offset, entry.size)()
+	}
+
+	// 圧縮されている場合は、先頭から読み進める
+	file, reader, err := f.openTarReader()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		header, err := reader.Next()
+		if err != nil {
+			file.Close()
+			if err == io.EOF {
+				return nil, fs.ErrNotExist
+			}
+			return nil, err
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if entryName, ok := tarEntryName(header.Name); ok && entryName == entry.content {
+			return &struct {
+				io.Reader
+				io.Closer
+			}{reader, file}, nil
+		}
+	}
+}
+
+type tarReader struct {
+	*tar.Reader
+	compressed bool
+}
+
+func (f *TarFS) openTarReader() (*os.File, *tarReader, error) {
+
+	file, err := os.Open(f.archivePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	magic := make([]byte, len(gzipMagic))
+	n, _ := io.ReadFull(file, magic)
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+
+	if n == len(gzipMagic) && string(magic) == string(gzipMagic) {
+		gzipReader, err := gzip.NewReader(bufio.NewReader(file))
+		if err != nil {
+			file.Close()
+			return nil, nil, fmt.Errorf("%s is invalid tar archive: %w", f.archivePath, err)
+		}
+		return file, &tarReader{Reader: tar.NewReader(gzipReader), compressed: true}, nil
+	}
+
+	// 内容の開始位置をファイルの位置から求めるので、バッファリングせずにそのまま読む
+	return file, &tarReader{Reader: tar.NewReader(file)}, nil
+}
+
+// アーカイブ内の名前を、fs.FSでのパスにする
+// 例: ./home/user1/Maildir/cur/1 -> home/user1/Maildir/cur/1
+func tarEntryName(name string) (string, bool) {
+
+	name = path.Clean("/" + name)[1:]
+	if name == "" {
+		return ".", true
+	}
+	return name, fs.ValidPath(name)
+}
+
+func newTarDirEntry(name string) *tarEntry {
+	return &tarEntry{
+		name:     name,
+		isDir:    true,
+		children: map[string]*tarEntry{},
+	}
+}
+
+// fs.FileInfo
+func (e *tarEntry) Name() string       { return e.name }
+func (e *tarEntry) Size() int64        { return e.size }
+func (e *tarEntry) ModTime() time.Time { return e.modTime }
+func (e *tarEntry) IsDir() bool        { return e.isDir }
+func (e *tarEntry) Sys() any           { return nil }
+func (e *tarEntry) Mode() fs.FileMode {
+	if e.isDir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+// fs.DirEntry
+func (e *tarEntry) Type() fs.FileMode          { return e.Mode().Type() }
+func (e *tarEntry) Info() (fs.FileInfo, error) { return e, nil }
+
+func (e *tarEntry) dirEntries() []fs.DirEntry {
+
+	entries := make([]fs.DirEntry, 0, len(e.children))
+	for _, child := range e.children {
+		entries = append(entries, child)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	return entries
+}
+
+type tarFile struct {
+	io.ReadCloser
+	entry *tarEntry
+}
+
+func (f *tarFile) Stat() (fs.FileInfo, error) {
+	return f.entry, nil
+}
+
+type tarDir struct {
+	entry   *tarEntry
+	entries []fs.DirEntry
+	read    bool
+}
+
+func (d *tarDir) Stat() (fs.FileInfo, error) {
+	return d.entry, nil
+}
+
+func (d *tarDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.entry.name, Err: fmt.Errorf("is a directory")}
+}
+
+func (d *tarDir) Close() error {
+	return nil
+}
+
+func (d *tarDir) ReadDir(count int) ([]fs.DirEntry, error) {
+
+	if !d.read {
+		d.entries = d.entry.dirEntries()
+		d.read = true
+	}
+
+	if count <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+
+	if count > len(d.entries) {
+		count = len(d.entries)
+	}
+	entries := d.entries[:count]
+	d.entries = d.entries[count:]
+	return entries, nil
+}
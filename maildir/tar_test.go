@@ -0,0 +1,249 @@
+package maildir
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenTarFS(t *testing.T) {
+
+	for _, compress := range []bool{false, true} {
+		t.Run(map[bool]string{false: "tar", true: "tar.gz"}[compress], func(t *testing.T) {
+
+			// ARRANGE
+			temp := t.TempDir()
+			archivePath := filepath.Join(temp, "backup.tar")
+			createTarArchive(t, archivePath, compress, []tarTestEntry{
+				{name: "./home/", dir: true},
+				{name: "./home/user1/Maildir/cur/1672531200.M1:2,S", content: "Subject: a\r\n\r\nbody"},
+				{name: "./home/user1/Maildir/new/1675209600.M2", content: "Subject: b\r\n\r\nbody b"},
+				{name: "./home/user1/Maildir/.Sent/cur/1669852800.M3:2,S", content: "Subject: c\r\n\r\nc"},
+				{name: "home/user2/.profile", content: "xxx"},
+			})
+
+			// ACT
+			tarFS, err := OpenTarFS(archivePath)
+
+			// ASSERT
+			require.NoError(t, err)
+
+			// fs.FSとしての振る舞いを確認
+			require.NoError(t, fstest.TestFS(tarFS,
+				"home/user1/Maildir/cur/1672531200.M1:2,S",
+				"home/user1/Maildir/new/1675209600.M2",
+				"home/user1/Maildir/.Sent/cur/1669852800.M3:2,S",
+				"home/user2/.profile"))
+
+			data, err := fs.ReadFile(tarFS, "home/user1/Maildir/new/1675209600.M2")
+			require.NoError(t, err)
+			assert.Equal(t, "Subject: b\r\n\r\nbody b", string(data))
+
+			info, err := fs.Stat(tarFS, "home/user2/.profile")
+			require.NoError(t, err)
+			assert.Equal(t, int64(3), info.Size())
+			assert.Equal(t, time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), info.ModTime().UTC())
+		})
+	}
+}
+
+func TestOpenTarFS_Aggregate(t *testing.T) {
+
+	for _, compress := range []bool{false, true} {
+		t.Run(map[bool]string{false: "tar", true: "tar.gz"}[compress], func(t *testing.T) {
+
+			// ARRANGE
+			temp := t.TempDir()
+			archivePath := filepath.Join(temp, "backup.tar")
+			createTarArchive(t, archivePath, compress, []tarTestEntry{
+				{name: "home/user1/Maildir/cur/1672531200.M1:2,S", content: "From: a@example.com\r\n\r\nbody"},
+				{name: "home/user1/Maildir/new/1675209600.M2", content: "From: b@example.net\r\n\r\nbody b"},
+				{name: "home/user1/Maildir/tmp/1675209600.M9", content: "From: c@example.com\r\n\r\nc"}, // tmpは対象外
+				{name: "home/user1/Maildir/.Sent/cur/1669852800.M3:2,S", content: "From: a@example.com\r\n\r\nsent"},
+			})
+
+			tarFS, err := OpenTarFS(archivePath)
+			require.NoError(t, err)
+
+			folderAggregator := NewFolderAggregator()
+			domainAggregator := NewSenderDomainAggregator()
+
+			// ACT
+			err = AggregateMailStore(
+				NewMaildirFSStore(tarFS, "home/user1/Maildir", "INBOX"),
+				NewMultiAggregator([]Aggregator{folderAggregator, domainAggregator}))
+
+			// ASSERT
+			require.NoError(t, err)
+
+			folderResults := folderAggregator.Results()
+			SortByName(folderResults)
+			assert.Equal(
+				t,
+				[]*AggregateResult{
+					{Name: "INBOX", Count: 2, TotalSize: 56},
+					{Name: "Sent", Count: 1, TotalSize: 27},
+				},
+				folderResults)
+
+			domainResults := domainAggregator.Results()
+			SortByName(domainResults)
+			assert.Equal(
+				t,
+				[]*AggregateResult{
+					{Name: "example.com", Count: 2, TotalSize: 54},
+					{Name: "example.net", Count: 1, TotalSize: 29},
+				},
+				domainResults)
+		})
+	}
+}
+
+func TestOpenTarFS_HardLink(t *testing.T) {
+
+	for _, compress := range []bool{false, true} {
+		t.Run(map[bool]string{false: "tar", true: "tar.gz"}[compress], func(t *testing.T) {
+
+			// ARRANGE
+			temp := t.TempDir()
+			archivePath := filepath.Join(temp, "backup.tar")
+			createTarArchive(t, archivePath, compress, []tarTestEntry{
+				{name: "home/user1/Maildir/cur/1672531200.M1:2,S", content: "From: a@example.com\r\n\r\nbody"},
+				{name: "home/user1/Maildir/new/1675209600.M2", content: "From: b@example.net\r\n\r\nbody b"},
+				{name: "home/user1/Maildir/.Sent/cur/1672531200.M1:2,S", link: "home/user1/Maildir/cur/1672531200.M1:2,S"},
+				{name: "./home/user2/Maildir/cur/1675209600.M2:2,S", link: "./home/user1/Maildir/new/1675209600.M2"},
+				{name: "home/user2/Maildir/cur/1675209600.M3:2,S", link: "home/user2/Maildir/cur/xxx"}, // リンク先が無いものは対象外
+			})
+
+			// ACT
+			tarFS, err := OpenTarFS(archivePath)
+
+			// ASSERT
+			require.NoError(t, err)
+
+			require.NoError(t, fstest.TestFS(tarFS,
+				"home/user1/Maildir/.Sent/cur/1672531200.M1:2,S",
+				"home/user2/Maildir/cur/1675209600.M2:2,S"))
+
+			data, err := fs.ReadFile(tarFS, "home/user2/Maildir/cur/1675209600.M2:2,S")
+			require.NoError(t, err)
+			assert.Equal(t, "From: b@example.net\r\n\r\nbody b", string(data))
+
+			_, err = fs.Stat(tarFS, "home/user2/Maildir/cur/1675209600.M3:2,S")
+			assert.ErrorIs(t, err, fs.ErrNotExist)
+
+			folderAggregator := NewFolderAggregator()
+			domainAggregator := NewSenderDomainAggregator()
+
+			err = AggregateMailStore(
+				NewMaildirFSStore(tarFS, "home/user1/Maildir", "INBOX"),
+				NewMultiAggregator([]Aggregator{folderAggregator, domainAggregator}))
+			require.NoError(t, err)
+
+			folderResults := folderAggregator.Results()
+			SortByName(folderResults)
+			assert.Equal(
+				t,
+				[]*AggregateResult{
+					{Name: "INBOX", Count: 2, TotalSize: 56},
+					{Name: "Sent", Count: 1, TotalSize: 27},
+				},
+				folderResults)
+
+			domainResults := domainAggregator.Results()
+			SortByName(domainResults)
+			assert.Equal(
+				t,
+				[]*AggregateResult{
+					{Name: "example.com", Count: 2, TotalSize: 54},
+					{Name: "example.net", Count: 1, TotalSize: 29},
+				},
+				domainResults)
+		})
+	}
+}
+
+func TestOpenTarFS_NotFound(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	archivePath := filepath.Join(temp, "backup.tar") // 存在しないファイル
+
+	// ACT
+	_, err := OpenTarFS(archivePath)
+
+	// ASSERT
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "open "+archivePath)
+}
+
+func TestOpenTarFS_Invalid(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	archivePath := filepath.Join(temp, "backup.tar")
+	createFile(t, archivePath, "This is not tar archive.")
+
+	// ACT
+	_, err := OpenTarFS(archivePath)
+
+	// ASSERT
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), archivePath+" is invalid tar archive")
+}
+
+type tarTestEntry struct {
+	name    string
+	content string
+	dir     bool
+	link    string // ハードリンクのリンク先
+}
+
+func createTarArchive(t *testing.T, archivePath string, compress bool, entries []tarTestEntry) {
+
+	file, err := os.Create(archivePath)
+	require.NoError(t, err)
+	defer file.Close()
+
+	var writer io.Writer = file
+	if compress {
+		gzipWriter := gzip.NewWriter(file)
+		defer gzipWriter.Close()
+		writer = gzipWriter
+	}
+
+	tarWriter := tar.NewWriter(writer)
+	defer tarWriter.Close()
+
+	modTime := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, entry := range entries {
+		header := &tar.Header{
+			Name:     entry.name,
+			Mode:     0644,
+			Size:     int64(len(entry.content)),
+			ModTime:  modTime,
+			Typeflag: tar.TypeReg,
+		}
+		if entry.dir {
+			header.Mode = 0755
+			header.Typeflag = tar.TypeDir
+		}
+		if entry.link != "" {
+			header.Typeflag = tar.TypeLink
+			header.Linkname = entry.link
+		}
+
+		require.NoError(t, tarWriter.WriteHeader(header))
+		_, err := tarWriter.Write([]byte(entry.content))
+		require.NoError(t, err)
+	}
+}
@@ -12,27 +12,32 @@ type TimeAggregator struct {
 func NewYearAggregator() *TimeAggregator {
 	return &TimeAggregator{
 		resultByTime: map[string]*AggregateResult{},
-		timeToName: func(time time.Time) string {
-			if time.Unix() == 0 {
-				return ""
-			}
-			return time.Format("2006")
-		},
+		timeToName:   yearName,
 	}
 }
 
 func NewMonthAggregator() *TimeAggregator {
 	return &TimeAggregator{
 		resultByTime: map[string]*AggregateResult{},
-		timeToName: func(time time.Time) string {
-			if time.Unix() == 0 {
-				return ""
-			}
-			return time.Format("2006-01")
-		},
+		timeToName:   monthName,
 	}
 }
 
+// 日時が不明なものは空
+func yearName(time time.Time) string {
+	if time.Unix() == 0 {
+		return ""
+	}
+	return time.Format("2006")
+}
+
+func monthName(time time.Time) string {
+	if time.Unix() == 0 {
+		return ""
+	}
+	return time.Format("2006-01")
+}
+
 func (a *TimeAggregator) StartUser(userName string) {
 	// 何もしない
 }
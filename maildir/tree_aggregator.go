@@ -0,0 +1,132 @@
+package maildir
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// メールファイルを ユーザ -> フォルダ -> ディレクトリ(new、cur) -> ファイル のツリーとして集める
+// ファイル数がmaxFilesを超えたディレクトリは、ファイルを個別に保持せず件数とサイズのみにまとめる
+type TreeAggregator struct {
+	maxFiles      int // 0以下の場合は全て個別に保持
+	users         []*TreeUser
+	currentUser   *TreeUser
+	currentFolder *TreeFolder
+}
+
+type TreeUser struct {
+	Name         string
+	Folders      []*TreeFolder
+	folderByName map[string]*TreeFolder
+}
+
+type TreeFolder struct {
+	Name      string
+	Dirs      []*TreeDir
+	dirByName map[string]*TreeDir
+}
+
+// new、curなどのディレクトリ
+// mbox、dboxのように、ディレクトリの区別が無いものは名前が空
+type TreeDir struct {
+	Name       string
+	Files      []*TreeFile // Aggregatedの場合はnil
+	Count      int64
+	TotalSize  int64
+	Aggregated bool
+}
+
+type TreeFile struct {
+	Name  string
+	Count int64 // mboxのように、1つのファイルに複数のメールが含まれる場合は2以上
+	Size  int64
+}
+
+func NewTreeAggregator(maxFiles int) *TreeAggregator {
+	return &TreeAggregator{
+		maxFiles: maxFiles,
+		users:    []*TreeUser{},
+	}
+}
+
+func (a *TreeAggregator) StartUser(userName string) {
+	a.currentUser = &TreeUser{
+		Name:         userName,
+		Folders:      []*TreeFolder{},
+		folderByName: map[string]*TreeFolder{},
+	}
+	a.users = append(a.users, a.currentUser)
+}
+
+func (a *TreeAggregator) StartMailFolder(mailFolderName string) {
+
+	if a.currentUser == nil {
+		// ユーザ単位で集計していない場合
+		a.StartUser("")
+	}
+
+	// Maildirとmboxが混在している場合など、同じ名前のフォルダはまとめる
+	if folder, ok := a.currentUser.folderByName[mailFolderName]; ok {
+		a.currentFolder = folder
+		return
+	}
+
+	a.currentFolder = &TreeFolder{
+		Name:      mailFolderName,
+		Dirs:      []*TreeDir{},
+		dirByName: map[string]*TreeDir{},
+	}
+	a.currentUser.Folders = append(a.currentUser.Folders, a.currentFolder)
+	a.currentUser.folderByName[mailFolderName] = a.currentFolder
+}
+
+func (a *TreeAggregator) Aggregate(mail mailInfo) {
+
+	dirName := filepath.Base(filepath.Dir(mail.path))
+	if dirName != "new" && dirName != "cur" {
+		dirName = ""
+	}
+
+	dir, ok := a.currentFolder.dirByName[dirName]
+	if !ok {
+		dir = &TreeDir{
+			Name:  dirName,
+			Files: []*TreeFile{},
+		}
+		a.currentFolder.Dirs = append(a.currentFolder.Dirs, dir)
+		a.currentFolder.dirByName[dirName] = dir
+	}
+
+	dir.Count++
+	dir.TotalSize += mail.size
+
+	if dir.Aggregated {
+		return
+	}
+
+	fileName := filepath.Base(mail.path)
+	if dirName == "" {
+		// mbox、dboxでは、同じファイル内のメールを区別するための位置(#以降)を除いてファイル単位にする
+		fileName, _, _ = strings.Cut(fileName, "#")
+	}
+
+	// 同じファイルのメールは続けて渡されるので、直前のファイルにまとめる
+	if len(dir.Files) > 0 && dir.Files[len(dir.Files)-1].Name == fileName {
+		file := dir.Files[len(dir.Files)-1]
+		file.Count++
+		file.Size += mail.size
+		return
+	}
+
+	if a.maxFiles > 0 && len(dir.Files) >= a.maxFiles {
+		dir.Files = nil
+		dir.Aggregated = true
+		return
+	}
+
+	dir.Files = append(dir.Files, &TreeFile{Name: fileName, Count: 1, Size: mail.size})
+}
+
+func (a *TreeAggregator) Users() []*TreeUser {
+	return a.users
+}
@@ -0,0 +1,127 @@
+package maildir
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/onozaty/maildir-stats/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregateUsers_TreeAggregator(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	user1 := createDir(t, temp, "user1")
+	{
+		maildir := createDir(t, user1, "Maildir")
+		createMailFolder(t, maildir, []mail{
+			{"new/1675209600", 1},
+			{"cur/1677542400", 2},
+		})
+		sub := createDir(t, maildir, ".A")
+		createMailFolder(t, sub, []mail{
+			{"cur/1672531200", 3},
+			{"cur/1672531201", 4},
+			{"cur/1672531202", 5},
+		})
+	}
+	user2 := createDir(t, temp, "user2")
+	{
+		maildir := createDir(t, user2, "Maildir")
+		createMailFolder(t, maildir, []mail{})
+	}
+
+	users := []user.User{
+		{Name: "user1", HomeDir: user1},
+		{Name: "user2", HomeDir: user2},
+	}
+
+	// ACT
+	aggregator := NewTreeAggregator(2)
+	err := AggregateUsers(users, "Maildir", "INBOX", aggregator)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	assert.Equal(
+		t,
+		[]*TreeUser{
+			{
+				Name: "user1",
+				Folders: []*TreeFolder{
+					{
+						Name: "INBOX",
+						Dirs: []*TreeDir{
+							{Name: "new", Files: []*TreeFile{{Name: "1675209600", Count: 1, Size: 1}}, Count: 1, TotalSize: 1},
+							{Name: "cur", Files: []*TreeFile{{Name: "1677542400", Count: 1, Size: 2}}, Count: 1, TotalSize: 2},
+						},
+					},
+					{
+						Name: "A",
+						Dirs: []*TreeDir{
+							// 最大ファイル数を超えたのでまとめられる
+							{Name: "cur", Files: nil, Count: 3, TotalSize: 12, Aggregated: true},
+						},
+					},
+				},
+			},
+			{
+				Name:    "user2",
+				Folders: []*TreeFolder{{Name: "INBOX", Dirs: []*TreeDir{}}},
+			},
+		},
+		treeUsersWithoutIndex(aggregator.Users()))
+}
+
+func TestAggregateMboxFolders_TreeAggregator(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	createFile(t, filepath.Join(temp, "Sent"), testMboxFromA+testMboxMessageA)
+	createFile(t, filepath.Join(temp, "Trash"), testMboxFromA+testMboxMessageA+"\n"+testMboxFromB+testMboxMessageB)
+
+	aggregator := NewTreeAggregator(0)
+
+	// ACT
+	err := AggregateMailStore(NewMboxDirStore(temp), aggregator)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	users := treeUsersWithoutIndex(aggregator.Users())
+	require.Len(t, users, 1)
+
+	assert.Equal(
+		t,
+		[]*TreeFolder{
+			{
+				Name: "Sent",
+				Dirs: []*TreeDir{
+					{Name: "", Files: []*TreeFile{{Name: "Sent", Count: 1, Size: int64(len(testMboxMessageA))}}, Count: 1, TotalSize: int64(len(testMboxMessageA))},
+				},
+			},
+			{
+				Name: "Trash",
+				Dirs: []*TreeDir{
+					// 1つのファイル内のメールはまとめられる
+					{Name: "", Files: []*TreeFile{{Name: "Trash", Count: 2, Size: int64(len(testMboxMessageA) + len(testMboxMessageB))}}, Count: 2, TotalSize: int64(len(testMboxMessageA) + len(testMboxMessageB))},
+				},
+			},
+		},
+		users[0].Folders)
+}
+
+// 比較用に、検索用のmapを除く
+func treeUsersWithoutIndex(users []*TreeUser) []*TreeUser {
+
+	for _, user := range users {
+		user.folderByName = nil
+		for _, folder := range user.Folders {
+			folder.dirByName = nil
+		}
+	}
+	return users
+}
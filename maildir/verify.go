@@ -0,0 +1,250 @@
+package maildir
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const dovecotUidlistFileName = "dovecot-uidlist"
+
+// フォルダ毎の、ファイルとdovecot-uidlistの突き合わせ結果
+type VerifyResult struct {
+	MailFolderName   string
+	FileCount        int64
+	UidlistFound     bool
+	UidlistCount     int64
+	MissingInUidlist []string // ファイルはあるが、uidlistに無いもの(ファイル名)
+	MissingFiles     []string // uidlistにあるが、ファイルが無いもの(uidlist上のファイル名)
+	SizeMismatches   []*SizeMismatch
+}
+
+// 記録されているサイズと、ファイルのサイズが異なるもの
+type SizeMismatch struct {
+	FileName     string
+	ExpectedSize int64
+	ActualSize   int64
+}
+
+// 不整合があるか
+// uidlistが無い場合は、ファイルがある時のみ不整合とする(一度も開かれていないフォルダにはuidlistが無い)
+func (r *VerifyResult) HasProblem() bool {
+
+	if !r.UidlistFound {
+		return r.FileCount > 0
+	}
+	return len(r.MissingInUidlist) > 0 || len(r.MissingFiles) > 0 || len(r.SizeMismatches) > 0
+}
+
+type uidlistEntry struct {
+	uid      int64
+	fileName string
+	size     int64 // 記録されていない場合は-1
+}
+
+// Maildir++の各フォルダで、ファイルとdovecot-uidlistの内容を突き合わせる
+func VerifyMaildir(rootMailFolderPath string, inboxFolderName string) ([]*VerifyResult, error) {
+
+	store := NewMaildirStore(rootMailFolderPath, inboxFolderName)
+
+	results := []*VerifyResult{}
+	for _, folder := range store.MailFolders() {
+		if folder.Err != nil {
+			return nil, folder.Err
+		}
+
+		result, err := verifyMailFolder(store, folder, filepath.Join(rootMailFolderPath, folder.Path, dovecotUidlistFileName))
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+func verifyMailFolder(store MailStore, folder MailFolder, uidlistPath string) (*VerifyResult, error) {
+
+	result := &VerifyResult{
+		MailFolderName:   folder.Name,
+		MissingInUidlist: []string{},
+		MissingFiles:     []string{},
+		SizeMismatches:   []*SizeMismatch{},
+	}
+
+	// ファイル名のフラグより前の部分(ベース名)で突き合わせる
+	mails := map[string]Mail{}
+	err := store.WalkMails(folder, func(mail Mail) error {
+		mails[mailBaseName(filepath.Base(mail.Path))] = mail
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.FileCount = int64(len(mails))
+
+	entries, err := readDovecotUidlist(uidlistPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return result, nil
+		}
+		return nil, err
+	}
+	result.UidlistFound = true
+	result.UidlistCount = int64(len(entries))
+
+	entryByBaseName := map[string]*uidlistEntry{}
+	for _, entry := range entries {
+		baseName := mailBaseName(entry.fileName)
+		entryByBaseName[baseName] = entry
+
+		if _, ok := mails[baseName]; !ok {
+			result.MissingFiles = append(result.MissingFiles, entry.fileName)
+		}
+	}
+
+	for baseName, mail := range mails {
+		fileName := filepath.Base(mail.Path)
+
+		entry, ok := entryByBaseName[baseName]
+		if !ok {
+			result.MissingInUidlist = append(result.MissingInUidlist, fileName)
+		}
+
+		// uidlistにサイズが無い場合は、ファイル名のサイズ(S=)と比較する
+		expectedSize := fileNameSize(baseName)
+		if ok && entry.size >= 0 {
+			expectedSize = entry.size
+		}
+		if expectedSize >= 0 && expectedSize != mail.Size {
+			result.SizeMismatches = append(result.SizeMismatches, &SizeMismatch{
+				FileName:     fileName,
+				ExpectedSize: expectedSize,
+				ActualSize:   mail.Size,
+			})
+		}
+	}
+
+	sort.Strings(result.MissingInUidlist)
+	sort.Strings(result.MissingFiles)
+	sort.Slice(result.SizeMismatches, func(i, j int) bool {
+		return result.SizeMismatches[i].FileName < result.SizeMismatches[j].FileName
+	})
+
+	return result, nil
+}
+
+// dovecot-uidlistの読み込み
+//
+//	バージョン1: 1行目が "1 <UIDVALIDITY> <NEXTUID>"、以降 "<UID> <ファイル名>"
+//	バージョン3: 1行目が "3 V<UIDVALIDITY> N<NEXTUID> ..."、以降 "<UID> <拡張フィールド>... :<ファイル名>"
+//
+// 拡張フィールドのSがファイルのサイズ
+func readDovecotUidlist(path string) ([]*uidlistEntry, error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%s is invalid uidlist: empty", path)
+	}
+
+	header := strings.Fields(scanner.Text())
+	if len(header) == 0 {
+		return nil, fmt.Errorf("%s is invalid uidlist: invalid header", path)
+	}
+	version := header[0]
+	if version != "1" && version != "2" && version != "3" {
+		return nil, fmt.Errorf("%s is unsupported uidlist version '%s'", path, version)
+	}
+
+	entries := []*uidlistEntry{}
+	for lineNumber := 2; scanner.Scan(); lineNumber++ {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+
+		entry, ok := parseUidlistLine(line, version)
+		if !ok {
+			return nil, fmt.Errorf("%s is invalid uidlist: line %d", path, lineNumber)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func parseUidlistLine(line string, version string) (*uidlistEntry, bool) {
+
+	uidPart, rest, found := strings.Cut(line, " ")
+	if !found {
+		return nil, false
+	}
+	uid, err := strconv.ParseInt(uidPart, 10, 64)
+	if err != nil {
+		return nil, false
+	}
+
+	entry := &uidlistEntry{uid: uid, size: -1}
+
+	if version == "1" {
+		entry.fileName = strings.TrimSpace(rest)
+		return entry, entry.fileName != ""
+	}
+
+	// ファイル名の前に ":" が付く
+	extensions, fileName, found := strings.Cut(rest, ":")
+	if !found || fileName == "" {
+		return nil, false
+	}
+	entry.fileName = fileName
+
+	for _, extension := range strings.Fields(extensions) {
+		if extension[0] == 'S' {
+			if size, err := strconv.ParseInt(extension[1:], 10, 64); err == nil {
+				entry.size = size
+			}
+		}
+	}
+
+	return entry, true
+}
+
+// フラグ(":"以降)を除いたファイル名
+// 例: 1674617693.M958571P8888.localhost,S=545,W=562:2,S -> 1674617693.M958571P8888.localhost,S=545,W=562
+func mailBaseName(fileName string) string {
+	baseName, _, _ := strings.Cut(fileName, ":")
+	return baseName
+}
+
+// ファイル名に含まれるサイズ(S=)
+// 例: 1674617693.M958571P8888.localhost,S=545,W=562 -> 545
+// 含まれない場合は-1
+func fileNameSize(baseName string) int64 {
+
+	for _, field := range strings.Split(baseName, ",")[1:] {
+		if strings.HasPrefix(field, "S=") {
+			if size, err := strconv.ParseInt(field[2:], 10, 64); err == nil {
+				return size
+			}
+		}
+	}
+	return -1
+}
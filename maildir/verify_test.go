@@ -0,0 +1,179 @@
+package maildir
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyMaildir(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	setupTestVerifyMaildir(t, temp)
+
+	// ACT
+	results, err := VerifyMaildir(temp, "INBOX")
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(
+		t,
+		[]*VerifyResult{
+			{
+				MailFolderName:   "INBOX",
+				FileCount:        4,
+				UidlistFound:     true,
+				UidlistCount:     4,
+				MissingInUidlist: []string{"1672531202.M3.host:2,"},
+				MissingFiles:     []string{"1672531209.M9.host,S=3"},
+				SizeMismatches: []*SizeMismatch{
+					// uidlistのサイズ(S)と異なる
+					{FileName: "1672531200.M1.host,S=5:2,S", ExpectedSize: 4, ActualSize: 5},
+					// ファイル名のサイズ(S=)と異なる
+					{FileName: "1672531203.M4.host,S=9", ExpectedSize: 9, ActualSize: 4},
+				},
+			},
+			{
+				MailFolderName:   "Empty",
+				FileCount:        0,
+				UidlistFound:     false,
+				MissingInUidlist: []string{},
+				MissingFiles:     []string{},
+				SizeMismatches:   []*SizeMismatch{},
+			},
+			{
+				MailFolderName:   "Sent",
+				FileCount:        1,
+				UidlistFound:     true,
+				UidlistCount:     1,
+				MissingInUidlist: []string{},
+				MissingFiles:     []string{},
+				SizeMismatches:   []*SizeMismatch{},
+			},
+		},
+		results)
+
+	assert.True(t, results[0].HasProblem())
+	assert.False(t, results[1].HasProblem())
+	assert.False(t, results[2].HasProblem())
+}
+
+func TestVerifyMaildir_UidlistNotFound(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	createMailFolder(t, temp, []mail{})
+	createFile(t, filepath.Join(temp, "cur", "1672531200.M1.host:2,S"), "1")
+
+	// ACT
+	results, err := VerifyMaildir(temp, "")
+
+	// ASSERT
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.False(t, results[0].UidlistFound)
+	assert.Equal(t, int64(1), results[0].FileCount)
+	// ファイルがあるのにuidlistが無いものは不整合
+	assert.True(t, results[0].HasProblem())
+}
+
+func TestVerifyMaildir_InvalidUidlist(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		content string
+		message string
+	}{
+		{"empty", "", "is invalid uidlist: empty"},
+		{"version", "4 V1 N2\n", "is unsupported uidlist version '4'"},
+		{"line", "3 V1 N2\n1 S1 1672531200.M1.host\n", "is invalid uidlist: line 2"},
+		{"uid", "3 V1 N2\nx :1672531200.M1.host\n", "is invalid uidlist: line 2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// ARRANGE
+			temp := t.TempDir()
+			createMailFolder(t, temp, []mail{})
+			uidlistPath := filepath.Join(temp, "dovecot-uidlist")
+			createFile(t, uidlistPath, tt.content)
+
+			// ACT
+			_, err := VerifyMaildir(temp, "")
+
+			// ASSERT
+			require.EqualError(t, err, uidlistPath+" "+tt.message)
+		})
+	}
+}
+
+func TestReadDovecotUidlist_Version1(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	path := filepath.Join(temp, "dovecot-uidlist")
+	createFile(t, path, "1 1275660208 3\n1 1672531200.M1.host:2,S\n2 1672531201.M2.host\n")
+
+	// ACT
+	entries, err := readDovecotUidlist(path)
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(
+		t,
+		[]*uidlistEntry{
+			{uid: 1, fileName: "1672531200.M1.host:2,S", size: -1},
+			{uid: 2, fileName: "1672531201.M2.host", size: -1},
+		},
+		entries)
+}
+
+func TestFileNameSize(t *testing.T) {
+
+	tests := []struct {
+		baseName string
+		expected int64
+	}{
+		{"1674617693.M958571P8888.localhost,S=545,W=562", 545},
+		{"1674617693.M958571P8888.localhost,W=562,S=545", 545},
+		{"1674617693.M958571P8888.localhost", -1},
+		{"1674617693.M958571P8888.localhost,S=xx", -1},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, fileNameSize(tt.baseName))
+	}
+}
+
+func setupTestVerifyMaildir(t *testing.T, rootMailFolderPath string) {
+
+	// INBOX
+	createMailFolder(t, rootMailFolderPath, []mail{})
+	createFile(t, filepath.Join(rootMailFolderPath, "cur", "1672531200.M1.host,S=5:2,S"), "12345")
+	createFile(t, filepath.Join(rootMailFolderPath, "new", "1672531201.M2.host,S=2"), "12")
+	createFile(t, filepath.Join(rootMailFolderPath, "cur", "1672531202.M3.host:2,"), "123")
+	createFile(t, filepath.Join(rootMailFolderPath, "new", "1672531203.M4.host,S=9"), "1234")
+	createFile(t, filepath.Join(rootMailFolderPath, "dovecot-uidlist"),
+		"3 V1672531200 N10 G3085f01b7f11094c501100008c4a11c1\n"+
+			"1 S4 W5 :1672531200.M1.host,S=5:2,S\n"+ // フラグは記録された時点のもの
+			"2 :1672531201.M2.host,S=2\n"+
+			"4 :1672531203.M4.host,S=9\n"+
+			"9 :1672531209.M9.host,S=3\n") // ファイルが無い
+
+	// 一度も開かれていないフォルダ
+	{
+		sub := createDir(t, rootMailFolderPath, ".Empty")
+		createMailFolder(t, sub, []mail{})
+	}
+
+	// 不整合が無いフォルダ
+	{
+		sub := createDir(t, rootMailFolderPath, ".Sent")
+		createMailFolder(t, sub, []mail{})
+		createFile(t, filepath.Join(sub, "cur", "1672531200.M1.host,S=5:2,S"), "12345")
+		createFile(t, filepath.Join(sub, "dovecot-uidlist"), "3 V1672531200 N2\n1 :1672531200.M1.host,S=5:2,RS\n")
+	}
+}